@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fleet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
+)
+
+const kAuditKeyFile = "key-file"
+
+// newAuditCommand returns the command used to verify the hash chain of the audit log files.
+func newAuditCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Audit log tools",
+	}
+	verify := &cobra.Command{
+		Use:   "verify FILE...",
+		Short: "Verify the hash chain of audit log files, given from the oldest to the most recent",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runAuditVerify,
+		// the error is reported by main
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	verify.Flags().String(kAuditKeyFile, "", "File holding the audit key the events were written with, if any")
+	cmd.AddCommand(verify)
+	return cmd
+}
+
+func runAuditVerify(cmd *cobra.Command, args []string) error {
+	var key []byte
+	if keyFile, _ := cmd.Flags().GetString(kAuditKeyFile); keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		key = bytes.TrimRight(data, "\r\n")
+	}
+
+	readers := make([]io.Reader, 0, len(args))
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	seq, hash, err := audit.Verify(io.MultiReader(readers...), key)
+	if err != nil {
+		return fmt.Errorf("audit log verification failed after event %d: %w", seq, err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "audit log verified up to event %d, hash %s\n", seq, hash)
+	return nil
+}
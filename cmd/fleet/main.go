@@ -143,5 +143,6 @@ func NewCommand(bi build.Info) *cobra.Command {
 	cmd.Flags().StringP("config", "c", "fleet-server.yml", "Configuration for Fleet Server")
 	cmd.Flags().Bool(kAgentMode, false, "Running under execution of the Elastic Agent")
 	cmd.Flags().VarP(config.NewFlag(), "E", "E", "Overwrite configuration value")
+	cmd.AddCommand(newAuditCommand())
 	return cmd
 }
@@ -8,10 +8,12 @@ package api
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
@@ -25,6 +27,7 @@ var (
 	ErrAgentCorrupted   = errors.New("agent record corrupted")
 	ErrAgentInactive    = errors.New("agent inactive")
 	ErrAgentIdentity    = errors.New("agent header contains wrong identifier")
+	ErrAuthLockout      = errors.New("too many failed authentication attempts")
 )
 
 // authAPIKey authenticates the provided API key, it checks that the key exists and is enabled.
@@ -52,6 +55,30 @@ func authAPIKey(r *http.Request, bulker bulk.Bulk, c cache.Cache) (*apikey.APIKe
 		span.Context.SetLabel("api_key_cache_hit", false)
 	}
 
+	// Keys and addresses with too many recent failures are rejected without
+	// a round trip to Elasticsearch; as are keys that have just failed.
+	addr := remoteIP(r)
+	if c.AuthLocked(*key, addr) {
+		span.Context.SetLabel("api_key_locked", true)
+		hlog.FromRequest(r).Debug().
+			Str(LogAPIKeyID, key.ID).
+			Str(ECSClientIP, addr).
+			Msg("ApiKey authentication locked out")
+		auditAuthFailure(r, key.ID, "", ErrAuthLockout)
+		return nil, ErrAuthLockout
+	}
+	if c.FailedAPIKey(*key) {
+		span.Context.SetLabel("api_key_fail_cache_hit", true)
+		hlog.FromRequest(r).Debug().
+			Str(LogAPIKeyID, key.ID).
+			Int64(ECSEventDuration, time.Since(start).Nanoseconds()).
+			Bool("fleet.apikey.fail_cache_hit", true).
+			Msg("ApiKey fail authentication")
+		err := fmt.Errorf("%w: %w", apikey.ErrUnauthorized, apikey.ErrCredentialsRejected)
+		auditAuthFailure(r, key.ID, "", err)
+		return nil, err
+	}
+
 	info, err := bulker.APIKeyAuth(ctx, *key)
 
 	if err != nil {
@@ -60,7 +87,21 @@ func authAPIKey(r *http.Request, bulker bulk.Bulk, c cache.Cache) (*apikey.APIKe
 			Str(LogAPIKeyID, key.ID).
 			Int64(ECSEventDuration, time.Since(start).Nanoseconds()).
 			Msg("ApiKey fail authentication")
-		return nil, fmt.Errorf("%w: %w", apikey.ErrUnauthorized, err)
+
+		// Only remember failures where Elasticsearch rejected the key, so an
+		// Elasticsearch outage does not lock out valid agents.
+		if errors.Is(err, apikey.ErrCredentialsRejected) {
+			c.SetAPIKeyFailure(*key)
+			if c.AuthFailure(*key, addr) {
+				hlog.FromRequest(r).Warn().
+					Str(LogAPIKeyID, key.ID).
+					Str(ECSClientIP, addr).
+					Msg("ApiKey authentication locked out after repeated failures")
+			}
+		}
+		err = fmt.Errorf("%w: %w", apikey.ErrUnauthorized, err)
+		auditAuthFailure(r, key.ID, "", err)
+		return nil, err
 	}
 
 	hlog.FromRequest(r).Debug().
@@ -81,6 +122,7 @@ func authAPIKey(r *http.Request, bulker bulk.Bulk, c cache.Cache) (*apikey.APIKe
 			Str("id", key.ID).
 			Int64(ECSEventDuration, time.Since(start).Nanoseconds()).
 			Msg("ApiKey not enabled")
+		auditAuthFailure(r, key.ID, "", err)
 	}
 
 	return key, err
@@ -114,7 +156,7 @@ func authAgent(r *http.Request, id *string, bulker bulk.Bulk, c cache.Cache) (*m
 			Msg("authApiKey slow")
 	}
 
-	agent, err := findAgentByAPIKeyID(r.Context(), bulker, key.ID)
+	agent, err := findAgentByAPIKeyID(r.Context(), bulker, c, key.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +170,7 @@ func authAgent(r *http.Request, id *string, bulker bulk.Bulk, c cache.Cache) (*m
 		zlog.Warn().
 			Err(ErrAgentCorrupted).
 			Msg("agent record does not contain required metadata section")
+		auditAuthFailure(r, key.ID, agent.Id, ErrAgentCorrupted)
 		return nil, ErrAgentCorrupted
 	}
 
@@ -146,15 +189,28 @@ func authAgent(r *http.Request, id *string, bulker bulk.Bulk, c cache.Cache) (*m
 			Err(ErrAgentCorrupted).
 			Str("agent.AccessApiKeyId", agent.AccessAPIKeyID).
 			Msg("agent access ApiKey id mismatch agent record")
+		auditAuthFailure(r, key.ID, agent.Id, ErrAgentCorrupted)
 		return nil, ErrAgentCorrupted
 	}
 
+	// validate that the client certificate is the one the agent enrolled with, so that the
+	// access ApiKey alone does not authenticate the agent
+	if err := verifyAgentCert(r, bulker, agent); err != nil {
+		zlog.Warn().
+			Err(err).
+			Str("agent.Id", agent.Id).
+			Msg("agent client certificate rejected")
+		auditAuthFailure(r, key.ID, agent.Id, err)
+		return nil, err
+	}
+
 	// validate that the id in the header is equal to the agent id record
 	if id != nil && *id != agent.Id {
 		zlog.Warn().
 			Err(ErrAgentIdentity).
 			Str("agent.Id", agent.Id).
 			Msg("agent id mismatch against http header")
+		auditAuthFailure(r, key.ID, agent.Id, ErrAgentIdentity)
 		return nil, ErrAgentIdentity
 	}
 
@@ -167,8 +223,28 @@ func authAgent(r *http.Request, id *string, bulker bulk.Bulk, c cache.Cache) (*m
 
 		// Update the cache to mark the api key id associated with this agent as not enabled
 		c.SetAPIKey(*key, false)
+		auditAuthFailure(r, key.ID, agent.Id, ErrAgentInactive)
 		return nil, ErrAgentInactive
 	}
 
 	return agent, nil
 }
+
+// auditAuthFailure writes the failed authentication of the API key to the audit log.
+func auditAuthFailure(r *http.Request, keyID, agentID string, err error) {
+	audit.Log(r.Context(), audit.Event{
+		Action:    audit.ActionAuthenticate,
+		Message:   "Authentication failed",
+		AgentID:   agentID,
+		APIKeyIDs: []string{keyID},
+	}.WithErr(err))
+}
+
+// remoteIP returns the IP address of the request's source.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,190 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+var (
+	ErrClientCertRequired = errors.New("valid client certificate required")
+	ErrClientCertMismatch = errors.New("client certificate does not match the agent")
+)
+
+// certVerifier verifies the client certificates of the agents, see config.AgentCertAuth.
+type certVerifier struct {
+	roots    *x509.CertPool
+	identity string
+
+	transition      bool      // bind the identity of the agents enrolled without certificate
+	transitionUntil time.Time // end of the transition, no end if zero
+}
+
+func newCertVerifier(cfg *config.AgentCertAuth) (*certVerifier, error) {
+	roots, errs := tlscommon.LoadCertificateAuthorities(cfg.CertificateAuthorities)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("unable to load agent certificate authorities: %w", errors.Join(errs...))
+	}
+	return &certVerifier{
+		roots:           roots,
+		identity:        cfg.Identity,
+		transition:      cfg.Transition.Enabled,
+		transitionUntil: cfg.Transition.Deadline(),
+	}, nil
+}
+
+// bindsUnbound returns true if the identity of the agents enrolled without certificate is bound
+// on their first request with a valid certificate.
+func (v *certVerifier) bindsUnbound(now time.Time) bool {
+	return v.transition && (v.transitionUntil.IsZero() || now.Before(v.transitionUntil))
+}
+
+// verify verifies the client certificate of r and returns its identity.
+func (v *certVerifier) verify(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", fmt.Errorf("%w: no certificate", ErrClientCertRequired)
+	}
+	cert := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrClientCertRequired, err)
+	}
+
+	var identity string
+	switch v.identity {
+	case config.CertIdentityDNSName:
+		if len(cert.DNSNames) > 0 {
+			identity = cert.DNSNames[0]
+		}
+	case config.CertIdentityURI:
+		if len(cert.URIs) > 0 {
+			identity = cert.URIs[0].String()
+		}
+	default:
+		identity = cert.Subject.CommonName
+	}
+	if identity == "" {
+		return "", fmt.Errorf("%w: no %s", ErrClientCertRequired, v.identity)
+	}
+	return identity, nil
+}
+
+type certVerifierKey struct{}
+
+// withCertVerifier returns a context requiring the agents to authenticate with a client
+// certificate verified by v.
+func withCertVerifier(ctx context.Context, v *certVerifier) context.Context {
+	return context.WithValue(ctx, certVerifierKey{}, v)
+}
+
+// clientCertIdentity returns the identity of the client certificate of r, or an empty identity if
+// the server does not require client certificates.
+func clientCertIdentity(r *http.Request) (string, error) {
+	v, ok := r.Context().Value(certVerifierKey{}).(*certVerifier)
+	if !ok {
+		return "", nil
+	}
+	return v.verify(r)
+}
+
+// verifyAgentCert ensures that the request is made with the client certificate bound to the agent
+// when the server requires client certificates. The identity of the certificate is bound to an agent
+// enrolled without certificate while the transition of the server allows it.
+func verifyAgentCert(r *http.Request, bulker bulk.Bulk, agent *model.Agent) error {
+	v, ok := r.Context().Value(certVerifierKey{}).(*certVerifier)
+	if !ok {
+		return nil
+	}
+	identity, err := v.verify(r)
+	if err != nil {
+		return err
+	}
+	if agent.ClientCertificateIdentity == "" {
+		if !v.bindsUnbound(time.Now()) {
+			// agents enrolled without certificate have to enroll again
+			return fmt.Errorf("%w: agent enrolled without certificate", ErrClientCertMismatch)
+		}
+		return bindAgentCert(r, bulker, agent, identity)
+	}
+	if identity != agent.ClientCertificateIdentity {
+		return ErrClientCertMismatch
+	}
+	return nil
+}
+
+// bindAgentCert binds the certificate identity to the agent, its later requests have to be made
+// with a certificate of the same identity.
+func bindAgentCert(r *http.Request, bulker bulk.Bulk, agent *model.Agent, identity string) error {
+	body, err := bulk.UpdateFields{
+		dl.FieldClientCertificateIdentity: identity,
+		dl.FieldUpdatedAt:                 time.Now().UTC().Format(time.RFC3339),
+	}.Marshal()
+	if err != nil {
+		return fmt.Errorf("bind client certificate marshal: %w", err)
+	}
+	if err := bulker.Update(r.Context(), dl.FleetAgents, agent.Id, body, bulk.WithRefresh(), bulk.WithRetryOnConflict(3)); err != nil {
+		return fmt.Errorf("bind client certificate update: %w", err)
+	}
+	agent.ClientCertificateIdentity = identity
+
+	hlog.FromRequest(r).Info().Str(LogAgentID, agent.Id).Str("identity", identity).Msg("client certificate bound to agent enrolled without certificate")
+	audit.Log(r.Context(), audit.Event{
+		Action:    audit.ActionAuthenticate,
+		Message:   "Client certificate bound to the agent",
+		AgentID:   agent.Id,
+		APIKeyIDs: []string{agent.AccessAPIKeyID},
+	})
+	return nil
+}
+
+// requestClientCert returns a TLS configuration requesting a client certificate on the handshake,
+// when cfg does not. The certificate is verified by the routes that require it, so that the
+// status of the server remains available to clients without certificate.
+func requestClientCert(cfg *tls.Config) *tls.Config {
+	getConfig := cfg.GetConfigForClient
+	cfg = withRequestClientCert(cfg)
+	if getConfig != nil {
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := getConfig(hello)
+			if err != nil || c == nil {
+				return c, err
+			}
+			return withRequestClientCert(c), nil
+		}
+	}
+	return cfg
+}
+
+func withRequestClientCert(cfg *tls.Config) *tls.Config {
+	cfg = cfg.Clone()
+	if cfg.ClientAuth == tls.NoClientCert {
+		cfg.ClientAuth = tls.RequestClientCert
+		// the verification of the ssl settings does not apply to the agent certificates
+		cfg.VerifyConnection = nil
+	}
+	return cfg
+}
@@ -0,0 +1,248 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "agents CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+}
+
+// issue returns a client certificate for the common name cn and the SPIFFE ID uri.
+func (ca *testCA) issue(t *testing.T, cn, uri string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func requestWithCert(v *certVerifier, cert *tls.Certificate) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/fleet/agents/agent-id/checkin", nil)
+	if cert != nil {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Leaf}}
+	}
+	if v != nil {
+		r = r.WithContext(withCertVerifier(r.Context(), v))
+	}
+	return r
+}
+
+func TestCertVerifier(t *testing.T) {
+	ca := newTestCA(t)
+	other := newTestCA(t)
+	agentCert := ca.issue(t, "agent-1", "spiffe://example.org/agent/1")
+	untrusted := other.issue(t, "agent-1", "spiffe://example.org/agent/1")
+	noURI := ca.issue(t, "agent-2", "")
+
+	newVerifier := func(identity string) *certVerifier {
+		v, err := newCertVerifier(&config.AgentCertAuth{Enabled: true, CertificateAuthorities: []string{ca.pem()}, Identity: identity})
+		require.NoError(t, err)
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		identity string
+		cert     *tls.Certificate
+		expect   string
+		err      error
+	}{
+		{"common name", config.CertIdentityCommonName, &agentCert, "agent-1", nil},
+		{"spiffe id", config.CertIdentityURI, &agentCert, "spiffe://example.org/agent/1", nil},
+		{"missing uri", config.CertIdentityURI, &noURI, "", ErrClientCertRequired},
+		{"untrusted ca", config.CertIdentityCommonName, &untrusted, "", ErrClientCertRequired},
+		{"no certificate", config.CertIdentityCommonName, nil, "", ErrClientCertRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := clientCertIdentity(requestWithCert(newVerifier(tt.identity), tt.cert))
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, identity)
+		})
+	}
+
+	t.Run("not required", func(t *testing.T) {
+		identity, err := clientCertIdentity(requestWithCert(nil, nil))
+		require.NoError(t, err)
+		assert.Empty(t, identity)
+	})
+}
+
+func TestVerifyAgentCert(t *testing.T) {
+	ca := newTestCA(t)
+	v, err := newCertVerifier(&config.AgentCertAuth{Enabled: true, CertificateAuthorities: []string{ca.pem()}, Identity: config.CertIdentityCommonName})
+	require.NoError(t, err)
+	agentCert := ca.issue(t, "agent-1", "")
+	otherCert := ca.issue(t, "agent-2", "")
+
+	bulker := ftesting.NewMockBulk()
+	bound := &model.Agent{ClientCertificateIdentity: "agent-1"}
+	assert.NoError(t, verifyAgentCert(requestWithCert(v, &agentCert), bulker, bound))
+	assert.ErrorIs(t, verifyAgentCert(requestWithCert(v, &otherCert), bulker, bound), ErrClientCertMismatch, "the api key of another agent")
+	assert.ErrorIs(t, verifyAgentCert(requestWithCert(v, nil), bulker, bound), ErrClientCertRequired)
+	assert.ErrorIs(t, verifyAgentCert(requestWithCert(v, &agentCert), bulker, &model.Agent{}), ErrClientCertMismatch, "agent enrolled without certificate")
+	assert.NoError(t, verifyAgentCert(requestWithCert(nil, nil), bulker, bound), "certificates not required")
+	bulker.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestVerifyAgentCertTransition(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := &config.AgentCertAuth{Enabled: true, CertificateAuthorities: []string{ca.pem()}, Identity: config.CertIdentityCommonName}
+	agentCert := ca.issue(t, "agent-1", "")
+	otherCert := ca.issue(t, "agent-2", "")
+
+	t.Run("binds on first use", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Transition = config.AgentCertTransition{Enabled: true, Until: time.Now().Add(time.Hour).Format(time.RFC3339)}
+		v, err := newCertVerifier(&cfg)
+		require.NoError(t, err)
+
+		bulker := ftesting.NewMockBulk()
+		bulker.On("Update", mock.Anything, dl.FleetAgents, "agent-id", mock.Anything, mock.Anything).Return(nil).Once()
+		agent := &model.Agent{ESDocument: model.ESDocument{Id: "agent-id"}}
+		require.NoError(t, verifyAgentCert(requestWithCert(v, &agentCert), bulker, agent))
+		assert.Equal(t, "agent-1", agent.ClientCertificateIdentity)
+		bulker.AssertExpectations(t)
+
+		// the identity is bound once
+		assert.ErrorIs(t, verifyAgentCert(requestWithCert(v, &otherCert), bulker, agent), ErrClientCertMismatch)
+		assert.ErrorIs(t, verifyAgentCert(requestWithCert(v, nil), bulker, &model.Agent{}), ErrClientCertRequired, "a valid certificate is required to bind")
+	})
+
+	t.Run("ended", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Transition = config.AgentCertTransition{Enabled: true, Until: time.Now().Add(-time.Hour).Format(time.RFC3339)}
+		v, err := newCertVerifier(&cfg)
+		require.NoError(t, err)
+
+		bulker := ftesting.NewMockBulk()
+		assert.ErrorIs(t, verifyAgentCert(requestWithCert(v, &agentCert), bulker, &model.Agent{}), ErrClientCertMismatch)
+		bulker.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestRequestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "fleet-server")
+	enabled := true
+	reloader, err := NewTLSReloader(&tlscommon.ServerConfig{
+		Enabled: &enabled,
+		Certificate: tlscommon.CertificateConfig{
+			Certificate: filepath.Join(dir, "server.crt"),
+			Key:         filepath.Join(dir, "server.key"),
+		},
+	}, "localhost")
+	require.NoError(t, err)
+
+	ca := newTestCA(t)
+	v, err := newCertVerifier(&config.AgentCertAuth{Enabled: true, CertificateAuthorities: []string{ca.pem()}, Identity: config.CertIdentityCommonName})
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := clientCertIdentity(r.WithContext(withCertVerifier(r.Context(), v)))
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(identity))
+	}))
+	srv.TLS = requestClientCert(reloader.ServerConfig())
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(certs ...tls.Certificate) (int, string) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // self-signed test server
+			Certificates:       certs,
+		}}}
+		resp, err := client.Get(srv.URL) //nolint:noctx // test request
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get(ca.issue(t, "agent-1", ""))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "agent-1", body)
+
+	code, _ = get()
+	assert.Equal(t, http.StatusUnauthorized, code, "clients without certificate complete the handshake")
+}
@@ -0,0 +1,75 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// kDrainRetryAfter is the longest retry hint sent with the checkins answered early while draining;
+// hints are spread from one second up to it so that agents do not reconnect all at once.
+const kDrainRetryAfter = 5 * time.Second
+
+type drainKey struct{}
+
+// drainSignals are the channels closed as the server shuts down. stopping is closed first, when the
+// server starts reporting itself as stopping, draining is closed once it stops accepting connections.
+type drainSignals struct {
+	stopping <-chan struct{}
+	draining <-chan struct{}
+}
+
+// withDrain returns a context carrying the channels closed when the server starts stopping and draining.
+func withDrain(ctx context.Context, stopping, draining <-chan struct{}) context.Context {
+	return context.WithValue(ctx, drainKey{}, drainSignals{stopping: stopping, draining: draining})
+}
+
+// draining returns the channel closed when the server serving the request of ctx starts draining.
+// The channel is nil, and never ready, if the request is not served by a server.
+func draining(ctx context.Context) <-chan struct{} {
+	sig, _ := ctx.Value(drainKey{}).(drainSignals)
+	return sig.draining
+}
+
+// isDraining returns true if the server serving the request of ctx is draining.
+func isDraining(ctx context.Context) bool {
+	return isClosed(draining(ctx))
+}
+
+// isStopping returns true if the server serving the request of ctx is shutting down, including
+// the pre-drain delay during which it still accepts connections.
+func isStopping(ctx context.Context) bool {
+	sig, _ := ctx.Value(drainKey{}).(drainSignals)
+	return isClosed(sig.stopping)
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// setDrainRetryAfter hints the client of a request answered early while draining when to retry.
+func setDrainRetryAfter(w http.ResponseWriter) {
+	seconds := 1 + rand.Int63n(int64(kDrainRetryAfter/time.Second)) //nolint:gosec // jitter does not need crypto/rand
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// valuesContext carries the values of a context without its cancellation, it lets the requests in
+// flight complete when the server context is cancelled.
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesContext) Done() <-chan struct{}       { return nil }
+func (valuesContext) Err() error                  { return nil }
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,8 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
 	"github.com/elastic/fleet-server/v7/internal/pkg/uploader"
 
 	"github.com/rs/zerolog"
@@ -29,6 +32,7 @@ const (
 	ECSEventDuration         = logger.ECSEventDuration
 	ECSHTTPResponseCode      = logger.ECSHTTPResponseCode
 	ECSHTTPResponseBodyBytes = logger.ECSHTTPResponseBodyBytes
+	ECSClientIP              = logger.ECSClientIP
 
 	LogAPIKeyID       = logger.APIKeyID
 	LogPolicyID       = logger.PolicyID
@@ -105,6 +109,51 @@ func NewHTTPErrResp(err error) HTTPErrResp {
 				zerolog.WarnLevel,
 			},
 		},
+		{
+			scheduler.ErrScheduleNotFound,
+			HTTPErrResp{
+				http.StatusNotFound,
+				"ScheduleNotFound",
+				"schedule could not be found",
+				zerolog.InfoLevel,
+			},
+		},
+		{
+			policy.ErrRolloutNotHalted,
+			HTTPErrResp{
+				http.StatusConflict,
+				"RolloutNotHalted",
+				"policy rollout is not halted",
+				zerolog.InfoLevel,
+			},
+		},
+		{
+			ErrInvalidPolicyPin,
+			HTTPErrResp{
+				http.StatusBadRequest,
+				"InvalidPolicyPin",
+				"",
+				zerolog.InfoLevel,
+			},
+		},
+		{
+			logger.ErrInvalidTarget,
+			HTTPErrResp{
+				http.StatusBadRequest,
+				"InvalidLogTarget",
+				"",
+				zerolog.InfoLevel,
+			},
+		},
+		{
+			logger.ErrTargetNotFound,
+			HTTPErrResp{
+				http.StatusNotFound,
+				"LogTargetNotFound",
+				"log target could not be found",
+				zerolog.InfoLevel,
+			},
+		},
 		{
 			ErrorThrottle,
 			HTTPErrResp{
@@ -114,6 +163,33 @@ func NewHTTPErrResp(err error) HTTPErrResp {
 				zerolog.DebugLevel,
 			},
 		},
+		{
+			ErrClientCertRequired,
+			HTTPErrResp{
+				http.StatusUnauthorized,
+				"ClientCertificateRequired",
+				"valid client certificate required",
+				zerolog.InfoLevel,
+			},
+		},
+		{
+			ErrClientCertMismatch,
+			HTTPErrResp{
+				http.StatusForbidden,
+				"ClientCertificateMismatch",
+				"client certificate does not match the agent",
+				zerolog.WarnLevel,
+			},
+		},
+		{
+			ErrAuthLockout,
+			HTTPErrResp{
+				http.StatusTooManyRequests,
+				"AuthLockout",
+				"too many failed authentication attempts",
+				zerolog.InfoLevel,
+			},
+		},
 		{
 			limit.ErrRateLimit,
 			HTTPErrResp{
@@ -447,6 +523,26 @@ func (er HTTPErrResp) Write(w http.ResponseWriter) error {
 	return err
 }
 
+// retryAfterResp is an HTTPErrResp with the number of seconds after which the request may be retried.
+type retryAfterResp struct {
+	HTTPErrResp
+	RetryAfter int `json:"retryAfter"`
+}
+
+// Write will serialize the response with the Retry-After header.
+func (er retryAfterResp) Write(w http.ResponseWriter) error {
+	data, err := json.Marshal(&er)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Retry-After", strconv.Itoa(er.RetryAfter))
+	w.WriteHeader(er.StatusCode)
+	_, err = w.Write(data)
+	return err
+}
+
 func ErrorResp(w http.ResponseWriter, r *http.Request, err error) {
 	zlog := hlog.FromRequest(r)
 	resp := NewHTTPErrResp(err)
@@ -454,8 +550,19 @@ func ErrorResp(w http.ResponseWriter, r *http.Request, err error) {
 	if ts, ok := logger.CtxStartTime(r.Context()); ok {
 		e = e.Int64(ECSEventDuration, time.Since(ts).Nanoseconds())
 	}
+	after, retry := limit.RetryAfter(err)
+	if retry {
+		e = e.Int("retry_after", after)
+	}
 	e.Msg("HTTP request error")
-	if rerr := resp.Write(w); rerr != nil {
+
+	var rerr error
+	if retry {
+		rerr = retryAfterResp{HTTPErrResp: resp, RetryAfter: after}.Write(w)
+	} else {
+		rerr = resp.Write(w)
+	}
+	if rerr != nil {
 		zlog.Error().Err(rerr).Msg("fail writing error response")
 	}
 }
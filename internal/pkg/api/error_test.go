@@ -0,0 +1,53 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+)
+
+func TestErrorRespRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		retryAfter string
+	}{{
+		name: "no retry hint",
+		err:  limit.ErrRateLimit,
+	}, {
+		name:       "retry hint",
+		err:        &limit.RetryAfterError{Err: limit.ErrMaxLimit, After: 2500 * time.Millisecond},
+		retryAfter: "3",
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ErrorResp(w, httptest.NewRequest(http.MethodGet, "/api/status", nil), tc.err)
+
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.Equal(t, tc.retryAfter, w.Header().Get("Retry-After"))
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, float64(http.StatusTooManyRequests), body["statusCode"])
+			if tc.retryAfter == "" {
+				assert.NotContains(t, body, "retryAfter")
+			} else {
+				assert.Equal(t, float64(3), body["retryAfter"])
+			}
+		})
+	}
+}
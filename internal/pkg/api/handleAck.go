@@ -14,10 +14,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
@@ -77,17 +79,25 @@ func (a *AckResponse) SetError(pos int, err error) {
 }
 
 type AckT struct {
-	cfg   *config.Server
+	cfg   atomic.Pointer[config.Server]
 	bulk  bulk.Bulk
 	cache cache.Cache
+	pm    policy.Monitor
 }
 
-func NewAckT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache) *AckT {
-	return &AckT{
-		cfg:   cfg,
+func NewAckT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, pm policy.Monitor) *AckT {
+	ack := &AckT{
 		bulk:  bulker,
 		cache: cache,
+		pm:    pm,
 	}
+	ack.cfg.Store(cfg)
+	return ack
+}
+
+// Reconfigure applies the limits of cfg to the following acks.
+func (ack *AckT) Reconfigure(cfg *config.Server) {
+	ack.cfg.Store(cfg)
 }
 
 func (ack *AckT) handleAcks(zlog zerolog.Logger, w http.ResponseWriter, r *http.Request, id string) error {
@@ -106,8 +116,8 @@ func (ack *AckT) processRequest(zlog zerolog.Logger, w http.ResponseWriter, r *h
 	body := r.Body
 
 	// Limit the size of the body to prevent malicious agent from exhausting RAM in server
-	if ack.cfg.Limits.AckLimit.MaxBody > 0 {
-		body = http.MaxBytesReader(w, body, ack.cfg.Limits.AckLimit.MaxBody)
+	if maxBody := listenerLimits(r.Context(), &ack.cfg.Load().Limits).AckLimit.MaxBody; maxBody > 0 {
+		body = http.MaxBytesReader(w, body, maxBody)
 	}
 
 	raw, err := io.ReadAll(body)
@@ -227,6 +237,9 @@ func (ack *AckT) handleAckEvents(ctx context.Context, zlog zerolog.Logger, agent
 				// only added if no error on action
 				policyAcks = append(policyAcks, ev.ActionId)
 				policyIdxs = append(policyIdxs, n)
+			} else if rev, ok := policy.RevisionFromString(ev.ActionId); ok && ack.pm != nil {
+				zlog.Warn().Str("actionId", ev.ActionId).Str("error", *ev.Error).Msg("policy change failed")
+				ack.pm.ReportFailure(agent.Id, rev.PolicyID, rev.RevisionIdx, rev.CoordinatorIdx)
 			}
 			// Set OK status, this can be overwritten in case of the errors later when the policy change events acked
 			setResult(n, http.StatusOK)
@@ -277,7 +290,15 @@ func (ack *AckT) handleAckEvents(ctx context.Context, zlog zerolog.Logger, agent
 
 	// Process unenroll acks
 	if len(unenrollIdxs) > 0 {
-		if err := ack.handleUnenroll(ctx, zlog, agent); err != nil {
+		err := ack.handleUnenroll(ctx, zlog, agent)
+		audit.Log(ctx, audit.Event{
+			Action:    audit.ActionAgentUnenroll,
+			Message:   "Agent unenrolled",
+			AgentID:   agent.Id,
+			PolicyID:  agent.PolicyID,
+			APIKeyIDs: agent.APIKeyIDs(),
+		}.WithErr(err))
+		if err != nil {
 			zlog.Error().Err(err).Msg("handle unenroll event")
 			// Set errors for each unenroll event
 			for _, idx := range unenrollIdxs {
@@ -363,6 +384,24 @@ func (ack *AckT) handlePolicyChange(ctx context.Context, zlog zerolog.Logger, ag
 		}
 	}
 
+	// A pinned revision is accepted even if it is older than the current one, in order to roll back
+	if ack.pm != nil {
+		if pinned, ok := ack.pm.PinnedRevision(agent.PolicyID, agent.PolicyPinnedRevisionIdx); ok &&
+			(pinned.RevisionIdx != agent.PolicyRevisionIdx || pinned.CoordinatorIdx != agent.PolicyCoordinatorIdx) {
+			for _, a := range actionIds {
+				if rev, ok := policy.RevisionFromString(a); ok && rev == pinned {
+					zlog.Info().
+						Int64("rev.revisionIdx", rev.RevisionIdx).
+						Int64("rev.coordinatorIdx", rev.CoordinatorIdx).
+						Msg("ack pinned policy revision")
+					found = true
+					currRev = rev.RevisionIdx
+					currCoord = rev.CoordinatorIdx
+				}
+			}
+		}
+	}
+
 	if !found {
 		return nil
 	}
@@ -437,7 +476,7 @@ func (ack *AckT) updateAPIKey(ctx context.Context,
 				}
 			}
 		}
-		ack.invalidateAPIKeys(ctx, zlog, toRetireAPIKeyIDs, apiKeyID)
+		ack.invalidateAPIKeys(ctx, zlog, agentID, toRetireAPIKeyIDs, apiKeyID)
 	}
 
 	return nil
@@ -504,7 +543,7 @@ func cleanRoles(roles json.RawMessage) (json.RawMessage, int, error) {
 	return r, len(keys), nil
 }
 
-func (ack *AckT) invalidateAPIKeys(ctx context.Context, zlog zerolog.Logger, toRetireAPIKeyIDs []model.ToRetireAPIKeyIdsItems, skip string) {
+func (ack *AckT) invalidateAPIKeys(ctx context.Context, zlog zerolog.Logger, agentID string, toRetireAPIKeyIDs []model.ToRetireAPIKeyIdsItems, skip string) {
 	ids := make([]string, 0, len(toRetireAPIKeyIDs))
 	for _, k := range toRetireAPIKeyIDs {
 		if k.ID == skip || k.ID == "" {
@@ -515,7 +554,14 @@ func (ack *AckT) invalidateAPIKeys(ctx context.Context, zlog zerolog.Logger, toR
 
 	if len(ids) > 0 {
 		zlog.Info().Strs("fleet.policy.apiKeyIDsToRetire", ids).Msg("Invalidate old API keys")
-		if err := ack.bulk.APIKeyInvalidate(ctx, ids...); err != nil {
+		err := ack.bulk.APIKeyInvalidate(ctx, ids...)
+		audit.Log(ctx, audit.Event{
+			Action:    audit.ActionAPIKeyInvalidate,
+			Message:   "Retired output API keys invalidated",
+			AgentID:   agentID,
+			APIKeyIDs: ids,
+		}.WithErr(err))
+		if err != nil {
 			zlog.Info().Err(err).Strs("ids", ids).Msg("Failed to invalidate API keys")
 		}
 	}
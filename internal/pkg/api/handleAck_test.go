@@ -484,7 +484,7 @@ func TestHandleAckEvents(t *testing.T) {
 			}
 
 			bulker := tc.bulker(t)
-			ack := NewAckT(cfg, bulker, cache)
+			ack := NewAckT(cfg, bulker, cache, nil)
 
 			res, err := ack.handleAckEvents(ctx, logger, agent, tc.events)
 			assert.Equal(t, tc.res, res)
@@ -555,7 +555,7 @@ func TestInvalidateAPIKeys(t *testing.T) {
 
 		logger := testlog.SetLogger(t)
 		ack := &AckT{bulk: bulker}
-		ack.invalidateAPIKeys(context.Background(), logger, out.ToRetireAPIKeyIds, skip)
+		ack.invalidateAPIKeys(context.Background(), logger, "agent-id", out.ToRetireAPIKeyIds, skip)
 
 		bulker.AssertExpectations(t)
 	}
@@ -633,7 +633,7 @@ func TestAckHandleUpgrade(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			logger := testlog.SetLogger(t)
 			bulker := tc.bulker(t)
-			ack := NewAckT(cfg, bulker, cache)
+			ack := NewAckT(cfg, bulker, cache, nil)
 
 			err := ack.handleUpgrade(ctx, logger, agent, tc.event)
 			assert.NoError(t, err)
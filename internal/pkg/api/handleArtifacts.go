@@ -17,6 +17,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
@@ -95,6 +96,12 @@ func (at ArtifactT) processRequest(ctx context.Context, zlog zerolog.Logger, age
 	// Determine whether the agent should have access to this artifact
 	if err := at.authorizeArtifact(ctx, agent, id, sha2); err != nil {
 		zlog.Warn().Err(err).Msg("Unauthorized GET on artifact")
+		audit.Log(ctx, audit.Event{
+			Action:   audit.ActionArtifactAuthorize,
+			Message:  "Unauthorized artifact request",
+			AgentID:  agent.Id,
+			PolicyID: agent.PolicyID,
+		}.WithErr(err))
 		return nil, err
 	}
 
@@ -158,11 +165,23 @@ func (at ArtifactT) getArtifact(ctx context.Context, zlog zerolog.Logger, ident,
 		return nil, err
 	}
 
+	if err = decodeArtifact(zlog, art); err != nil {
+		return nil, err
+	}
+
+	// Update the cache.
+	at.cache.SetArtifact(*art)
+
+	return art, nil
+}
+
+// decodeArtifact replaces the artifact's base64 encoded body with the decoded payload.
+func decodeArtifact(zlog zerolog.Logger, art *model.Artifact) error {
 	// The 'Body' field type is Raw; extract to string.
 	var srcPayload string
-	if err = json.Unmarshal(art.Body, &srcPayload); err != nil {
+	if err := json.Unmarshal(art.Body, &srcPayload); err != nil {
 		zlog.Error().Err(err).Msg("Cannot unmarshal artifact payload")
-		return nil, err
+		return err
 	}
 
 	// Artifact is stored base64 encoded in ElasticSearch.
@@ -171,22 +190,18 @@ func (at ArtifactT) getArtifact(ctx context.Context, zlog zerolog.Logger, ident,
 	dstPayload, err := base64.StdEncoding.DecodeString(srcPayload)
 	if err != nil {
 		zlog.Error().Err(err).Msg("Fail base64 decode artifact")
-		return nil, err
+		return err
 	}
 
 	// Validate the sha256 hash; this is just good hygiene.
 	if err = validateSha2Data(dstPayload, art.EncodedSha256); err != nil {
 		zlog.Error().Err(err).Msg("Fail sha2 hash validation")
-		return nil, err
+		return err
 	}
 
 	// Reassign decoded payload before adding to cache, avoid base64 decode on cache hit.
 	art.Body = dstPayload
-
-	// Update the cache.
-	at.cache.SetArtifact(*art)
-
-	return art, nil
+	return nil
 }
 
 // Attempt to fetch the artifact from Elastic
@@ -15,6 +15,7 @@ import (
 	"math/rand"
 	"net/http"
 	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/action"
@@ -52,7 +53,7 @@ const (
 
 type CheckinT struct {
 	verCon version.Constraints
-	cfg    *config.Server
+	cfg    atomic.Pointer[config.Server]
 	cache  cache.Cache
 	bc     *checkin.Bulk
 	pm     policy.Monitor
@@ -75,7 +76,6 @@ func NewCheckinT(
 ) *CheckinT {
 	ct := &CheckinT{
 		verCon: verCon,
-		cfg:    cfg,
 		cache:  c,
 		bc:     bc,
 		pm:     pm,
@@ -84,10 +84,16 @@ func NewCheckinT(
 		tr:     tr,
 		bulker: bulker,
 	}
+	ct.cfg.Store(cfg)
 
 	return ct
 }
 
+// Reconfigure applies the limits, timeouts and compression settings of cfg to the following checkins.
+func (ct *CheckinT) Reconfigure(cfg *config.Server) {
+	ct.cfg.Store(cfg)
+}
+
 func (ct *CheckinT) handleCheckin(zlog zerolog.Logger, w http.ResponseWriter, r *http.Request, id, userAgent string) error {
 	start := time.Now()
 
@@ -112,11 +118,12 @@ func (ct *CheckinT) handleCheckin(zlog zerolog.Logger, w http.ResponseWriter, r
 
 func (ct *CheckinT) ProcessRequest(zlog zerolog.Logger, w http.ResponseWriter, r *http.Request, start time.Time, agent *model.Agent, ver string) error {
 	ctx := r.Context()
+	cfg := ct.cfg.Load()
 
 	body := r.Body
 	// Limit the size of the body to prevent malicious agent from exhausting RAM in server
-	if ct.cfg.Limits.CheckinLimit.MaxBody > 0 {
-		body = http.MaxBytesReader(w, body, ct.cfg.Limits.CheckinLimit.MaxBody)
+	if maxBody := listenerLimits(ctx, &cfg.Limits).CheckinLimit.MaxBody; maxBody > 0 {
+		body = http.MaxBytesReader(w, body, maxBody)
 	}
 	readCounter := datacounter.NewReaderCounter(body)
 
@@ -136,14 +143,14 @@ func (ct *CheckinT) ProcessRequest(zlog zerolog.Logger, w http.ResponseWriter, r
 		}
 	}
 
-	pollDuration := ct.cfg.Timeouts.CheckinLongPoll
+	pollDuration := cfg.Timeouts.CheckinLongPoll
 	// set the pollDuration if pDur parsed from poll_timeout was a non-zero value
 	// sets timeout is set to max(1m, min(pDur-2m, max poll time))
 	// sets the response write timeout to max(2m, timeout+1m)
 	if pDur != time.Duration(0) {
 		pollDuration = pDur - (2 * time.Minute)
-		if pollDuration > ct.cfg.Timeouts.CheckinMaxPoll {
-			pollDuration = ct.cfg.Timeouts.CheckinMaxPoll
+		if pollDuration > cfg.Timeouts.CheckinMaxPoll {
+			pollDuration = cfg.Timeouts.CheckinMaxPoll
 		}
 		if pollDuration < time.Minute {
 			pollDuration = time.Minute
@@ -171,6 +178,11 @@ func (ct *CheckinT) ProcessRequest(zlog zerolog.Logger, w http.ResponseWriter, r
 		return err
 	}
 
+	// A failing agent halts the canary rollout of the revision it is running
+	if req.Status == CheckinRequestStatusError {
+		ct.pm.ReportFailure(agent.Id, agent.PolicyID, agent.PolicyRevisionIdx, agent.PolicyCoordinatorIdx)
+	}
+
 	// Resolve AckToken from request, fallback on the agent record
 	seqno, err := ct.resolveSeqNo(ctx, zlog, req, agent)
 	if err != nil {
@@ -183,7 +195,9 @@ func (ct *CheckinT) ProcessRequest(zlog zerolog.Logger, w http.ResponseWriter, r
 	actCh := aSub.Ch()
 
 	// Subscribe to policy manager for changes on PolicyId > policyRev
-	sub, err := ct.pm.Subscribe(agent.Id, agent.PolicyID, agent.PolicyRevisionIdx, agent.PolicyCoordinatorIdx)
+	sub, err := ct.pm.Subscribe(agent.Id, agent.PolicyID, agent.PolicyRevisionIdx, agent.PolicyCoordinatorIdx,
+		policy.WithAgentTags(agent.Tags...),
+		policy.WithPinnedRevision(agent.PolicyPinnedRevisionIdx))
 	if err != nil {
 		return fmt.Errorf("subscribe policy monitor: %w", err)
 	}
@@ -195,11 +209,11 @@ func (ct *CheckinT) ProcessRequest(zlog zerolog.Logger, w http.ResponseWriter, r
 	}()
 
 	// Update check-in timestamp on timeout
-	tick := time.NewTicker(ct.cfg.Timeouts.CheckinTimestamp)
+	tick := time.NewTicker(cfg.Timeouts.CheckinTimestamp)
 	defer tick.Stop()
 
 	setupDuration := time.Since(start)
-	pollDuration, jitter := calcPollDuration(zlog, pollDuration, setupDuration, ct.cfg.Timeouts.CheckinJitter)
+	pollDuration, jitter := calcPollDuration(zlog, pollDuration, setupDuration, cfg.Timeouts.CheckinJitter)
 
 	zlog.Debug().
 		Str("status", string(req.Status)).
@@ -240,14 +254,23 @@ func (ct *CheckinT) ProcessRequest(zlog zerolog.Logger, w http.ResponseWriter, r
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case <-draining(ctx):
+				// Answer early so the agent reconnects to another instance
+				zlog.Debug().Msg("server draining, end long poll")
+				setDrainRetryAfter(w)
+				break LOOP
 			case acdocs := <-actCh:
 				var acs []Action
 				acdocs = filterActions(zlog, agent.Id, acdocs)
 				acs, ackToken = convertActions(agent.Id, acdocs)
 				actions = append(actions, acs...)
 				break LOOP
-			case policy := <-sub.Output():
-				actionResp, err := processPolicy(ctx, zlog, ct.bulker, agent.Id, policy)
+			case pp := <-sub.Output():
+				var pm policy.Monitor
+				if fromPtr(req.AcceptPolicyPatch) {
+					pm = ct.pm
+				}
+				actionResp, err := processPolicy(ctx, zlog, ct.bulker, pm, agent.Id, pp)
 				if err != nil {
 					return fmt.Errorf("processPolicy: %w", err)
 				}
@@ -320,8 +343,9 @@ func (ct *CheckinT) writeResponse(zlog zerolog.Logger, w http.ResponseWriter, r
 		return fmt.Errorf("writeResponse marshal: %w", err)
 	}
 
-	compressionLevel := ct.cfg.CompressionLevel
-	compressThreshold := ct.cfg.CompressionThresh
+	cfg := ct.cfg.Load()
+	compressionLevel := cfg.CompressionLevel
+	compressThreshold := cfg.CompressionThresh
 
 	if len(payload) > compressThreshold && compressionLevel != flate.NoCompression && acceptsEncoding(r, kEncodingGzip) {
 
@@ -475,7 +499,8 @@ func convertActions(agentID string, actions []model.Action) ([]Action, string) {
 // A new policy exists for this agent.  Perform the following:
 //   - Generate and update default ApiKey if roles have changed.
 //   - Rewrite the policy for delivery to the agent injecting the key material.
-func processPolicy(ctx context.Context, zlog zerolog.Logger, bulker bulk.Bulk, agentID string, pp *policy.ParsedPolicy) (*Action, error) {
+//   - If pm is set, send the policy as a patch against the revision the agent is running when it is still known.
+func processPolicy(ctx context.Context, zlog zerolog.Logger, bulker bulk.Bulk, pm policy.Monitor, agentID string, pp *policy.ParsedPolicy) (*Action, error) {
 	zlog = zlog.With().
 		Str("fleet.ctx", "processPolicy").
 		Int64("fleet.policyRevision", pp.Policy.RevisionIdx).
@@ -525,15 +550,30 @@ func processPolicy(ctx context.Context, zlog zerolog.Logger, bulker bulk.Bulk, a
 	// Update only the output fields to avoid duping the whole map
 	fields[outputsProperty] = json.RawMessage(outputRaw)
 
-	rewrittenPolicy := struct {
+	var data interface{} = struct {
 		Policy map[string]json.RawMessage `json:"policy"`
 	}{fields}
 
+	if pm != nil && agent.PolicyID == pp.Policy.PolicyID {
+		if base, ok := pm.LookupRevision(agent.PolicyID, agent.PolicyRevisionIdx, agent.PolicyCoordinatorIdx); ok {
+			patch, err := newPolicyPatch(base, fields)
+			if err != nil {
+				zlog.Warn().Err(err).Msg("unable to create policy patch, sending full policy")
+			} else if patch != nil {
+				zlog.Debug().
+					Int64("fleet.policyBaseRevision", patch.BaseRevisionIdx).
+					Int("fleet.policyPatchOps", len(patch.Patch)).
+					Msg("sending policy patch")
+				data = patch
+			}
+		}
+	}
+
 	r := policy.RevisionFromPolicy(pp.Policy)
 	resp := Action{
 		AgentId:   agent.Id,
 		CreatedAt: pp.Policy.Timestamp,
-		Data:      rewrittenPolicy,
+		Data:      data,
 		Id:        r.String(),
 		Type:      TypePolicyChange,
 	}
@@ -541,8 +581,56 @@ func processPolicy(ctx context.Context, zlog zerolog.Logger, bulker bulk.Bulk, a
 	return &resp, nil
 }
 
-func findAgentByAPIKeyID(ctx context.Context, bulker bulk.Bulk, id string) (*model.Agent, error) {
-	agent, err := dl.FindAgent(ctx, bulker, dl.QueryAgentByAssessAPIKeyID, dl.FieldAccessAPIKeyID, id)
+// policyPatch is the POLICY_CHANGE action data sent in place of the full policy.
+type policyPatch struct {
+	BaseRevisionIdx    int64            `json:"base_revision_idx"`
+	BaseCoordinatorIdx int64            `json:"base_coordinator_idx"`
+	Patch              []policy.PatchOp `json:"policy_patch"`
+}
+
+// newPolicyPatch creates the patch from the base policy to the rewritten policy fields.
+// The outputs contain key material specific to the agent, so they are always replaced as a whole.
+// A nil patch is returned if it would not be smaller than the full policy.
+func newPolicyPatch(base *policy.ParsedPolicy, fields map[string]json.RawMessage) (*policyPatch, error) {
+	ops, err := policy.Diff(base.Fields, fields, policy.FieldOutputs)
+	if err != nil {
+		return nil, err
+	}
+	ops = append(ops, policy.PatchOp{Op: policy.PatchOpReplace, Path: "/" + policy.FieldOutputs, Value: fields[policy.FieldOutputs]})
+
+	patch := &policyPatch{
+		BaseRevisionIdx:    base.Policy.RevisionIdx,
+		BaseCoordinatorIdx: base.Policy.CoordinatorIdx,
+		Patch:              ops,
+	}
+
+	patchSize := 0
+	for _, op := range ops {
+		patchSize += len(op.Path) + len(op.Value)
+	}
+	fullSize := 0
+	for k, v := range fields {
+		fullSize += len(k) + len(v)
+	}
+	if patchSize >= fullSize {
+		return nil, nil
+	}
+	return patch, nil
+}
+
+// findAgentByAPIKeyID returns the agent of the access API key. The agent is read by id when the cache
+// knows the agent of the key, and searched for otherwise.
+func findAgentByAPIKeyID(ctx context.Context, bulker bulk.Bulk, c cache.Cache, id string) (*model.Agent, error) {
+	var agent model.Agent
+	var err error
+	if agentID, ok := c.GetAPIKeyAgent(id); ok {
+		agent, err = dl.ReadAgent(ctx, bulker, agentID)
+	} else {
+		agent, err = dl.FindAgent(ctx, bulker, dl.QueryAgentByAssessAPIKeyID, dl.FieldAccessAPIKeyID, id)
+		if err == nil {
+			c.SetAPIKeyAgent(id, agent.Id)
+		}
+	}
 	if err != nil {
 		if errors.Is(err, dl.ErrNotFound) {
 			err = ErrAgentNotFound
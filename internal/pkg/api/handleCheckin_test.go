@@ -174,3 +174,43 @@ func TestResolveSeqNo(t *testing.T) {
 	}
 
 }
+
+func TestNewPolicyPatch(t *testing.T) {
+	outputs := json.RawMessage(`{"default":{"type":"elasticsearch","api_key":"id:key"}}`)
+	base := &policy.ParsedPolicy{
+		Policy: model.Policy{RevisionIdx: 2, CoordinatorIdx: 1},
+		Fields: map[string]json.RawMessage{
+			"outputs": json.RawMessage(`{"default":{"type":"elasticsearch"}}`),
+			"inputs":  json.RawMessage(`[{"id":"a","streams":[{"period":"10s"}]}]`),
+			"agent":   json.RawMessage(`{"monitoring":{"enabled":true,"logs":true,"metrics":true,"namespace":"default","use_output":"default"}}`),
+		},
+	}
+
+	t.Run("patch", func(t *testing.T) {
+		fields := map[string]json.RawMessage{
+			"outputs": outputs,
+			"inputs":  base.Fields["inputs"],
+			"agent":   json.RawMessage(`{"monitoring":{"enabled":true,"logs":false,"metrics":true,"namespace":"default","use_output":"default"}}`),
+		}
+		patch, err := newPolicyPatch(base, fields)
+		assert.NoError(t, err)
+		if assert.NotNil(t, patch) {
+			assert.Equal(t, int64(2), patch.BaseRevisionIdx)
+			assert.Equal(t, int64(1), patch.BaseCoordinatorIdx)
+			assert.Equal(t, []policy.PatchOp{
+				{Op: policy.PatchOpReplace, Path: "/agent/monitoring/logs", Value: json.RawMessage(`false`)},
+				{Op: policy.PatchOpReplace, Path: "/outputs", Value: outputs},
+			}, patch.Patch)
+		}
+	})
+
+	t.Run("full policy when patch is not smaller", func(t *testing.T) {
+		fields := map[string]json.RawMessage{
+			"outputs": outputs,
+			"inputs":  json.RawMessage(`[{"id":"b"}]`),
+		}
+		patch, err := newPolicyPatch(base, fields)
+		assert.NoError(t, err)
+		assert.Nil(t, patch)
+	})
+}
@@ -11,10 +11,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastic/elastic-agent-libs/str"
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
@@ -58,19 +60,25 @@ var (
 
 type EnrollerT struct {
 	verCon version.Constraints
-	cfg    *config.Server
+	cfg    atomic.Pointer[config.Server]
 	bulker bulk.Bulk
 	cache  cache.Cache
 }
 
 func NewEnrollerT(verCon version.Constraints, cfg *config.Server, bulker bulk.Bulk, c cache.Cache) (*EnrollerT, error) {
-	return &EnrollerT{
+	et := &EnrollerT{
 		verCon: verCon,
-		cfg:    cfg,
 		bulker: bulker,
 		cache:  c,
-	}, nil
+	}
+	et.cfg.Store(cfg)
+	return et, nil
+
+}
 
+// Reconfigure applies the limits of cfg to the following enrollments.
+func (et *EnrollerT) Reconfigure(cfg *config.Server) {
+	et.cfg.Store(cfg)
 }
 
 func (et *EnrollerT) handleEnroll(zlog zerolog.Logger, w http.ResponseWriter, r *http.Request, rb *rollback.Rollback, userAgent string) error {
@@ -87,16 +95,38 @@ func (et *EnrollerT) handleEnroll(zlog zerolog.Logger, w http.ResponseWriter, r
 		return err
 	}
 
-	resp, err := et.processRequest(zlog, w, r, rb, key.ID, ver)
+	// the identity of the client certificate is bound to the agent, when required
+	certIdentity, err := clientCertIdentity(r)
 	if err != nil {
 		return err
 	}
 
+	resp, err := et.processRequest(zlog, w, r, rb, key.ID, ver, certIdentity)
+	if err != nil {
+		audit.Log(ctx, audit.Event{
+			Action:         audit.ActionAgentEnroll,
+			Message:        "Agent enrollment failed",
+			EnrollAPIKeyID: key.ID,
+			CertIdentity:   certIdentity,
+		}.WithErr(err))
+		return err
+	}
+	audit.Log(ctx, audit.Event{
+		Action:         audit.ActionAgentEnroll,
+		Outcome:        audit.OutcomeSuccess,
+		Message:        "Agent enrolled",
+		AgentID:        resp.Item.Id,
+		PolicyID:       resp.Item.PolicyId,
+		EnrollAPIKeyID: key.ID,
+		APIKeyIDs:      []string{resp.Item.AccessApiKeyId},
+		CertIdentity:   certIdentity,
+	})
+
 	ts, _ := logger.CtxStartTime(r.Context())
 	return writeResponse(zlog, w, resp, ts)
 }
 
-func (et *EnrollerT) processRequest(zlog zerolog.Logger, w http.ResponseWriter, r *http.Request, rb *rollback.Rollback, enrollmentAPIKeyID, ver string) (*EnrollResponse, error) {
+func (et *EnrollerT) processRequest(zlog zerolog.Logger, w http.ResponseWriter, r *http.Request, rb *rollback.Rollback, enrollmentAPIKeyID, ver, certIdentity string) (*EnrollResponse, error) {
 
 	// Validate that an enrollment record exists for a key with this id.
 	erec, err := et.fetchEnrollmentKeyRecord(r.Context(), enrollmentAPIKeyID)
@@ -107,8 +137,8 @@ func (et *EnrollerT) processRequest(zlog zerolog.Logger, w http.ResponseWriter,
 	body := r.Body
 
 	// Limit the size of the body to prevent malicious agent from exhausting RAM in server
-	if et.cfg.Limits.EnrollLimit.MaxBody > 0 {
-		body = http.MaxBytesReader(w, body, et.cfg.Limits.EnrollLimit.MaxBody)
+	if maxBody := listenerLimits(r.Context(), &et.cfg.Load().Limits).EnrollLimit.MaxBody; maxBody > 0 {
+		body = http.MaxBytesReader(w, body, maxBody)
 	}
 
 	readCounter := datacounter.NewReaderCounter(body)
@@ -121,7 +151,7 @@ func (et *EnrollerT) processRequest(zlog zerolog.Logger, w http.ResponseWriter,
 
 	cntEnroll.bodyIn.Add(readCounter.Count())
 
-	return et._enroll(r.Context(), rb, zlog, req, erec.PolicyID, ver)
+	return et._enroll(r.Context(), rb, zlog, req, erec.PolicyID, ver, certIdentity)
 }
 
 func (et *EnrollerT) _enroll(
@@ -130,7 +160,8 @@ func (et *EnrollerT) _enroll(
 	zlog zerolog.Logger,
 	req *EnrollRequest,
 	policyID,
-	ver string) (*EnrollResponse, error) {
+	ver,
+	certIdentity string) (*EnrollResponse, error) {
 
 	if req.SharedId != "" {
 		// TODO: Support pre-existing install
@@ -176,7 +207,8 @@ func (et *EnrollerT) _enroll(
 			ID:      agentID,
 			Version: ver,
 		},
-		Tags: removeDuplicateStr(req.Metadata.Tags),
+		Tags:                      removeDuplicateStr(req.Metadata.Tags),
+		ClientCertificateIdentity: certIdentity,
 	}
 
 	err = createFleetAgent(ctx, et.bulker, agentID, agentData)
@@ -267,7 +299,13 @@ LOOP:
 		}
 	}
 
-	if err := bulker.APIKeyInvalidate(ctx, apikeyID); err != nil {
+	err := bulker.APIKeyInvalidate(ctx, apikeyID)
+	audit.Log(ctx, audit.Event{
+		Action:    audit.ActionAPIKeyInvalidate,
+		Message:   "Access API key of failed enrollment invalidated",
+		APIKeyIDs: []string{apikeyID},
+	}.WithErr(err))
+	if err != nil {
 		zlog.Error().Err(err).Msg("fail invalidate apiKey")
 		return err
 	}
@@ -371,13 +409,23 @@ func createFleetAgent(ctx context.Context, bulker bulk.Bulk, id string, agent mo
 }
 
 func generateAccessAPIKey(ctx context.Context, bulk bulk.Bulk, agentID string) (*apikey.APIKey, error) {
-	return bulk.APIKeyCreate(
+	key, err := bulk.APIKeyCreate(
 		ctx,
 		agentID,
 		"",
 		[]byte(kFleetAccessRolesJSON),
 		apikey.NewMetadata(agentID, "", apikey.TypeAccess),
 	)
+	e := audit.Event{
+		Action:  audit.ActionAPIKeyCreate,
+		Message: "Agent access API key created",
+		AgentID: agentID,
+	}
+	if key != nil {
+		e.APIKeyIDs = []string{key.ID}
+	}
+	audit.Log(ctx, e.WithErr(err))
+	return key, err
 }
 
 func (et *EnrollerT) fetchEnrollmentKeyRecord(ctx context.Context, id string) (*model.EnrollmentAPIKey, error) {
@@ -30,14 +30,31 @@ const (
 type AuthFunc func(*http.Request) (*apikey.APIKey, error)
 
 type StatusT struct {
-	cfg    *config.Server
-	bulk   bulk.Bulk
-	cache  cache.Cache
-	authfn AuthFunc
+	cfg     *config.Server
+	bulk    bulk.Bulk
+	cache   cache.Cache
+	authfn  AuthFunc
+	readyfn func() bool
+	cafn    func() string
 }
 
 type OptFunc func(*StatusT)
 
+// WithReadyFunc holds a HEALTHY status as STARTING until fn returns true.
+func WithReadyFunc(fn func() bool) OptFunc {
+	return func(st *StatusT) {
+		st.readyfn = fn
+	}
+}
+
+// WithCAFingerprint includes the fingerprint of the local certificate authority returned by fn
+// in the responses to authenticated requests.
+func WithCAFingerprint(fn func() string) OptFunc {
+	return func(st *StatusT) {
+		st.cafn = fn
+	}
+}
+
 func NewStatusT(cfg *config.Server, bulker bulk.Bulk, cache cache.Cache, opts ...OptFunc) *StatusT {
 	st := &StatusT{
 		cfg:   cfg,
@@ -68,6 +85,13 @@ func (st StatusT) handleStatus(zlog zerolog.Logger, sm policy.SelfMonitor, bi bu
 	}
 
 	state := sm.State()
+	switch {
+	case isStopping(r.Context()):
+		// Report the server as stopping first so that load balancers stop routing to it
+		state = client.UnitStateStopping
+	case state == client.UnitStateHealthy && st.readyfn != nil && !st.readyfn():
+		state = client.UnitStateStarting
+	}
 	resp := StatusResponse{
 		Name:   build.ServiceName,
 		Status: StatusResponseStatus(state.String()), // TODO try to make the oapi codegen less verbose here
@@ -80,6 +104,11 @@ func (st StatusT) handleStatus(zlog zerolog.Logger, sm policy.SelfMonitor, bi bu
 			BuildHash: &bi.Commit,
 			BuildTime: &bt,
 		}
+		if st.cafn != nil {
+			if fp := st.cafn(); fp != "" {
+				resp.CaSha256 = &fp
+			}
+		}
 	}
 
 	data, err := json.Marshal(&resp)
@@ -128,3 +128,96 @@ func TestHandleStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleStatusWarmingUp(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	c, err := cache.New(config.Cache{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+
+	ready := false
+	r := apiServer{
+		st: NewStatusT(cfg, nil, c, withAuthFunc(func(r *http.Request) (*apikey.APIKey, error) {
+			return nil, nil
+		}), WithReadyFunc(func() bool { return ready })),
+		sm: &mockPolicyMonitor{client.UnitStateHealthy},
+	}
+	hr := Handler(&r)
+
+	for _, tc := range []struct {
+		ready  bool
+		code   int
+		status client.UnitState
+	}{
+		{false, http.StatusServiceUnavailable, client.UnitStateStarting},
+		{true, http.StatusOK, client.UnitStateHealthy},
+	} {
+		ready = tc.ready
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		hr.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code)
+		var res StatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, tc.status.String(), string(res.Status))
+	}
+}
+
+func TestHandleStatusStopping(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	c, err := cache.New(config.Cache{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+
+	r := apiServer{
+		st: NewStatusT(cfg, nil, c, withAuthFunc(func(r *http.Request) (*apikey.APIKey, error) {
+			return nil, nil
+		})),
+		sm: &mockPolicyMonitor{client.UnitStateHealthy},
+	}
+	hr := Handler(&r)
+
+	// the server reports that it is stopping during the pre-drain delay, before it drains
+	stoppingCh := make(chan struct{})
+	close(stoppingCh)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	hr.ServeHTTP(w, req.WithContext(withDrain(req.Context(), stoppingCh, nil)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var res StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, client.UnitStateStopping.String(), string(res.Status))
+}
+
+func TestHandleStatusCAFingerprint(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	c, err := cache.New(config.Cache{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+
+	for _, authed := range []bool{true, false} {
+		r := apiServer{
+			st: NewStatusT(cfg, nil, c, WithCAFingerprint(func() string { return "ca-fingerprint" }), withAuthFunc(func(r *http.Request) (*apikey.APIKey, error) {
+				if !authed {
+					return nil, apikey.ErrNoAuthHeader
+				}
+				return nil, nil
+			})),
+			sm: &mockPolicyMonitor{client.UnitStateHealthy},
+		}
+		w := httptest.NewRecorder()
+		Handler(&r).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var res StatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		if authed {
+			require.NotNil(t, res.CaSha256)
+			assert.Equal(t, "ca-fingerprint", *res.CaSha256)
+		} else {
+			assert.Nil(t, res.CaSha256, "the fingerprint is only returned to authenticated callers")
+		}
+	}
+}
@@ -14,7 +14,6 @@ import (
 	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
@@ -30,8 +29,7 @@ import (
 
 const (
 	// TODO: move to a config
-	maxFileSize    = 104857600 // 100 MiB
-	maxUploadTimer = 24 * time.Hour
+	maxFileSize = 104857600 // 100 MiB
 )
 
 var (
@@ -61,7 +59,7 @@ func NewUploadT(cfg *config.Server, bulker bulk.Bulk, chunkClient *elasticsearch
 		chunkClient: chunkClient,
 		bulker:      bulker,
 		cache:       cache,
-		uploader:    uploader.New(chunkClient, bulker, cache, maxFileSize, maxUploadTimer),
+		uploader:    uploader.New(chunkClient, bulker, cache, maxFileSize, cfg.Limits.UploadTimeLimit),
 		authAgent:   authAgent,
 		authAPIKey:  authAPIKey,
 	}
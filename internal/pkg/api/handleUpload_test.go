@@ -41,6 +41,8 @@ import (
 
 const RouteUploadBegin = "/api/fleet/uploads"
 
+const maxUploadTimer = 24 * time.Hour
+
 func TestUploadBeginValidation(t *testing.T) {
 	hr, _, _ := prepareUploaderMock(t)
 
@@ -395,6 +397,7 @@ func TestChunkUploadStatus(t *testing.T) {
 		{"Status Delete Files cannot upload", upload.StatusDel, http.StatusBadRequest, "stopped"},
 		{"Status Complete File cannot upload", upload.StatusDone, http.StatusBadRequest, "stopped"},
 		{"Status Failure File cannot upload", upload.StatusFail, http.StatusBadRequest, "stopped"},
+		{"Status Expired File cannot upload", upload.StatusExpired, http.StatusBadRequest, "stopped"},
 	}
 
 	for _, tc := range tests {
@@ -566,6 +569,7 @@ func TestUploadCompleteRequiresValidStatus(t *testing.T) {
 		{"Cannot finalize Status Deleted", upload.StatusDel, http.StatusBadRequest, "closed"},
 		{"Cannot finalize Status Complete", upload.StatusDone, http.StatusBadRequest, "closed"},
 		{"Cannot finalize Status Failure", upload.StatusFail, http.StatusBadRequest, "closed"},
+		{"Cannot finalize Status Expired", upload.StatusExpired, http.StatusBadRequest, "closed"},
 	}
 
 	for _, tc := range tests {
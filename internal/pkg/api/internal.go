@@ -0,0 +1,274 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
+)
+
+// ErrInvalidPolicyPin is returned when pinning a policy to a revision index that is not positive.
+var ErrInvalidPolicyPin = errors.New("invalid policy pin")
+
+// InternalRoute is an HTTP route that is only served by the internal listener.
+type InternalRoute struct {
+	Method  string
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// ServerOpt is an option used when creating a server.
+type ServerOpt func(*server)
+
+// WithInternalRoutes adds routes that are only exposed on the internal listener.
+func WithInternalRoutes(routes ...InternalRoute) ServerOpt {
+	return func(s *server) {
+		s.internal = append(s.internal, routes...)
+	}
+}
+
+// WithBulkLatency sets the Elasticsearch bulk latency followed by adaptive limits.
+func WithBulkLatency(latency *limit.LatencySignal) ServerOpt {
+	return func(s *server) {
+		s.latency = latency
+	}
+}
+
+// WithTLSReloader sets the TLS configuration served by the server, shared with the other servers.
+func WithTLSReloader(r *TLSReloader) ServerOpt {
+	return func(s *server) {
+		s.tls = r
+	}
+}
+
+// WithNetwork sets the network the server listens on, tcp or unix; the address is the path of
+// the socket on unix.
+func WithNetwork(network string) ServerOpt {
+	return func(s *server) {
+		s.network = network
+	}
+}
+
+// WithRouteGroups restricts the routes served by the server to the route groups, see
+// config.RouteGroups; all routes are served without groups.
+func WithRouteGroups(groups ...string) ServerOpt {
+	return func(s *server) {
+		s.routes = append(s.routes, groups...)
+	}
+}
+
+// WithLogTargets elevates the logging of the requests of the log targets.
+func WithLogTargets(t *logger.Targets) ServerOpt {
+	return func(s *server) {
+		s.targets = t
+	}
+}
+
+// CacheRoutes returns the internal routes used to inspect the cache.
+func CacheRoutes(c cache.Cache) []InternalRoute {
+	return []InternalRoute{{
+		Method:  http.MethodGet,
+		Pattern: "/api/internal/cache",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, r, http.StatusOK, c.Stats())
+		},
+	}}
+}
+
+// ScheduleRoutes returns the internal routes used to list the schedules, with their recent runs,
+// and to run a schedule immediately; the triggered run is skipped if another instance holds the schedule lease.
+func ScheduleRoutes(s *scheduler.Scheduler) []InternalRoute {
+	return []InternalRoute{{
+		Method:  http.MethodGet,
+		Pattern: "/api/internal/schedules",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, r, http.StatusOK, map[string]interface{}{"schedules": s.Statuses()})
+		},
+	}, {
+		Method:  http.MethodPost,
+		Pattern: "/api/internal/schedules/{name}/run",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			name := chi.URLParam(r, "name")
+			if err := s.Trigger(name); err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			hlog.FromRequest(r).Info().Str("schedule", name).Msg("schedule run triggered")
+			writeJSON(w, r, http.StatusAccepted, map[string]string{"schedule": name})
+		},
+	}}
+}
+
+// RolloutRoutes returns the internal routes used to resume or abort the halted rollout of a policy.
+func RolloutRoutes(pm policy.Monitor) []InternalRoute {
+	return []InternalRoute{{
+		Method:  http.MethodPost,
+		Pattern: "/api/internal/policies/{id}/rollout/resume",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			id := chi.URLParam(r, "id")
+			if err := pm.ResumeRollout(id); err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			hlog.FromRequest(r).Info().Str(logger.PolicyID, id).Msg("policy rollout resumed")
+			writeJSON(w, r, http.StatusAccepted, map[string]string{"policy_id": id})
+		},
+	}, {
+		Method:  http.MethodPost,
+		Pattern: "/api/internal/policies/{id}/rollout/abort",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			id := chi.URLParam(r, "id")
+			if err := pm.AbortRollout(id); err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			hlog.FromRequest(r).Info().Str(logger.PolicyID, id).Msg("policy rollout aborted")
+			writeJSON(w, r, http.StatusAccepted, map[string]string{"policy_id": id})
+		},
+	}}
+}
+
+// PolicyPinRoutes returns the internal routes used to pin a policy to a revision, to remove the pin and
+// to roll a policy back to the revision before its latest revision. The pins apply to all fleet-servers.
+func PolicyPinRoutes(bulker bulk.Bulk) []InternalRoute {
+	pin := func(w http.ResponseWriter, r *http.Request, id string, revIdx int64) {
+		// the pin of a revision that does not exist is ignored by the policy monitor
+		if _, err := dl.FindPolicyRevision(r.Context(), bulker, id, revIdx); err != nil {
+			ErrorResp(w, r, err)
+			return
+		}
+		if err := dl.SetPolicyPin(r.Context(), bulker, id, revIdx); err != nil {
+			ErrorResp(w, r, err)
+			return
+		}
+		hlog.FromRequest(r).Info().Str(logger.PolicyID, id).Int64("pinnedRev", revIdx).Msg("policy pinned")
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"policy_id": id, "pinned_revision_idx": revIdx})
+	}
+
+	return []InternalRoute{{
+		Method:  http.MethodPut,
+		Pattern: "/api/internal/policies/{id}/pin",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				RevisionIdx int64 `json:"revision_idx"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				ErrorResp(w, r, fmt.Errorf("%w: %v", ErrInvalidPolicyPin, err)) //nolint:errorlint // the decoding error is only reported
+				return
+			}
+			if req.RevisionIdx <= 0 {
+				ErrorResp(w, r, fmt.Errorf("%w: revision_idx must be greater than 0", ErrInvalidPolicyPin))
+				return
+			}
+			pin(w, r, chi.URLParam(r, "id"), req.RevisionIdx)
+		},
+	}, {
+		Method:  http.MethodDelete,
+		Pattern: "/api/internal/policies/{id}/pin",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			id := chi.URLParam(r, "id")
+			if err := dl.SetPolicyPin(r.Context(), bulker, id, 0); err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			hlog.FromRequest(r).Info().Str(logger.PolicyID, id).Msg("policy unpinned")
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}, {
+		Method:  http.MethodPost,
+		Pattern: "/api/internal/policies/{id}/rollback",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			id := chi.URLParam(r, "id")
+			latest, err := dl.FindLatestPolicyRevision(r.Context(), bulker, id, math.MaxInt64)
+			if err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			prev, err := dl.FindLatestPolicyRevision(r.Context(), bulker, id, latest.RevisionIdx-1)
+			if err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			pin(w, r, id, prev.RevisionIdx)
+		},
+	}}
+}
+
+// LogTargetRoutes returns the internal routes used to list, add and remove the log targets.
+func LogTargetRoutes(t *logger.Targets) []InternalRoute {
+	return []InternalRoute{{
+		Method:  http.MethodGet,
+		Pattern: "/api/internal/log_targets",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, r, http.StatusOK, map[string]interface{}{"targets": t.List()})
+		},
+	}, {
+		Method:  http.MethodPost,
+		Pattern: "/api/internal/log_targets",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				logger.Target
+				Duration string `json:"duration"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				ErrorResp(w, r, fmt.Errorf("%w: %v", logger.ErrInvalidTarget, err)) //nolint:errorlint // the decoding error is only reported
+				return
+			}
+			var d time.Duration
+			if req.Duration != "" {
+				var err error
+				if d, err = time.ParseDuration(req.Duration); err != nil {
+					ErrorResp(w, r, fmt.Errorf("%w: %v", logger.ErrInvalidTarget, err)) //nolint:errorlint // the parsing error is only reported
+					return
+				}
+			}
+			target, err := t.Add(req.Target, d)
+			if err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			writeJSON(w, r, http.StatusCreated, target)
+		},
+	}, {
+		Method:  http.MethodDelete,
+		Pattern: "/api/internal/log_targets/{id}",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if err := t.Remove(chi.URLParam(r, "id")); err != nil {
+				ErrorResp(w, r, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}}
+}
+
+// writeJSON writes v as the JSON body of an internal API response.
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		ErrorResp(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if _, err := w.Write(data); err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("fail writing internal api response")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	mmock "github.com/elastic/fleet-server/v7/internal/pkg/monitor/mock"
+	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+func TestCacheRoutes(t *testing.T) {
+	c, err := cache.New(config.Cache{NumCounters: 100, MaxCost: 100000})
+	require.NoError(t, err)
+	c.GetArtifact("ident", "sha2")
+
+	cfg := &config.ServerLimits{}
+	hr := newRouter(Limiter(cfg, nil), nil, nil, nil, &apiServer{}, nil, CacheRoutes(c)...)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/internal/cache", nil)
+	hr.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats cache.Stats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(100000), stats.MaxCost)
+	assert.Equal(t, uint64(1), stats.Types[cache.TypeArtifact].Misses)
+	assert.NotNil(t, stats.Total)
+}
+
+func TestCacheRoutesNotMounted(t *testing.T) {
+	cfg := &config.ServerLimits{}
+	hr := newRouter(Limiter(cfg, nil), nil, nil, nil, &apiServer{}, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/internal/cache", nil)
+	hr.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestScheduleRoutes(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ran := make(chan struct{}, 1)
+	sched, err := scheduler.New([]scheduler.Schedule{{
+		Name:     "actions-cleanup",
+		Interval: time.Hour,
+		WorkFn: func(context.Context) error {
+			ran <- struct{}{}
+			return nil
+		},
+	}}, scheduler.WithFirstRunDelay(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = sched.Run(ctx)
+	}()
+
+	cfg := &config.ServerLimits{}
+	hr := newRouter(Limiter(cfg, nil), nil, nil, nil, &apiServer{}, nil, ScheduleRoutes(sched)...)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/internal/schedules/unknown/run", nil)
+	hr.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/api/internal/schedules/actions-cleanup/run", nil)
+	hr.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("triggered schedule did not run")
+	}
+
+	var resp struct {
+		Schedules []scheduler.Status `json:"schedules"`
+	}
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		hr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/internal/schedules", nil))
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || len(resp.Schedules) != 1 {
+			return false
+		}
+		return resp.Schedules[0].LastRun != nil
+	}, time.Second, 10*time.Millisecond)
+
+	st := resp.Schedules[0]
+	assert.Equal(t, "actions-cleanup", st.Name)
+	assert.Equal(t, scheduler.OutcomeSuccess, st.LastRun.Outcome)
+	assert.True(t, st.LastRun.Triggered)
+	assert.NotNil(t, st.NextRun)
+}
+
+func TestRolloutRoutes(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	pm := policy.NewMonitor(ftesting.NewMockBulk(), mmock.NewMockMonitor(), 0)
+
+	cfg := &config.ServerLimits{}
+	hr := newRouter(Limiter(cfg, nil), nil, nil, nil, &apiServer{}, nil, RolloutRoutes(pm)...)
+
+	for _, action := range []string{"resume", "abort"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/internal/policies/policy/rollout/"+action, nil)
+		hr.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusConflict, w.Code, action)
+	}
+}
+
+func TestPolicyPinRoutes(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Search", mock.Anything, dl.FleetPolicies, mock.Anything, mock.Anything).Return(&es.ResultT{
+		HitsT: es.HitsT{Hits: []es.HitT{{Source: []byte(`{"policy_id":"policy","revision_idx":2,"coordinator_idx":1}`)}}},
+	}, nil).Once()
+	bulker.On("Search", mock.Anything, dl.FleetPolicies, mock.Anything, mock.Anything).Return(&es.ResultT{}, nil)
+	bulker.On("Index", mock.Anything, dl.FleetPolicyPins, "policy", mock.Anything, mock.Anything).Return("policy", nil)
+
+	cfg := &config.ServerLimits{}
+	hr := newRouter(Limiter(cfg, nil), nil, nil, nil, &apiServer{}, nil, PolicyPinRoutes(bulker)...)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{http.MethodPut, "/api/internal/policies/policy/pin", `{"revision_idx":0}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/internal/policies/policy/pin", `{"revision_idx":2}`, http.StatusOK},
+		{http.MethodPut, "/api/internal/policies/policy/pin", `{"revision_idx":5}`, http.StatusNotFound},
+		{http.MethodPost, "/api/internal/policies/policy/rollback", ``, http.StatusNotFound},
+		{http.MethodDelete, "/api/internal/policies/policy/pin", ``, http.StatusNoContent},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		hr.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, "%s %s %s", tc.method, tc.path, tc.body)
+	}
+	bulker.AssertNumberOfCalls(t, "Index", 2)
+}
+
+func TestLogTargetRoutes(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	targets := logger.NewTargets()
+	cfg := &config.ServerLimits{}
+	hr := newRouter(Limiter(cfg, nil), nil, nil, targets, &apiServer{}, nil, LogTargetRoutes(targets)...)
+
+	w := httptest.NewRecorder()
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/internal/log_targets", strings.NewReader(`{"level":"debug"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/internal/log_targets", strings.NewReader(`{"agent_ids":["agent"],"duration":"forever"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/internal/log_targets", strings.NewReader(`{"agent_ids":["agent"],"capture":true,"duration":"5m"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var target logger.Target
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &target))
+	assert.NotEmpty(t, target.ID)
+	assert.Equal(t, "trace", target.Level)
+	assert.True(t, target.Capture)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), target.Expires, time.Minute)
+
+	w = httptest.NewRecorder()
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/internal/log_targets", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Targets []logger.Target `json:"targets"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Targets, 1)
+	assert.Equal(t, target.ID, resp.Targets[0].ID)
+
+	w = httptest.NewRecorder()
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/internal/log_targets/"+target.ID, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = httptest.NewRecorder()
+	hr.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/internal/log_targets/"+target.ID, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, targets.List())
+}
@@ -29,6 +29,8 @@ var (
 	cntHTTPNew   *monitoring.Uint
 	cntHTTPClose *monitoring.Uint
 
+	cntConnRejected connStats
+
 	cntCheckin     routeStats
 	cntEnroll      routeStats
 	cntAcks        routeStats
@@ -69,14 +71,18 @@ func InitMetrics(ctx context.Context, cfg *config.Config, bi build.Info) (*api.S
 }
 
 type routeStats struct {
-	active    *monitoring.Uint
-	total     *monitoring.Uint
-	rateLimit *monitoring.Uint
-	maxLimit  *monitoring.Uint
-	failure   *monitoring.Uint
-	drop      *monitoring.Uint
-	bodyIn    *monitoring.Uint
-	bodyOut   *monitoring.Uint
+	active      *monitoring.Uint
+	total       *monitoring.Uint
+	rateLimit   *monitoring.Uint
+	maxLimit    *monitoring.Uint
+	keyedRate   *monitoring.Uint
+	keyedMax    *monitoring.Uint
+	limit       *monitoring.Int
+	authLockout *monitoring.Uint
+	failure     *monitoring.Uint
+	drop        *monitoring.Uint
+	bodyIn      *monitoring.Uint
+	bodyOut     *monitoring.Uint
 }
 
 func (rt *routeStats) Register(registry *monitoring.Registry) {
@@ -84,6 +90,10 @@ func (rt *routeStats) Register(registry *monitoring.Registry) {
 	rt.total = monitoring.NewUint(registry, "total")
 	rt.rateLimit = monitoring.NewUint(registry, "limit_rate")
 	rt.maxLimit = monitoring.NewUint(registry, "limit_max")
+	rt.keyedRate = monitoring.NewUint(registry, "limit_keyed_rate")
+	rt.keyedMax = monitoring.NewUint(registry, "limit_keyed_max")
+	rt.limit = monitoring.NewInt(registry, "limit_adaptive")
+	rt.authLockout = monitoring.NewUint(registry, "auth_lockout")
 	rt.failure = monitoring.NewUint(registry, "fail")
 	rt.drop = monitoring.NewUint(registry, "drop")
 	rt.bodyIn = monitoring.NewUint(registry, "body_in")
@@ -99,6 +109,7 @@ func init() {
 	registry = monitoring.Default.NewRegistry("http_server")
 	cntHTTPNew = monitoring.NewUint(registry, "tcp_open")
 	cntHTTPClose = monitoring.NewUint(registry, "tcp_close")
+	cntConnRejected.Register(registry.NewRegistry("tcp_rejected"))
 
 	routesRegistry := registry.NewRegistry("routes")
 
@@ -115,10 +126,16 @@ func init() {
 func (rt *routeStats) IncError(err error) {
 
 	switch {
+	case errors.Is(err, limit.ErrKeyedRateLimit):
+		rt.keyedRate.Inc()
+	case errors.Is(err, limit.ErrKeyedMaxLimit):
+		rt.keyedMax.Inc()
 	case errors.Is(err, limit.ErrRateLimit):
 		rt.rateLimit.Inc()
 	case errors.Is(err, limit.ErrMaxLimit):
 		rt.maxLimit.Inc()
+	case errors.Is(err, ErrAuthLockout):
+		rt.authLockout.Inc()
 	case errors.Is(err, context.Canceled):
 		rt.drop.Inc()
 	default:
@@ -132,6 +149,35 @@ func (rt *routeStats) IncStart() func() {
 	return rt.active.Dec
 }
 
+// SetLimit reports the current adaptive concurrency limit of the route.
+func (rt *routeStats) SetLimit(n int64) {
+	rt.limit.Set(n)
+}
+
+// connStats counts the connections closed by the connection limiters, per reason.
+type connStats struct {
+	max        *monitoring.Uint
+	sourceMax  *monitoring.Uint
+	sourceRate *monitoring.Uint
+}
+
+func (cs *connStats) Register(registry *monitoring.Registry) {
+	cs.max = monitoring.NewUint(registry, "max")
+	cs.sourceMax = monitoring.NewUint(registry, "source_max")
+	cs.sourceRate = monitoring.NewUint(registry, "source_rate")
+}
+
+func (cs *connStats) IncReject(err error) {
+	switch {
+	case errors.Is(err, limit.ErrSourceMaxConnections):
+		cs.sourceMax.Inc()
+	case errors.Is(err, limit.ErrSourceConnectionRate):
+		cs.sourceRate.Inc()
+	default:
+		cs.max.Inc()
+	}
+}
+
 type artifactStats struct {
 	routeStats
 	notFound *monitoring.Uint
@@ -154,6 +154,12 @@ type ActionSignature struct {
 
 // CheckinRequest defines model for checkinRequest.
 type CheckinRequest struct {
+	// AcceptPolicyPatch Indicates that the agent is able to apply a POLICY_CHANGE action delivered as a JSON patch.
+	// If set, fleet-server may send a POLICY_CHANGE action with a `policy_patch` attribute containing the RFC 6902 patch
+	// against the policy with the `base_revision_idx` and `base_coordinator_idx` the agent is running, instead of the full `policy`.
+	// fleet-server sends the full policy when the agent's revision is no longer known.
+	AcceptPolicyPatch *bool `json:"accept_policy_patch,omitempty"`
+
 	// AckToken The ack_token form a previous response if the agent has checked in before.
 	// Translated to a sequence number in fleet-server in order to retrieve any new actions for the agent from the last checkin.
 	AckToken *string `json:"ack_token,omitempty"`
@@ -310,6 +316,9 @@ type Error struct {
 	// Message (optional) Error message.
 	Message *string `json:"message,omitempty"`
 
+	// RetryAfter (optional) The number of seconds after which a rate or concurrency limited request may be retried, also sent as the Retry-After header.
+	RetryAfter *int `json:"retryAfter,omitempty"`
+
 	// StatusCode The HTTP status code of the error.
 	StatusCode int `json:"statusCode"`
 }
@@ -405,6 +414,10 @@ type EventType string
 
 // StatusResponse Status response information.
 type StatusResponse struct {
+	// CaSha256 The base64 encoded SHA-256 of the public key of the certificate authority generated by fleet-server when ssl_bootstrap is used.
+	// Included in the response to an authorized status request, it can be pinned by agents at enrollment.
+	CaSha256 *string `json:"ca_sha256,omitempty"`
+
 	// Name Service name.
 	Name string `json:"name"`
 
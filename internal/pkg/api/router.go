@@ -5,12 +5,21 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/proxy"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
@@ -18,14 +27,21 @@ import (
 	"go.elastic.co/apm/v2"
 )
 
-func newRouter(cfg *config.ServerLimits, si ServerInterface, tracer *apm.Tracer) http.Handler {
+func newRouter(l *limiter, routeGroups []string, trustedProxies []netip.Prefix, targets *logger.Targets, si ServerInterface, tracer *apm.Tracer, internal ...InternalRoute) http.Handler {
 	r := chi.NewRouter()
-	r.Use(logger.Middleware) // Attach middlewares to router directly so the occur before any request parsing/validation
+	r.Use(proxy.Middleware(trustedProxies)) // Resolve the client address before it is logged, traced or limited
+	r.Use(logger.Middleware)                // Attach middlewares to router directly so the occur before any request parsing/validation
+	r.Use(logger.TargetMiddleware(targets, agentIDFromPath))
+	r.Use(audit.Middleware)
 	r.Use(middleware.Recoverer)
-	r.Use(Limiter(cfg).middleware)
+	r.Use(routeFilter(routeGroups))
+	r.Use(l.middleware)
 	if tracer != nil {
 		r.Use(apmchiv5.Middleware(apmchiv5.WithTracer(tracer)))
 	}
+	for _, route := range internal {
+		r.Method(route.Method, route.Pattern, route.Handler)
+	}
 	return HandlerWithOptions(si, ChiServerOptions{
 		BaseRouter:       r,
 		ErrorHandlerFunc: ErrorResp,
@@ -35,28 +51,120 @@ func newRouter(cfg *config.ServerLimits, si ServerInterface, tracer *apm.Tracer)
 
 // limiter wraps routes with metrics and rate limits.
 //
+// The limiter of a route is replaced when its limits change, requests in flight complete
+// under the limiter they were admitted by.
+//
 // auth is handled elsewhere.
 type limiter struct {
-	checkin        *limit.Limiter
-	artifact       *limit.Limiter
-	enroll         *limit.Limiter
-	ack            *limit.Limiter
-	status         *limit.Limiter
-	uploadBegin    *limit.Limiter
-	uploadChunk    *limit.Limiter
-	uploadComplete *limit.Limiter
+	bulkLatency *limit.LatencySignal
+
+	mut    sync.Mutex // serializes Reconfigure
+	cfg    config.ServerLimits
+	limits atomic.Pointer[config.ServerLimits] // passed to the handlers, see listenerLimits
+
+	checkin        atomic.Pointer[limit.Limiter]
+	artifact       atomic.Pointer[limit.Limiter]
+	enroll         atomic.Pointer[limit.Limiter]
+	ack            atomic.Pointer[limit.Limiter]
+	status         atomic.Pointer[limit.Limiter]
+	uploadBegin    atomic.Pointer[limit.Limiter]
+	uploadChunk    atomic.Pointer[limit.Limiter]
+	uploadComplete atomic.Pointer[limit.Limiter]
+}
+
+// Limiter returns the limiter of the routes; adaptive limits follow the Elasticsearch latency of bulkLatency.
+func Limiter(cfg *config.ServerLimits, bulkLatency *limit.LatencySignal) *limiter {
+	l := &limiter{bulkLatency: bulkLatency}
+	l.Reconfigure(cfg)
+	return l
 }
 
-func Limiter(cfg *config.ServerLimits) *limiter {
-	return &limiter{
-		checkin:        limit.NewLimiter(&cfg.CheckinLimit),
-		artifact:       limit.NewLimiter(&cfg.ArtifactLimit),
-		enroll:         limit.NewLimiter(&cfg.EnrollLimit),
-		ack:            limit.NewLimiter(&cfg.AckLimit),
-		status:         limit.NewLimiter(&cfg.StatusLimit),
-		uploadBegin:    limit.NewLimiter(&cfg.UploadStartLimit),
-		uploadChunk:    limit.NewLimiter(&cfg.UploadChunkLimit),
-		uploadComplete: limit.NewLimiter(&cfg.UploadEndLimit),
+// Reconfigure replaces the limiters of the routes whose limits differ in cfg.
+func (l *limiter) Reconfigure(cfg *config.ServerLimits) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	swap := func(route *atomic.Pointer[limit.Limiter], cur, next *config.Limit) {
+		if route.Load() == nil || *cur != *next {
+			route.Store(newLimiter(next, l.bulkLatency))
+		}
+	}
+	swap(&l.checkin, &l.cfg.CheckinLimit, &cfg.CheckinLimit)
+	swap(&l.artifact, &l.cfg.ArtifactLimit, &cfg.ArtifactLimit)
+	swap(&l.enroll, &l.cfg.EnrollLimit, &cfg.EnrollLimit)
+	swap(&l.ack, &l.cfg.AckLimit, &cfg.AckLimit)
+	swap(&l.status, &l.cfg.StatusLimit, &cfg.StatusLimit)
+	swap(&l.uploadBegin, &l.cfg.UploadStartLimit, &cfg.UploadStartLimit)
+	swap(&l.uploadChunk, &l.cfg.UploadChunkLimit, &cfg.UploadChunkLimit)
+	swap(&l.uploadComplete, &l.cfg.UploadEndLimit, &cfg.UploadEndLimit)
+	l.cfg = *cfg
+	limits := *cfg
+	l.limits.Store(&limits)
+}
+
+type limitsKey struct{}
+
+// withListenerLimits returns a context carrying the limits of the listener serving the request.
+func withListenerLimits(ctx context.Context, limits *config.ServerLimits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+// listenerLimits returns the limits of the listener serving the request of ctx, the handlers
+// shared by the listeners apply them rather than the limits of the main listener. It returns
+// fallback if the request is not served by a listener.
+func listenerLimits(ctx context.Context, fallback *config.ServerLimits) *config.ServerLimits {
+	if limits, ok := ctx.Value(limitsKey{}).(*config.ServerLimits); ok {
+		return limits
+	}
+	return fallback
+}
+
+func newLimiter(cfg *config.Limit, bulkLatency *limit.LatencySignal) *limit.Limiter {
+	return limit.NewLimiter(cfg, limitKeyFunc(cfg.Keyed.By), bulkLatency)
+}
+
+// limitKeyFunc returns the function identifying the client of a request for keyed limits.
+// The limits are applied before authentication, so the agent and API key ids are keyed along with
+// a hash of the API key of the request: a client that claims the id of another agent or key without
+// its secret is limited apart from it.
+func limitKeyFunc(by string) limit.KeyFunc {
+	switch by {
+	case config.LimitByAgentID:
+		return func(r *http.Request) string {
+			agentID := agentIDFromPath(r)
+			credential := credentialKey(r)
+			if agentID == "" || credential == "" {
+				return ""
+			}
+			return agentID + ":" + credential
+		}
+	case config.LimitByAPIKeyID:
+		return credentialKey
+	case config.LimitBySourceIP:
+		return remoteIP
+	default:
+		return nil
+	}
+}
+
+// credentialKey returns the id of the API key of the request with a hash of its secret, like the
+// authentication lockout, or an empty string if the request has no API key.
+func credentialKey(r *http.Request) string {
+	key, err := apikey.ExtractAPIKey(r)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key.Key))
+	return key.ID + ":" + hex.EncodeToString(sum[:])
+}
+
+// agentIDFromPath returns the agent id of the acks and checkin routes.
+func agentIDFromPath(r *http.Request) string {
+	switch pathToOperation(r.URL.Path) {
+	case "acks", "checkin":
+		return strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[3]
+	default:
+		return ""
 	}
 }
 
@@ -95,25 +203,65 @@ func pathToOperation(path string) string {
 	return ""
 }
 
+// routeGroup returns the route group of an operation returned by pathToOperation.
+func routeGroup(op string) string {
+	switch op {
+	case "checkin", "acks":
+		return config.RouteGroupCheckin
+	case "enroll":
+		return config.RouteGroupEnroll
+	case "artifact":
+		return config.RouteGroupArtifacts
+	case "uploadBegin", "uploadChunk", "uploadComplete":
+		return config.RouteGroupUploads
+	case "status":
+		return config.RouteGroupStatus
+	default:
+		return ""
+	}
+}
+
+// routeFilter answers not found to the requests of the route groups that are not enabled,
+// all groups are enabled if groups is empty.
+func routeFilter(groups []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(groups) == 0 {
+			return next
+		}
+		enabled := make(map[string]bool, len(groups))
+		for _, group := range groups {
+			enabled[group] = true
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if group := routeGroup(pathToOperation(r.URL.Path)); group != "" && !enabled[group] {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (l *limiter) middleware(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(withListenerLimits(r.Context(), l.limits.Load()))
 		switch pathToOperation(r.URL.Path) {
 		case "enroll":
-			l.enroll.Wrap("enroll", &cntEnroll, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.enroll.Load().Wrap("enroll", &cntEnroll, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		case "acks":
-			l.ack.Wrap("acks", &cntAcks, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.ack.Load().Wrap("acks", &cntAcks, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		case "checkin":
-			l.checkin.Wrap("checkin", &cntCheckin, zerolog.WarnLevel)(next).ServeHTTP(w, r)
+			l.checkin.Load().Wrap("checkin", &cntCheckin, zerolog.WarnLevel)(next).ServeHTTP(w, r)
 		case "artifact":
-			l.artifact.Wrap("artifact", &cntArtifacts, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.artifact.Load().Wrap("artifact", &cntArtifacts, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		case "uploadBegin":
-			l.uploadBegin.Wrap("uploadBegin", &cntUploadStart, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.uploadBegin.Load().Wrap("uploadBegin", &cntUploadStart, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		case "uploadComplete":
-			l.uploadComplete.Wrap("uploadComplete", &cntUploadEnd, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.uploadComplete.Load().Wrap("uploadComplete", &cntUploadEnd, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		case "uploadChunk":
-			l.uploadChunk.Wrap("uploadChunk", &cntUploadChunk, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.uploadChunk.Load().Wrap("uploadChunk", &cntUploadChunk, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		case "status":
-			l.status.Wrap("status", &cntStatus, zerolog.DebugLevel)(next).ServeHTTP(w, r)
+			l.status.Load().Wrap("status", &cntStatus, zerolog.DebugLevel)(next).ServeHTTP(w, r)
 		default:
 			// no tracking or limits
 			next.ServeHTTP(w, r)
@@ -5,12 +5,15 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -45,7 +48,7 @@ func TestPathToOperation(t *testing.T) {
 
 func testStatusServer(t *testing.T, cfg *config.ServerLimits) http.Handler {
 	t.Helper()
-	l := Limiter(cfg)
+	l := Limiter(cfg, nil)
 
 	r := chi.NewRouter()
 	r.Use(l.middleware)
@@ -99,3 +102,132 @@ func TestLimiter(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyedLimiter(t *testing.T) {
+	cfg := &config.ServerLimits{
+		CheckinLimit: config.Limit{
+			Interval: time.Millisecond,
+			Burst:    100,
+			Keyed: config.KeyedLimit{
+				By:       config.LimitByAgentID,
+				Interval: time.Hour,
+				Burst:    1,
+				MaxKeys:  10,
+			},
+		},
+	}
+	h := Limiter(cfg, nil).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	checkin := func(agentID string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/fleet/agents/"+agentID+"/checkin", nil)
+		r.Header.Set("Authorization", "ApiKey "+(apikey.APIKey{ID: "key-id", Key: "secret"}).Token())
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, checkin("agent-1"))
+	assert.Equal(t, http.StatusTooManyRequests, checkin("agent-1"))
+	assert.Equal(t, http.StatusOK, checkin("agent-2"), "other agents are not limited by agent-1")
+}
+
+func TestLimiterReconfigure(t *testing.T) {
+	cfg := &config.ServerLimits{
+		StatusLimit: config.Limit{Interval: time.Hour, Burst: 1},
+	}
+	l := Limiter(cfg, nil)
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	status := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/status", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, status())
+	assert.Equal(t, http.StatusTooManyRequests, status())
+
+	checkin := l.checkin.Load()
+	l.Reconfigure(&config.ServerLimits{
+		StatusLimit: config.Limit{Interval: time.Hour, Burst: 2},
+	})
+	assert.Same(t, checkin, l.checkin.Load(), "unchanged limits are kept")
+	assert.Equal(t, http.StatusOK, status())
+	assert.Equal(t, http.StatusOK, status())
+	assert.Equal(t, http.StatusTooManyRequests, status())
+}
+
+func TestListenerLimits(t *testing.T) {
+	global := &config.ServerLimits{AckLimit: config.Limit{MaxBody: 10}}
+	l := Limiter(&config.ServerLimits{AckLimit: config.Limit{MaxBody: 20}}, nil)
+
+	var maxBody int64
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxBody = listenerLimits(r.Context(), global).AckLimit.MaxBody
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/fleet/agents/id/acks", nil))
+	assert.Equal(t, int64(20), maxBody, "the limits of the listener are applied")
+
+	l.Reconfigure(&config.ServerLimits{AckLimit: config.Limit{MaxBody: 30}})
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/fleet/agents/id/acks", nil))
+	assert.Equal(t, int64(30), maxBody)
+
+	assert.Equal(t, int64(10), listenerLimits(context.Background(), global).AckLimit.MaxBody)
+}
+
+func TestLimitKeyFunc(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/fleet/agents/agent-id/acks", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	r.Header.Set("Authorization", "ApiKey "+(apikey.APIKey{ID: "key-id", Key: "secret"}).Token())
+
+	assert.Nil(t, limitKeyFunc(""))
+	agentKey := limitKeyFunc(config.LimitByAgentID)(r)
+	apiKey := limitKeyFunc(config.LimitByAPIKeyID)(r)
+	assert.True(t, strings.HasPrefix(agentKey, "agent-id:key-id:"), agentKey)
+	assert.True(t, strings.HasPrefix(apiKey, "key-id:"), apiKey)
+	assert.NotContains(t, apiKey, "secret")
+	assert.Equal(t, "10.0.0.1", limitKeyFunc(config.LimitBySourceIP)(r))
+
+	// a request claiming the ids with another secret does not share their limits
+	other := httptest.NewRequest("POST", "/api/fleet/agents/agent-id/acks", nil)
+	other.Header.Set("Authorization", "ApiKey "+(apikey.APIKey{ID: "key-id", Key: "guess"}).Token())
+	assert.NotEqual(t, agentKey, limitKeyFunc(config.LimitByAgentID)(other))
+	assert.NotEqual(t, apiKey, limitKeyFunc(config.LimitByAPIKeyID)(other))
+
+	// requests without an API key are not limited per agent
+	other.Header.Del("Authorization")
+	assert.Empty(t, limitKeyFunc(config.LimitByAgentID)(other))
+
+	r = httptest.NewRequest("GET", "/api/status", nil)
+	assert.Empty(t, limitKeyFunc(config.LimitByAgentID)(r))
+	assert.Empty(t, limitKeyFunc(config.LimitByAPIKeyID)(r))
+}
+
+func TestRouteFilter(t *testing.T) {
+	handler := routeFilter([]string{config.RouteGroupEnroll, config.RouteGroupStatus})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/api/status", http.StatusOK},
+		{"/api/fleet/agents/some-id", http.StatusOK},
+		{"/api/fleet/agents/some-id/checkin", http.StatusNotFound},
+		{"/api/fleet/agents/some-id/acks", http.StatusNotFound},
+		{"/api/fleet/artifacts/some-id/hash", http.StatusNotFound},
+		{"/api/fleet/uploads/some-id/0", http.StatusNotFound},
+		{"/api/internal/cache", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
@@ -11,30 +11,39 @@ import (
 	slog "log"
 	"net"
 	"net/http"
+	"os"
+	"time"
 
-	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 	"github.com/elastic/fleet-server/v7/internal/pkg/build"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
 	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
+	"github.com/elastic/fleet-server/v7/internal/pkg/proxy"
 	"go.elastic.co/apm/v2"
 
 	"github.com/rs/zerolog/log"
 )
 
 type server struct {
-	cfg     *config.Server
-	addr    string
-	handler http.Handler
+	cfg      *config.Server
+	network  string
+	addr     string
+	routes   []string
+	handler  http.Handler
+	limiter  *limiter
+	internal []InternalRoute
+	latency  *limit.LatencySignal
+	tls      *TLSReloader
+	targets  *logger.Targets
 }
 
 // NewServer creates a new HTTP api for the passed addr.
 //
 // The server has a listener specific conn limit and endpoint specific rate-limits.
 // The underlying API structs (such as *CheckinT) may be shared between servers.
-func NewServer(addr string, cfg *config.Server, ct *CheckinT, et *EnrollerT, at *ArtifactT, ack *AckT, st *StatusT, sm policy.SelfMonitor, bi build.Info, ut *UploadT, bulker bulk.Bulk, tracer *apm.Tracer) *server {
+func NewServer(addr string, cfg *config.Server, ct *CheckinT, et *EnrollerT, at *ArtifactT, ack *AckT, st *StatusT, sm policy.SelfMonitor, bi build.Info, ut *UploadT, bulker bulk.Bulk, tracer *apm.Tracer, opts ...ServerOpt) *server {
 	a := &apiServer{
 		ct:     ct,
 		et:     et,
@@ -46,11 +55,27 @@ func NewServer(addr string, cfg *config.Server, ct *CheckinT, et *EnrollerT, at
 		ut:     ut,
 		bulker: bulker,
 	}
-	return &server{
-		addr:    addr,
-		cfg:     cfg,
-		handler: newRouter(&cfg.Limits, a, tracer),
+	s := &server{
+		addr: addr,
+		cfg:  cfg,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	// trusted proxies are validated when the configuration is loaded, none are trusted otherwise
+	trusted, err := config.ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		log.Error().Err(err).Msg("ignoring invalid trusted proxies")
+	}
+	s.limiter = Limiter(&cfg.Limits, s.latency)
+	s.handler = newRouter(s.limiter, s.routes, trusted, s.targets, a, tracer, s.internal...)
+	return s
+}
+
+// Reconfigure applies the route limits of cfg to the following requests.
+// Listener settings such as the address, timeouts and TLS mode require a new server.
+func (s *server) Reconfigure(cfg *config.Server) {
+	s.limiter.Reconfigure(&cfg.Limits)
 }
 
 func (s *server) Run(ctx context.Context) error {
@@ -60,6 +85,29 @@ func (s *server) Run(ctx context.Context) error {
 	rdhr := s.cfg.Timeouts.ReadHeader
 	mhbz := s.cfg.Limits.MaxHeaderByteSize
 
+	tlsEnabled := s.cfg.TLS != nil && s.cfg.TLS.IsEnabled()
+	var certVerifier *certVerifier
+	if s.cfg.AgentCertAuth.Enabled {
+		if !tlsEnabled {
+			return errors.New("agent certificate authentication requires tls")
+		}
+		var err error
+		if certVerifier, err = newCertVerifier(&s.cfg.AgentCertAuth); err != nil {
+			return err
+		}
+	}
+
+	// Requests are not cancelled with ctx so that they can complete while the server drains,
+	// they are cancelled once the server is closed.
+	stopping := make(chan struct{})
+	draining := make(chan struct{})
+	baseReqCtx := withDrain(valuesContext{ctx}, stopping, draining)
+	if certVerifier != nil {
+		baseReqCtx = withCertVerifier(baseReqCtx, certVerifier)
+	}
+	reqCtx, cancelReq := context.WithCancel(baseReqCtx)
+	defer cancelReq()
+
 	srv := http.Server{
 		Addr:              s.addr,
 		Handler:           s.handler,
@@ -68,23 +116,25 @@ func (s *server) Run(ctx context.Context) error {
 		WriteTimeout:      wrto,
 		IdleTimeout:       idle,
 		MaxHeaderBytes:    mhbz,
-		BaseContext:       func(net.Listener) context.Context { return ctx },
+		BaseContext:       func(net.Listener) context.Context { return reqCtx },
 		ErrorLog:          errLogger(),
 		ConnState:         diagConn,
 	}
 
 	forceCh := make(chan struct{})
-	defer close(forceCh)
+	closedCh := make(chan struct{})
+	defer func() {
+		close(forceCh)
+		<-closedCh
+	}()
 
 	// handler to close server
 	go func() {
+		defer close(closedCh)
 		select {
 		case <-ctx.Done():
-			log.Debug().Msg("force server close on ctx.Done()")
-			err := srv.Close()
-			if err != nil {
-				log.Error().Err(err).Msg("error while closing server")
-			}
+			s.shutdown(&srv, stopping, draining)
+			cancelReq()
 		case <-forceCh:
 			log.Debug().Msg("go routine forced closed on exit")
 		}
@@ -92,7 +142,14 @@ func (s *server) Run(ctx context.Context) error {
 
 	var listenCfg net.ListenConfig
 
-	ln, err := listenCfg.Listen(ctx, "tcp", s.addr)
+	network := s.network
+	switch network {
+	case "":
+		network = "tcp"
+	case "unix":
+		removeStaleSocket(s.addr)
+	}
+	ln, err := listenCfg.Listen(ctx, network, s.addr)
 	if err != nil {
 		return err
 	}
@@ -104,28 +161,46 @@ func (s *server) Run(ctx context.Context) error {
 		}
 	}()
 
+	// The PROXY header is read first, so that the conn limiter and the TLS listener see the
+	// address of the client.
+	if pp := s.cfg.ProxyProtocol; pp.Enabled {
+		trusted, err := config.ParseNetworks(pp.Trusted)
+		if err != nil {
+			return err
+		}
+		log.Info().Strs("trusted", pp.Trusted).Msg("proxy protocol enabled")
+		ln = proxy.Listener(ln, trusted, pp.HeaderTimeout)
+	}
+
 	// Conn Limiter must be before the TLS handshake in the stack;
 	// The server should not eat the cost of the handshake if there
 	// is no capacity to service the connection.
 	// Also, it appears the HTTP2 implementation depends on the tls.Listener
 	// being at the top of the stack.
-	ln = wrapConnLimitter(ctx, ln, s.cfg)
+	ln, err = wrapConnLimitter(ctx, ln, s.cfg)
+	if err != nil {
+		return err
+	}
 
-	if s.cfg.TLS != nil && s.cfg.TLS.IsEnabled() {
-		commonTLSCfg, err := tlscommon.LoadTLSServerConfig(s.cfg.TLS)
-		if err != nil {
-			return err
+	if tlsEnabled {
+		// Certificates are resolved on every handshake so that they can be replaced without restarting the listener.
+		reloader := s.tls
+		if reloader == nil {
+			reloader, err = NewTLSReloader(s.cfg.TLS, s.cfg.Host)
+			if err != nil {
+				return err
+			}
+			go reloader.Run(ctx, s.cfg.TLSReloadInterval) //nolint:errcheck // always returns nil
+		}
+		srv.TLSConfig = reloader.ServerConfig()
+		if certVerifier != nil {
+			srv.TLSConfig = requestClientCert(srv.TLSConfig)
 		}
-		srv.TLSConfig = commonTLSCfg.BuildServerConfig(s.cfg.Host)
-
-		// Must enable http/2 in the configuration explicitly.
-		// (see https://golang.org/pkg/net/http/#Server.Serve)
-		srv.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
 
 		ln = tls.NewListener(ln, srv.TLSConfig)
 
 	} else {
-		log.Warn().Msg("Exposed over insecure HTTP; enablement of TLS is strongly recommended")
+		log.Warn().Msg("Exposed over insecure HTTP; enablement of TLS is strongly recommended, ssl_bootstrap generates certificates when none are available")
 	}
 
 	errCh := make(chan error)
@@ -145,11 +220,62 @@ func (s *server) Run(ctx context.Context) error {
 			return err
 		}
 	case <-baseCtx.Done():
+		// the listener is kept open until the server drained
+		<-closedCh
 	}
 
 	return nil
 }
 
+// shutdown stops the server once its context is cancelled. If a pre-drain delay is configured, the
+// server reports that it is stopping for that delay while it keeps accepting connections and serving
+// the pending checkins, so that the load balancers probing its status stop routing to it first. If a
+// drain deadline is configured, the server then stops accepting connections, pending checkins are
+// answered early and the requests in flight are given until the deadline to complete before the
+// connections are closed.
+func (s *server) shutdown(srv *http.Server, stopping, draining chan struct{}) {
+	close(stopping)
+	if delay := s.cfg.Timeouts.PreDrain; delay > 0 {
+		log.Info().Str("addr", s.addr).Dur("delay", delay).Msg("reporting server as stopping")
+		time.Sleep(delay)
+	}
+
+	deadline := s.cfg.Timeouts.Drain
+	if deadline <= 0 {
+		log.Debug().Msg("force server close on ctx.Done()")
+		if err := srv.Close(); err != nil {
+			log.Error().Err(err).Msg("error while closing server")
+		}
+		return
+	}
+
+	log.Info().Str("addr", s.addr).Dur("deadline", deadline).Msg("draining server")
+	close(draining)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Str("addr", s.addr).Msg("drain deadline reached, closing remaining connections")
+		if err := srv.Close(); err != nil {
+			log.Error().Err(err).Msg("error while closing server")
+		}
+		return
+	}
+	log.Info().Str("addr", s.addr).Msg("server drained")
+}
+
+// removeStaleSocket removes the unix socket left at path by a server that did not exit cleanly,
+// the listener would fail to bind otherwise.
+func removeStaleSocket(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Warn().Err(err).Str("socket", path).Msg("unable to remove stale socket")
+	}
+}
+
 func diagConn(c net.Conn, s http.ConnState) {
 	if c == nil {
 		return
@@ -169,7 +295,21 @@ func diagConn(c net.Conn, s http.ConnState) {
 	}
 }
 
-func wrapConnLimitter(_ context.Context, ln net.Listener, cfg *config.Server) net.Listener {
+func wrapConnLimitter(_ context.Context, ln net.Listener, cfg *config.Server) (net.Listener, error) {
+	// Connections over the source limits do not count towards the hard limit.
+	if sourceLimit := &cfg.Limits.SourceConnections; sourceLimit.Enabled() {
+		log.Info().
+			Int("max", sourceLimit.Max).
+			Dur("interval", sourceLimit.Interval).
+			Strs("allow", sourceLimit.Allow).
+			Msg("server source connection limiter installed")
+
+		var err error
+		if ln, err = limit.SourceListener(ln, sourceLimit, cntConnRejected.IncReject); err != nil {
+			return nil, err
+		}
+	}
+
 	hardLimit := cfg.Limits.MaxConnections
 
 	if hardLimit != 0 {
@@ -177,12 +317,12 @@ func wrapConnLimitter(_ context.Context, ln net.Listener, cfg *config.Server) ne
 			Int("hardConnLimit", hardLimit).
 			Msg("server hard connection limiter installed")
 
-		ln = limit.Listener(ln, hardLimit)
+		ln = limit.Listener(ln, hardLimit, cntConnRejected.IncReject)
 	} else {
 		log.Info().Msg("server hard connection limiter disabled")
 	}
 
-	return ln
+	return ln, nil
 }
 
 type stubLogger struct {
@@ -9,7 +9,9 @@ package api
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -71,3 +73,208 @@ func Test_server_Run(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func Test_server_RunUnixSocket(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	path := filepath.Join(t.TempDir(), "fleet-server.sock")
+	// a socket left by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	srv := &server{
+		network: "unix",
+		addr:    path,
+		cfg:     cfg,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(ctx)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	require.Eventually(t, func() bool {
+		resp, err := client.Get("http://fleet-server/api/status") //nolint:noctx // test request
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusNoContent
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-runErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit")
+	}
+}
+
+func Test_server_Drain(t *testing.T) {
+	port, err := ftesting.FreePort()
+	require.NoError(t, err)
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.Host = "localhost"
+	cfg.Port = port
+	cfg.Timeouts.Drain = 5 * time.Second
+	addr := cfg.BindEndpoints()[0]
+
+	started := make(chan struct{}, 2)
+	srv := &server{
+		addr: addr,
+		cfg:  cfg,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			switch r.URL.Path {
+			case "/poll":
+				// pending long polls are answered early
+				<-draining(r.Context())
+				setDrainRetryAfter(w)
+			case "/upload":
+				// requests in flight complete after the server context is cancelled
+				<-draining(r.Context())
+				time.Sleep(100 * time.Millisecond)
+				if r.Context().Err() != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(ctx)
+	}()
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	request := func(path string) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			resp, err := http.Get("http://" + addr + path) //nolint:noctx // test request
+			if err == nil {
+				resp.Body.Close()
+			}
+			ch <- result{resp, err}
+		}()
+		return ch
+	}
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	poll := request("/poll")
+	upload := request("/upload")
+	<-started
+	<-started
+	cancel()
+
+	res := <-poll
+	require.NoError(t, res.err)
+	require.Equal(t, http.StatusOK, res.resp.StatusCode)
+	require.NotEmpty(t, res.resp.Header.Get("Retry-After"))
+
+	res = <-upload
+	require.NoError(t, res.err)
+	require.Equal(t, http.StatusOK, res.resp.StatusCode)
+
+	select {
+	case err := <-runErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit after draining")
+	}
+
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err, "server must not accept connections after draining")
+}
+
+func Test_server_PreDrain(t *testing.T) {
+	port, err := ftesting.FreePort()
+	require.NoError(t, err)
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.Host = "localhost"
+	cfg.Port = port
+	cfg.Timeouts.PreDrain = 2 * time.Second
+	addr := cfg.BindEndpoints()[0]
+
+	srv := &server{
+		addr: addr,
+		cfg:  cfg,
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case isDraining(r.Context()):
+				w.WriteHeader(http.StatusGone)
+			case isStopping(r.Context()):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(ctx)
+	}()
+
+	status := func() int {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get("http://" + addr + "/api/status") //nolint:noctx // test request
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Eventually(t, func() bool {
+		return status() == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// new connections are accepted and reported as stopping during the pre-drain delay, the long
+	// polls are only ended once the server drains
+	cancel()
+	require.Eventually(t, func() bool {
+		return status() == http.StatusServiceUnavailable
+	}, 500*time.Millisecond, 10*time.Millisecond)
+	require.Never(t, func() bool {
+		return status() != http.StatusServiceUnavailable
+	}, 300*time.Millisecond, 50*time.Millisecond)
+
+	select {
+	case err := <-runErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not exit after draining")
+	}
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err, "server must not accept connections after draining")
+}
@@ -0,0 +1,154 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/rs/zerolog/log"
+)
+
+// TLSReloader serves the TLS configuration of the API servers to every new handshake.
+//
+// The configuration is reloaded when the content of the certificate, key or CA files changes on
+// disk, or when a new configuration is set with Update. Established connections are not affected.
+type TLSReloader struct {
+	host string
+
+	mut         sync.Mutex // serializes reloads
+	cfg         *tlscommon.ServerConfig
+	fingerprint []byte
+
+	current atomic.Pointer[tls.Config]
+}
+
+// NewTLSReloader loads the TLS configuration cfg of the servers bound to host.
+func NewTLSReloader(cfg *tlscommon.ServerConfig, host string) (*TLSReloader, error) {
+	r := &TLSReloader{host: host}
+	if err := r.Update(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update loads and serves the TLS configuration cfg.
+// The previous configuration remains in use if cfg can not be loaded.
+func (r *TLSReloader) Update(cfg *tlscommon.ServerConfig) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	fingerprint, err := tlsFingerprint(cfg)
+	if err != nil {
+		return err
+	}
+	return r.load(cfg, fingerprint)
+}
+
+// load must be called with mut held.
+func (r *TLSReloader) load(cfg *tlscommon.ServerConfig, fingerprint []byte) error {
+	commonTLSCfg, err := tlscommon.LoadTLSServerConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if commonTLSCfg == nil {
+		return errors.New("tls is not enabled")
+	}
+	tlsCfg := commonTLSCfg.BuildServerConfig(r.host)
+
+	// Must enable http/2 in the configuration explicitly.
+	// (see https://golang.org/pkg/net/http/#Server.Serve)
+	tlsCfg.NextProtos = []string{"h2", "http/1.1"}
+
+	r.cfg = cfg
+	r.fingerprint = fingerprint
+	r.current.Store(tlsCfg)
+	return nil
+}
+
+// ServerConfig returns the TLS configuration of a listener, it resolves the configuration
+// served by the reloader on every handshake.
+func (r *TLSReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS11, // overridden by the configuration returned for the client
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Run checks the certificate and CA files for changes every interval, until ctx is cancelled.
+// Files are not checked if interval is not positive.
+func (r *TLSReloader) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			r.reload()
+		}
+	}
+}
+
+// reload loads the configuration again if the content of its files changed.
+func (r *TLSReloader) reload() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	fingerprint, err := tlsFingerprint(r.cfg)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to read tls files, keeping the current certificates")
+		return
+	}
+	if bytes.Equal(fingerprint, r.fingerprint) {
+		return
+	}
+	if err := r.load(r.cfg, fingerprint); err != nil {
+		log.Error().Err(err).Msg("unable to reload tls configuration, keeping the current certificates")
+		return
+	}
+	log.Info().Msg("tls certificates reloaded")
+}
+
+// tlsFingerprint returns the hash of the content of the files referenced by the TLS configuration.
+// Certificates given inline as PEM are part of the configuration and change with it.
+func tlsFingerprint(cfg *tlscommon.ServerConfig) ([]byte, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	files := make([]string, 0, len(cfg.CAs)+3)
+	files = append(files, cfg.CAs...)
+	files = append(files, cfg.Certificate.Certificate, cfg.Certificate.Key, cfg.Certificate.PassphrasePath)
+
+	h := sha256.New()
+	for _, f := range files {
+		if f == "" || tlscommon.IsPEMString(f) {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", f, err)
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	return h.Sum(nil), nil
+}
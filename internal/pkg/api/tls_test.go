@@ -0,0 +1,122 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate for localhost and its key to dir.
+func writeTestCert(t *testing.T, dir, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "server.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "server.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	require.NoError(t, err)
+}
+
+func servedCommonName(t *testing.T, r *TLSReloader) string {
+	t.Helper()
+	cfg, err := r.ServerConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Len(t, cfg.Certificates, 1)
+	cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return cert.Subject.CommonName
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCert(t, dir, "first")
+
+	enabled := true
+	cfg := &tlscommon.ServerConfig{
+		Enabled: &enabled,
+		Certificate: tlscommon.CertificateConfig{
+			Certificate: filepath.Join(dir, "server.crt"),
+			Key:         filepath.Join(dir, "server.key"),
+		},
+	}
+	r, err := NewTLSReloader(cfg, "localhost")
+	require.NoError(t, err)
+	require.Equal(t, "first", servedCommonName(t, r))
+
+	t.Run("unchanged files", func(t *testing.T) {
+		before := r.current.Load()
+		r.reload()
+		require.Same(t, before, r.current.Load())
+	})
+
+	t.Run("rotated files", func(t *testing.T) {
+		writeTestCert(t, dir, "second")
+		r.reload()
+		require.Equal(t, "second", servedCommonName(t, r))
+	})
+
+	t.Run("invalid files keep the current certificate", func(t *testing.T) {
+		err := os.WriteFile(filepath.Join(dir, "server.key"), []byte("not a key"), 0o600)
+		require.NoError(t, err)
+		r.reload()
+		require.Equal(t, "second", servedCommonName(t, r))
+
+		err = os.Remove(filepath.Join(dir, "server.crt"))
+		require.NoError(t, err)
+		r.reload()
+		require.Equal(t, "second", servedCommonName(t, r))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		other := t.TempDir()
+		writeTestCert(t, other, "third")
+		err := r.Update(&tlscommon.ServerConfig{
+			Enabled: &enabled,
+			Certificate: tlscommon.CertificateConfig{
+				Certificate: filepath.Join(other, "server.crt"),
+				Key:         filepath.Join(other, "server.key"),
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "third", servedCommonName(t, r))
+
+		err = r.Update(&tlscommon.ServerConfig{
+			Enabled:     &enabled,
+			Certificate: tlscommon.CertificateConfig{Certificate: filepath.Join(dir, "missing.crt")},
+		})
+		require.Error(t, err)
+		require.Equal(t, "third", servedCommonName(t, r))
+	})
+}
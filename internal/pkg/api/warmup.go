@@ -0,0 +1,178 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+// CacheWarmer preloads the cache on startup so that the first wave of
+// requests after a restart does not miss on every entry at once.
+//
+// Active enrollment keys, the artifacts referenced by the policies and the
+// access API key ids of the most recently checked in agents are loaded.
+// API key validations themselves are not preloaded; validating a key requires
+// its secret, which is only ever presented by the agent itself. Preloading the
+// agent of the key ids lets their first authentication read the agent by id
+// instead of searching for it.
+type CacheWarmer struct {
+	cfg    config.CacheWarmup
+	bulker bulk.Bulk
+	cache  cache.Cache
+	done   chan struct{}
+}
+
+// NewCacheWarmer creates a new cache warmer.
+func NewCacheWarmer(cfg config.CacheWarmup, bulker bulk.Bulk, c cache.Cache) *CacheWarmer {
+	return &CacheWarmer{
+		cfg:    cfg,
+		bulker: bulker,
+		cache:  c,
+		done:   make(chan struct{}),
+	}
+}
+
+// Run preloads the cache and marks the warmer as ready once done.
+//
+// Warm-up is best effort; failures are logged and do not stop the server.
+func (w *CacheWarmer) Run(ctx context.Context) error {
+	defer close(w.done)
+	if !w.cfg.Enabled {
+		return nil
+	}
+
+	zlog := log.With().Str("ctx", "cache warmup").Logger()
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+
+	keys := w.warmEnrollmentKeys(ctx, zlog)
+	artifacts := w.warmArtifacts(ctx, zlog)
+	apiKeys := w.warmAPIKeys(ctx, zlog)
+
+	zlog.Info().
+		Int("enrollment_keys", keys).
+		Int("artifacts", artifacts).
+		Int("api_keys", apiKeys).
+		Dur("duration", time.Since(start)).
+		Msg("cache warmup complete")
+	return nil
+}
+
+// Ready returns true once warm-up has completed or is disabled.
+func (w *CacheWarmer) Ready() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *CacheWarmer) warmEnrollmentKeys(ctx context.Context, zlog zerolog.Logger) int {
+	recs, err := dl.FindActiveEnrollmentAPIKeys(ctx, w.bulker, w.cfg.EnrollmentKeys)
+	if err != nil {
+		zlog.Warn().Err(err).Msg("unable to preload enrollment keys")
+		return 0
+	}
+	for _, rec := range recs {
+		// mirror the cost used by the enroll handler
+		w.cache.SetEnrollmentAPIKey(rec.APIKeyID, rec, int64(len(rec.APIKey)))
+	}
+	return len(recs)
+}
+
+// warmArtifacts loads the artifacts referenced by the artifact manifests of the latest policy
+// revisions; those are the artifacts that agents download, and so that are served, after a restart.
+func (w *CacheWarmer) warmArtifacts(ctx context.Context, zlog zerolog.Logger) int {
+	policies, err := dl.QueryLatestPolicies(ctx, w.bulker)
+	if err != nil {
+		zlog.Warn().Err(err).Msg("unable to preload artifacts")
+		return 0
+	}
+	n := 0
+	for _, ref := range policyArtifacts(zlog, policies, w.cfg.Artifacts) {
+		art, err := dl.FindArtifact(ctx, w.bulker, ref.ident, ref.sha2)
+		if err != nil {
+			zlog.Debug().Err(err).Str("ident", ref.ident).Str("sha2", ref.sha2).Msg("unable to preload artifact")
+			continue
+		}
+		if err := decodeArtifact(zlog, art); err != nil {
+			continue
+		}
+		w.cache.SetArtifact(*art)
+		n++
+	}
+	return n
+}
+
+func (w *CacheWarmer) warmAPIKeys(ctx context.Context, zlog zerolog.Logger) int {
+	agents, err := dl.FindRecentAgents(ctx, w.bulker, w.cfg.APIKeys)
+	if err != nil {
+		zlog.Warn().Err(err).Msg("unable to preload api key ids")
+		return 0
+	}
+	n := 0
+	for _, agent := range agents {
+		if agent.AccessAPIKeyID == "" {
+			continue
+		}
+		w.cache.SetAPIKeyAgent(agent.AccessAPIKeyID, agent.Id)
+		n++
+	}
+	return n
+}
+
+type artifactRef struct {
+	ident string
+	sha2  string
+}
+
+// policyArtifacts returns up to size distinct artifacts referenced by the inputs of the policies.
+func policyArtifacts(zlog zerolog.Logger, policies []model.Policy, size int) []artifactRef {
+	var refs []artifactRef
+	seen := make(map[artifactRef]bool)
+	for _, p := range policies {
+		var data struct {
+			Inputs []struct {
+				ArtifactManifest struct {
+					Artifacts map[string]struct {
+						DecodedSha256 string `json:"decoded_sha256"`
+					} `json:"artifacts"`
+				} `json:"artifact_manifest"`
+			} `json:"inputs"`
+		}
+		if err := json.Unmarshal(p.Data, &data); err != nil {
+			zlog.Debug().Err(err).Str(LogPolicyID, p.PolicyID).Msg("unable to parse policy artifacts")
+			continue
+		}
+		for _, input := range data.Inputs {
+			for ident, art := range input.ArtifactManifest.Artifacts {
+				ref := artifactRef{ident: ident, sha2: art.DecodedSha256}
+				if ref.sha2 == "" || seen[ref] {
+					continue
+				}
+				if len(refs) == size {
+					return refs
+				}
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
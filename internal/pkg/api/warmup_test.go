@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+func TestPolicyArtifacts(t *testing.T) {
+	policies := []model.Policy{{
+		PolicyID: "p1",
+		Data: []byte(`{"inputs":[{"type":"endpoint","artifact_manifest":{"artifacts":{
+			"endpoint-trustlist-linux-v1":{"decoded_sha256":"aaa"},
+			"endpoint-exceptionlist-linux-v1":{"decoded_sha256":"bbb"}}}},{"type":"logfile"}]}`),
+	}, {
+		PolicyID: "p2",
+		Data:     []byte(`{"inputs":[{"type":"endpoint","artifact_manifest":{"artifacts":{"endpoint-trustlist-linux-v1":{"decoded_sha256":"aaa"}}}}]}`),
+	}, {
+		PolicyID: "p3",
+		Data:     []byte(`not json`),
+	}}
+
+	refs := policyArtifacts(testlog.SetLogger(t), policies, 10)
+	assert.ElementsMatch(t, []artifactRef{
+		{ident: "endpoint-trustlist-linux-v1", sha2: "aaa"},
+		{ident: "endpoint-exceptionlist-linux-v1", sha2: "bbb"},
+	}, refs, "artifacts are deduplicated across policies")
+
+	assert.Len(t, policyArtifacts(testlog.SetLogger(t), policies, 1), 1)
+}
+
+func TestFindAgentByAPIKeyIDCached(t *testing.T) {
+	c, err := cache.New(config.Cache{NumCounters: 100, MaxCost: 100000, APIKeyTTL: time.Minute})
+	require.NoError(t, err)
+	c.SetAPIKeyAgent("key-id", "agent-id")
+	require.Eventually(t, func() bool {
+		_, ok := c.GetAPIKeyAgent("key-id")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Read", mock.Anything, dl.FleetAgents, "agent-id", mock.Anything).
+		Return([]byte(`{"access_api_key_id":"key-id","active":true}`), nil).Once()
+
+	agent, err := findAgentByAPIKeyID(context.Background(), bulker, c, "key-id")
+	require.NoError(t, err)
+	assert.Equal(t, "agent-id", agent.Id)
+	assert.Equal(t, "key-id", agent.AccessAPIKeyID)
+	bulker.AssertExpectations(t)
+}
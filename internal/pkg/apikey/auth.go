@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
@@ -16,6 +17,9 @@ import (
 
 var (
 	ErrUnauthorized = errors.New("unauthorized")
+	// ErrCredentialsRejected is returned together with ErrUnauthorized when
+	// Elasticsearch rejects the key itself, rather than failing to process the request.
+	ErrCredentialsRejected = errors.New("credentials rejected")
 )
 
 // SecurityInfo contains all related information about an APIKey that Elasticsearch tracks.
@@ -50,6 +54,10 @@ func (k APIKey) Authenticate(ctx context.Context, es *elasticsearch.Client) (*Se
 		defer res.Body.Close()
 	}
 
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, fmt.Errorf("%w: apikey auth response %s: %s", ErrCredentialsRejected, k.ID, res.String()))
+	}
+
 	if res.IsError() {
 		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, fmt.Errorf("apikey auth response %s: %s", k.ID, res.String()))
 	}
@@ -0,0 +1,349 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package audit writes the security events of fleet-server, such as enrollments, API key changes
+// and failed authentications, to a dedicated ECS log.
+//
+// Every event holds the hash of the previous one and its own hash in event.hash, so that the
+// modification, insertion or removal of events breaks the chain, see Verify. The hashes are
+// HMAC-SHA256 of the events when a key is configured, so that the chain can not be rewritten
+// without the key; without key they are SHA-256 and someone with write access to the log can
+// rewrite the whole chain. The chain starts again, with an audit-chain-break event, when the
+// last event of the log can not be read on start.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/build"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Actions of the audit events.
+const (
+	ActionAgentEnroll       = "agent-enroll"
+	ActionAgentUnenroll     = "agent-unenroll"
+	ActionAPIKeyCreate      = "api-key-create"
+	ActionAPIKeyInvalidate  = "api-key-invalidate"
+	ActionAuthenticate      = "authenticate"
+	ActionArtifactAuthorize = "artifact-authorize"
+	ActionAuditStart        = "audit-start"
+	ActionAuditChainBreak   = "audit-chain-break"
+)
+
+// categories are the ECS event.category and event.type of the actions.
+var categories = map[string][2]string{
+	ActionAgentEnroll:       {"iam", "creation"},
+	ActionAgentUnenroll:     {"iam", "deletion"},
+	ActionAPIKeyCreate:      {"iam", "creation"},
+	ActionAPIKeyInvalidate:  {"iam", "deletion"},
+	ActionAuthenticate:      {"authentication", "info"},
+	ActionArtifactAuthorize: {"web", "access"},
+	ActionAuditStart:        {"configuration", "start"},
+	ActionAuditChainBreak:   {"configuration", "info"},
+}
+
+const (
+	ecsVersion = "1.6.0"
+	dataset    = "fleet_server.audit"
+	hashField  = "event.hash"
+)
+
+var (
+	ErrChainBroken = errors.New("audit log hash chain broken")
+	errClosed      = errors.New("audit log closed")
+)
+
+// Event is a security event. The client of the request, if any, is added from the context, see
+// Middleware.
+type Event struct {
+	Action   string
+	Outcome  string
+	Message  string
+	Err      error
+	AgentID  string
+	PolicyID string
+	// EnrollAPIKeyID is the id of the enrollment API key used to enroll the agent.
+	EnrollAPIKeyID string
+	APIKeyIDs      []string
+	OutputName     string
+	// CertIdentity is the identity of the client certificate bound to the agent.
+	CertIdentity string
+}
+
+// WithErr returns the event with the failure outcome and err, or the success outcome if err is nil.
+func (e Event) WithErr(err error) Event {
+	if err != nil {
+		e.Outcome, e.Err = OutcomeFailure, err
+	} else {
+		e.Outcome = OutcomeSuccess
+	}
+	return e
+}
+
+// record is the ECS document of an event; event.hash is appended to it.
+type record struct {
+	Timestamp      string   `json:"@timestamp"`
+	Level          string   `json:"log.level"`
+	Message        string   `json:"message,omitempty"`
+	ECSVersion     string   `json:"ecs.version"`
+	Service        string   `json:"service.name"`
+	Kind           string   `json:"event.kind"`
+	Category       []string `json:"event.category,omitempty"`
+	Type           []string `json:"event.type,omitempty"`
+	Action         string   `json:"event.action"`
+	Outcome        string   `json:"event.outcome,omitempty"`
+	Dataset        string   `json:"event.dataset"`
+	Sequence       uint64   `json:"event.sequence"`
+	Error          string   `json:"error.message,omitempty"`
+	ClientIP       string   `json:"client.ip,omitempty"`
+	UserAgent      string   `json:"user_agent.original,omitempty"`
+	RequestID      string   `json:"http.request.id,omitempty"`
+	AgentID        string   `json:"fleet.agent.id,omitempty"`
+	PolicyID       string   `json:"fleet.policy.id,omitempty"`
+	EnrollAPIKeyID string   `json:"fleet.enroll.apikey.id,omitempty"`
+	APIKeyIDs      []string `json:"fleet.apikey.id,omitempty"`
+	OutputName     string   `json:"fleet.output.name,omitempty"`
+	CertIdentity   string   `json:"fleet.agent.client_certificate_identity,omitempty"`
+	PrevHash       string   `json:"fleet.audit.prev_hash"`
+}
+
+// Auditor writes the events to the audit log.
+type Auditor struct {
+	mut      sync.Mutex
+	w        io.Writer
+	closer   io.Closer
+	key      []byte
+	seq      uint64
+	prevHash string
+	closed   bool
+	now      func() time.Time
+}
+
+// NewWriter returns an auditor writing the events to w, following the chain of the event with
+// the sequence number and hash; both are empty for a new log. The events are hashed with the HMAC
+// key, if any.
+func NewWriter(w io.Writer, key []byte, seq uint64, prevHash string) *Auditor {
+	a := &Auditor{
+		w:        w,
+		key:      key,
+		seq:      seq,
+		prevHash: prevHash,
+		now:      time.Now,
+	}
+	if c, ok := w.(io.Closer); ok {
+		a.closer = c
+	}
+	return a
+}
+
+// Log writes the event to the audit log.
+func (a *Auditor) Log(ctx context.Context, e Event) error {
+	rec := record{
+		Level:          "info",
+		Message:        e.Message,
+		ECSVersion:     ecsVersion,
+		Service:        build.ServiceName,
+		Kind:           "event",
+		Action:         e.Action,
+		Outcome:        e.Outcome,
+		Dataset:        dataset,
+		AgentID:        e.AgentID,
+		PolicyID:       e.PolicyID,
+		EnrollAPIKeyID: e.EnrollAPIKeyID,
+		APIKeyIDs:      e.APIKeyIDs,
+		OutputName:     e.OutputName,
+		CertIdentity:   e.CertIdentity,
+	}
+	if c, ok := categories[e.Action]; ok {
+		rec.Category, rec.Type = []string{c[0]}, []string{c[1]}
+	}
+	if e.Outcome == OutcomeFailure {
+		rec.Level = "warn"
+	}
+	if e.Err != nil {
+		rec.Error = e.Err.Error()
+	}
+	if req, ok := ctx.Value(requestKey{}).(requestInfo); ok {
+		rec.ClientIP, rec.UserAgent, rec.RequestID = req.clientIP, req.userAgent, req.requestID
+	}
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if a.closed {
+		return errClosed
+	}
+	rec.Timestamp = a.now().UTC().Format(time.RFC3339Nano)
+	rec.Sequence = a.seq + 1
+	rec.PrevHash = a.prevHash
+	line, hash, err := encode(&rec, a.key)
+	if err != nil {
+		return err
+	}
+	if _, err := a.w.Write(line); err != nil {
+		return fmt.Errorf("audit log write: %w", err)
+	}
+	a.seq, a.prevHash = rec.Sequence, hash
+	return nil
+}
+
+// Close closes the audit log, the following events are not written.
+func (a *Auditor) Close() error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	a.closed = true
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// chain returns the sequence number and hash of the last event.
+func (a *Auditor) chain() (uint64, string) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	return a.seq, a.prevHash
+}
+
+// encode returns the line of the record with its hash, and the hash.
+func encode(rec *record, key []byte) ([]byte, string, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, "", fmt.Errorf("audit event marshal: %w", err)
+	}
+	hash := sum(data, key)
+	line := make([]byte, 0, len(data)+len(hash)+len(hashField)+8)
+	line = append(line, data[:len(data)-1]...)
+	line = append(line, `,"`+hashField+`":"`+hash+`"}`+"\n"...)
+	return line, hash, nil
+}
+
+// sum returns the hex HMAC-SHA256 of data with key, or its SHA-256 without key.
+func sum(data, key []byte) string {
+	if len(key) == 0 {
+		s := sha256.Sum256(data)
+		return hex.EncodeToString(s[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the hash chain of the events read from r with the HMAC key the events were written
+// with, if any. The first event may follow events that are not read. It returns the sequence number
+// and hash of the last event.
+func Verify(r io.Reader, key []byte) (uint64, string, error) {
+	dec := json.NewDecoder(r)
+	var seq uint64
+	var prevHash string
+	for first := true; ; first = false {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+			return seq, prevHash, nil
+		} else if err != nil {
+			return seq, prevHash, err
+		}
+		var fields struct {
+			Sequence uint64 `json:"event.sequence"`
+			PrevHash string `json:"fleet.audit.prev_hash"`
+			Hash     string `json:"event.hash"`
+		}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return seq, prevHash, err
+		}
+		suffix := `,"` + hashField + `":"` + fields.Hash + `"}`
+		if len(raw) < len(suffix) || string(raw[len(raw)-len(suffix):]) != suffix {
+			return seq, prevHash, fmt.Errorf("%w: event %d has no hash", ErrChainBroken, fields.Sequence)
+		}
+		if !hmac.Equal([]byte(sum(append(raw[:len(raw)-len(suffix):len(raw)-len(suffix)], '}'), key)), []byte(fields.Hash)) {
+			return seq, prevHash, fmt.Errorf("%w: event %d was modified", ErrChainBroken, fields.Sequence)
+		}
+		if !first && (fields.PrevHash != prevHash || fields.Sequence != seq+1) {
+			return seq, prevHash, fmt.Errorf("%w: event %d does not follow event %d", ErrChainBroken, fields.Sequence, seq)
+		}
+		seq, prevHash = fields.Sequence, fields.Hash
+	}
+}
+
+// std is the auditor of the process, nil if the audit log is disabled.
+var std atomic.Pointer[Auditor]
+
+var (
+	configMut sync.Mutex
+	current   config.Audit
+)
+
+// Configure opens the audit log of cfg, or closes it if the audit log is disabled. The chain of
+// events continues in the new log. It does nothing if the configuration did not change.
+func Configure(cfg *config.Audit) error {
+	configMut.Lock()
+	defer configMut.Unlock()
+
+	prev := std.Load()
+	if prev != nil && current == *cfg {
+		return nil
+	}
+	if !cfg.Enabled {
+		current = *cfg
+		if prev != nil {
+			std.Store(nil)
+			return prev.Close()
+		}
+		return nil
+	}
+
+	a, err := open(cfg, prev)
+	if err != nil {
+		return err
+	}
+	current = *cfg
+	std.Store(a)
+	if prev != nil {
+		if err := prev.Close(); err != nil {
+			log.Warn().Err(err).Msg("fail to close the previous audit log")
+		}
+	}
+	return a.Log(context.Background(), Event{
+		Action:  ActionAuditStart,
+		Outcome: OutcomeSuccess,
+		Message: "Audit log started",
+	})
+}
+
+// Log writes the event to the audit log of the process, it does nothing if the audit log is
+// disabled. Errors are logged.
+func Log(ctx context.Context, e Event) {
+	for {
+		a := std.Load()
+		if a == nil {
+			return
+		}
+		err := a.Log(ctx, e)
+		if errors.Is(err, errClosed) {
+			// the audit log was reconfigured
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Str("event.action", e.Action).Msg("fail to write the audit log")
+		}
+		return
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+)
+
+func TestAuditorChain(t *testing.T) {
+	var b bytes.Buffer
+	a := NewWriter(&b, nil, 0, "")
+	ctx := context.Background()
+	require.NoError(t, a.Log(ctx, Event{Action: ActionAgentEnroll, Outcome: OutcomeSuccess, AgentID: "agent", EnrollAPIKeyID: "enroll"}))
+	require.NoError(t, a.Log(ctx, Event{Action: ActionAuthenticate, APIKeyIDs: []string{"key"}}.WithErr(errors.New("rejected"))))
+	require.NoError(t, a.Log(ctx, Event{Action: ActionAPIKeyInvalidate, APIKeyIDs: []string{"key"}}.WithErr(nil)))
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 3)
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &m))
+	assert.Equal(t, "authenticate", m["event.action"])
+	assert.Equal(t, "failure", m["event.outcome"])
+	assert.Equal(t, "warn", m["log.level"])
+	assert.Equal(t, "rejected", m["error.message"])
+	assert.Equal(t, []interface{}{"authentication"}, m["event.category"])
+	assert.Equal(t, float64(2), m["event.sequence"])
+
+	seq, hash, err := Verify(strings.NewReader(b.String()), nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	assert.Equal(t, a.prevHash, hash)
+
+	t.Run("modified", func(t *testing.T) {
+		modified := strings.Replace(b.String(), `"fleet.agent.id":"agent"`, `"fleet.agent.id":"other"`, 1)
+		_, _, err := Verify(strings.NewReader(modified), nil)
+		assert.ErrorIs(t, err, ErrChainBroken)
+	})
+	t.Run("removed", func(t *testing.T) {
+		removed := lines[0] + "\n" + lines[2] + "\n"
+		_, _, err := Verify(strings.NewReader(removed), nil)
+		assert.ErrorIs(t, err, ErrChainBroken)
+	})
+	t.Run("tail", func(t *testing.T) {
+		_, _, err := Verify(strings.NewReader(lines[1]+"\n"+lines[2]+"\n"), nil)
+		assert.NoError(t, err, "the first event may follow events that are not read")
+	})
+}
+
+func TestAuditorChainKey(t *testing.T) {
+	var b bytes.Buffer
+	key := []byte("audit-key")
+	a := NewWriter(&b, key, 0, "")
+	ctx := context.Background()
+	require.NoError(t, a.Log(ctx, Event{Action: ActionAgentEnroll, Outcome: OutcomeSuccess, AgentID: "agent"}))
+	require.NoError(t, a.Log(ctx, Event{Action: ActionAgentUnenroll, Outcome: OutcomeSuccess, AgentID: "agent"}))
+
+	seq, _, err := Verify(strings.NewReader(b.String()), key)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+
+	_, _, err = Verify(strings.NewReader(b.String()), []byte("other"))
+	assert.ErrorIs(t, err, ErrChainBroken, "the chain is verified with the key")
+	_, _, err = Verify(strings.NewReader(b.String()), nil)
+	assert.ErrorIs(t, err, ErrChainBroken)
+
+	// a chain rewritten without the key does not verify
+	var rewritten bytes.Buffer
+	w := NewWriter(&rewritten, nil, 0, "")
+	require.NoError(t, w.Log(ctx, Event{Action: ActionAgentEnroll, Outcome: OutcomeSuccess, AgentID: "other"}))
+	_, _, err = Verify(strings.NewReader(rewritten.String()), key)
+	assert.ErrorIs(t, err, ErrChainBroken)
+}
+
+func TestMiddleware(t *testing.T) {
+	var b bytes.Buffer
+	a := NewWriter(&b, nil, 0, "")
+	std.Store(a)
+	t.Cleanup(func() { std.Store(nil) })
+
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Log(r.Context(), Event{Action: ActionAgentEnroll, Outcome: OutcomeSuccess})
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/fleet/agents/enroll", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-Agent", "Elastic Agent v8.8.0")
+	req.Header.Set(logger.HeaderRequestID, "request")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &m))
+	assert.Equal(t, "192.0.2.1", m["client.ip"])
+	assert.Equal(t, "Elastic Agent v8.8.0", m["user_agent.original"])
+	assert.Equal(t, "request", m["http.request.id"])
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, Configure(&config.Audit{}))
+	})
+	dir := t.TempDir()
+	cfg := config.Audit{Enabled: true}
+	cfg.Files.InitDefaults()
+	cfg.Files.Path = dir
+
+	require.NoError(t, Configure(&cfg))
+	Log(context.Background(), Event{Action: ActionAgentUnenroll, Outcome: OutcomeSuccess, AgentID: "agent"})
+	require.NoError(t, Configure(&config.Audit{}))
+	Log(context.Background(), Event{Action: ActionAgentUnenroll, Outcome: OutcomeSuccess, AgentID: "not written"})
+
+	// the chain resumes from the last event of the file
+	require.NoError(t, Configure(&cfg))
+	Log(context.Background(), Event{Action: ActionAgentUnenroll, Outcome: OutcomeSuccess, AgentID: "again"})
+	require.NoError(t, Configure(&config.Audit{}))
+
+	files, err := filepath.Glob(filepath.Join(dir, cfg.Files.Name+"*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "not written")
+	seq, _, err := Verify(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), seq, "two starts and two events")
+}
+
+func TestConfigureChainBreak(t *testing.T) {
+	t.Cleanup(func() {
+		require.NoError(t, Configure(&config.Audit{}))
+	})
+	dir := t.TempDir()
+	cfg := config.Audit{Enabled: true, Key: "audit-key"}
+	cfg.Files.InitDefaults()
+	cfg.Files.Path = dir
+
+	require.NoError(t, Configure(&cfg))
+	require.NoError(t, Configure(&config.Audit{}))
+	files, err := filepath.Glob(filepath.Join(dir, cfg.Files.Name+"*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// the tail of the log is damaged
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"event.sequence":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, Configure(&cfg))
+	require.NoError(t, Configure(&config.Audit{}))
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1][len(`{"event.sequence":`):]), &m))
+	assert.Equal(t, ActionAuditChainBreak, m["event.action"], "the break is recorded")
+	assert.Equal(t, float64(1), m["event.sequence"])
+	assert.NotEmpty(t, m["error.message"])
+
+	// the new chain verifies from the break
+	seq, _, err := Verify(strings.NewReader(lines[1][len(`{"event.sequence":`):]+"\n"+lines[2]+"\n"), []byte(cfg.Key))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+}
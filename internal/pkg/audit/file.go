@@ -0,0 +1,139 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// maxTailBytes is the size of the end of the last audit file read to find the last event.
+const maxTailBytes = 64 * 1024
+
+// open opens the audit log file of cfg. The chain of events continues from prev, or from the last
+// event of the files if prev is nil. If the last event can not be read, a new chain starts with an
+// event recording the break.
+func open(cfg *config.Audit, prev *Auditor) (*Auditor, error) {
+	files := cfg.Files
+	filename := filepath.Join(files.Path, files.Name)
+
+	var seq uint64
+	var prevHash string
+	var chainErr error
+	if prev != nil {
+		seq, prevHash = prev.chain()
+	} else {
+		seq, prevHash, chainErr = lastEvent(filename)
+	}
+
+	rotator, err := file.NewFileRotator(filename,
+		file.MaxSizeBytes(files.MaxSize),
+		file.MaxBackups(files.MaxBackups),
+		file.Permissions(os.FileMode(files.Permissions)),
+		file.Interval(files.Interval),
+		file.RotateOnStartup(files.RotateOnStartup),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	if cfg.Key != "" {
+		key = []byte(cfg.Key)
+	}
+	a := NewWriter(rotator, key, seq, prevHash)
+	if chainErr != nil {
+		log.Warn().Err(chainErr).Msg("Audit log hash chain starts again, the last event could not be read")
+		if err := a.Log(context.Background(), Event{
+			Action:  ActionAuditChainBreak,
+			Message: "Audit log hash chain starts again, the last event could not be read",
+		}.WithErr(chainErr)); err != nil {
+			a.Close() //nolint:errcheck // the write error is returned
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// lastEvent returns the sequence number and hash of the last event of the most recent audit file.
+// A new chain starts without error when there is no audit file, and with the error when the
+// last event of the file can not be read.
+func lastEvent(filename string) (uint64, string, error) {
+	ext := filepath.Ext(filename)
+	matches, err := filepath.Glob(strings.TrimSuffix(filename, ext) + "*" + ext)
+	if err != nil || len(matches) == 0 {
+		return 0, "", nil
+	}
+	var last string
+	var lastMod int64
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if mod := info.ModTime().UnixNano(); last == "" || mod > lastMod {
+			last, lastMod = m, mod
+		}
+	}
+	if last == "" {
+		return 0, "", nil
+	}
+
+	line, err := lastLine(last)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", last, err)
+	}
+	if len(line) == 0 {
+		// the log always starts with an event, the file was truncated
+		return 0, "", fmt.Errorf("%s: %w: no event", last, ErrChainBroken)
+	}
+	var fields struct {
+		Sequence uint64 `json:"event.sequence"`
+		Hash     string `json:"event.hash"`
+	}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return 0, "", fmt.Errorf("%s: %w: %w", last, ErrChainBroken, err)
+	}
+	if fields.Hash == "" {
+		return 0, "", fmt.Errorf("%s: %w: last event has no hash", last, ErrChainBroken)
+	}
+	return fields.Sequence, fields.Hash, nil
+}
+
+// lastLine returns the last non empty line of the file.
+func lastLine(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data, nil
+}
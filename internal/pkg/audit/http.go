@@ -0,0 +1,44 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+)
+
+type requestKey struct{}
+
+// requestInfo is the client of a request, added to the audit events.
+type requestInfo struct {
+	clientIP  string
+	userAgent string
+	requestID string
+}
+
+// Middleware adds the client of the requests to the audit events logged with their context. It
+// must follow the middlewares resolving the client address and the request id.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if std.Load() == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			// the address of a client behind a trusted proxy has no port
+			host = r.RemoteAddr
+		}
+		ctx := context.WithValue(r.Context(), requestKey{}, requestInfo{
+			clientIP:  host,
+			userAgent: r.UserAgent(),
+			requestID: r.Header.Get(logger.HeaderRequestID),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
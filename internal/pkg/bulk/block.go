@@ -5,6 +5,8 @@
 package bulk
 
 import (
+	"go.elastic.co/apm/v2"
+
 	"github.com/elastic/fleet-server/v7/internal/pkg/danger"
 )
 
@@ -14,12 +16,13 @@ type Buf = danger.Buf
 // However, the multiOp API's will allocate directly in large blocks.
 
 type bulkT struct {
-	action actionT    // requested actions
-	flags  flagsT     // execution flags
-	idx    int32      // idx of originating request, used in mulitOp
-	ch     chan respT // response channel, caller is waiting synchronously
-	buf    Buf        // json payload to be sent to elastic
-	next   *bulkT     // pointer to next bulkT, used for fast internal queueing
+	action actionT      // requested actions
+	flags  flagsT       // execution flags
+	idx    int32        // idx of originating request, used in mulitOp
+	ch     chan respT   // response channel, caller is waiting synchronously
+	buf    Buf          // json payload to be sent to elastic
+	next   *bulkT       // pointer to next bulkT, used for fast internal queueing
+	link   apm.SpanLink // span of the originating request, linked to the flush transaction
 }
 
 type flagsT int8
@@ -70,6 +73,7 @@ func (blk *bulkT) reset() {
 	blk.idx = 0
 	blk.buf.Reset()
 	blk.next = nil
+	blk.link = apm.SpanLink{}
 }
 
 type respT struct {
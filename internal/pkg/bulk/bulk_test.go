@@ -18,6 +18,8 @@ import (
 
 	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
 	"github.com/rs/zerolog/log"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/transport/transporttest"
 )
 
 // TODO:
@@ -371,3 +373,114 @@ func BenchmarkMockBulk(b *testing.B) {
 		b.Run(strconv.Itoa(n), bindFunc(n))
 	}
 }
+
+func TestFlushObserver(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	observed := make(chan time.Duration, 1)
+	bulker := NewBulker(&mockBulkTransport{}, nil, WithFlushInterval(10*time.Millisecond), WithFlushObserver(func(d time.Duration) {
+		observed <- d
+	}))
+	go func() {
+		_ = bulker.Run(ctx)
+	}()
+
+	if _, err := bulker.Create(ctx, "index", "id", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-observed:
+		if d <= 0 {
+			t.Errorf("expected a positive flush duration, got %v", d)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("flush not observed")
+	}
+}
+
+func TestFlushLinks(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer, recorder := transporttest.NewRecorderTracer()
+	defer tracer.Close()
+	bulker := NewBulker(&mockBulkTransport{}, tracer, WithFlushInterval(10*time.Millisecond))
+	go func() {
+		_ = bulker.Run(ctx)
+	}()
+
+	tx := tracer.StartTransaction("request", "request")
+	if _, err := bulker.Create(apm.ContextWithTransaction(ctx, tx), "index", "id", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	tx.End()
+
+	// the flush transaction ends after the response is sent
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		tracer.Flush(nil)
+		for _, flush := range recorder.Payloads().Transactions {
+			if flush.Type != "bulker" {
+				continue
+			}
+			if len(flush.Links) != 1 || flush.Links[0].TraceID != [16]byte(tx.TraceContext().Trace) || flush.Links[0].SpanID != [8]byte(tx.TraceContext().Span) {
+				t.Fatalf("expected a link to the request, got %v", flush.Links)
+			}
+			return
+		}
+	}
+	t.Fatal("flush transaction not recorded")
+}
+
+func TestReconfigure(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Items are not flushed before an hour unless the flush options are reconfigured
+	bulker := NewBulker(&mockBulkTransport{}, nil, WithFlushInterval(time.Hour), WithFlushThresholdCount(1000))
+	go func() {
+		_ = bulker.Run(ctx)
+	}()
+	bulker.Reconfigure(WithFlushInterval(10*time.Millisecond), WithFlushThresholdCount(1000))
+
+	createCtx, createCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer createCancel()
+	if _, err := bulker.Create(createCtx, "index", "id", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunFlushOnExit(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bulker := NewBulker(&mockBulkTransport{}, nil, WithFlushInterval(time.Hour), WithFlushThresholdCount(1000))
+	done := make(chan error, 1)
+	go func() {
+		done <- bulker.Run(ctx)
+	}()
+
+	created := make(chan error, 1)
+	go func() {
+		_, err := bulker.Create(context.Background(), "index", "id", []byte(`{}`))
+		created <- err
+	}()
+
+	// Queued operations are flushed when the bulker stops, not after the flush interval
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-created:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued operation not flushed on exit")
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
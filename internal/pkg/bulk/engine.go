@@ -74,6 +74,9 @@ type Bulker struct {
 	blkPool     sync.Pool
 	apikeyLimit *semaphore.Weighted
 	tracer      *apm.Tracer
+
+	reconfigMut sync.Mutex
+	reconfigCh  chan bulkOptT // flush options to apply, consumed by Run
 }
 
 const (
@@ -84,6 +87,7 @@ const (
 	defaultBlockQueueSz      = 32 // Small capacity to allow multiOp to spin fast
 	defaultAPIKeyMaxParallel = 32
 	defaultApikeyMaxReqSize  = 100 * 1024 * 1024
+	shutdownFlushTimeout     = 10 * time.Second
 )
 
 func NewBulker(es esapi.Transport, tracer *apm.Tracer, opts ...BulkOpt) *Bulker {
@@ -101,9 +105,26 @@ func NewBulker(es esapi.Transport, tracer *apm.Tracer, opts ...BulkOpt) *Bulker
 		blkPool:     sync.Pool{New: poolFunc},
 		apikeyLimit: semaphore.NewWeighted(int64(bopts.apikeyMaxParallel)),
 		tracer:      tracer,
+		reconfigCh:  make(chan bulkOptT, 1),
 	}
 }
 
+// Reconfigure applies the flush interval and thresholds of opts to the running bulker,
+// starting with the next queued item. Other options are only set when creating the bulker.
+func (b *Bulker) Reconfigure(opts ...BulkOpt) {
+	bopts := parseBulkOpts(opts...)
+
+	b.reconfigMut.Lock()
+	defer b.reconfigMut.Unlock()
+
+	// Replace options not applied yet
+	select {
+	case <-b.reconfigCh:
+	default:
+	}
+	b.reconfigCh <- bopts
+}
+
 func (b *Bulker) Client() *elasticsearch.Client {
 	client, ok := b.es.(*elasticsearch.Client)
 	if !ok {
@@ -172,7 +193,7 @@ func (b *Bulker) Run(ctx context.Context) error {
 	var itemCnt int
 	var byteCnt int
 
-	doFlush := func() error {
+	doFlush := func(ctx context.Context) error {
 
 		for i := range queues {
 			q := &queues[i]
@@ -231,18 +252,31 @@ func (b *Bulker) Run(ctx context.Context) error {
 					Int("byteCnt", byteCnt).
 					Msg("Flush on threshold")
 
-				err = doFlush()
+				err = doFlush(ctx)
 
 				stopTimer(timer)
 			}
 
+		case opts := <-b.reconfigCh:
+			// The flush options are only read by this goroutine
+			b.opts.flushInterval = opts.flushInterval
+			b.opts.flushThresholdCnt = opts.flushThresholdCnt
+			b.opts.flushThresholdSz = opts.flushThresholdSz
+			log.Info().Interface("opts", &b.opts).Msg("Reconfigured bulker flush options")
+
+			// Pending items are flushed on the new interval
+			if itemCnt > 0 {
+				stopTimer(timer)
+				timer.Reset(b.opts.flushInterval)
+			}
+
 		case <-timer.C:
 			log.Trace().
 				Str("mod", kModBulk).
 				Int("itemCnt", itemCnt).
 				Int("byteCnt", byteCnt).
 				Msg("Flush on timer")
-			err = doFlush()
+			err = doFlush(ctx)
 
 		case <-ctx.Done():
 			err = ctx.Err()
@@ -250,6 +284,17 @@ func (b *Bulker) Run(ctx context.Context) error {
 
 	}
 
+	// Flush the queued operations and wait for the flushes in flight before exiting.
+	if errors.Is(err, context.Canceled) {
+		flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+		defer cancel()
+		if ferr := doFlush(flushCtx); ferr != nil {
+			log.Error().Err(ferr).Msg("Failed to flush bulk queues on exit")
+		} else if ferr := w.Acquire(flushCtx, int64(b.opts.maxPending)); ferr != nil {
+			log.Error().Err(ferr).Msg("Timed out waiting for bulk flushes on exit")
+		}
+	}
+
 	return err
 }
 
@@ -278,7 +323,9 @@ func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue qu
 		start := time.Now()
 
 		if b.tracer != nil {
-			trans := b.tracer.StartTransaction(fmt.Sprintf("Flush queue %s", queue.Type()), "bulker")
+			trans := b.tracer.StartTransactionOptions(fmt.Sprintf("Flush queue %s", queue.Type()), "bulker", apm.TransactionOptions{
+				Links: queueLinks(queue),
+			})
 			trans.Context.SetLabel("queue.size", queue.cnt)
 			trans.Context.SetLabel("queue.pending", queue.pending)
 			ctx = apm.ContextWithTransaction(ctx, trans)
@@ -300,9 +347,19 @@ func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue qu
 		}
 
 		if err != nil {
+			cntFlushFailed.Inc()
 			failQueue(queue, err)
 		}
 
+		rtt := time.Since(start)
+		cntFlush.Inc()
+		cntFlushItems.Add(uint64(queue.cnt))
+		flushLatency.Set(rtt.Milliseconds())
+		cntFlushLatency.Add(uint64(rtt.Microseconds()))
+		if b.opts.flushObserver != nil {
+			b.opts.flushObserver(rtt)
+		}
+
 		log.Trace().
 			Err(err).
 			Str("mod", kModBulk).
@@ -317,6 +374,39 @@ func (b *Bulker) flushQueue(ctx context.Context, w *semaphore.Weighted, queue qu
 	return nil
 }
 
+// maxFlushLinks is the maximum number of requests linked to a flush transaction.
+const maxFlushLinks = 128
+
+// queueLinks returns the links to the requests of the queue, once per request.
+func queueLinks(queue queueT) []apm.SpanLink {
+	var links []apm.SpanLink
+	seen := make(map[apm.SpanLink]struct{})
+	for n := queue.head; n != nil && len(links) < maxFlushLinks; n = n.next {
+		if n.link == (apm.SpanLink{}) {
+			continue
+		}
+		if _, ok := seen[n.link]; ok {
+			continue
+		}
+		seen[n.link] = struct{}{}
+		links = append(links, n.link)
+	}
+	return links
+}
+
+// traceLink returns the link to the span, or else the transaction, of ctx.
+func traceLink(ctx context.Context) apm.SpanLink {
+	var tc apm.TraceContext
+	if span := apm.SpanFromContext(ctx); span != nil {
+		tc = span.TraceContext()
+	} else if tx := apm.TransactionFromContext(ctx); tx != nil {
+		tc = tx.TraceContext()
+	} else {
+		return apm.SpanLink{}
+	}
+	return apm.SpanLink{Trace: tc.Trace, Span: tc.Span}
+}
+
 func failQueue(queue queueT, err error) {
 	for n := queue.head; n != nil; {
 		next := n.next // 'n' is invalid immediately on channel send
@@ -383,6 +473,9 @@ func (b *Bulker) validateBody(body []byte) error {
 
 func (b *Bulker) dispatch(ctx context.Context, blk *bulkT) respT {
 	start := time.Now()
+	if b.tracer != nil {
+		blk.link = traceLink(ctx)
+	}
 
 	// Dispatch to bulk Run loop
 	select {
@@ -0,0 +1,22 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package bulk
+
+import (
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+var (
+	registry = monitoring.Default.NewRegistry("bulk")
+
+	cntFlush       = monitoring.NewUint(registry, "flush")
+	cntFlushFailed = monitoring.NewUint(registry, "flush_failed")
+	cntFlushItems  = monitoring.NewUint(registry, "flush_items")
+	// flushLatency is the round trip time of the last flush, in milliseconds.
+	flushLatency = monitoring.NewInt(registry, "flush_latency_ms")
+	// cntFlushLatency is the cumulative round trip time of the flushes, in microseconds; the average
+	// latency over an interval is its increase divided by the increase of cntFlush.
+	cntFlushLatency = monitoring.NewUint(registry, "flush_latency_us_sum")
+)
@@ -8,6 +8,8 @@ import (
 	"context"
 	"errors"
 	"math"
+
+	"go.elastic.co/apm/v2"
 )
 
 func (b *Bulker) MCreate(ctx context.Context, ops []MultiOp, opts ...Opt) ([]BulkIndexerResponseItem, error) {
@@ -112,9 +114,14 @@ func (b *Bulker) multiWaitBulkOp(ctx context.Context, action actionT, ops []Mult
 }
 
 func (b *Bulker) multiDispatch(ctx context.Context, blks []bulkT) error {
+	var link apm.SpanLink
+	if b.tracer != nil {
+		link = traceLink(ctx)
+	}
 
 	// Dispatch to bulk Run loop; Iterate by reference.
 	for i := range blks {
+		blks[i].link = link
 		select {
 		case b.ch <- &blks[i]:
 		case <-ctx.Done():
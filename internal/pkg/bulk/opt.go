@@ -63,6 +63,7 @@ type bulkOptT struct {
 	blockQueueSz      int
 	apikeyMaxParallel int
 	apikeyMaxReqSize  int
+	flushObserver     func(time.Duration)
 }
 
 type BulkOpt func(*bulkOptT)
@@ -118,6 +119,13 @@ func WithAPIKeyMaxRequestSize(maxBytes int) BulkOpt {
 	}
 }
 
+// WithFlushObserver sets a function called with the round trip time of every queue flush.
+func WithFlushObserver(fn func(time.Duration)) BulkOpt {
+	return func(opt *bulkOptT) {
+		opt.flushObserver = fn
+	}
+}
+
 func parseBulkOpts(opts ...BulkOpt) bulkOptT {
 	bopt := bulkOptT{
 		flushInterval:     defaultFlushInterval,
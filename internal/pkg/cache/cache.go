@@ -6,6 +6,8 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -28,6 +30,15 @@ type Cache interface {
 	SetAPIKey(key APIKey, enabled bool)
 	ValidAPIKey(key APIKey) bool
 
+	SetAPIKeyFailure(key APIKey)
+	FailedAPIKey(key APIKey) bool
+
+	SetAPIKeyAgent(keyID, agentID string)
+	GetAPIKeyAgent(keyID string) (string, bool)
+
+	AuthFailure(key APIKey, addr string) bool
+	AuthLocked(key APIKey, addr string) bool
+
 	SetEnrollmentAPIKey(id string, key model.EnrollmentAPIKey, cost int64)
 	GetEnrollmentAPIKey(id string) (model.EnrollmentAPIKey, bool)
 
@@ -36,15 +47,20 @@ type Cache interface {
 
 	SetUpload(id string, info upload.Info)
 	GetUpload(id string) (upload.Info, bool)
+
+	Stats() Stats
 }
 
 type APIKey = apikey.APIKey
 type SecurityInfo = apikey.SecurityInfo
 
 type CacheT struct {
-	cache Cacher
-	cfg   config.Cache
-	mut   sync.RWMutex
+	cache     Cacher
+	stats     *cacheStats
+	keyLocks  *lockout
+	addrLocks *lockout
+	cfg       config.Cache
+	mut       sync.RWMutex
 }
 
 type actionCache struct {
@@ -52,27 +68,38 @@ type actionCache struct {
 	actionType string
 }
 
+// failedAPIKey is the payload of a negative API key cache entry.
+type failedAPIKey string
+
+// apiKeyAgent is the payload of an entry mapping an access API key id to its agent.
+type apiKeyAgent string
+
 // New creates a new cache.
 func New(cfg config.Cache) (*CacheT, error) {
-	cache, err := newCache(cfg)
+	stats := newCacheStats()
+	cache, err := newCache(cfg, stats)
 	if err != nil {
 		return nil, err
 	}
 
 	c := CacheT{
-		cache: cache,
-		cfg:   cfg,
+		cache:     cache,
+		stats:     stats,
+		keyLocks:  newKeyLockout(cfg),
+		addrLocks: newAddrLockout(cfg),
+		cfg:       cfg,
 	}
 
 	return &c, nil
 }
 
-// Reconfigure will drop cache
+// Reconfigure will drop cache; authentication lockouts are kept.
 func (c *CacheT) Reconfigure(cfg config.Cache) error {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	cache, err := newCache(cfg)
+	stats := newCacheStats()
+	cache, err := newCache(cfg, stats)
 	if err != nil {
 		return err
 	}
@@ -83,9 +110,31 @@ func (c *CacheT) Reconfigure(cfg config.Cache) error {
 	// And assign new one
 	c.cfg = cfg
 	c.cache = cache
+	c.stats = stats
+	l := cfg.AuthLockout
+	c.keyLocks = c.keyLocks.reconfigure(l.KeyMaxFailures, l.Window, l.Duration, l.MaxTracked)
+	c.addrLocks = c.addrLocks.reconfigure(l.IPMaxFailures, l.Window, l.Duration, l.MaxTracked)
 	return nil
 }
 
+func newKeyLockout(cfg config.Cache) *lockout {
+	l := cfg.AuthLockout
+	return newLockout(l.KeyMaxFailures, l.Window, l.Duration, l.MaxTracked)
+}
+
+func newAddrLockout(cfg config.Cache) *lockout {
+	l := cfg.AuthLockout
+	return newLockout(l.IPMaxFailures, l.Window, l.Duration, l.MaxTracked)
+}
+
+// lockoutID returns the lockout identifier of the API key. It includes a hash
+// of the secret, like the negative cache, so that failures with wrong secrets
+// cannot lock out the agent that holds the valid one.
+func lockoutID(key APIKey) string {
+	sum := sha256.Sum256([]byte(key.Key))
+	return key.ID + ":" + hex.EncodeToString(sum[:])
+}
+
 // SetAction sets an action in the cache.
 //
 // This will only cache the action ID and action Type. So `GetAction` will only
@@ -102,6 +151,7 @@ func (c *CacheT) SetAction(action model.Action) {
 	cost := len(action.ActionID) + len(action.Type)
 	ttl := c.cfg.ActionTTL
 	ok := c.cache.SetWithTTL(scopedKey, v, int64(cost), ttl)
+	c.stats.set(TypeAction, int64(cost), ok)
 	log.Trace().
 		Bool("ok", ok).
 		Str("id", action.ActionID).
@@ -119,6 +169,7 @@ func (c *CacheT) GetAction(id string) (model.Action, bool) {
 
 	scopedKey := "action:" + id
 	if v, ok := c.cache.Get(scopedKey); ok {
+		c.stats.hit(TypeAction)
 		log.Trace().Str("id", id).Msg("Action cache HIT")
 		action, ok := v.(actionCache)
 		if !ok {
@@ -131,6 +182,7 @@ func (c *CacheT) GetAction(id string) (model.Action, bool) {
 		}, ok
 	}
 
+	c.stats.miss(TypeAction)
 	log.Trace().Str("id", id).Msg("Action cache MISS")
 	return model.Action{}, false
 }
@@ -163,6 +215,7 @@ func (c *CacheT) SetAPIKey(key APIKey, enabled bool) {
 
 	cost := len(scopedKey) + len(val)
 	ok := c.cache.SetWithTTL(scopedKey, val, int64(cost), ttl)
+	c.stats.set(TypeAPIKey, int64(cost), ok)
 	log.Trace().
 		Bool("ok", ok).
 		Bool("enabled", enabled).
@@ -192,9 +245,117 @@ func (c *CacheT) ValidAPIKey(key APIKey) bool {
 	} else {
 		log.Trace().Str("id", key.ID).Msg("ApiKey cache MISS")
 	}
+	if ok {
+		c.stats.hit(TypeAPIKey)
+	} else {
+		c.stats.miss(TypeAPIKey)
+	}
 	return ok
 }
 
+// SetAPIKeyFailure records that the API key failed authentication.
+//
+// The secret is kept as the payload so that a request with a different secret
+// for the same key id is not rejected by a failure it did not cause.
+// Negative caching is disabled if the failure TTL is zero.
+func (c *CacheT) SetAPIKeyFailure(key APIKey) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	ttl := c.cfg.APIKeyFailTTL
+	if ttl <= 0 {
+		return
+	}
+
+	scopedKey := "apifail:" + key.ID
+	cost := len(scopedKey) + len(key.Key)
+	ok := c.cache.SetWithTTL(scopedKey, failedAPIKey(key.Key), int64(cost), ttl)
+	c.stats.set(TypeAPIKeyFailure, int64(cost), ok)
+	log.Trace().
+		Bool("ok", ok).
+		Str("key", key.ID).
+		Dur("ttl", ttl).
+		Int("cost", cost).
+		Msg("ApiKey failure cache SET")
+}
+
+// FailedAPIKey returns true if the ApiKey recently failed authentication.
+func (c *CacheT) FailedAPIKey(key APIKey) bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	scopedKey := "apifail:" + key.ID
+	v, ok := c.cache.Get(scopedKey)
+	if !ok || v != failedAPIKey(key.Key) {
+		c.stats.miss(TypeAPIKeyFailure)
+		return false
+	}
+	c.stats.hit(TypeAPIKeyFailure)
+	log.Trace().Str("id", key.ID).Msg("ApiKey failure cache HIT")
+	return true
+}
+
+// SetAPIKeyAgent records the id of the agent that the access API key belongs to.
+//
+// An access API key belongs to a single agent for its whole lifetime, so the
+// entry does not need the key secret and can be preloaded.
+func (c *CacheT) SetAPIKeyAgent(keyID, agentID string) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	scopedKey := "apiagent:" + keyID
+	cost := len(scopedKey) + len(agentID)
+	ttl := c.cfg.APIKeyTTL
+	ok := c.cache.SetWithTTL(scopedKey, apiKeyAgent(agentID), int64(cost), ttl)
+	c.stats.set(TypeAPIKeyAgent, int64(cost), ok)
+	log.Trace().
+		Bool("ok", ok).
+		Str("key", keyID).
+		Str("agent", agentID).
+		Dur("ttl", ttl).
+		Int("cost", cost).
+		Msg("ApiKey agent cache SET")
+}
+
+// GetAPIKeyAgent returns the id of the agent that the access API key belongs to.
+func (c *CacheT) GetAPIKeyAgent(keyID string) (string, bool) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	scopedKey := "apiagent:" + keyID
+	if v, ok := c.cache.Get(scopedKey); ok {
+		if agentID, ok := v.(apiKeyAgent); ok {
+			c.stats.hit(TypeAPIKeyAgent)
+			log.Trace().Str("id", keyID).Msg("ApiKey agent cache HIT")
+			return string(agentID), true
+		}
+		log.Error().Str("id", keyID).Msg("ApiKey agent cache cast fail")
+	}
+
+	c.stats.miss(TypeAPIKeyAgent)
+	log.Trace().Str("id", keyID).Msg("ApiKey agent cache MISS")
+	return "", false
+}
+
+// AuthFailure counts a failed authentication against the API key and the
+// source address. It returns true if either of them is now locked out.
+func (c *CacheT) AuthFailure(key APIKey, addr string) bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	keyLocked := c.keyLocks.fail(lockoutID(key))
+	addrLocked := c.addrLocks.fail(addr)
+	return keyLocked || addrLocked
+}
+
+// AuthLocked returns true if either the API key or the source address is locked out.
+func (c *CacheT) AuthLocked(key APIKey, addr string) bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	return c.keyLocks.locked(lockoutID(key)) || c.addrLocks.locked(addr)
+}
+
 // GetEnrollmentAPIKey returns the enrollment API key by ID.
 func (c *CacheT) GetEnrollmentAPIKey(id string) (model.EnrollmentAPIKey, bool) { //nolint:dupl // similar getters to support strong typing
 	c.mut.RLock()
@@ -202,6 +363,7 @@ func (c *CacheT) GetEnrollmentAPIKey(id string) (model.EnrollmentAPIKey, bool) {
 
 	scopedKey := "record:" + id
 	if v, ok := c.cache.Get(scopedKey); ok {
+		c.stats.hit(TypeEnrollmentKey)
 		log.Trace().Str("id", id).Msg("Enrollment cache HIT")
 		key, ok := v.(model.EnrollmentAPIKey)
 
@@ -212,6 +374,7 @@ func (c *CacheT) GetEnrollmentAPIKey(id string) (model.EnrollmentAPIKey, bool) {
 		return key, ok
 	}
 
+	c.stats.miss(TypeEnrollmentKey)
 	log.Trace().Str("id", id).Msg("EnrollmentApiKey cache MISS")
 	return model.EnrollmentAPIKey{}, false
 }
@@ -224,6 +387,7 @@ func (c *CacheT) SetEnrollmentAPIKey(id string, key model.EnrollmentAPIKey, cost
 	scopedKey := "record:" + id
 	ttl := c.cfg.EnrollKeyTTL
 	ok := c.cache.SetWithTTL(scopedKey, key, cost, ttl)
+	c.stats.set(TypeEnrollmentKey, cost, ok)
 	log.Trace().
 		Bool("ok", ok).
 		Str("id", id).
@@ -242,6 +406,7 @@ func (c *CacheT) GetArtifact(ident, sha2 string) (model.Artifact, bool) {
 
 	scopedKey := makeArtifactKey(ident, sha2)
 	if v, ok := c.cache.Get(scopedKey); ok {
+		c.stats.hit(TypeArtifact)
 		log.Trace().Str("key", scopedKey).Msg("Artifact cache HIT")
 		key, ok := v.(model.Artifact)
 
@@ -252,6 +417,7 @@ func (c *CacheT) GetArtifact(ident, sha2 string) (model.Artifact, bool) {
 		return key, ok
 	}
 
+	c.stats.miss(TypeArtifact)
 	log.Trace().Str("key", scopedKey).Msg("Artifact cache MISS")
 	return model.Artifact{}, false
 }
@@ -267,6 +433,7 @@ func (c *CacheT) SetArtifact(artifact model.Artifact) {
 	ttl := c.cfg.ArtifactTTL
 
 	ok := c.cache.SetWithTTL(scopedKey, artifact, cost, ttl)
+	c.stats.set(TypeArtifact, cost, ok)
 	log.Trace().
 		Bool("ok", ok).
 		Str("key", scopedKey).
@@ -284,6 +451,7 @@ func (c *CacheT) SetUpload(id string, info upload.Info) {
 	// cache cost for other entries use bytes as the unit. Add up the string lengths and the size of the int64s in the upload.Info struct, as a manual 'sizeof'
 	cost := int64(len(info.ID) + len(info.DocID) + len(info.ActionID) + len(info.AgentID) + len(info.Source) + len(info.Status) + 8*4)
 	ok := c.cache.SetWithTTL(scopedKey, info, cost, ttl)
+	c.stats.set(TypeUpload, cost, ok)
 	log.Trace().
 		Bool("ok", ok).
 		Str("id", id).
@@ -297,6 +465,7 @@ func (c *CacheT) GetUpload(id string) (upload.Info, bool) { //nolint:dupl // a l
 
 	scopedKey := "upload:" + id
 	if v, ok := c.cache.Get(scopedKey); ok {
+		c.stats.hit(TypeUpload)
 		log.Trace().Str("id", id).Msg("upload info cache HIT")
 		key, ok := v.(upload.Info)
 		if !ok {
@@ -306,6 +475,20 @@ func (c *CacheT) GetUpload(id string) (upload.Info, bool) { //nolint:dupl // a l
 		return key, ok
 	}
 
+	c.stats.miss(TypeUpload)
 	log.Trace().Str("id", id).Msg("upload info cache MISS")
 	return upload.Info{}, false
 }
+
+// Stats returns a summary of the cache contents and usage since the cache was
+// created or last reconfigured.
+func (c *CacheT) Stats() Stats {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	return Stats{
+		MaxCost: c.cfg.MaxCost,
+		Types:   c.stats.snapshot(),
+		Total:   totalStats(c.cache),
+	}
+}
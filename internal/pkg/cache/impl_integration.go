@@ -12,10 +12,14 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 )
 
-func newCache(_ config.Cache) (Cacher, error) {
+func newCache(_ config.Cache, _ *cacheStats) (Cacher, error) {
 	return &NoCache{}, nil
 }
 
+func totalStats(_ Cacher) *TotalStats {
+	return nil
+}
+
 type NoCache struct{}
 
 func (c *NoCache) Get(_ interface{}) (interface{}, bool) {
@@ -7,17 +7,95 @@
 package cache
 
 import (
+	"time"
+
 	"github.com/dgraph-io/ristretto"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 )
 
-func newCache(cfg config.Cache) (Cacher, error) {
+// costedValue is a value as stored in ristretto, along with the cost it was set with, so that
+// the statistics can account for the cost of the values leaving the cache; ristretto only
+// reports the value of replaced entries.
+type costedValue struct {
+	value interface{}
+	cost  int64
+}
+
+// ristrettoCache stores the values of the cache with their cost.
+type ristrettoCache struct {
+	*ristretto.Cache
+}
+
+func newCache(cfg config.Cache, stats *cacheStats) (Cacher, error) {
 	rcfg := &ristretto.Config{
 		NumCounters: cfg.NumCounters,
 		MaxCost:     cfg.MaxCost,
 		BufferItems: 64,
+		Metrics:     true,
+		OnEvict: func(item *ristretto.Item) {
+			stats.evict(unwrap(item.Value))
+		},
+		OnReject: func(item *ristretto.Item) {
+			stats.reject(unwrap(item.Value))
+		},
+		// called for evicted, expired, rejected and replaced values
+		OnExit: func(v interface{}) {
+			if cv, ok := v.(costedValue); ok {
+				stats.exit(cv.value, cv.cost)
+			}
+		},
+	}
+
+	c, err := ristretto.NewCache(rcfg)
+	if err != nil {
+		return nil, err
+	}
+	return ristrettoCache{c}, nil
+}
+
+func (c ristrettoCache) Get(key interface{}) (interface{}, bool) {
+	v, ok := c.Cache.Get(key)
+	if !ok {
+		return nil, false
 	}
+	return unwrap(v), true
+}
+
+func (c ristrettoCache) Set(key, value interface{}, cost int64) bool {
+	return c.Cache.Set(key, costedValue{value: value, cost: cost}, cost)
+}
+
+func (c ristrettoCache) SetWithTTL(key, value interface{}, cost int64, ttl time.Duration) bool {
+	return c.Cache.SetWithTTL(key, costedValue{value: value, cost: cost}, cost, ttl)
+}
 
-	return ristretto.NewCache(rcfg)
+func unwrap(v interface{}) interface{} {
+	if cv, ok := v.(costedValue); ok {
+		return cv.value
+	}
+	return v
+}
+
+func totalStats(c Cacher) *TotalStats {
+	rc, ok := c.(ristrettoCache)
+	if !ok || rc.Metrics == nil {
+		return nil
+	}
+	m := rc.Metrics
+	return &TotalStats{
+		Cost:         int64(m.CostAdded()) - int64(m.CostEvicted()),
+		Hits:         m.Hits(),
+		Misses:       m.Misses(),
+		HitRatio:     m.Ratio(),
+		KeysAdded:    m.KeysAdded(),
+		KeysUpdated:  m.KeysUpdated(),
+		KeysEvicted:  m.KeysEvicted(),
+		CostAdded:    m.CostAdded(),
+		CostEvicted:  m.CostEvicted(),
+		SetsDropped:  m.SetsDropped(),
+		SetsRejected: m.SetsRejected(),
+		GetsDropped:  m.GetsDropped(),
+		GetsKept:     m.GetsKept(),
+	}
 }
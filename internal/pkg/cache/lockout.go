@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cache
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// lockout counts failures per identifier (an API key or a source address)
+// within a fixed window, and locks out any identifier that reaches maxFailures
+// for the configured duration.
+//
+// The number of tracked identifiers is bounded by an LRU so that a scan with
+// many random keys cannot grow memory without limit.
+type lockout struct {
+	mut         sync.Mutex
+	entries     *lru.Cache[string, *lockoutEntry]
+	maxFailures int
+	window      time.Duration
+	duration    time.Duration
+	now         func() time.Time
+}
+
+type lockoutEntry struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// newLockout returns a lockout tracker, or nil if lockouts are disabled.
+// All methods are safe to call on a nil tracker.
+func newLockout(maxFailures int, window, duration time.Duration, size int) *lockout {
+	if maxFailures <= 0 || window <= 0 || duration <= 0 || size <= 0 {
+		return nil
+	}
+	entries, err := lru.New[string, *lockoutEntry](size)
+	if err != nil {
+		return nil
+	}
+	return &lockout{
+		entries:     entries,
+		maxFailures: maxFailures,
+		window:      window,
+		duration:    duration,
+		now:         time.Now,
+	}
+}
+
+// reconfigure returns the tracker with the new settings. The failures and
+// active lockouts of l are kept, so that a configuration change does not
+// unlock the identifiers currently locked out.
+func (l *lockout) reconfigure(maxFailures int, window, duration time.Duration, size int) *lockout {
+	if l == nil {
+		return newLockout(maxFailures, window, duration, size)
+	}
+	if maxFailures <= 0 || window <= 0 || duration <= 0 || size <= 0 {
+		return nil
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.entries.Resize(size)
+	l.maxFailures = maxFailures
+	l.window = window
+	l.duration = duration
+	return l
+}
+
+// fail records a failure for id and returns true if id is now locked out.
+func (l *lockout) fail(id string) bool {
+	if l == nil || id == "" {
+		return false
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	now := l.now()
+	e, ok := l.entries.Get(id)
+	if !ok || now.Sub(e.windowStart) > l.window {
+		e = &lockoutEntry{windowStart: now}
+		l.entries.Add(id, e)
+	}
+	if now.Before(e.lockedUntil) {
+		return true
+	}
+	e.failures++
+	if e.failures >= l.maxFailures {
+		e.lockedUntil = now.Add(l.duration)
+		// start a fresh window once the lockout expires
+		e.failures = 0
+		e.windowStart = e.lockedUntil
+		return true
+	}
+	return false
+}
+
+// locked returns true if id is currently locked out.
+func (l *lockout) locked(id string) bool {
+	if l == nil || id == "" {
+		return false
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	e, ok := l.entries.Peek(id)
+	return ok && l.now().Before(e.lockedUntil)
+}
@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Now()
+	l := newLockout(3, time.Minute, 10*time.Minute, 10)
+	require.NotNil(t, l)
+	l.now = func() time.Time { return now }
+
+	assert.False(t, l.fail("a"))
+	assert.False(t, l.fail("a"))
+	assert.False(t, l.locked("a"))
+	assert.True(t, l.fail("a"))
+	assert.True(t, l.locked("a"))
+	assert.False(t, l.locked("b"), "other ids are not affected")
+
+	now = now.Add(5 * time.Minute)
+	assert.True(t, l.locked("a"), "still locked within duration")
+
+	now = now.Add(6 * time.Minute)
+	assert.False(t, l.locked("a"), "unlocked after duration")
+	assert.False(t, l.fail("a"), "failures are counted from zero after lockout")
+}
+
+func TestLockoutWindowExpires(t *testing.T) {
+	now := time.Now()
+	l := newLockout(2, time.Minute, 10*time.Minute, 10)
+	require.NotNil(t, l)
+	l.now = func() time.Time { return now }
+
+	assert.False(t, l.fail("a"))
+	now = now.Add(2 * time.Minute)
+	assert.False(t, l.fail("a"), "previous failure is outside of window")
+	assert.True(t, l.fail("a"))
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	l := newLockout(0, time.Minute, time.Minute, 10)
+	assert.Nil(t, l)
+	assert.False(t, l.fail("a"))
+	assert.False(t, l.locked("a"))
+}
+
+func TestAPIKeyFailure(t *testing.T) {
+	c, err := New(config.Cache{NumCounters: 100, MaxCost: 100000, APIKeyFailTTL: time.Minute})
+	require.NoError(t, err)
+
+	key := APIKey{ID: "id", Key: "secret"}
+	c.SetAPIKeyFailure(key)
+	c.cache.(ristrettoCache).Wait() // ristretto sets are async
+
+	assert.True(t, c.FailedAPIKey(key))
+	assert.False(t, c.FailedAPIKey(APIKey{ID: "id", Key: "other"}), "a different secret must not hit the failure cache")
+	assert.False(t, c.ValidAPIKey(key))
+}
+
+func TestAuthLockoutKeyedOnSecret(t *testing.T) {
+	cfg := config.Cache{NumCounters: 100, MaxCost: 100000}
+	cfg.AuthLockout = config.AuthLockout{KeyMaxFailures: 2, IPMaxFailures: 100, Window: time.Minute, Duration: time.Minute, MaxTracked: 10}
+	c, err := New(cfg)
+	require.NoError(t, err)
+
+	bad := APIKey{ID: "id", Key: "guess"}
+	assert.False(t, c.AuthFailure(bad, "10.0.0.1"))
+	assert.True(t, c.AuthFailure(bad, "10.0.0.1"))
+	assert.True(t, c.AuthLocked(bad, "10.0.0.2"))
+	assert.False(t, c.AuthLocked(APIKey{ID: "id", Key: "secret"}, "10.0.0.2"), "failures with another secret must not lock out the key")
+
+	cfg.AuthLockout.Duration = 2 * time.Minute
+	require.NoError(t, c.Reconfigure(cfg))
+	assert.True(t, c.AuthLocked(bad, "10.0.0.2"), "lockouts are kept on reconfigure")
+}
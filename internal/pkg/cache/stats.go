@@ -0,0 +1,179 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cache
+
+import (
+	"sync/atomic"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/uploader/upload"
+)
+
+// Entry types tracked in the cache statistics.
+const (
+	TypeAction        = "action"
+	TypeAPIKey        = "api_key"
+	TypeAPIKeyFailure = "api_key_fail"
+	TypeAPIKeyAgent   = "api_key_agent"
+	TypeEnrollmentKey = "enrollment_key"
+	TypeArtifact      = "artifact"
+	TypeUpload        = "upload"
+)
+
+var entryTypes = []string{TypeAction, TypeAPIKey, TypeAPIKeyFailure, TypeAPIKeyAgent, TypeEnrollmentKey, TypeArtifact, TypeUpload}
+
+// Stats is a point in time summary of the cache contents and usage.
+type Stats struct {
+	MaxCost int64                `json:"max_cost"`
+	Types   map[string]TypeStats `json:"types"`
+	Total   *TotalStats          `json:"total,omitempty"`
+}
+
+// TypeStats are the statistics for a single type of cache entry.
+//
+// Entries and cost are derived from the sets, replacements, rejections and
+// evictions that have been observed and may briefly lag behind the cache's
+// buffered writes.
+type TypeStats struct {
+	Entries    int64   `json:"entries"`
+	Cost       int64   `json:"cost"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	HitRatio   float64 `json:"hit_ratio"`
+	Sets       uint64  `json:"sets"`
+	Evictions  uint64  `json:"evictions"`
+	Rejections uint64  `json:"rejections"`
+}
+
+// TotalStats are the statistics reported by the underlying cache implementation.
+type TotalStats struct {
+	Cost         int64   `json:"cost"`
+	Hits         uint64  `json:"hits"`
+	Misses       uint64  `json:"misses"`
+	HitRatio     float64 `json:"hit_ratio"`
+	KeysAdded    uint64  `json:"keys_added"`
+	KeysUpdated  uint64  `json:"keys_updated"`
+	KeysEvicted  uint64  `json:"keys_evicted"`
+	CostAdded    uint64  `json:"cost_added"`
+	CostEvicted  uint64  `json:"cost_evicted"`
+	SetsDropped  uint64  `json:"sets_dropped"`
+	SetsRejected uint64  `json:"sets_rejected"`
+	GetsDropped  uint64  `json:"gets_dropped"`
+	GetsKept     uint64  `json:"gets_kept"`
+}
+
+type typeCounters struct {
+	entries    atomic.Int64
+	cost       atomic.Int64
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	sets       atomic.Uint64
+	evictions  atomic.Uint64
+	rejections atomic.Uint64
+}
+
+// cacheStats tracks per type counters for a single Cacher instance.
+type cacheStats struct {
+	types map[string]*typeCounters
+}
+
+func newCacheStats() *cacheStats {
+	s := &cacheStats{types: make(map[string]*typeCounters, len(entryTypes))}
+	for _, t := range entryTypes {
+		s.types[t] = &typeCounters{}
+	}
+	return s
+}
+
+func (s *cacheStats) hit(t string) {
+	s.types[t].hits.Add(1)
+}
+
+func (s *cacheStats) miss(t string) {
+	s.types[t].misses.Add(1)
+}
+
+// set records a value that has been accepted by the cache; it may still be
+// rejected by the admission policy, which is then recorded by reject and exit.
+func (s *cacheStats) set(t string, cost int64, ok bool) {
+	if !ok {
+		return
+	}
+	c := s.types[t]
+	c.sets.Add(1)
+	c.entries.Add(1)
+	c.cost.Add(cost)
+}
+
+// evict records a value that has been evicted or has expired.
+func (s *cacheStats) evict(v interface{}) {
+	if c, ok := s.types[entryType(v)]; ok {
+		c.evictions.Add(1)
+	}
+}
+
+// reject records a value that has been rejected by the admission policy.
+func (s *cacheStats) reject(v interface{}) {
+	if c, ok := s.types[entryType(v)]; ok {
+		c.rejections.Add(1)
+	}
+}
+
+// exit records a value of the given cost leaving the cache for any reason;
+// evicted, expired, rejected or replaced.
+func (s *cacheStats) exit(v interface{}, cost int64) {
+	if c, ok := s.types[entryType(v)]; ok {
+		c.entries.Add(-1)
+		c.cost.Add(-cost)
+	}
+}
+
+func (s *cacheStats) snapshot() map[string]TypeStats {
+	res := make(map[string]TypeStats, len(s.types))
+	for t, c := range s.types {
+		ts := TypeStats{
+			Entries:    c.entries.Load(),
+			Cost:       c.cost.Load(),
+			Hits:       c.hits.Load(),
+			Misses:     c.misses.Load(),
+			Sets:       c.sets.Load(),
+			Evictions:  c.evictions.Load(),
+			Rejections: c.rejections.Load(),
+		}
+		if ts.Entries < 0 {
+			ts.Entries = 0
+		}
+		if ts.Cost < 0 {
+			ts.Cost = 0
+		}
+		if total := ts.Hits + ts.Misses; total > 0 {
+			ts.HitRatio = float64(ts.Hits) / float64(total)
+		}
+		res[t] = ts
+	}
+	return res
+}
+
+// entryType maps a cached value to the type of entry it was stored as.
+func entryType(v interface{}) string {
+	switch v.(type) {
+	case actionCache:
+		return TypeAction
+	case string:
+		return TypeAPIKey
+	case failedAPIKey:
+		return TypeAPIKeyFailure
+	case apiKeyAgent:
+		return TypeAPIKeyAgent
+	case model.EnrollmentAPIKey:
+		return TypeEnrollmentKey
+	case model.Artifact:
+		return TypeArtifact
+	case upload.Info:
+		return TypeUpload
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+func TestStatsCost(t *testing.T) {
+	c, err := New(config.Cache{NumCounters: 100, MaxCost: 1000, ArtifactTTL: time.Hour})
+	require.NoError(t, err)
+	wait := c.cache.(ristrettoCache).Wait
+
+	c.SetArtifact(model.Artifact{Identifier: "a", DecodedSha256: "1", Body: make([]byte, 100)})
+	wait()
+	assert.Equal(t, TypeStats{Entries: 1, Cost: 100, Sets: 1}, c.Stats().Types[TypeArtifact])
+
+	c.SetArtifact(model.Artifact{Identifier: "a", DecodedSha256: "1", Body: make([]byte, 50)})
+	wait()
+	assert.Equal(t, TypeStats{Entries: 1, Cost: 50, Sets: 2}, c.Stats().Types[TypeArtifact], "the cost of a replaced entry is removed")
+
+	c.SetArtifact(model.Artifact{Identifier: "b", DecodedSha256: "2", Body: make([]byte, 2000)})
+	wait()
+	assert.Equal(t, TypeStats{Entries: 1, Cost: 50, Sets: 3, Rejections: 1}, c.Stats().Types[TypeArtifact], "the cost of a rejected entry is removed")
+}
@@ -18,7 +18,10 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-const defaultFlushInterval = 10 * time.Second
+const (
+	defaultFlushInterval = 10 * time.Second
+	shutdownFlushTimeout = 10 * time.Second
+)
 
 type optionsT struct {
 	flushInterval time.Duration
@@ -127,7 +130,7 @@ func (bc *Bulk) CheckIn(id string, status string, message string, meta []byte, c
 	return nil
 }
 
-// Run starts the flush timer and exit only when the context is cancelled.
+// Run starts the flush timer and exit only when the context is cancelled, after flushing the pending checkins.
 func (bc *Bulk) Run(ctx context.Context) error {
 
 	tick := time.NewTicker(bc.opts.flushInterval)
@@ -148,6 +151,13 @@ LOOP:
 		}
 	}
 
+	// Flush the checkins received until the server stopped, the bulker outlives the checkin bulk.
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	if ferr := bc.flush(flushCtx); ferr != nil {
+		log.Error().Err(ferr).Msg("Failed to flush pending checkins on exit")
+	}
+
 	return err
 }
 
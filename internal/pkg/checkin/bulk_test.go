@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -198,6 +199,24 @@ func TestBulkSimple(t *testing.T) {
 	}
 }
 
+func TestBulkRunFlushOnExit(t *testing.T) {
+	log.Logger = testlog.SetLogger(t)
+	mockBulk := ftesting.NewMockBulk()
+	mockBulk.On("MUpdate", mock.Anything, mock.Anything, mock.Anything).Return([]bulk.BulkIndexerResponseItem{}, nil).Once()
+	bc := NewBulk(mockBulk, WithFlushInterval(time.Hour))
+
+	if err := bc.CheckIn("agent-id", "online", "", nil, nil, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bc.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	mockBulk.AssertExpectations(t)
+}
+
 func validateTimestamp(tb testing.TB, start time.Time, ts string) {
 	if t1, err := time.Parse(time.RFC3339, ts); err != nil {
 		tb.Error("expected rfc3999")
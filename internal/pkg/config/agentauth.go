@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Identities of the agent client certificates.
+const (
+	CertIdentityCommonName = "common_name"
+	CertIdentityDNSName    = "dns_san"
+	CertIdentityURI        = "uri_san" // such as a SPIFFE ID
+)
+
+// AgentCertAuth requires the agents to authenticate with a client certificate issued by one of the
+// CertificateAuthorities, in addition to their access API key.
+//
+// The identity of the certificate is bound to the agent when it enrolls, the requests of the agent
+// are then rejected when they are not made with a certificate of the same identity. The agents
+// enrolled without certificate are rejected, unless the Transition binds their identity.
+type AgentCertAuth struct {
+	Enabled                bool                `config:"enabled"`
+	CertificateAuthorities []string            `config:"certificate_authorities"` // CA files or PEM strings
+	Identity               string              `config:"identity"`
+	Transition             AgentCertTransition `config:"transition"`
+}
+
+// AgentCertTransition binds the identity of the certificate of an agent enrolled without certificate
+// on the first request the agent makes with a valid certificate, until the Until time if set, so that
+// the agents enrolled before the certificates are required do not have to enroll again.
+type AgentCertTransition struct {
+	Enabled bool   `config:"enabled"`
+	Until   string `config:"until"` // RFC 3339 time, the transition does not end if empty
+}
+
+// Deadline returns the end of the transition, the zero time if it does not end.
+func (c *AgentCertTransition) Deadline() time.Time {
+	t, _ := time.Parse(time.RFC3339, c.Until)
+	return t
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AgentCertTransition) Validate() error {
+	if c.Until == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, c.Until); err != nil {
+		return fmt.Errorf("invalid agent certificate transition until: %w", err)
+	}
+	return nil
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *AgentCertAuth) InitDefaults() {
+	c.Identity = CertIdentityCommonName
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AgentCertAuth) Validate() error {
+	switch c.Identity {
+	case CertIdentityCommonName, CertIdentityDNSName, CertIdentityURI:
+	default:
+		return fmt.Errorf("unknown agent certificate identity %q", c.Identity)
+	}
+	if c.Enabled && len(c.CertificateAuthorities) == 0 {
+		return errors.New("agent certificate authentication requires certificate_authorities")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package config
+
+import (
+	"testing"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentCertAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    map[string]interface{}
+		expect *AgentCertAuth
+	}{{
+		name:   "disabled",
+		cfg:    map[string]interface{}{},
+		expect: &AgentCertAuth{Identity: CertIdentityCommonName},
+	}, {
+		name: "spiffe id",
+		cfg: map[string]interface{}{
+			"enabled":                 true,
+			"certificate_authorities": []string{"/etc/fleet-server/agents-ca.crt"},
+			"identity":                "uri_san",
+		},
+		expect: &AgentCertAuth{Enabled: true, CertificateAuthorities: []string{"/etc/fleet-server/agents-ca.crt"}, Identity: CertIdentityURI},
+	}, {
+		name: "transition",
+		cfg: map[string]interface{}{
+			"enabled":                 true,
+			"certificate_authorities": []string{"/etc/fleet-server/agents-ca.crt"},
+			"transition":              map[string]interface{}{"enabled": true, "until": "2026-12-01T00:00:00Z"},
+		},
+		expect: &AgentCertAuth{
+			Enabled:                true,
+			CertificateAuthorities: []string{"/etc/fleet-server/agents-ca.crt"},
+			Identity:               CertIdentityCommonName,
+			Transition:             AgentCertTransition{Enabled: true, Until: "2026-12-01T00:00:00Z"},
+		},
+	}, {
+		name: "invalid transition until",
+		cfg:  map[string]interface{}{"transition": map[string]interface{}{"enabled": true, "until": "december"}},
+	}, {
+		name: "missing certificate authorities",
+		cfg:  map[string]interface{}{"enabled": true},
+	}, {
+		name: "unknown identity",
+		cfg:  map[string]interface{}{"identity": "email"},
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{"agent_certificates": tc.cfg})
+			require.NoError(t, err)
+
+			var s Server
+			s.InitDefaults()
+			err = c.Unpack(&s)
+			if tc.expect == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, *tc.expect, s.AgentCertAuth)
+		})
+	}
+}
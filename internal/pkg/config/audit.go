@@ -0,0 +1,29 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+const defaultAuditFileName = "fleet-server-audit"
+
+// Audit writes the security events of the server, such as enrollments and API key changes, to a
+// dedicated file with its own rotation. The audit log does not depend on the logging settings.
+//
+// The events are hashed with HMAC-SHA256 when a Key is set, so that the hash chain of the events
+// can not be rewritten without it; the key is required to verify the log.
+type Audit struct {
+	Enabled bool       `config:"enabled"`
+	Key     string     `config:"key"`
+	Files   AuditFiles `config:"files"`
+}
+
+// AuditFiles are the settings of the audit log files, with the defaults of the audit log.
+type AuditFiles LoggingFiles
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *AuditFiles) InitDefaults() {
+	(*LoggingFiles)(c).InitDefaults()
+	c.Name = defaultAuditFileName
+	// the hash chain of the events continues in the current file on restart
+	c.RotateOnStartup = false
+}
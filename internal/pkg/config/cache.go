@@ -11,11 +11,22 @@ import (
 )
 
 const (
-	defaultActionTTL    = time.Minute * 5
-	defaultEnrollKeyTTL = time.Minute
-	defaultArtifactTTL  = time.Hour * 24
-	defaultAPIKeyTTL    = time.Minute * 15 // APIKey validation is a bottleneck.
-	defaultAPIKeyJitter = time.Minute * 5  // Jitter allows some randomness on APIKeyTTL, zero to disable
+	defaultActionTTL     = time.Minute * 5
+	defaultEnrollKeyTTL  = time.Minute
+	defaultArtifactTTL   = time.Hour * 24
+	defaultAPIKeyTTL     = time.Minute * 15 // APIKey validation is a bottleneck.
+	defaultAPIKeyJitter  = time.Minute * 5  // Jitter allows some randomness on APIKeyTTL, zero to disable
+	defaultAPIKeyFailTTL = time.Minute      // Failed authentications are remembered for a short time only
+
+	defaultLockoutKeyMaxFailures = 5
+	defaultLockoutWindow         = time.Minute * 5
+	defaultLockoutDuration       = time.Minute * 15
+	defaultLockoutMaxTracked     = 10000
+
+	defaultWarmupTimeout        = time.Second * 30
+	defaultWarmupEnrollmentKeys = 1000
+	defaultWarmupArtifacts      = 100
+	defaultWarmupAPIKeys        = 10000
 )
 
 type Cache struct {
@@ -26,6 +37,65 @@ type Cache struct {
 	ArtifactTTL  time.Duration `config:"ttl_artifact"`
 	APIKeyTTL    time.Duration `config:"ttl_api_key"`
 	APIKeyJitter time.Duration `config:"jitter_api_key"`
+
+	APIKeyFailTTL time.Duration `config:"ttl_api_key_fail"`
+	AuthLockout   AuthLockout   `config:"auth_lockout"`
+	Warmup        CacheWarmup   `config:"warmup"`
+}
+
+// CacheWarmup is the configuration for preloading the cache on startup.
+type CacheWarmup struct {
+	Enabled        bool          `config:"enabled"`
+	Timeout        time.Duration `config:"timeout"`
+	EnrollmentKeys int           `config:"enrollment_keys"`
+	Artifacts      int           `config:"artifacts"`
+	APIKeys        int           `config:"api_keys"`
+}
+
+// LoadDefaults sets the default value for any attribute that is not defined.
+func (c *CacheWarmup) LoadDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = defaultWarmupTimeout
+	}
+	if c.EnrollmentKeys == 0 {
+		c.EnrollmentKeys = defaultWarmupEnrollmentKeys
+	}
+	if c.Artifacts == 0 {
+		c.Artifacts = defaultWarmupArtifacts
+	}
+	if c.APIKeys == 0 {
+		c.APIKeys = defaultWarmupAPIKeys
+	}
+}
+
+// AuthLockout is the configuration for locking out API keys (id and secret) and
+// source addresses that repeatedly fail authentication.
+//
+// The source address lockout is disabled unless IPMaxFailures is set: the agents
+// behind a NAT or a load balancer share an address. A negative KeyMaxFailures
+// disables the API key lockout.
+type AuthLockout struct {
+	KeyMaxFailures int           `config:"key_max_failures"`
+	IPMaxFailures  int           `config:"ip_max_failures"`
+	Window         time.Duration `config:"window"`
+	Duration       time.Duration `config:"duration"`
+	MaxTracked     int           `config:"max_tracked"`
+}
+
+// LoadDefaults sets the default value for any attribute that is not defined.
+func (c *AuthLockout) LoadDefaults() {
+	if c.KeyMaxFailures == 0 {
+		c.KeyMaxFailures = defaultLockoutKeyMaxFailures
+	}
+	if c.Window == 0 {
+		c.Window = defaultLockoutWindow
+	}
+	if c.Duration == 0 {
+		c.Duration = defaultLockoutDuration
+	}
+	if c.MaxTracked == 0 {
+		c.MaxTracked = defaultLockoutMaxTracked
+	}
 }
 
 func (c *Cache) InitDefaults() {
@@ -57,6 +127,11 @@ func (c *Cache) LoadLimits(limits *envLimits) {
 	if c.APIKeyJitter == 0 {
 		c.APIKeyJitter = defaultAPIKeyJitter
 	}
+	if c.APIKeyFailTTL == 0 {
+		c.APIKeyFailTTL = defaultAPIKeyFailTTL
+	}
+	c.AuthLockout.LoadDefaults()
+	c.Warmup.LoadDefaults()
 }
 
 // CopyCache returns a copy of the config's Cache settings
@@ -70,6 +145,10 @@ func CopyCache(cfg *Config) Cache {
 		ArtifactTTL:  ccfg.ArtifactTTL,
 		APIKeyTTL:    ccfg.APIKeyTTL,
 		APIKeyJitter: ccfg.APIKeyJitter,
+
+		APIKeyFailTTL: ccfg.APIKeyFailTTL,
+		AuthLockout:   ccfg.AuthLockout,
+		Warmup:        ccfg.Warmup,
 	}
 }
 
@@ -82,4 +161,10 @@ func (c *Cache) MarshalZerologObject(e *zerolog.Event) {
 	e.Dur("artifactTTL", c.ArtifactTTL)
 	e.Dur("apiKeyTTL", c.APIKeyTTL)
 	e.Dur("apiKeyJitter", c.APIKeyJitter)
+	e.Dur("apiKeyFailTTL", c.APIKeyFailTTL)
+	e.Int("lockoutKeyMaxFailures", c.AuthLockout.KeyMaxFailures)
+	e.Int("lockoutIPMaxFailures", c.AuthLockout.IPMaxFailures)
+	e.Dur("lockoutWindow", c.AuthLockout.Window)
+	e.Dur("lockoutDuration", c.AuthLockout.Duration)
+	e.Bool("warmup", c.Warmup.Enabled)
 }
@@ -93,6 +93,11 @@ func (c *Config) LoadServerLimits() error {
 	agentLimits := loadLimits(fleetInput.Server.Limits.MaxAgents)
 	fleetInput.Cache.LoadLimits(agentLimits)
 	fleetInput.Server.Limits.LoadLimits(agentLimits)
+	for i := range fleetInput.Server.Listeners {
+		if l := fleetInput.Server.Listeners[i].Limits; l != nil {
+			l.LoadLimits(agentLimits)
+		}
+	}
 	return nil
 }
 
@@ -178,6 +183,10 @@ func redactServer(cfg *Config) Server {
 		redacted.TLS = &newTLS
 	}
 
+	if redacted.Audit.Key != "" {
+		redacted.Audit.Key = kRedacted
+	}
+
 	return redacted
 }
 
@@ -38,8 +38,9 @@ func TestConfig(t *testing.T) {
 						Server: defaultServer(),
 						Cache:  defaultCache(),
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:             defaultFetchSize,
+							PollTimeout:           defaultPollTimeout,
+							PolicyRevisionHistory: defaultPolicyRevisionHistory,
 						},
 					},
 				},
@@ -66,8 +67,9 @@ func TestConfig(t *testing.T) {
 						Server: defaultServer(),
 						Cache:  defaultCache(),
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:             defaultFetchSize,
+							PollTimeout:           defaultPollTimeout,
+							PolicyRevisionHistory: defaultPolicyRevisionHistory,
 						},
 					},
 				},
@@ -87,8 +89,9 @@ func TestConfig(t *testing.T) {
 						Server: defaultServer(),
 						Cache:  defaultCache(),
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:             defaultFetchSize,
+							PollTimeout:           defaultPollTimeout,
+							PolicyRevisionHistory: defaultPolicyRevisionHistory,
 						},
 					},
 				},
@@ -106,9 +109,10 @@ func TestConfig(t *testing.T) {
 					{
 						Type: "fleet-server",
 						Server: Server{
-							Host:         "localhost",
-							Port:         8888,
-							InternalPort: 8221,
+							Host:              "localhost",
+							Port:              8888,
+							InternalPort:      8221,
+							TLSReloadInterval: time.Minute,
 							Timeouts: ServerTimeouts{
 								Read:             20 * time.Second,
 								ReadHeader:       5 * time.Second,
@@ -118,6 +122,7 @@ func TestConfig(t *testing.T) {
 								CheckinLongPoll:  5 * time.Minute,
 								CheckinJitter:    30 * time.Second,
 								CheckinMaxPoll:   10 * time.Minute,
+								Drain:            10 * time.Second,
 							},
 							Profiler: ServerProfiler{
 								Enabled: false,
@@ -128,11 +133,16 @@ func TestConfig(t *testing.T) {
 							Limits:            generateServerLimits(12500),
 							Bulk:              defaultServerBulk(),
 							GC:                defaultServerGC(),
+							ProxyProtocol:     defaultProxyProtocol(),
+							AgentCertAuth:     defaultAgentCertAuth(),
+							TLSBootstrap:      defaultTLSBootstrap(),
+							Audit:             defaultAudit(),
 						},
 						Cache: generateCache(12500),
 						Monitor: Monitor{
-							FetchSize:   defaultFetchSize,
-							PollTimeout: defaultPollTimeout,
+							FetchSize:             defaultFetchSize,
+							PollTimeout:           defaultPollTimeout,
+							PolicyRevisionHistory: defaultPolicyRevisionHistory,
 						},
 					},
 				},
@@ -201,6 +211,8 @@ func TestLoadServerLimits(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, int64(defaultCheckinMaxBody), c.Inputs[0].Server.Limits.CheckinLimit.MaxBody)
 		assert.Equal(t, defaultActionTTL, c.Inputs[0].Cache.ActionTTL)
+		assert.Equal(t, defaultLockoutKeyMaxFailures, c.Inputs[0].Cache.AuthLockout.KeyMaxFailures)
+		assert.Zero(t, c.Inputs[0].Cache.AuthLockout.IPMaxFailures, "the source address lockout is opt-in")
 	})
 	t.Run("existing values are not overridden", func(t *testing.T) {
 		c := &Config{
@@ -259,6 +271,30 @@ func defaultServerGC() GC {
 	return d
 }
 
+func defaultProxyProtocol() ProxyProtocol {
+	var d ProxyProtocol
+	d.InitDefaults()
+	return d
+}
+
+func defaultAgentCertAuth() AgentCertAuth {
+	var d AgentCertAuth
+	d.InitDefaults()
+	return d
+}
+
+func defaultTLSBootstrap() TLSBootstrap {
+	var d TLSBootstrap
+	d.InitDefaults()
+	return d
+}
+
+func defaultAudit() Audit {
+	var d Audit
+	d.Files.InitDefaults()
+	return d
+}
+
 func defaultLogging() Logging {
 	var d Logging
 	d.InitDefaults()
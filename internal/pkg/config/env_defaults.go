@@ -26,6 +26,8 @@ const (
 	defaultMaxConnections = 0 // no limit
 	defaultPolicyThrottle = time.Millisecond * 5
 
+	defaultUploadTimeLimit = 24 * time.Hour
+
 	defaultCheckinInterval = time.Millisecond
 	defaultCheckinBurst    = 1000
 	defaultCheckinMax      = 0
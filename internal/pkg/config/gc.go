@@ -4,21 +4,56 @@
 
 package config
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 const (
 	defaultScheduleInterval            = time.Hour
 	defaultCleanupIntervalAfterExpired = "30d" // cleanup expired actions with expiration time older than 30 days from now
+	defaultStaleServerInterval         = 24 * time.Hour
 )
 
+// GCSchedules are the names of the garbage collection schedules, that Cron is keyed by.
+var GCSchedules = []string{"actions-cleanup", "unenroll-inactive-agents", "uploads-cleanup", "servers-cleanup"}
+
 // GC is the configuration for the Fleet Server data garbage collection.
-// Currently manages the expired actions cleanup
 type GC struct {
 	ScheduleInterval            time.Duration `config:"schedule_interval"`
 	CleanupAfterExpiredInterval string        `config:"cleanup_after_expired_interval"`
+
+	// StaleServerInterval is the time after which the document of a fleet-server that stopped
+	// updating it is deleted, along with the policy leader documents it held.
+	StaleServerInterval time.Duration `config:"stale_server_interval"`
+
+	// Cron holds cron expressions, keyed by schedule name, used instead of ScheduleInterval to run
+	// the matching schedules.
+	Cron map[string]string `config:"cron"`
 }
 
 func (g *GC) InitDefaults() {
 	g.ScheduleInterval = defaultScheduleInterval
 	g.CleanupAfterExpiredInterval = defaultCleanupIntervalAfterExpired
+	g.StaleServerInterval = defaultStaleServerInterval
+}
+
+// Validate ensures that the cron expressions are set for known schedules.
+func (g *GC) Validate() error {
+	for name := range g.Cron {
+		if !isGCSchedule(name) {
+			return fmt.Errorf("unknown gc schedule %q in cron, expected one of %s", name, strings.Join(GCSchedules, ", "))
+		}
+	}
+	return nil
+}
+
+func isGCSchedule(name string) bool {
+	for _, s := range GCSchedules {
+		if s == name {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,48 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package config
+
+import (
+	"testing"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCCron(t *testing.T) {
+	tests := []struct {
+		name string
+		cron map[string]interface{}
+		err  string
+	}{{
+		name: "known schedules",
+		cron: map[string]interface{}{"actions-cleanup": "*/15 * * * *", "servers-cleanup": "@daily"},
+	}, {
+		name: "unknown schedule",
+		cron: map[string]interface{}{"action-cleanup": "@daily"},
+		err:  `unknown gc schedule "action-cleanup"`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{"cron": tc.cron})
+			require.NoError(t, err)
+
+			var gc GC
+			gc.InitDefaults()
+			err = c.Unpack(&gc)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, gc.Cron, len(tc.cron))
+		})
+	}
+}
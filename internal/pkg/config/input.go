@@ -17,6 +17,7 @@ const kDefaultHost = "0.0.0.0"
 const kDefaultPort = 8220
 const kDefaultInternalHost = "localhost"
 const kDefaultInternalPort = 8221
+const kDefaultTLSReloadInterval = time.Minute
 const fleetInputType = "fleet-server"
 
 // Policy is the configuration policy to use.
@@ -62,6 +63,7 @@ type Server struct {
 	Port              uint16                  `config:"port"`
 	InternalPort      uint16                  `config:"internal_port"`
 	TLS               *tlscommon.ServerConfig `config:"ssl"`
+	TLSReloadInterval time.Duration           `config:"ssl_reload_interval"` // Interval to check certificate and CA files for changes, 0 disables it
 	Timeouts          ServerTimeouts          `config:"timeouts"`
 	Profiler          ServerProfiler          `config:"profiler"`
 	CompressionLevel  int                     `config:"compression_level"`
@@ -71,6 +73,13 @@ type Server struct {
 	Bulk              ServerBulk              `config:"bulk"`
 	GC                GC                      `config:"gc"`
 	Instrumentation   Instrumentation         `config:"instrumentation"`
+	PolicyRollouts    []PolicyRollout         `config:"policy_rollouts"`
+	ProxyProtocol     ProxyProtocol           `config:"proxy_protocol"`
+	TrustedProxies    []string                `config:"trusted_proxies"` // HTTP proxies whose X-Forwarded-For header is honored
+	Listeners         []Listener              `config:"listeners"`       // Replace the listener on host and port when set
+	AgentCertAuth     AgentCertAuth           `config:"agent_certificates"`
+	TLSBootstrap      TLSBootstrap            `config:"ssl_bootstrap"` // Used when ssl is not configured
+	Audit             Audit                   `config:"audit"`
 }
 
 // InitDefaults initializes the defaults for the configuration.
@@ -78,6 +87,7 @@ func (c *Server) InitDefaults() {
 	c.Host = kDefaultHost
 	c.Port = kDefaultPort
 	c.InternalPort = kDefaultInternalPort
+	c.TLSReloadInterval = kDefaultTLSReloadInterval
 	c.Timeouts.InitDefaults()
 	c.CompressionLevel = flate.BestSpeed
 	c.CompressionThresh = 1024
@@ -86,6 +96,21 @@ func (c *Server) InitDefaults() {
 	c.Runtime.InitDefaults()
 	c.Bulk.InitDefaults()
 	c.GC.InitDefaults()
+	c.ProxyProtocol.InitDefaults()
+	c.AgentCertAuth.InitDefaults()
+	c.TLSBootstrap.InitDefaults()
+	c.Audit.Files.InitDefaults()
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Server) Validate() error {
+	if _, err := ParseNetworks(c.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted_proxies: %w", err)
+	}
+	if err := validateListeners(c.Listeners); err != nil {
+		return fmt.Errorf("invalid listeners: %w", err)
+	}
+	return nil
 }
 
 // BindEndpoints returns the binding address for the all HTTP server listeners.
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 
@@ -38,6 +39,8 @@ type Instrumentation struct {
 	GlobalLabels string `config:"global_labels"`
 	// TransactionSampleRate sets the sample rate  - may be specified with ELASTIC_APM_TRANSACTION_SAMPLE_RATE
 	TransactionSampleRate string `config:"transaction_sample_rate"`
+	// OTLP exports the traces and metrics to an OpenTelemetry collector instead of the APM server hosts.
+	OTLP InstrumentationOTLP `config:"otlp"`
 }
 
 type InstrumentationTLS struct {
@@ -49,6 +52,77 @@ type InstrumentationTLS struct {
 	ServerCA string `config:"server_ca"`
 }
 
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+
+	envOTLPEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+)
+
+// InstrumentationOTLP configures the export of the traces and metrics with the OpenTelemetry protocol.
+// The tls settings of the instrumentation apply to the collector.
+type InstrumentationOTLP struct {
+	Enabled bool `config:"enabled"`
+	// Protocol is grpc or http/protobuf, defaults to grpc.
+	Protocol string `config:"protocol"`
+	// Endpoint is the host:port of the gRPC collector or the URL of the HTTP collector - may be specified with OTEL_EXPORTER_OTLP_ENDPOINT
+	Endpoint string `config:"endpoint"`
+	// Headers are sent with every export, such as an authorization header.
+	Headers map[string]string `config:"headers"`
+	// Insecure disables tls to the collector.
+	Insecure bool `config:"insecure"`
+	// Timeout of every export, defaults to 10s.
+	Timeout time.Duration `config:"timeout"`
+}
+
+// Validate ensures that the protocol is known.
+func (c *InstrumentationOTLP) Validate() error {
+	switch c.Protocol {
+	case "", OTLPProtocolGRPC, OTLPProtocolHTTP:
+		return nil
+	}
+	return fmt.Errorf("unknown otlp protocol %q, expected %s or %s", c.Protocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+}
+
+// GetProtocol returns the protocol of the exports.
+func (c *InstrumentationOTLP) GetProtocol() string {
+	if c.Protocol == "" {
+		return OTLPProtocolGRPC
+	}
+	return c.Protocol
+}
+
+// GetEndpoint returns the endpoint of the collector, the local collector by default.
+func (c *InstrumentationOTLP) GetEndpoint() string {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv(envOTLPEndpoint)
+	}
+	if endpoint != "" {
+		return endpoint
+	}
+	if c.GetProtocol() == OTLPProtocolHTTP {
+		return "http://localhost:4318"
+	}
+	return "localhost:4317"
+}
+
+// GetTimeout returns the timeout of every export.
+func (c *InstrumentationOTLP) GetTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return c.Timeout
+}
+
+// OTLPTLSConfig returns the tls configuration of the connections to the OpenTelemetry collector.
+func (c *Instrumentation) OTLPTLSConfig() (*tls.Config, error) {
+	if c.OTLP.Insecure {
+		return nil, nil
+	}
+	return c.tlsConfig()
+}
+
 // APMHTTPTransportOptions will return an APM HTTP transport options configuration specifier.
 func (c *Instrumentation) APMHTTPTransportOptions() (apmtransport.HTTPTransportOptions, error) {
 	hosts := make([]*url.URL, 0, len(c.Hosts))
@@ -60,33 +134,9 @@ func (c *Instrumentation) APMHTTPTransportOptions() (apmtransport.HTTPTransportO
 		hosts = append(hosts, u)
 	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: c.TLS.SkipVerify, //nolint:gosec // users can disable tls validation
-	}
-
-	if c.TLS.ServerCertificate != "" {
-		p, err := os.ReadFile(c.TLS.ServerCertificate)
-		if err != nil {
-			return apmtransport.HTTPTransportOptions{}, fmt.Errorf("unable to read instrumentation certificate: %w", err)
-		}
-		block, _ := pem.Decode(p)
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return apmtransport.HTTPTransportOptions{}, fmt.Errorf("unable to parse instrumentation certificate: %w", err)
-		}
-		tlsConfig.InsecureSkipVerify = true
-		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-			return verifyPeerCertificate(rawCerts, cert)
-		}
-	}
-
-	if c.TLS.ServerCA != "" {
-		pool, errs := tlscommon.LoadCertificateAuthorities([]string{c.TLS.ServerCA})
-		// FIXME once we update elastic-agent-libs to go 1.20 we can return multiple errors directly with errors.Join()
-		if len(errs) != 0 {
-			return apmtransport.HTTPTransportOptions{}, fmt.Errorf("unable to load instrumentation cas: %w", errors.Join(errs...))
-		}
-		tlsConfig.RootCAs = pool
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return apmtransport.HTTPTransportOptions{}, err
 	}
 
 	apiKey := c.APIKey
@@ -115,6 +165,40 @@ func (c *Instrumentation) APMHTTPTransportOptions() (apmtransport.HTTPTransportO
 	}, nil
 }
 
+// tlsConfig returns the tls configuration of the connections to the APM server or the OpenTelemetry collector.
+func (c *Instrumentation) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.TLS.SkipVerify, //nolint:gosec // users can disable tls validation
+	}
+
+	if c.TLS.ServerCertificate != "" {
+		p, err := os.ReadFile(c.TLS.ServerCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read instrumentation certificate: %w", err)
+		}
+		block, _ := pem.Decode(p)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse instrumentation certificate: %w", err)
+		}
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			return verifyPeerCertificate(rawCerts, cert)
+		}
+	}
+
+	if c.TLS.ServerCA != "" {
+		pool, errs := tlscommon.LoadCertificateAuthorities([]string{c.TLS.ServerCA})
+		// FIXME once we update elastic-agent-libs to go 1.20 we can return multiple errors directly with errors.Join()
+		if len(errs) != 0 {
+			return nil, fmt.Errorf("unable to load instrumentation cas: %w", errors.Join(errs...))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
 // verifyPeerCertificate copied from elastic/apm-agent-go/transport/http.go with the following alterations:
 // - replaced use of pkg/errors with fmt
 func verifyPeerCertificate(rawCerts [][]byte, trusted *x509.Certificate) error {
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -169,6 +170,33 @@ func TestAPMHTTPTransportOptions(t *testing.T) {
 	})
 }
 
+func TestInstrumentationOTLP(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
+	var c InstrumentationOTLP
+	require.NoError(t, c.Validate())
+	assert.Equal(t, OTLPProtocolGRPC, c.GetProtocol())
+	assert.Equal(t, "localhost:4317", c.GetEndpoint())
+	assert.Equal(t, 10*time.Second, c.GetTimeout())
+
+	c.Protocol = OTLPProtocolHTTP
+	require.NoError(t, c.Validate())
+	assert.Equal(t, "http://localhost:4318", c.GetEndpoint())
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://collector:4318")
+	assert.Equal(t, "https://collector:4318", c.GetEndpoint())
+	c.Endpoint = "https://otel:4318"
+	assert.Equal(t, "https://otel:4318", c.GetEndpoint(), "the configuration has precedence")
+
+	c.Protocol = "http/json"
+	assert.Error(t, c.Validate())
+
+	i := &Instrumentation{OTLP: InstrumentationOTLP{Insecure: true}}
+	tlsConfig, err := i.OTLPTLSConfig()
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
 func testFile(t *testing.T, content string) string {
 	t.Helper()
 	f, err := os.CreateTemp(t.TempDir(), "")
@@ -5,14 +5,153 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
+// Keys used to identify the client of a request by keyed limits.
+const (
+	LimitByAgentID  = "agent_id"
+	LimitByAPIKeyID = "api_key_id"
+	LimitBySourceIP = "source_ip"
+)
+
+const (
+	defaultKeyedLimitMaxKeys         = 10000
+	defaultSourceConnMaxSources      = 10000
+	defaultSourceConnPrefixIPv4      = 32
+	defaultSourceConnPrefixIPv6      = 64
+	defaultAdaptiveBackoff           = 0.9
+	defaultAdaptiveBulkTargetLatency = time.Second
+)
+
 type Limit struct {
 	Interval time.Duration `config:"interval"`
 	Burst    int           `config:"burst"`
 	Max      int64         `config:"max"`
 	MaxBody  int64         `config:"max_body_byte_size"`
+
+	// Keyed is applied to every client of the route, in addition to the limits above shared by all clients.
+	Keyed KeyedLimit `config:"keyed"`
+
+	// Adaptive replaces the static Max concurrency limit with one adjusted to the observed latency.
+	Adaptive AdaptiveLimit `config:"adaptive"`
+}
+
+// AdaptiveLimit is a concurrency limit adjusted between Min and Max; it decreases when the handler
+// latency exceeds TargetLatency or the Elasticsearch bulk latency exceeds BulkTargetLatency, and
+// slowly increases otherwise. Max defaults to the Max of the route limit.
+//
+// A zero TargetLatency ignores the handler latency, as needed for the checkin long poll.
+type AdaptiveLimit struct {
+	Enabled           bool          `config:"enabled"`
+	Min               int64         `config:"min"`
+	Max               int64         `config:"max"`
+	TargetLatency     time.Duration `config:"target_latency"`
+	BulkTargetLatency time.Duration `config:"bulk_target_latency"`
+	Backoff           float64       `config:"backoff"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *AdaptiveLimit) Validate() error {
+	if c.Min < 0 || c.Max < 0 || c.TargetLatency < 0 || c.BulkTargetLatency < 0 {
+		return errors.New("adaptive limit values must not be negative")
+	}
+	if c.Max > 0 && c.Min > c.Max {
+		return errors.New("adaptive limit min must not exceed max")
+	}
+	if c.Backoff < 0 || c.Backoff >= 1 {
+		return errors.New("adaptive limit backoff must be between 0 and 1")
+	}
+	return nil
+}
+
+// SourceConnLimit limits the concurrent connections and the rate of new connections of every
+// source, before the TLS handshake. A source is the network of the client IP address with the
+// PrefixIPv4 or PrefixIPv6 length, the address itself by default for IPv4. The sources in Allow,
+// such as known NAT gateways, are not limited.
+//
+// The connections of at most MaxSources idle sources are tracked, the least recently seen ones are
+// dropped; the sources with open connections are not.
+type SourceConnLimit struct {
+	Max        int           `config:"max"`
+	Interval   time.Duration `config:"interval"`
+	Burst      int           `config:"burst"`
+	PrefixIPv4 int           `config:"prefix_ipv4"`
+	PrefixIPv6 int           `config:"prefix_ipv6"`
+	Allow      []string      `config:"allow"`
+	MaxSources int           `config:"max_sources"`
+}
+
+// Enabled returns true if connections are limited per source.
+func (c *SourceConnLimit) Enabled() bool {
+	return c.Max > 0 || c.Interval > 0
+}
+
+// Validate ensures that the configuration is valid.
+func (c *SourceConnLimit) Validate() error {
+	if c.Max < 0 || c.Interval < 0 || c.Burst < 0 || c.MaxSources < 0 {
+		return errors.New("source connection limit values must not be negative")
+	}
+	if c.PrefixIPv4 < 0 || c.PrefixIPv4 > 32 || c.PrefixIPv6 < 0 || c.PrefixIPv6 > 128 {
+		return errors.New("source connection limit prefix lengths must be valid for ipv4 and ipv6")
+	}
+	if _, err := ParseNetworks(c.Allow); err != nil {
+		return fmt.Errorf("invalid source connection limit allow: %w", err)
+	}
+	return nil
+}
+
+func (c *SourceConnLimit) loadDefaults() {
+	if c.Burst == 0 {
+		c.Burst = 1
+	}
+	if c.PrefixIPv4 == 0 {
+		c.PrefixIPv4 = defaultSourceConnPrefixIPv4
+	}
+	if c.PrefixIPv6 == 0 {
+		c.PrefixIPv6 = defaultSourceConnPrefixIPv6
+	}
+	if c.MaxSources == 0 {
+		c.MaxSources = defaultSourceConnMaxSources
+	}
+}
+
+// KeyedLimit is a rate and concurrency limit applied per client, identified by the agent id,
+// the API key id or the source IP of the request. Requests without the key are not limited.
+//
+// The limits are applied before the request is authenticated: the agent id and API key id keys
+// include a hash of the API key of the request, so a client that claims the id of another agent
+// or key without its secret does not use up its limits. Requests without an API key are not
+// limited per agent or key.
+//
+// The limits of at most MaxKeys idle clients are tracked, the least recently seen ones are dropped.
+// Burst defaults to 1 when Interval is set.
+type KeyedLimit struct {
+	By       string        `config:"by"`
+	Interval time.Duration `config:"interval"`
+	Burst    int           `config:"burst"`
+	Max      int64         `config:"max"`
+	MaxKeys  int           `config:"max_keys"`
+}
+
+// Enabled returns true if requests are limited per client.
+func (c *KeyedLimit) Enabled() bool {
+	return c.By != "" && (c.Interval > 0 || c.Max > 0)
+}
+
+// Validate ensures that the configuration is valid.
+func (c *KeyedLimit) Validate() error {
+	switch c.By {
+	case "", LimitByAgentID, LimitByAPIKeyID, LimitBySourceIP:
+	default:
+		return fmt.Errorf("keyed limit by must be one of %q, %q or %q", LimitByAgentID, LimitByAPIKeyID, LimitBySourceIP)
+	}
+	if c.Interval < 0 || c.Burst < 0 || c.Max < 0 || c.MaxKeys < 0 {
+		return errors.New("keyed limit values must not be negative")
+	}
+	return nil
 }
 
 type ServerLimits struct {
@@ -21,6 +160,12 @@ type ServerLimits struct {
 	MaxHeaderByteSize int           `config:"max_header_byte_size"`
 	MaxConnections    int           `config:"max_connections"`
 
+	// SourceConnections limits the connections of every client address or network, in addition to MaxConnections.
+	SourceConnections SourceConnLimit `config:"source_connections"`
+
+	// UploadTimeLimit is the time an agent has to complete a file upload after starting it.
+	UploadTimeLimit time.Duration `config:"upload_time_limit"`
+
 	CheckinLimit     Limit `config:"checkin_limit"`
 	ArtifactLimit    Limit `config:"artifact_limit"`
 	EnrollLimit      Limit `config:"enroll_limit"`
@@ -45,9 +190,13 @@ func (c *ServerLimits) LoadLimits(limits *envLimits) {
 	if c.MaxConnections == 0 {
 		c.MaxConnections = l.MaxConnections
 	}
+	c.SourceConnections.loadDefaults()
 	if c.PolicyThrottle == 0 {
 		c.PolicyThrottle = l.PolicyThrottle
 	}
+	if c.UploadTimeLimit == 0 {
+		c.UploadTimeLimit = defaultUploadTimeLimit
+	}
 
 	c.CheckinLimit = mergeEnvLimit(c.CheckinLimit, l.CheckinLimit)
 	c.ArtifactLimit = mergeEnvLimit(c.ArtifactLimit, l.ArtifactLimit)
@@ -65,6 +214,8 @@ func mergeEnvLimit(L Limit, l limit) Limit {
 		Burst:    L.Burst,
 		Max:      L.Max,
 		MaxBody:  L.MaxBody,
+		Keyed:    L.Keyed,
+		Adaptive: L.Adaptive,
 	}
 	if result.Interval == 0 {
 		result.Interval = l.Interval
@@ -78,5 +229,17 @@ func mergeEnvLimit(L Limit, l limit) Limit {
 	if result.MaxBody == 0 {
 		result.MaxBody = l.MaxBody
 	}
+	if result.Keyed.MaxKeys == 0 {
+		result.Keyed.MaxKeys = defaultKeyedLimitMaxKeys
+	}
+	if result.Keyed.Interval > 0 && result.Keyed.Burst == 0 {
+		result.Keyed.Burst = 1
+	}
+	if result.Adaptive.Backoff == 0 {
+		result.Adaptive.Backoff = defaultAdaptiveBackoff
+	}
+	if result.Adaptive.BulkTargetLatency == 0 {
+		result.Adaptive.BulkTargetLatency = defaultAdaptiveBulkTargetLatency
+	}
 	return result
 }
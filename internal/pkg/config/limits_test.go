@@ -0,0 +1,157 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    map[string]interface{}
+		expect *KeyedLimit
+	}{{
+		name:   "disabled by default",
+		cfg:    map[string]interface{}{},
+		expect: &KeyedLimit{MaxKeys: defaultKeyedLimitMaxKeys},
+	}, {
+		name:   "by agent id",
+		cfg:    map[string]interface{}{"by": "agent_id", "interval": "1s", "burst": 5, "max": 2},
+		expect: &KeyedLimit{By: LimitByAgentID, Interval: time.Second, Burst: 5, Max: 2, MaxKeys: defaultKeyedLimitMaxKeys},
+	}, {
+		name:   "max keys",
+		cfg:    map[string]interface{}{"by": "source_ip", "max": 2, "max_keys": 100},
+		expect: &KeyedLimit{By: LimitBySourceIP, Max: 2, MaxKeys: 100},
+	}, {
+		name:   "default burst",
+		cfg:    map[string]interface{}{"by": "agent_id", "interval": "1s"},
+		expect: &KeyedLimit{By: LimitByAgentID, Interval: time.Second, Burst: 1, MaxKeys: defaultKeyedLimitMaxKeys},
+	}, {
+		name: "unknown key",
+		cfg:  map[string]interface{}{"by": "user_agent", "max": 2},
+	}, {
+		name: "negative max",
+		cfg:  map[string]interface{}{"by": "api_key_id", "max": -1},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{
+				"checkin_limit": map[string]interface{}{"keyed": tc.cfg},
+			})
+			require.NoError(t, err)
+
+			var l ServerLimits
+			err = c.Unpack(&l)
+			if tc.expect == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			l.InitDefaults()
+			assert.Equal(t, *tc.expect, l.CheckinLimit.Keyed)
+			assert.Equal(t, *tc.expect == KeyedLimit{MaxKeys: defaultKeyedLimitMaxKeys}, !l.CheckinLimit.Keyed.Enabled())
+		})
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    map[string]interface{}
+		expect *AdaptiveLimit
+	}{{
+		name:   "defaults",
+		cfg:    map[string]interface{}{"enabled": true},
+		expect: &AdaptiveLimit{Enabled: true, Backoff: defaultAdaptiveBackoff, BulkTargetLatency: defaultAdaptiveBulkTargetLatency},
+	}, {
+		name:   "bounds",
+		cfg:    map[string]interface{}{"enabled": true, "min": 5, "max": 50, "target_latency": "2s", "backoff": 0.7},
+		expect: &AdaptiveLimit{Enabled: true, Min: 5, Max: 50, TargetLatency: 2 * time.Second, BulkTargetLatency: defaultAdaptiveBulkTargetLatency, Backoff: 0.7},
+	}, {
+		name: "min over max",
+		cfg:  map[string]interface{}{"enabled": true, "min": 10, "max": 5},
+	}, {
+		name: "invalid backoff",
+		cfg:  map[string]interface{}{"enabled": true, "backoff": 1.5},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{
+				"ack_limit": map[string]interface{}{"adaptive": tc.cfg},
+			})
+			require.NoError(t, err)
+
+			var l ServerLimits
+			err = c.Unpack(&l)
+			if tc.expect == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			l.InitDefaults()
+			assert.Equal(t, *tc.expect, l.AckLimit.Adaptive)
+		})
+	}
+}
+
+func TestSourceConnLimit(t *testing.T) {
+	defaults := SourceConnLimit{Burst: 1, PrefixIPv4: 32, PrefixIPv6: 64, MaxSources: defaultSourceConnMaxSources}
+	tests := []struct {
+		name   string
+		cfg    map[string]interface{}
+		expect *SourceConnLimit
+	}{{
+		name:   "disabled by default",
+		cfg:    map[string]interface{}{},
+		expect: &defaults,
+	}, {
+		name: "networks",
+		cfg: map[string]interface{}{
+			"max": 20, "interval": "100ms", "burst": 10, "prefix_ipv4": 24, "prefix_ipv6": 48,
+			"allow": []string{"10.0.0.1", "192.168.0.0/16"},
+		},
+		expect: &SourceConnLimit{
+			Max: 20, Interval: 100 * time.Millisecond, Burst: 10, PrefixIPv4: 24, PrefixIPv6: 48,
+			Allow: []string{"10.0.0.1", "192.168.0.0/16"}, MaxSources: defaultSourceConnMaxSources,
+		},
+	}, {
+		name: "negative max",
+		cfg:  map[string]interface{}{"max": -1},
+	}, {
+		name: "invalid prefix",
+		cfg:  map[string]interface{}{"max": 10, "prefix_ipv4": 33},
+	}, {
+		name: "invalid allow",
+		cfg:  map[string]interface{}{"max": 10, "allow": []string{"gateway"}},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{"source_connections": tc.cfg})
+			require.NoError(t, err)
+
+			var l ServerLimits
+			err = c.Unpack(&l)
+			if tc.expect == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			l.InitDefaults()
+			assert.Equal(t, *tc.expect, l.SourceConnections)
+			assert.Equal(t, tc.expect != &defaults, l.SourceConnections.Enabled())
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// Groups of routes that can be enabled on a listener.
+const (
+	RouteGroupCheckin   = "checkin" // checkin and acks
+	RouteGroupEnroll    = "enroll"
+	RouteGroupArtifacts = "artifacts"
+	RouteGroupUploads   = "uploads"
+	RouteGroupStatus    = "status"
+)
+
+// RouteGroups lists the groups of routes, all of them are enabled on a listener without routes.
+var RouteGroups = []string{RouteGroupCheckin, RouteGroupEnroll, RouteGroupArtifacts, RouteGroupUploads, RouteGroupStatus}
+
+const defaultListenerName = "default"
+
+// Listener is a named listener of the server, bound to a TCP address or a unix domain socket.
+//
+// The TLS settings and the limits of the server are used when they are not set on the listener.
+type Listener struct {
+	Name   string                  `config:"name"`
+	Host   string                  `config:"host"`
+	Port   uint16                  `config:"port"`
+	Socket string                  `config:"socket"` // Path of a unix domain socket, used instead of host and port
+	TLS    *tlscommon.ServerConfig `config:"ssl"`
+	Routes []string                `config:"routes"` // Route groups served by the listener, all if empty
+	Limits *ServerLimits           `config:"limits"`
+}
+
+// Validate ensures that the configuration is valid.
+func (c *Listener) Validate() error {
+	if c.Name == "" {
+		return errors.New("listener name is required")
+	}
+	if c.Socket == "" && c.Port == 0 {
+		return fmt.Errorf("listener %q requires a port or a socket", c.Name)
+	}
+	if c.Socket != "" && (c.Host != "" || c.Port != 0) {
+		return fmt.Errorf("listener %q can not have both a socket and a host or port", c.Name)
+	}
+	for _, route := range c.Routes {
+		if !isRouteGroup(route) {
+			return fmt.Errorf("listener %q has unknown route group %q", c.Name, route)
+		}
+	}
+	return nil
+}
+
+// BindAddress returns the network, tcp or unix, and the address the listener binds to.
+func (c *Listener) BindAddress() (network, address string) {
+	if c.Socket != "" {
+		return "unix", c.Socket
+	}
+	host := c.Host
+	if host == "" {
+		host = kDefaultHost
+	}
+	return "tcp", bindAddress(host, c.Port)
+}
+
+// BindListeners returns the listeners of the server; the configured listeners, or a listener serving
+// every route on host and port when none are configured. The internal listener is not included.
+func (c *Server) BindListeners() []Listener {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+	return []Listener{{
+		Name: defaultListenerName,
+		Host: c.Host,
+		Port: c.Port,
+	}}
+}
+
+// ListenerServer returns the configuration of the server for the listener l: the configuration of
+// c with the address, TLS settings and limits of l.
+func (c *Server) ListenerServer(l *Listener) Server {
+	srv := *c
+	srv.Listeners = nil
+	if l.Socket == "" {
+		srv.Host = l.Host
+		srv.Port = l.Port
+	}
+	if l.TLS != nil {
+		srv.TLS = l.TLS
+	}
+	if l.Limits != nil {
+		srv.Limits = *l.Limits
+	}
+	return srv
+}
+
+func validateListeners(listeners []Listener) error {
+	names := make(map[string]struct{}, len(listeners))
+	for i := range listeners {
+		l := &listeners[i]
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		if _, ok := names[l.Name]; ok {
+			return fmt.Errorf("duplicate listener name %q", l.Name)
+		}
+		names[l.Name] = struct{}{}
+	}
+	return nil
+}
+
+func isRouteGroup(name string) bool {
+	for _, group := range RouteGroups {
+		if group == name {
+			return true
+		}
+	}
+	return false
+}
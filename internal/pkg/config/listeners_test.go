@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package config
+
+import (
+	"testing"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListeners(t *testing.T) {
+	tests := []struct {
+		name      string
+		listeners []interface{}
+		err       bool
+	}{{
+		name: "tcp and unix",
+		listeners: []interface{}{
+			map[string]interface{}{"name": "agents", "port": 8220, "routes": []string{"checkin", "artifacts", "status"}},
+			map[string]interface{}{"name": "enroll", "host": "10.0.0.1", "port": 8222, "routes": []string{"enroll"}},
+			map[string]interface{}{"name": "local", "socket": "/run/fleet-server.sock"},
+		},
+	}, {
+		name:      "missing name",
+		listeners: []interface{}{map[string]interface{}{"port": 8220}},
+		err:       true,
+	}, {
+		name:      "missing address",
+		listeners: []interface{}{map[string]interface{}{"name": "agents"}},
+		err:       true,
+	}, {
+		name:      "socket and port",
+		listeners: []interface{}{map[string]interface{}{"name": "agents", "port": 8220, "socket": "/run/fleet-server.sock"}},
+		err:       true,
+	}, {
+		name:      "unknown route group",
+		listeners: []interface{}{map[string]interface{}{"name": "agents", "port": 8220, "routes": []string{"policies"}}},
+		err:       true,
+	}, {
+		name: "duplicate name",
+		listeners: []interface{}{
+			map[string]interface{}{"name": "agents", "port": 8220},
+			map[string]interface{}{"name": "agents", "port": 8222},
+		},
+		err: true,
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{"listeners": tc.listeners})
+			require.NoError(t, err)
+
+			var s Server
+			s.InitDefaults()
+			err = c.Unpack(&s)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, s.BindListeners(), len(tc.listeners))
+		})
+	}
+}
+
+func TestListenerServer(t *testing.T) {
+	c, err := ucfg.NewFrom(map[string]interface{}{
+		"host":   "localhost",
+		"limits": map[string]interface{}{"max_connections": 100},
+		"listeners": []interface{}{
+			map[string]interface{}{"name": "agents", "host": "10.0.0.1", "port": 8220},
+			map[string]interface{}{
+				"name":   "uploads",
+				"socket": "/run/fleet-server.sock",
+				"limits": map[string]interface{}{"upload_chunk_limit": map[string]interface{}{"max_body_byte_size": 1024}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	var s Server
+	s.InitDefaults()
+	require.NoError(t, c.Unpack(&s))
+	listeners := s.BindListeners()
+
+	network, addr := listeners[0].BindAddress()
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "10.0.0.1:8220", addr)
+	agents := s.ListenerServer(&listeners[0])
+	assert.Equal(t, "10.0.0.1", agents.Host)
+	assert.Equal(t, 100, agents.Limits.MaxConnections, "server limits are used by default")
+	assert.Nil(t, agents.Listeners)
+
+	network, addr = listeners[1].BindAddress()
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/run/fleet-server.sock", addr)
+	uploads := s.ListenerServer(&listeners[1])
+	assert.Equal(t, "localhost", uploads.Host)
+	assert.Equal(t, int64(1024), uploads.Limits.UploadChunkLimit.MaxBody)
+	assert.Equal(t, 8192, uploads.Limits.MaxHeaderByteSize, "listener limits have defaults")
+	assert.Equal(t, 100, s.Limits.MaxConnections)
+
+	s.Listeners = nil
+	listeners = s.BindListeners()
+	require.Len(t, listeners, 1)
+	_, addr = listeners[0].BindAddress()
+	assert.Equal(t, s.BindAddress(), addr, "the listener defaults to host and port")
+}
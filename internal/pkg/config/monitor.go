@@ -7,16 +7,22 @@ package config
 import "time"
 
 const (
-	defaultFetchSize   = 1000
-	defaultPollTimeout = 4 * time.Minute
+	defaultFetchSize             = 1000
+	defaultPollTimeout           = 4 * time.Minute
+	defaultPolicyRevisionHistory = 5
 )
 
 type Monitor struct {
 	FetchSize   int           `config:"fetch_size"`
 	PollTimeout time.Duration `config:"poll_timeout"`
+
+	// PolicyRevisionHistory is the number of previous revisions the policy monitor retains per
+	// policy in order to send policy changes as patches; 0 or a negative value disables it.
+	PolicyRevisionHistory int `config:"policy_revision_history"`
 }
 
 func (m *Monitor) InitDefaults() {
 	m.FetchSize = defaultFetchSize
 	m.PollTimeout = defaultPollTimeout
+	m.PolicyRevisionHistory = defaultPolicyRevisionHistory
 }
@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const defaultProxyHeaderTimeout = 5 * time.Second
+
+// ProxyProtocol is the configuration of the PROXY protocol (v1 and v2) on the listeners.
+//
+// The PROXY header is only read from the connections of the Trusted sources, which are required
+// when enabled; connections without a header keep their address.
+type ProxyProtocol struct {
+	Enabled       bool          `config:"enabled"`
+	Trusted       []string      `config:"trusted"`
+	HeaderTimeout time.Duration `config:"header_timeout"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *ProxyProtocol) InitDefaults() {
+	c.HeaderTimeout = defaultProxyHeaderTimeout
+}
+
+// Validate ensures that the configuration is valid.
+func (c *ProxyProtocol) Validate() error {
+	if _, err := ParseNetworks(c.Trusted); err != nil {
+		return fmt.Errorf("invalid proxy_protocol.trusted: %w", err)
+	}
+	if c.Enabled && len(c.Trusted) == 0 {
+		return errors.New("proxy_protocol.trusted must list the load balancers when proxy_protocol is enabled")
+	}
+	return nil
+}
+
+// ParseNetworks parses a list of IP addresses and CIDR ranges.
+func ParseNetworks(addrs []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if strings.Contains(addr, "/") {
+			prefix, err := netip.ParsePrefix(addr)
+			if err != nil {
+				return nil, err
+			}
+			networks = append(networks, prefix.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+	}
+	return networks, nil
+}
@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package config
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", " 192.0.2.1 ", "2001:db8::1/32", "::ffff:192.0.2.2"})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("192.0.2.2/32"),
+	}, networks)
+
+	_, err = ParseNetworks([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = ParseNetworks([]string{"proxy.example.com"})
+	assert.Error(t, err)
+
+	srv := Server{TrustedProxies: []string{"not-an-ip"}}
+	assert.Error(t, srv.Validate())
+	pp := ProxyProtocol{Trusted: []string{"10.0.0.0/8"}}
+	assert.NoError(t, pp.Validate())
+	pp = ProxyProtocol{Enabled: true}
+	assert.Error(t, pp.Validate(), "proxy protocol requires trusted sources")
+	pp.Trusted = []string{"10.0.0.0/8"}
+	assert.NoError(t, pp.Validate())
+}
@@ -0,0 +1,45 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+const defaultRolloutSoakTime = 10 * time.Minute
+
+// PolicyRollout is the rollout ordering used when a new revision of a policy is delivered.
+//
+// Agents in the canary set, selected by tag or by percentage of agents, receive the revision first.
+// The remaining agents follow once the soak time has passed without a canary reporting a failure.
+type PolicyRollout struct {
+	PolicyID      string        `config:"policy_id"`
+	CanaryTags    []string      `config:"canary_tags"`
+	CanaryPercent int           `config:"canary_percent"`
+	SoakTime      time.Duration `config:"soak_time"`
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *PolicyRollout) InitDefaults() {
+	c.SoakTime = defaultRolloutSoakTime
+}
+
+// Validate ensures that the configuration is valid.
+func (c *PolicyRollout) Validate() error {
+	if c.PolicyID == "" {
+		return errors.New("policy rollout requires a policy_id")
+	}
+	if c.CanaryPercent < 0 || c.CanaryPercent > 100 {
+		return errors.New("policy rollout canary_percent must be between 0 and 100")
+	}
+	if len(c.CanaryTags) == 0 && c.CanaryPercent == 0 {
+		return errors.New("policy rollout requires canary_tags or canary_percent")
+	}
+	if c.SoakTime < 0 {
+		return errors.New("policy rollout soak_time must not be negative")
+	}
+	return nil
+}
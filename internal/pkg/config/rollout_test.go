@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyRollouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    map[string]interface{}
+		expect *PolicyRollout
+	}{{
+		name:   "tags with default soak time",
+		cfg:    map[string]interface{}{"policy_id": "p", "canary_tags": []string{"canary"}},
+		expect: &PolicyRollout{PolicyID: "p", CanaryTags: []string{"canary"}, SoakTime: defaultRolloutSoakTime},
+	}, {
+		name:   "percent",
+		cfg:    map[string]interface{}{"policy_id": "p", "canary_percent": 5, "soak_time": "1m"},
+		expect: &PolicyRollout{PolicyID: "p", CanaryPercent: 5, SoakTime: time.Minute},
+	}, {
+		name: "missing policy id",
+		cfg:  map[string]interface{}{"canary_percent": 5},
+	}, {
+		name: "no canary set",
+		cfg:  map[string]interface{}{"policy_id": "p"},
+	}, {
+		name: "invalid percent",
+		cfg:  map[string]interface{}{"policy_id": "p", "canary_percent": 101},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ucfg.NewFrom(map[string]interface{}{
+				"policy_rollouts": []interface{}{tc.cfg},
+			})
+			require.NoError(t, err)
+
+			var s Server
+			s.InitDefaults()
+			err = c.Unpack(&s)
+			if tc.expect == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, s.PolicyRollouts, 1)
+			assert.Equal(t, *tc.expect, s.PolicyRollouts[0])
+		})
+	}
+}
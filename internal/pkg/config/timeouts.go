@@ -18,6 +18,8 @@ type ServerTimeouts struct {
 	CheckinLongPoll  time.Duration `config:"checkin_long_poll"`
 	CheckinJitter    time.Duration `config:"checkin_jitter"`
 	CheckinMaxPoll   time.Duration `config:"checkin_max_poll"`
+	Drain            time.Duration `config:"drain"`
+	PreDrain         time.Duration `config:"pre_drain"`
 }
 
 // InitDefaults initializes the defaults for the configuration.
@@ -64,4 +66,13 @@ func (c *ServerTimeouts) InitDefaults() {
 	// The long poll value is poll_timeout-2m, and the request's write timeout is set to poll_timeout-1m
 	// CheckinMaxPoll values of less then 1m are effectively ignored and a 1m limit is used.
 	c.CheckinMaxPoll = time.Hour
+
+	// Drain is the time given on shutdown to the requests in flight to complete once the server
+	// stops accepting connections; pending long polls are answered early. Disabled if zero.
+	c.Drain = 10 * time.Second
+
+	// PreDrain is the time on shutdown during which the server keeps accepting connections while its
+	// status reports it is stopping, before it drains; load balancers stop routing to it meanwhile.
+	// Disabled if zero.
+	c.PreDrain = 0
 }
@@ -0,0 +1,57 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultTLSBootstrapPath        = "data/tls"
+	defaultTLSBootstrapValidity    = 90 * 24 * time.Hour
+	defaultTLSBootstrapRenewBefore = 30 * 24 * time.Hour
+)
+
+// TLSBootstrap serves TLS with a certificate issued by a local certificate authority when the
+// server has no ssl configuration.
+//
+// The certificate authority and the server certificate are generated on the first start and
+// stored in Path; the server certificate is valid for the host of the server, its listeners and
+// the Hosts, and is renewed RenewBefore it expires.
+//
+// The generated certificate authority is specific to each fleet-server. The fleet-servers behind
+// the same address share the certificate authority of the CertificateAuthority and
+// CertificateAuthorityKey files instead, it is then only used to issue their server certificates.
+type TLSBootstrap struct {
+	Enabled                 bool          `config:"enabled"`
+	Path                    string        `config:"path"`
+	Hosts                   []string      `config:"hosts"` // Additional host names and IPs of the server certificate
+	Validity                time.Duration `config:"validity"`
+	RenewBefore             time.Duration `config:"renew_before"`
+	CertificateAuthority    string        `config:"certificate_authority"`     // PEM certificate file of a shared certificate authority
+	CertificateAuthorityKey string        `config:"certificate_authority_key"` // PEM EC or PKCS #8 private key file of a shared certificate authority
+}
+
+// InitDefaults initializes the defaults for the configuration.
+func (c *TLSBootstrap) InitDefaults() {
+	c.Path = defaultTLSBootstrapPath
+	c.Validity = defaultTLSBootstrapValidity
+	c.RenewBefore = defaultTLSBootstrapRenewBefore
+}
+
+// Validate ensures that the configuration is valid.
+func (c *TLSBootstrap) Validate() error {
+	if c.Validity <= 0 || c.RenewBefore <= 0 {
+		return errors.New("ssl_bootstrap validity and renew_before must be positive")
+	}
+	if c.RenewBefore >= c.Validity {
+		return errors.New("ssl_bootstrap renew_before must be less than the validity")
+	}
+	if (c.CertificateAuthority == "") != (c.CertificateAuthorityKey == "") {
+		return errors.New("ssl_bootstrap certificate_authority and certificate_authority_key must be set together")
+	}
+	return nil
+}
@@ -6,10 +6,13 @@ package dl
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 )
 
@@ -20,6 +23,8 @@ const (
 var (
 	QueryAgentByAssessAPIKeyID = prepareAgentFindByAccessAPIKeyID()
 	QueryAgentByID             = prepareAgentFindByID()
+	QueryInactiveAgents        = prepareFindInactiveAgents()
+	QueryRecentAgents          = prepareFindRecentAgents()
 )
 
 func prepareAgentFindByID() *dsl.Tmpl {
@@ -52,3 +57,101 @@ func FindAgent(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, name strin
 
 	return agent, nil
 }
+
+func prepareFindInactiveAgents() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	query := root.Query().Bool()
+	filter := query.Filter()
+	filter.Term(FieldActive, true, nil)
+	filter.Term(FieldPolicyID, tmpl.Bind(FieldPolicyID), nil)
+	// agents that never checked in are inactive once they are enrolled for longer than the cutoff
+	cutoff := tmpl.Bind(FieldLastCheckin)
+	mustNot := query.MustNot()
+	mustNot.Terms(FieldID, tmpl.Bind(FieldID), nil)
+	mustNot.Range(FieldLastCheckin, dsl.WithRangeGT(cutoff))
+	should := query.Should()
+	should.Range(FieldLastCheckin, dsl.WithRangeLTE(cutoff))
+	should.Range(FieldEnrolledAt, dsl.WithRangeLTE(cutoff))
+	query.MinimumShouldMatch(1)
+	root.Sort().SortOrder(FieldLastCheckin, dsl.SortAscend)
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// FindInactiveAgents returns up to size active agents enrolled in the policy that have not checked in since lastCheckin,
+// including the agents that never checked in and were enrolled before lastCheckin.
+// lastCheckin may be a date or date math expression, agents with IDs in skip are not returned.
+func FindInactiveAgents(ctx context.Context, bulker bulk.Bulk, policyID string, lastCheckin string, skip []string, size int, opt ...Option) ([]model.Agent, error) {
+	o := newOption(FleetAgents, opt...)
+	if skip == nil {
+		skip = []string{}
+	}
+	res, err := Search(ctx, bulker, QueryInactiveAgents, o.indexName, map[string]interface{}{
+		FieldPolicyID:    policyID,
+		FieldLastCheckin: lastCheckin,
+		FieldID:          skip,
+		FieldSize:        size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed searching for inactive agents: %w", err)
+	}
+
+	agents := make([]model.Agent, len(res.Hits))
+	for i := range res.Hits {
+		if err := res.Hits[i].Unmarshal(&agents[i]); err != nil {
+			return nil, fmt.Errorf("could not unmarshal ES document into model.Agent: %w", err)
+		}
+	}
+	return agents, nil
+}
+
+func prepareFindRecentAgents() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Query().Bool().Filter().Term(FieldActive, true, nil)
+	root.Source().Includes(FieldAccessAPIKeyID)
+	root.Sort().SortOrder(FieldLastCheckin, dsl.SortDescend)
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// FindRecentAgents returns up to size active agents, most recently checked in first.
+// Only the id and the access API key id of the agents are returned.
+func FindRecentAgents(ctx context.Context, bulker bulk.Bulk, size int, opt ...Option) ([]model.Agent, error) {
+	o := newOption(FleetAgents, opt...)
+	res, err := SearchWithOneParam(ctx, bulker, QueryRecentAgents, o.indexName, FieldSize, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed searching for recent agents: %w", err)
+	}
+
+	agents := make([]model.Agent, len(res.Hits))
+	for i := range res.Hits {
+		if err := res.Hits[i].Unmarshal(&agents[i]); err != nil {
+			return nil, fmt.Errorf("could not unmarshal ES document into model.Agent: %w", err)
+		}
+	}
+	return agents, nil
+}
+
+// ReadAgent reads the agent document by id. Unlike FindAgent, the read is real time and batched
+// with other reads by the bulker.
+func ReadAgent(ctx context.Context, bulker bulk.Bulk, id string, opt ...Option) (model.Agent, error) {
+	o := newOption(FleetAgents, opt...)
+	data, err := bulker.Read(ctx, o.indexName, id)
+	if err != nil {
+		if errors.Is(err, es.ErrElasticNotFound) {
+			return model.Agent{}, ErrNotFound
+		}
+		return model.Agent{}, fmt.Errorf("failed reading agent: %w", err)
+	}
+
+	var agent model.Agent
+	if err := json.Unmarshal(data, &agent); err != nil {
+		return model.Agent{}, fmt.Errorf("could not unmarshal ES document into model.Agent: %w", err)
+	}
+	agent.Id = id
+	return agent, nil
+}
@@ -65,3 +65,34 @@ func TestFindAgent_NewModel(t *testing.T) {
 	assert.Equal(t, agentID, agent.Id)
 	assert.Equal(t, wantOutputs, agent.Outputs)
 }
+
+func TestFindInactiveAgents(t *testing.T) {
+	ctx := context.Background()
+	index, bulker := ftesting.SetupCleanIndex(ctx, t, FleetAgents)
+
+	policyID := uuid.Must(uuid.NewV4()).String()
+	now := time.Now().UTC()
+
+	agents := map[string]model.Agent{
+		"inactive":     {PolicyID: policyID, Active: true, LastCheckin: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		"skipped":      {PolicyID: policyID, Active: true, LastCheckin: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		"recent":       {PolicyID: policyID, Active: true, LastCheckin: now.Format(time.RFC3339)},
+		"unenrolled":   {PolicyID: policyID, Active: false, LastCheckin: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		"other-policy": {PolicyID: "other", Active: true, LastCheckin: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		"never":        {PolicyID: policyID, Active: true, EnrolledAt: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		"enrolled":     {PolicyID: policyID, Active: true, EnrolledAt: now.Format(time.RFC3339)},
+		"checked-in":   {PolicyID: policyID, Active: true, EnrolledAt: now.Add(-2 * time.Hour).Format(time.RFC3339), LastCheckin: now.Format(time.RFC3339)},
+	}
+	for id, agent := range agents {
+		body, err := json.Marshal(agent)
+		require.NoError(t, err)
+		_, err = bulker.Create(ctx, index, id, body, bulk.WithRefresh())
+		require.NoError(t, err)
+	}
+
+	found, err := FindInactiveAgents(ctx, bulker, policyID, "now-1h", []string{"skipped"}, 10, WithIndexName(index))
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "inactive", found[0].Id)
+	assert.Equal(t, "never", found[1].Id, "agents that never checked in are sorted last")
+}
@@ -15,7 +15,10 @@ const (
 	FleetEnrollmentAPIKeys = ".fleet-enrollment-api-keys"
 	FleetPolicies          = ".fleet-policies"
 	FleetPoliciesLeader    = ".fleet-policies-leader"
+	FleetPolicyPins        = ".fleet-policy-pins"
+	FleetPolicyRollouts    = ".fleet-policy-rollouts"
 	FleetServers           = ".fleet-servers"
+	FleetSchedulesLeader   = ".fleet-schedules-leader"
 )
 
 // Query fields
@@ -27,9 +30,13 @@ const (
 	FieldMaxSeqNo    = "max_seq_no"
 	FieldActionSeqNo = "action_seq_no"
 
+	FieldTimestamp = "@timestamp"
+	FieldServerID  = "server.id"
+
 	FieldActionID                      = "action_id"
 	FieldAgent                         = "agent"
 	FieldAgentVersion                  = "version"
+	FieldClientCertificateIdentity     = "client_certificate_identity"
 	FieldCoordinatorIdx                = "coordinator_idx"
 	FieldLastCheckin                   = "last_checkin"
 	FieldLastCheckinStatus             = "last_checkin_status"
@@ -45,9 +52,11 @@ const (
 	FieldPolicyRevisionIdx             = "policy_revision_idx"
 	FieldRevisionIdx                   = "revision_idx"
 	FieldUnenrolledReason              = "unenrolled_reason"
+	FieldValidationError               = "validation_error"
 	FiledType                          = "type"
 
 	FieldActive           = "active"
+	FieldEnrolledAt       = "enrolled_at"
 	FieldUpdatedAt        = "updated_at"
 	FieldUnenrolledAt     = "unenrolled_at"
 	FieldUpgradedAt       = "upgraded_at"
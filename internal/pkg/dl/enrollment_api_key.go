@@ -21,6 +21,7 @@ const (
 var (
 	QueryEnrollmentAPIKeyByID       = prepareFindActiveEnrollmentAPIKeyByID()
 	QueryEnrollmentAPIKeyByPolicyID = prepareFindActiveEnrollmentAPIKeyByPolicyID()
+	QueryActiveEnrollmentAPIKeys    = prepareFindActiveEnrollmentAPIKeys()
 )
 
 func prepareFindActiveEnrollmentAPIKeyByID() *dsl.Tmpl {
@@ -47,6 +48,23 @@ func prepareFindActiveEnrollmentAPIKeyByPolicyID() *dsl.Tmpl {
 	return tmpl
 }
 
+func prepareFindActiveEnrollmentAPIKeys() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+
+	root := dsl.NewRoot()
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldActive, true, nil)
+	root.WithSize(tmpl.Bind(FieldSize))
+
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// FindActiveEnrollmentAPIKeys returns up to size active enrollment API keys.
+func FindActiveEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, size int) ([]model.EnrollmentAPIKey, error) {
+	return findEnrollmentAPIKeys(ctx, bulker, FleetEnrollmentAPIKeys, QueryActiveEnrollmentAPIKeys, FieldSize, size)
+}
+
 func FindEnrollmentAPIKey(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, field string, id string) (rec model.EnrollmentAPIKey, err error) {
 	return findEnrollmentAPIKey(ctx, bulker, FleetEnrollmentAPIKeys, tmpl, field, id)
 }
@@ -70,7 +88,7 @@ func FindEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl
 	return findEnrollmentAPIKeys(ctx, bulker, FleetEnrollmentAPIKeys, tmpl, field, id)
 }
 
-func findEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, index string, tmpl *dsl.Tmpl, field string, id string) ([]model.EnrollmentAPIKey, error) {
+func findEnrollmentAPIKeys(ctx context.Context, bulker bulk.Bulk, index string, tmpl *dsl.Tmpl, field string, id interface{}) ([]model.EnrollmentAPIKey, error) {
 	res, err := SearchWithOneParam(ctx, bulker, tmpl, index, field, id)
 	if err != nil {
 		return nil, err
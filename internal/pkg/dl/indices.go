@@ -0,0 +1,106 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+)
+
+// The indices that are not registered by the Elasticsearch fleet plugin are created by fleet-server,
+// so that their documents are not mapped dynamically.
+const (
+	indexSettings = `{
+		"index.hidden": true,
+		"index.number_of_shards": 1,
+		"index.auto_expand_replicas": "0-1"
+	}`
+
+	// MappingScheduleLease is the mapping of the FleetSchedulesLeader index.
+	MappingScheduleLease = `{
+		"dynamic": false,
+		"properties": {
+			"@timestamp": {"type": "date"},
+			"expires_at": {"type": "date"},
+			"schedule": {"type": "keyword"},
+			"server": {
+				"properties": {
+					"id": {"type": "keyword"},
+					"version": {"type": "keyword"}
+				}
+			},
+			"token": {"type": "long"}
+		}
+	}`
+
+	// MappingPolicyPin is the mapping of the FleetPolicyPins index.
+	MappingPolicyPin = `{
+		"dynamic": false,
+		"properties": {
+			"@timestamp": {"type": "date"},
+			"pinned_revision_idx": {"type": "long"},
+			"policy_id": {"type": "keyword"}
+		}
+	}`
+
+	// MappingPolicyRollout is the mapping of the FleetPolicyRollouts index.
+	MappingPolicyRollout = `{
+		"dynamic": false,
+		"properties": {
+			"@timestamp": {"type": "date"},
+			"coordinator_idx": {"type": "long"},
+			"good_coordinator_idx": {"type": "long"},
+			"good_revision_idx": {"type": "long"},
+			"policy_id": {"type": "keyword"},
+			"revision_idx": {"type": "long"},
+			"seq": {"type": "long"},
+			"soak_until": {"type": "date"},
+			"state": {"type": "keyword"}
+		}
+	}`
+)
+
+var fleetServerIndices = map[string]string{
+	FleetSchedulesLeader: MappingScheduleLease,
+	FleetPolicyPins:      MappingPolicyPin,
+	FleetPolicyRollouts:  MappingPolicyRollout,
+}
+
+// EnsureIndices creates the indices owned by fleet-server with their mappings, the indices that exist are left as is.
+func EnsureIndices(ctx context.Context, bulker bulk.Bulk) error {
+	for index, mapping := range fleetServerIndices {
+		if err := ensureIndex(ctx, bulker, index, mapping); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureIndex(ctx context.Context, bulker bulk.Bulk, index, mapping string) error {
+	client := bulker.Client()
+
+	body := fmt.Sprintf(`{"settings": %s, "mappings": %s}`, indexSettings, mapping)
+	res, err := client.Indices.Create(index,
+		client.Indices.Create.WithBody(strings.NewReader(body)),
+		client.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		// Another fleet-server or the fleet plugin created the index
+		if res.StatusCode == http.StatusBadRequest && strings.Contains(res.String(), "resource_already_exists_exception") {
+			return nil
+		}
+		return fmt.Errorf("create index %s failed: %s", index, res.String())
+	}
+	return nil
+}
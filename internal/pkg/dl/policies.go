@@ -17,6 +17,8 @@ import (
 
 var (
 	tmplQueryLatestPolicies = prepareQueryLatestPolicies()
+	tmplQueryPolicyRevision = prepareQueryPolicyRevision()
+	tmplQueryLatestRevision = prepareQueryLatestRevision()
 	ErrMissingAggregations  = errors.New("missing expected aggregation result")
 )
 
@@ -33,6 +35,34 @@ func prepareQueryLatestPolicies() []byte {
 	return root.MustMarshalJSON()
 }
 
+func prepareQueryPolicyRevision() *dsl.Tmpl {
+	root := dsl.NewRoot()
+	tmpl := dsl.NewTmpl()
+
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldPolicyID, tmpl.Bind(FieldPolicyID), nil)
+	filter.Term(FieldRevisionIdx, tmpl.Bind(FieldRevisionIdx), nil)
+	root.Size(1)
+	root.Sort().SortOrder(FieldCoordinatorIdx, dsl.SortDescend)
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+func prepareQueryLatestRevision() *dsl.Tmpl {
+	root := dsl.NewRoot()
+	tmpl := dsl.NewTmpl()
+
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldPolicyID, tmpl.Bind(FieldPolicyID), nil)
+	filter.Range(FieldRevisionIdx, dsl.WithRangeLTE(tmpl.Bind(FieldRevisionIdx)))
+	root.Size(1)
+	rSort := root.Sort()
+	rSort.SortOrder(FieldRevisionIdx, dsl.SortDescend)
+	rSort.SortOrder(FieldCoordinatorIdx, dsl.SortDescend)
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
 // QueryLatestPolicies gets the latest revision for a policy
 func QueryLatestPolicies(ctx context.Context, bulker bulk.Bulk, opt ...Option) ([]model.Policy, error) {
 	o := newOption(FleetPolicies, opt...)
@@ -63,6 +93,61 @@ func QueryLatestPolicies(ctx context.Context, bulker bulk.Bulk, opt ...Option) (
 	return policies, nil
 }
 
+// FindPolicyRevision gets the document with the highest coordinator index for a revision of a policy
+func FindPolicyRevision(ctx context.Context, bulker bulk.Bulk, policyID string, revisionIdx int64, opt ...Option) (model.Policy, error) {
+	o := newOption(FleetPolicies, opt...)
+	res, err := Search(ctx, bulker, tmplQueryPolicyRevision, o.indexName, map[string]interface{}{
+		FieldPolicyID:    policyID,
+		FieldRevisionIdx: revisionIdx,
+	})
+	if err != nil {
+		return model.Policy{}, err
+	}
+	if len(res.Hits) == 0 {
+		return model.Policy{}, ErrNotFound
+	}
+
+	var policy model.Policy
+	if err := res.Hits[0].Unmarshal(&policy); err != nil {
+		return model.Policy{}, err
+	}
+	return policy, nil
+}
+
+// FindLatestPolicyRevision gets the document with the highest revision and coordinator index of a policy,
+// up to the given revision index
+func FindLatestPolicyRevision(ctx context.Context, bulker bulk.Bulk, policyID string, maxRevisionIdx int64, opt ...Option) (model.Policy, error) {
+	o := newOption(FleetPolicies, opt...)
+	res, err := Search(ctx, bulker, tmplQueryLatestRevision, o.indexName, map[string]interface{}{
+		FieldPolicyID:    policyID,
+		FieldRevisionIdx: maxRevisionIdx,
+	})
+	if err != nil {
+		return model.Policy{}, err
+	}
+	if len(res.Hits) == 0 {
+		return model.Policy{}, ErrNotFound
+	}
+
+	var policy model.Policy
+	if err := res.Hits[0].Unmarshal(&policy); err != nil {
+		return model.Policy{}, err
+	}
+	return policy, nil
+}
+
+// SetPolicyValidationError records the reason a policy revision failed validation on the revision document
+func SetPolicyValidationError(ctx context.Context, bulker bulk.Bulk, id string, reason string, opt ...Option) error {
+	o := newOption(FleetPolicies, opt...)
+	body, err := bulk.UpdateFields{
+		FieldValidationError: reason,
+	}.Marshal()
+	if err != nil {
+		return err
+	}
+	return bulker.Update(ctx, o.indexName, id, body, bulk.WithRetryOnConflict(3))
+}
+
 // CreatePolicy creates a new policy in the index
 func CreatePolicy(ctx context.Context, bulker bulk.Bulk, policy model.Policy, opt ...Option) (string, error) {
 	o := newOption(FleetPolicies, opt...)
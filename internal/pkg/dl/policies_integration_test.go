@@ -8,6 +8,8 @@ package dl
 
 import (
 	"context"
+	"errors"
+	"math"
 	"testing"
 	"time"
 
@@ -92,3 +94,36 @@ func TestCreatePolicy(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFindLatestPolicyRevision(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupCleanIndex(ctx, t, FleetPolicies)
+
+	rec, err := storeRandomPolicy(ctx, bulker, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := FindLatestPolicyRevision(ctx, bulker, rec.PolicyID, math.MaxInt64, WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.RevisionIdx != rec.RevisionIdx {
+		t.Fatalf("expected revision %d, got %d", rec.RevisionIdx, latest.RevisionIdx)
+	}
+
+	prev, err := FindLatestPolicyRevision(ctx, bulker, rec.PolicyID, rec.RevisionIdx-1, WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev.RevisionIdx != rec.RevisionIdx-1 {
+		t.Fatalf("expected revision %d, got %d", rec.RevisionIdx-1, prev.RevisionIdx)
+	}
+
+	_, err = FindLatestPolicyRevision(ctx, bulker, rec.PolicyID, 0, WithIndexName(index))
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -152,3 +152,67 @@ func ReleasePolicyLeadership(ctx context.Context, bulker bulk.Bulk, policyID, se
 	}
 	return err
 }
+
+var (
+	QueryAllPolicyLeaders  = prepareQueryAllPolicyLeaders()
+	QueryStalePolicyLeader = prepareQueryStalePolicyLeader()
+)
+
+func prepareQueryAllPolicyLeaders() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Query().MatchAll()
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+func prepareQueryStalePolicyLeader() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	filter := root.Query().Bool().Filter()
+	filter.Term(FieldID, tmpl.Bind(FieldID), nil)
+	filter.Term(FieldServerID, tmpl.Bind(FieldServerID), nil)
+	filter.Range(FieldTimestamp, dsl.WithRangeLTE(tmpl.Bind(FieldTimestamp)))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// FindPolicyLeaders returns up to size policy leader documents keyed by policy ID.
+func FindPolicyLeaders(ctx context.Context, bulker bulk.Bulk, size int, opt ...Option) (map[string]model.PolicyLeader, error) {
+	o := newOption(FleetPoliciesLeader, opt...)
+	res, err := Search(ctx, bulker, QueryAllPolicyLeaders, o.indexName, map[string]interface{}{
+		FieldSize: size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leaders := make(map[string]model.PolicyLeader, len(res.Hits))
+	for _, hit := range res.Hits {
+		var l model.PolicyLeader
+		if err := hit.Unmarshal(&l); err != nil {
+			return nil, err
+		}
+		leaders[hit.ID] = l
+	}
+	return leaders, nil
+}
+
+// DeleteStalePolicyLeader deletes the leader document of a policy if it is still held by the server and
+// was not renewed since the given date or date math expression. Returns true if the document was deleted.
+//
+// The conditions are checked by Elasticsearch so that a leadership renewed or taken over concurrently is kept.
+func DeleteStalePolicyLeader(ctx context.Context, bulker bulk.Bulk, policyID, serverID string, renewedBefore string, opt ...Option) (bool, error) {
+	o := newOption(FleetPoliciesLeader, opt...)
+	query, err := QueryStalePolicyLeader.Render(map[string]interface{}{
+		FieldID:        policyID,
+		FieldServerID:  serverID,
+		FieldTimestamp: renewedBefore,
+	})
+	if err != nil {
+		return false, err
+	}
+	deleted, err := deleteByQuery(ctx, bulker, o.indexName, query)
+	return deleted > 0, err
+}
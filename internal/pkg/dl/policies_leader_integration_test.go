@@ -168,3 +168,51 @@ func TestReleasePolicyLeadership_NothingIfNotLeader(t *testing.T) {
 		t.Fatalf("@timestamp different should less than 5 seconds; instead its %.0f secs", diff)
 	}
 }
+
+func TestDeleteStalePolicyLeader(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupCleanIndex(ctx, t, FleetPoliciesLeader)
+
+	serverID := uuid.Must(uuid.NewV4()).String()
+	policyID := uuid.Must(uuid.NewV4()).String()
+	err := TakePolicyLeadership(ctx, bulker, policyID, serverID, testVer, WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a leadership renewed within the interval is kept
+	deleted, err := DeleteStalePolicyLeader(ctx, bulker, policyID, serverID, "now-1m", WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted {
+		t.Fatal("renewed leadership must not be deleted")
+	}
+
+	// a leadership held by another server is kept
+	deleted, err = DeleteStalePolicyLeader(ctx, bulker, policyID, "other", "now", WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted {
+		t.Fatal("leadership of another server must not be deleted")
+	}
+
+	deleted, err = DeleteStalePolicyLeader(ctx, bulker, policyID, serverID, "now", WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Fatal("stale leadership should be deleted")
+	}
+
+	leaders, err := FindPolicyLeaders(ctx, bulker, 10, WithIndexName(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaders) != 0 {
+		t.Fatalf("expected no leaders, found %d", len(leaders))
+	}
+}
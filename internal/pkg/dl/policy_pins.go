@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+var QueryAllPolicyPins = prepareQueryAllPolicyPins()
+
+func prepareQueryAllPolicyPins() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Query().MatchAll()
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// FindPolicyPins returns up to size policy pin documents keyed by policy ID.
+// The policy pins are kept in a document per policy, so they apply to the new revisions of the policy.
+func FindPolicyPins(ctx context.Context, bulker bulk.Bulk, size int, opt ...Option) (map[string]model.PolicyPin, error) {
+	o := newOption(FleetPolicyPins, opt...)
+	res, err := Search(ctx, bulker, QueryAllPolicyPins, o.indexName, map[string]interface{}{
+		FieldSize: size,
+	})
+	if errors.Is(err, es.ErrIndexNotFound) {
+		return map[string]model.PolicyPin{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pins := make(map[string]model.PolicyPin, len(res.Hits))
+	for _, hit := range res.Hits {
+		var pin model.PolicyPin
+		if err := hit.Unmarshal(&pin); err != nil {
+			return nil, err
+		}
+		pins[pin.PolicyID] = pin
+	}
+	return pins, nil
+}
+
+// SetPolicyPin pins a policy to a revision, a revision index of 0 removes the pin.
+func SetPolicyPin(ctx context.Context, bulker bulk.Bulk, policyID string, revisionIdx int64, opt ...Option) error {
+	o := newOption(FleetPolicyPins, opt...)
+	pin := model.PolicyPin{
+		PolicyID:          policyID,
+		PinnedRevisionIdx: revisionIdx,
+		Timestamp:         time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	body, err := json.Marshal(&pin)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Index(ctx, o.indexName, policyID, body, bulk.WithRefresh())
+	return err
+}
@@ -0,0 +1,35 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build integration
+
+package dl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestPolicyPins(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupCleanIndex(ctx, t, FleetPolicyPins)
+
+	require.NoError(t, SetPolicyPin(ctx, bulker, "policy1", 3, WithIndexName(index)))
+	require.NoError(t, SetPolicyPin(ctx, bulker, "policy2", 5, WithIndexName(index)))
+	// the pin is replaced, not added
+	require.NoError(t, SetPolicyPin(ctx, bulker, "policy2", 0, WithIndexName(index)))
+
+	pins, err := FindPolicyPins(ctx, bulker, 100, WithIndexName(index))
+	require.NoError(t, err)
+	require.Len(t, pins, 2)
+	assert.Equal(t, int64(3), pins["policy1"].PinnedRevisionIdx)
+	assert.Zero(t, pins["policy2"].PinnedRevisionIdx)
+}
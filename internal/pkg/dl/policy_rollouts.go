@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+// ErrPolicyRolloutExists is returned when creating the rollout of a policy revision that was created by another fleet-server.
+var ErrPolicyRolloutExists = errors.New("policy rollout exists")
+
+// PolicyRolloutID returns the ID of the rollout document of a policy revision.
+func PolicyRolloutID(policyID string, revisionIdx, coordinatorIdx int64) string {
+	return fmt.Sprintf("%s:%d:%d", policyID, revisionIdx, coordinatorIdx)
+}
+
+// FindPolicyRollout returns the rollout of a policy revision.
+func FindPolicyRollout(ctx context.Context, bulker bulk.Bulk, policyID string, revisionIdx, coordinatorIdx int64, opt ...Option) (model.PolicyRollout, error) {
+	o := newOption(FleetPolicyRollouts, opt...)
+	data, err := bulker.Read(ctx, o.indexName, PolicyRolloutID(policyID, revisionIdx, coordinatorIdx))
+	if errors.Is(err, es.ErrElasticNotFound) || errors.Is(err, es.ErrIndexNotFound) {
+		return model.PolicyRollout{}, ErrNotFound
+	}
+	if err != nil {
+		return model.PolicyRollout{}, err
+	}
+
+	var rollout model.PolicyRollout
+	if err := json.Unmarshal(data, &rollout); err != nil {
+		return model.PolicyRollout{}, err
+	}
+	return rollout, nil
+}
+
+// CreatePolicyRollout creates the rollout of a policy revision, ErrPolicyRolloutExists is returned
+// if the rollout exists so that the state set by another fleet-server is not overwritten.
+func CreatePolicyRollout(ctx context.Context, bulker bulk.Bulk, rollout model.PolicyRollout, opt ...Option) error {
+	o := newOption(FleetPolicyRollouts, opt...)
+	body, err := json.Marshal(&rollout)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Create(ctx, o.indexName, PolicyRolloutID(rollout.PolicyID, rollout.RevisionIdx, rollout.CoordinatorIdx), body, bulk.WithRefresh())
+	if errors.Is(err, es.ErrElasticVersionConflict) {
+		return ErrPolicyRolloutExists
+	}
+	return err
+}
+
+// SetPolicyRollout sets the state of the rollout of a policy revision.
+func SetPolicyRollout(ctx context.Context, bulker bulk.Bulk, rollout model.PolicyRollout, opt ...Option) error {
+	o := newOption(FleetPolicyRollouts, opt...)
+	body, err := json.Marshal(&rollout)
+	if err != nil {
+		return err
+	}
+	_, err = bulker.Index(ctx, o.indexName, PolicyRolloutID(rollout.PolicyID, rollout.RevisionIdx, rollout.CoordinatorIdx), body, bulk.WithRefresh())
+	return err
+}
@@ -0,0 +1,180 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package dl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+// ErrLeaseHeld is returned when the lease of a schedule is held by another fleet-server.
+var ErrLeaseHeld = errors.New("schedule lease held by another server")
+
+type leaseDoc struct {
+	Found       bool                `json:"found"`
+	SeqNo       int                 `json:"_seq_no"`
+	PrimaryTerm int                 `json:"_primary_term"`
+	Source      model.ScheduleLease `json:"_source"`
+}
+
+// AcquireScheduleLease acquires or renews the lease of a schedule for the server until ttl from now.
+//
+// The lease is only acquired if it is not held by another server or it has expired. The lease document is
+// written with optimistic concurrency control so that only one of the servers racing for it succeeds, the
+// others get ErrLeaseHeld. The fencing token of the returned lease is incremented whenever the lease changes
+// server.
+func AcquireScheduleLease(ctx context.Context, bulker bulk.Bulk, schedule, serverID, version string, ttl time.Duration, opt ...Option) (model.ScheduleLease, error) {
+	o := newOption(FleetSchedulesLeader, opt...)
+	client := bulker.Client()
+
+	doc, err := readLease(ctx, client, o.indexName, schedule)
+	if err != nil {
+		return model.ScheduleLease{}, err
+	}
+
+	now := time.Now().UTC()
+	lease := doc.Source
+	if doc.Found && lease.Server != nil && lease.Server.ID != serverID {
+		expires, err := time.Parse(time.RFC3339Nano, lease.ExpiresAt)
+		if err == nil && now.Before(expires) {
+			return lease, ErrLeaseHeld
+		}
+	}
+	if !doc.Found || lease.Server == nil || lease.Server.ID != serverID {
+		lease.Token++
+	}
+	lease.Schedule = schedule
+	lease.Server = &model.ServerMetadata{ID: serverID, Version: version}
+	lease.Timestamp = now.Format(time.RFC3339Nano)
+	lease.ExpiresAt = now.Add(ttl).Format(time.RFC3339Nano)
+
+	req := esapi.IndexRequest{
+		Index:      o.indexName,
+		DocumentID: schedule,
+		Refresh:    "true",
+	}
+	if doc.Found {
+		req.IfSeqNo = &doc.SeqNo
+		req.IfPrimaryTerm = &doc.PrimaryTerm
+	} else {
+		req.OpType = "create"
+	}
+	if err := writeLease(ctx, client, req, lease); err != nil {
+		return model.ScheduleLease{}, err
+	}
+	return lease, nil
+}
+
+// ReleaseScheduleLease expires the lease of a schedule if it is still held by the server with the given
+// fencing token, so that another server can acquire it without waiting for it to expire.
+func ReleaseScheduleLease(ctx context.Context, bulker bulk.Bulk, schedule, serverID string, token int64, opt ...Option) error {
+	o := newOption(FleetSchedulesLeader, opt...)
+	client := bulker.Client()
+
+	doc, err := readLease(ctx, client, o.indexName, schedule)
+	if err != nil {
+		return err
+	}
+	lease := doc.Source
+	if !doc.Found || lease.Server == nil || lease.Server.ID != serverID || lease.Token != token {
+		// not the holder anymore; nothing to do
+		return nil
+	}
+	lease.ExpiresAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	err = writeLease(ctx, client, esapi.IndexRequest{
+		Index:         o.indexName,
+		DocumentID:    schedule,
+		Refresh:       "true",
+		IfSeqNo:       &doc.SeqNo,
+		IfPrimaryTerm: &doc.PrimaryTerm,
+	}, lease)
+	if errors.Is(err, ErrLeaseHeld) {
+		// another server took over; nothing to worry about
+		return nil
+	}
+	return err
+}
+
+// CheckScheduleLease returns ErrLeaseHeld unless the lease of a schedule is held by the server with the given
+// fencing token and has not expired.
+func CheckScheduleLease(ctx context.Context, bulker bulk.Bulk, schedule, serverID string, token int64, opt ...Option) error {
+	o := newOption(FleetSchedulesLeader, opt...)
+
+	doc, err := readLease(ctx, bulker.Client(), o.indexName, schedule)
+	if err != nil {
+		return err
+	}
+	lease := doc.Source
+	if !doc.Found || lease.Server == nil || lease.Server.ID != serverID || lease.Token != token {
+		return ErrLeaseHeld
+	}
+	expires, err := time.Parse(time.RFC3339Nano, lease.ExpiresAt)
+	if err != nil || !time.Now().Before(expires) {
+		return ErrLeaseHeld
+	}
+	return nil
+}
+
+func readLease(ctx context.Context, client esapi.Transport, index, schedule string) (leaseDoc, error) {
+	var doc leaseDoc
+	res, err := esapi.GetRequest{Index: index, DocumentID: schedule}.Do(ctx, client)
+	if err != nil {
+		return doc, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		// missing document or index
+		return doc, nil
+	}
+	if res.IsError() {
+		return doc, es.TranslateError(res.StatusCode, readError(res))
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return doc, err
+	}
+	return doc, nil
+}
+
+func writeLease(ctx context.Context, client esapi.Transport, req esapi.IndexRequest, lease model.ScheduleLease) error {
+	body, err := json.Marshal(&lease)
+	if err != nil {
+		return err
+	}
+	req.Body = bytes.NewReader(body)
+
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		err = es.TranslateError(res.StatusCode, readError(res))
+		if errors.Is(err, es.ErrElasticVersionConflict) {
+			return ErrLeaseHeld
+		}
+		return err
+	}
+	return nil
+}
+
+func readError(res *esapi.Response) json.RawMessage {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&body)
+	return body.Error
+}
@@ -0,0 +1,54 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build integration
+
+package dl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestAcquireScheduleLease(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupCleanIndex(ctx, t, FleetSchedulesLeader)
+
+	lease, err := AcquireScheduleLease(ctx, bulker, "schedule", "server1", testVer, time.Minute, WithIndexName(index))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), lease.Token)
+
+	// renewing keeps the fencing token
+	lease, err = AcquireScheduleLease(ctx, bulker, "schedule", "server1", testVer, time.Minute, WithIndexName(index))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), lease.Token)
+
+	// held by another server until it expires or is released
+	_, err = AcquireScheduleLease(ctx, bulker, "schedule", "server2", testVer, time.Minute, WithIndexName(index))
+	require.ErrorIs(t, err, ErrLeaseHeld)
+
+	require.NoError(t, ReleaseScheduleLease(ctx, bulker, "schedule", "server1", lease.Token, WithIndexName(index)))
+
+	lease, err = AcquireScheduleLease(ctx, bulker, "schedule", "server2", testVer, time.Minute, WithIndexName(index))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), lease.Token)
+
+	// a release with a stale token does not affect the new holder
+	require.NoError(t, ReleaseScheduleLease(ctx, bulker, "schedule", "server1", 1, WithIndexName(index)))
+	_, err = AcquireScheduleLease(ctx, bulker, "schedule", "server1", testVer, time.Minute, WithIndexName(index))
+	require.ErrorIs(t, err, ErrLeaseHeld)
+
+	// only the holder with the current fencing token passes the check
+	require.NoError(t, CheckScheduleLease(ctx, bulker, "schedule", "server2", 2, WithIndexName(index)))
+	require.ErrorIs(t, CheckScheduleLease(ctx, bulker, "schedule", "server1", 1, WithIndexName(index)), ErrLeaseHeld)
+	require.ErrorIs(t, CheckScheduleLease(ctx, bulker, "schedule", "server2", 1, WithIndexName(index)), ErrLeaseHeld)
+}
@@ -5,11 +5,15 @@
 package dl
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/rs/zerolog/log"
 )
 
 func Search(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, index string, params map[string]interface{}, opts ...bulk.Opt) (*es.HitsT, error) {
@@ -38,3 +42,32 @@ func SearchWithOneParam(ctx context.Context, bulker bulk.Bulk, tmpl *dsl.Tmpl, i
 
 	return &res.HitsT, nil
 }
+
+// deleteByQuery deletes the documents matching the query and returns the number of deleted documents.
+// Documents updated while the request runs are version conflicts and are not deleted.
+func deleteByQuery(ctx context.Context, bulker bulk.Bulk, index string, query []byte) (int64, error) {
+	client := bulker.Client()
+	res, err := client.DeleteByQuery([]string{index}, bytes.NewReader(query),
+		client.DeleteByQuery.WithContext(ctx),
+		client.DeleteByQuery.WithConflicts("proceed"),
+		client.DeleteByQuery.WithRefresh(true),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	var esres es.DeleteByQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&esres); err != nil {
+		return 0, err
+	}
+	if res.IsError() {
+		err := es.TranslateError(res.StatusCode, esres.Error)
+		if errors.Is(err, es.ErrIndexNotFound) {
+			log.Debug().Str("index", index).Msg(es.ErrIndexNotFound.Error())
+			return 0, nil
+		}
+		return 0, err
+	}
+	return esres.Deleted, nil
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 )
@@ -57,3 +58,62 @@ func EnsureServer(ctx context.Context, bulker bulk.Bulk, version string, agent m
 	}
 	return bulker.Update(ctx, o.indexName, agent.ID, data, bulk.WithRefresh(), bulk.WithRetryOnConflict(3))
 }
+
+var (
+	QueryStaleServers = prepareQueryStaleServers()
+	QueryServerIDs    = prepareQueryServerIDs()
+)
+
+func prepareQueryStaleServers() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Query().Bool().Filter().Range(FieldTimestamp, dsl.WithRangeLTE(tmpl.Bind(FieldTimestamp)))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+func prepareQueryServerIDs() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Source().Includes(FieldServerID)
+	root.Query().MatchAll()
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// DeleteStaleServers deletes the fleet-server documents that were not updated since the given date
+// or date math expression, and returns the number of deleted documents.
+func DeleteStaleServers(ctx context.Context, bulker bulk.Bulk, updatedBefore string, opts ...Option) (int64, error) {
+	o := newOption(FleetServers, opts...)
+	query, err := QueryStaleServers.Render(map[string]interface{}{
+		FieldTimestamp: updatedBefore,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleteByQuery(ctx, bulker, o.indexName, query)
+}
+
+// FindServerIDs returns the IDs of the fleet-servers that have a document, up to size.
+func FindServerIDs(ctx context.Context, bulker bulk.Bulk, size int, opts ...Option) (map[string]bool, error) {
+	o := newOption(FleetServers, opts...)
+	res, err := Search(ctx, bulker, QueryServerIDs, o.indexName, map[string]interface{}{
+		FieldSize: size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool, len(res.Hits))
+	for _, hit := range res.Hits {
+		var server model.Server
+		if err := hit.Unmarshal(&server); err != nil {
+			return nil, err
+		}
+		if server.Server != nil {
+			ids[server.Server.ID] = true
+		}
+	}
+	return ids, nil
+}
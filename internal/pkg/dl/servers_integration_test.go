@@ -11,9 +11,13 @@ import (
 	"encoding/json"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/model"
 	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
 )
@@ -54,3 +58,30 @@ func TestEnsureServer(t *testing.T) {
 		t.Fatal("agent.id should match agentId")
 	}
 }
+
+func TestDeleteStaleServers(t *testing.T) {
+	ctx, cn := context.WithCancel(context.Background())
+	defer cn()
+
+	index, bulker := ftesting.SetupCleanIndex(ctx, t, FleetServers)
+
+	for id, ts := range map[string]time.Time{
+		"stale": time.Now().Add(-2 * time.Hour),
+		"live":  time.Now(),
+	} {
+		server := model.Server{Server: &model.ServerMetadata{ID: id, Version: "1.0.0"}}
+		server.SetTime(ts.UTC())
+		body, err := json.Marshal(server)
+		require.NoError(t, err)
+		_, err = bulker.Create(ctx, index, id, body, bulk.WithRefresh())
+		require.NoError(t, err)
+	}
+
+	deleted, err := DeleteStaleServers(ctx, bulker, "now-1h", WithIndexName(index))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	ids, err := FindServerIDs(ctx, bulker, 10, WithIndexName(index))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"live": true}, ids)
+}
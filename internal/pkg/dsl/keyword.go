@@ -20,8 +20,10 @@ const (
 	kKeywordMax         = "max"
 	kKeywordMust        = "must"
 	kKeywordMustNot     = "must_not"
+	kKeywordMinShould   = "minimum_should_match"
 	kKeywordNULL        = "null"
 	kKeywordQuery       = "query"
+	kKeywordShould      = "should"
 	kKeywordSize        = "size"
 	kKeywordSort        = "sort"
 	kKeywordSource      = "_source"
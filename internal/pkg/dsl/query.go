@@ -27,3 +27,16 @@ func (n *Node) MustNot() *Node {
 	}
 	return childNode
 }
+
+func (n *Node) Should() *Node {
+	childNode := n.findOrCreateChildByName(kKeywordShould)
+	if childNode.nodeList == nil {
+		childNode.nodeList = nodeListT{}
+	}
+	return childNode
+}
+
+// MinimumShouldMatch sets the number of should clauses a bool query requires to match.
+func (n *Node) MinimumShouldMatch(v interface{}) {
+	n.Param(kKeywordMinShould, v)
+}
@@ -74,6 +74,10 @@ func cleanupActions(ctx context.Context, index string, bulker bulk.Bulk, opts ..
 
 	log.Debug().Msg("delete expired actions")
 
+	if err := scheduler.CheckLease(ctx); err != nil {
+		return err
+	}
+
 	deleted, err := dl.DeleteExpiredForIndex(ctx, index, bulker, c.cleanupIntervalAfterExpired)
 	if err != nil {
 		log.Debug().Err(err).Msg("failed to delete actions")
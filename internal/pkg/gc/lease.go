@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package gc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
+)
+
+// lease implements scheduler.Lease with the lease documents stored in Elasticsearch
+// so that each GC schedule runs on a single fleet-server.
+type lease struct {
+	bulker   bulk.Bulk
+	serverID string
+	version  string
+}
+
+// NewLease returns the schedule lease of the fleet-server with the given ID.
+func NewLease(bulker bulk.Bulk, serverID, version string) scheduler.Lease {
+	return &lease{
+		bulker:   bulker,
+		serverID: serverID,
+		version:  version,
+	}
+}
+
+func (l *lease) Acquire(ctx context.Context, name string, ttl time.Duration) (int64, bool, error) {
+	sl, err := dl.AcquireScheduleLease(ctx, l.bulker, name, l.serverID, l.version, ttl)
+	if errors.Is(err, dl.ErrLeaseHeld) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return sl.Token, true, nil
+}
+
+func (l *lease) Release(ctx context.Context, name string, token int64) error {
+	return dl.ReleaseScheduleLease(ctx, l.bulker, name, l.serverID, token)
+}
+
+func (l *lease) Check(ctx context.Context, name string, token int64) error {
+	err := dl.CheckScheduleLease(ctx, l.bulker, name, l.serverID, token)
+	if errors.Is(err, dl.ErrLeaseHeld) {
+		return scheduler.ErrLeaseLost
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package gc
+
+import (
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+var (
+	registry = monitoring.Default.NewRegistry("gc")
+
+	cntAgentsUnenrolled   = monitoring.NewUint(registry, "agents_unenrolled")
+	cntAPIKeysInvalidated = monitoring.NewUint(registry, "api_keys_invalidated")
+
+	cntUploadsExpired       = monitoring.NewUint(registry, "uploads_expired")
+	cntOrphanedUploads      = monitoring.NewUint(registry, "uploads_orphaned")
+	cntUploadBytesReclaimed = monitoring.NewUint(registry, "upload_bytes_reclaimed")
+
+	cntServersDeleted       = monitoring.NewUint(registry, "servers_deleted")
+	cntPolicyLeadersDeleted = monitoring.NewUint(registry, "policy_leaders_deleted")
+)
@@ -8,28 +8,68 @@ import (
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
 )
 
 const (
 	defaultScheduleInterval            = time.Hour
 	defaultCleanupIntervalAfterExpired = "30d" // cleanup with expiration older than 30 days from now
+	defaultUploadTimeLimit             = 24 * time.Hour
+	defaultStaleServerInterval         = 24 * time.Hour
 )
 
-// Schedules returns the GC schedules
-func Schedules(bulker bulk.Bulk, scheduleInterval time.Duration, cleanupIntervalAfterExpired string) []scheduler.Schedule {
+// Schedule names, used to configure their cron expression and to trigger them on demand.
+// They are listed in config.GCSchedules so that the cron configuration of unknown schedules is rejected.
+const (
+	ScheduleActionsCleanup   = "actions-cleanup"
+	ScheduleUnenrollInactive = "unenroll-inactive-agents"
+	ScheduleUploadsCleanup   = "uploads-cleanup"
+	ScheduleServersCleanup   = "servers-cleanup"
+)
+
+func Schedules(bulker bulk.Bulk, cfg *config.Server) []scheduler.Schedule {
+	scheduleInterval := cfg.GC.ScheduleInterval
 	if scheduleInterval == 0 {
 		scheduleInterval = defaultScheduleInterval
 	}
+	cleanupIntervalAfterExpired := cfg.GC.CleanupAfterExpiredInterval
 	if cleanupIntervalAfterExpired == "" {
 		cleanupIntervalAfterExpired = defaultCleanupIntervalAfterExpired
 	}
+	staleServerInterval := cfg.GC.StaleServerInterval
+	if staleServerInterval == 0 {
+		staleServerInterval = defaultStaleServerInterval
+	}
+	uploadTimeLimit := cfg.Limits.UploadTimeLimit
+	if uploadTimeLimit == 0 {
+		uploadTimeLimit = defaultUploadTimeLimit
+	}
 
-	return []scheduler.Schedule{
+	schedules := []scheduler.Schedule{
 		{
-			Name:     "fleet actions cleanup",
+			Name:     ScheduleActionsCleanup,
 			Interval: scheduleInterval,
 			WorkFn:   getActionsGCFunc(bulker, cleanupIntervalAfterExpired),
 		},
+		{
+			Name:     ScheduleUnenrollInactive,
+			Interval: scheduleInterval,
+			WorkFn:   getUnenrollGCFunc(bulker),
+		},
+		{
+			Name:     ScheduleUploadsCleanup,
+			Interval: scheduleInterval,
+			WorkFn:   getUploadsGCFunc(bulker, uploadTimeLimit),
+		},
+		{
+			Name:     ScheduleServersCleanup,
+			Interval: scheduleInterval,
+			WorkFn:   getServersGCFunc(bulker, staleServerInterval),
+		},
+	}
+	for i := range schedules {
+		schedules[i].Cron = cfg.GC.Cron[schedules[i].Name]
 	}
+	return schedules
 }
@@ -0,0 +1,33 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package gc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+)
+
+func TestSchedulesCron(t *testing.T) {
+	var cfg config.Server
+	cfg.InitDefaults()
+	cfg.GC.Cron = map[string]string{ScheduleServersCleanup: "@daily"}
+
+	names := make([]string, 0, len(config.GCSchedules))
+	for _, s := range Schedules(ftesting.NewMockBulk(), &cfg) {
+		names = append(names, s.Name)
+		if s.Name == ScheduleServersCleanup {
+			assert.Equal(t, "@daily", s.Cron)
+		} else {
+			assert.Empty(t, s.Cron)
+		}
+	}
+	assert.ElementsMatch(t, config.GCSchedules, names, "every schedule can be configured")
+}
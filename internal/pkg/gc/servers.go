@@ -0,0 +1,107 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
+)
+
+const (
+	// Leader documents are renewed every few seconds by the policy leader, only leaderships
+	// that were not renewed for much longer than that are deleted.
+	leaderRenewalGrace = 5 * time.Minute
+
+	serversMaxDocs = 10000
+)
+
+func getServersGCFunc(bulker bulk.Bulk, staleInterval time.Duration) scheduler.WorkFunc {
+	return func(ctx context.Context) error {
+		return cleanupServers(ctx, bulker, staleInterval)
+	}
+}
+
+// cleanupServers deletes the fleet-server documents that were not updated within the stale interval, then
+// the policy leader documents held by servers that no longer exist or for policies that no longer exist.
+func cleanupServers(ctx context.Context, bulker bulk.Bulk, staleInterval time.Duration) error {
+	log := log.With().Str("ctx", "fleet servers cleanup").Dur("stale_interval", staleInterval).Logger()
+
+	if err := scheduler.CheckLease(ctx); err != nil {
+		return err
+	}
+	deleted, err := dl.DeleteStaleServers(ctx, bulker, dateMathAgo(staleInterval))
+	if err != nil {
+		return fmt.Errorf("failed to delete stale fleet-servers: %w", err)
+	}
+	cntServersDeleted.Add(uint64(deleted))
+	if deleted > 0 {
+		log.Info().Int64("count", deleted).Msg("deleted stale fleet-servers")
+	}
+
+	leaders, err := dl.FindPolicyLeaders(ctx, bulker, serversMaxDocs)
+	if err != nil {
+		if errors.Is(err, es.ErrIndexNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find policy leaders: %w", err)
+	}
+	if len(leaders) == 0 {
+		return nil
+	}
+	servers, err := dl.FindServerIDs(ctx, bulker, serversMaxDocs)
+	if err != nil && !errors.Is(err, es.ErrIndexNotFound) {
+		return fmt.Errorf("failed to find fleet-servers: %w", err)
+	}
+	latest, err := dl.QueryLatestPolicies(ctx, bulker)
+	if err != nil && !errors.Is(err, es.ErrIndexNotFound) {
+		return fmt.Errorf("failed to find policies: %w", err)
+	}
+	policies := make(map[string]bool, len(latest))
+	for _, p := range latest {
+		policies[p.PolicyID] = true
+	}
+
+	if err := scheduler.CheckLease(ctx); err != nil {
+		return err
+	}
+	var count int
+	renewedBefore := dateMathAgo(leaderRenewalGrace)
+	for policyID, leader := range leaders {
+		if leader.Server == nil || leader.Server.ID == "" {
+			continue
+		}
+		if servers[leader.Server.ID] && policies[policyID] {
+			continue
+		}
+		ok, err := dl.DeleteStalePolicyLeader(ctx, bulker, policyID, leader.Server.ID, renewedBefore)
+		if err != nil {
+			log.Warn().Err(err).Str(logger.PolicyID, policyID).Str("server_id", leader.Server.ID).Msg("failed to delete policy leader")
+			continue
+		}
+		if ok {
+			count++
+		}
+	}
+	cntPolicyLeadersDeleted.Add(uint64(count))
+	if count > 0 {
+		log.Info().Int("count", count).Msg("deleted orphaned policy leaders")
+	}
+	return nil
+}
+
+func dateMathAgo(d time.Duration) string {
+	return "now-" + strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
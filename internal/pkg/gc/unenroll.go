@@ -0,0 +1,195 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
+)
+
+const (
+	unenrollBatchSize = 100
+	unenrollMaxPerRun = 10000 // remaining agents are unenrolled on the next run
+
+	unenrolledReasonTimeout = "timeout"
+)
+
+// The agent is only updated if it is still active, so that an agent unenrolled by another
+// fleet-server instance running the same schedule, or by the user, keeps its unenroll details.
+const unenrollInactiveScript = `if (ctx._source.active == false) { ctx.op = 'noop'; } else {
+ctx._source.active = false;
+ctx._source.unenrolled_at = params.now;
+ctx._source.unenrolled_reason = params.reason;
+ctx._source.updated_at = params.now; }`
+
+func getUnenrollGCFunc(bulker bulk.Bulk) scheduler.WorkFunc {
+	return func(ctx context.Context) error {
+		policies, err := dl.QueryLatestPolicies(ctx, bulker)
+		if err != nil {
+			if errors.Is(err, es.ErrIndexNotFound) {
+				return nil
+			}
+			return err
+		}
+		return unenrollInactiveAgents(ctx, dl.FleetAgents, bulker, policies)
+	}
+}
+
+// unenrollInactiveAgents unenrolls the agents that have not checked in within the unenroll timeout of their policy,
+// or that never checked in and were enrolled before it.
+//
+// The API keys of an agent are invalidated before it is marked inactive, an agent that fails to be updated is
+// found again on the next run. Invalidating API keys and unenrolling agents is idempotent, so the schedule is
+// safe to run concurrently on multiple fleet-server instances.
+func unenrollInactiveAgents(ctx context.Context, index string, bulker bulk.Bulk, policies []model.Policy) error {
+	log := log.With().Str("ctx", "unenroll inactive agents").Logger()
+
+	var total int
+	for _, policy := range policies {
+		if policy.UnenrollTimeout <= 0 {
+			continue
+		}
+		zlog := log.With().
+			Str(logger.PolicyID, policy.PolicyID).
+			Int64("unenroll_timeout", policy.UnenrollTimeout).
+			Logger()
+
+		n, err := unenrollPolicyAgents(ctx, zlog, index, bulker, policy, unenrollMaxPerRun-total)
+		total += n
+		if err != nil {
+			if errors.Is(err, es.ErrIndexNotFound) {
+				return nil
+			}
+			return err
+		}
+		if n > 0 {
+			zlog.Info().Int("count", n).Msg("unenrolled inactive agents")
+		}
+		if total >= unenrollMaxPerRun {
+			log.Info().Int("count", total).Msg("reached the maximum number of agents to unenroll in a run")
+			break
+		}
+	}
+	log.Debug().Int("count", total).Msg("unenrolled inactive agents")
+	return nil
+}
+
+func unenrollPolicyAgents(ctx context.Context, zlog zerolog.Logger, index string, bulker bulk.Bulk, policy model.Policy, limit int) (int, error) {
+	lastCheckin := dateMathAgo(time.Duration(policy.UnenrollTimeout) * time.Second)
+
+	// Updated agents are excluded from the following searches as the index may not be refreshed yet.
+	var seen []string
+	var count int
+	for len(seen) < limit {
+		size := unenrollBatchSize
+		if limit-len(seen) < size {
+			size = limit - len(seen)
+		}
+		agents, err := dl.FindInactiveAgents(ctx, bulker, policy.PolicyID, lastCheckin, seen, size, dl.WithIndexName(index))
+		if err != nil {
+			return count, err
+		}
+		if len(agents) == 0 {
+			break
+		}
+
+		if err := scheduler.CheckLease(ctx); err != nil {
+			return count, err
+		}
+		n, err := unenrollAgents(ctx, zlog, index, bulker, agents)
+		count += n
+		if err != nil {
+			return count, err
+		}
+		for _, agent := range agents {
+			seen = append(seen, agent.Id)
+		}
+		if len(agents) < size {
+			break
+		}
+	}
+	return count, nil
+}
+
+// unenrollAgents invalidates the API keys of a batch of agents and marks them inactive.
+func unenrollAgents(ctx context.Context, zlog zerolog.Logger, index string, bulker bulk.Bulk, agents []model.Agent) (int, error) {
+	var apiKeys []string
+	for i := range agents {
+		apiKeys = append(apiKeys, agents[i].APIKeyIDs()...)
+	}
+	if len(apiKeys) > 0 {
+		err := bulker.APIKeyInvalidate(ctx, apiKeys...)
+		audit.Log(ctx, audit.Event{
+			Action:    audit.ActionAPIKeyInvalidate,
+			Message:   "API keys of inactive agents invalidated",
+			APIKeyIDs: apiKeys,
+		}.WithErr(err))
+		if err != nil {
+			return 0, fmt.Errorf("failed to invalidate API keys of inactive agents: %w", err)
+		}
+		cntAPIKeysInvalidated.Add(uint64(len(apiKeys)))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": unenrollInactiveScript,
+			"params": map[string]interface{}{
+				"now":    time.Now().UTC().Format(time.RFC3339),
+				"reason": unenrolledReasonTimeout,
+			},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ops := make([]bulk.MultiOp, len(agents))
+	for i := range agents {
+		ops[i] = bulk.MultiOp{
+			ID:    agents[i].Id,
+			Index: index,
+			Body:  body,
+		}
+	}
+	// Individual failures are reported by the items, the agents are found again on the next run.
+	items, err := bulker.MUpdate(ctx, ops)
+	if items == nil && err != nil {
+		return 0, fmt.Errorf("failed to unenroll inactive agents: %w", err)
+	}
+
+	var count int
+	for i, item := range items {
+		if err := es.TranslateError(item.Status, item.Error); err != nil {
+			zlog.Warn().Err(err).Str(logger.AgentID, agents[i].Id).Msg("failed to unenroll inactive agent")
+			continue
+		}
+		audit.Log(ctx, audit.Event{
+			Action:    audit.ActionAgentUnenroll,
+			Outcome:   audit.OutcomeSuccess,
+			Message:   "Inactive agent unenrolled",
+			AgentID:   agents[i].Id,
+			PolicyID:  agents[i].PolicyID,
+			APIKeyIDs: agents[i].APIKeyIDs(),
+		})
+		count++
+	}
+	cntAgentsUnenrolled.Add(uint64(count))
+	return count, nil
+}
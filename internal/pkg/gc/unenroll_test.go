@@ -0,0 +1,94 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+func agentHits(t *testing.T, agents ...model.Agent) *es.ResultT {
+	t.Helper()
+	res := &es.ResultT{}
+	for _, agent := range agents {
+		src, err := json.Marshal(agent)
+		require.NoError(t, err)
+		res.Hits = append(res.Hits, es.HitT{ID: agent.Id, Source: src})
+	}
+	return res
+}
+
+func TestUnenrollInactiveAgents(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx := context.Background()
+
+	agent1 := model.Agent{
+		ESDocument:     model.ESDocument{Id: "agent1"},
+		Active:         true,
+		AccessAPIKeyID: "access1",
+		Outputs: map[string]*model.PolicyOutput{
+			"default": {APIKeyID: "output1"},
+		},
+	}
+	agent2 := model.Agent{
+		ESDocument:     model.ESDocument{Id: "agent2"},
+		Active:         true,
+		AccessAPIKeyID: "access2",
+	}
+	policies := []model.Policy{
+		{PolicyID: "no-timeout"},
+		{PolicyID: "policy", UnenrollTimeout: 3600},
+	}
+
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Search", mock.Anything, dl.FleetAgents, mock.MatchedBy(func(body []byte) bool {
+		return assert.Contains(t, string(body), `"now-3600s"`)
+	}), mock.Anything).Return(agentHits(t, agent1, agent2), nil).Once()
+	bulker.On("APIKeyInvalidate", mock.Anything, []string{"access1", "output1", "access2"}).Return(nil).Once()
+	bulker.On("MUpdate", mock.Anything, mock.MatchedBy(func(ops []bulk.MultiOp) bool {
+		return len(ops) == 2 && ops[0].ID == "agent1" && ops[1].ID == "agent2"
+	}), mock.Anything).Return([]bulk.BulkIndexerResponseItem{{Status: 200}, {Status: 200}}, nil).Once()
+
+	err := unenrollInactiveAgents(ctx, dl.FleetAgents, bulker, policies)
+	require.NoError(t, err)
+	bulker.AssertExpectations(t)
+}
+
+func TestUnenrollInactiveAgentsInvalidateFailure(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx := context.Background()
+
+	agent := model.Agent{
+		ESDocument:     model.ESDocument{Id: "agent1"},
+		Active:         true,
+		AccessAPIKeyID: "access1",
+	}
+	policies := []model.Policy{{PolicyID: "policy", UnenrollTimeout: 60}}
+
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Search", mock.Anything, dl.FleetAgents, mock.Anything, mock.Anything).Return(agentHits(t, agent), nil).Once()
+	bulker.On("APIKeyInvalidate", mock.Anything, []string{"access1"}).Return(errors.New("invalidate failed")).Once()
+
+	// agents are not marked inactive unless their keys are invalidated
+	err := unenrollInactiveAgents(ctx, dl.FleetAgents, bulker, policies)
+	require.Error(t, err)
+	bulker.AssertNotCalled(t, "MUpdate", mock.Anything, mock.Anything, mock.Anything)
+	bulker.AssertExpectations(t)
+}
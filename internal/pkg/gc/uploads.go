@@ -0,0 +1,165 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package gc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
+	"github.com/elastic/fleet-server/v7/internal/pkg/uploader"
+	"github.com/elastic/fleet-server/v7/internal/pkg/uploader/upload"
+)
+
+const (
+	staleUploadsBatchSize = 1000 // remaining uploads are expired on the next run
+	chunkBIDsBatchSize    = 1000
+)
+
+// uploadsGC removes the data left behind by uploads that are never completed.
+type uploadsGC struct {
+	bulker    bulk.Bulk
+	timeLimit time.Duration
+
+	// injectable for testing purposes
+	deleteChunks func(ctx context.Context, bulker bulk.Bulk, source string, baseID string) error
+	chunkInfos   func(ctx context.Context, bulker bulk.Bulk, baseID string) ([]uploader.ChunkInfo, error)
+}
+
+func newUploadsGC(bulker bulk.Bulk, timeLimit time.Duration) *uploadsGC {
+	return &uploadsGC{
+		bulker:       bulker,
+		timeLimit:    timeLimit,
+		deleteChunks: uploader.DeleteChunksByQuery,
+		chunkInfos:   uploader.GetChunkInfos,
+	}
+}
+
+func getUploadsGCFunc(bulker bulk.Bulk, timeLimit time.Duration) scheduler.WorkFunc {
+	u := newUploadsGC(bulker, timeLimit)
+	return func(ctx context.Context) error {
+		if err := u.expireStaleUploads(ctx); err != nil {
+			return err
+		}
+		return u.deleteOrphanedChunks(ctx)
+	}
+}
+
+// expireStaleUploads deletes the chunks of uploads that were not completed within the upload time limit
+// and marks them expired. Agents are already refused to upload chunks to these uploads, see upload.Info.Expired.
+//
+// Chunks are deleted before the status is updated so that an upload is found again on the next run
+// if either fails.
+func (u *uploadsGC) expireStaleUploads(ctx context.Context) error {
+	log := log.With().Str("ctx", "expire stale uploads").Dur("time_limit", u.timeLimit).Logger()
+
+	infos, err := uploader.FindStaleUploads(ctx, u.bulker, time.Now().Add(-u.timeLimit), staleUploadsBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to find stale uploads: %w", err)
+	}
+
+	if len(infos) > 0 {
+		if err := scheduler.CheckLease(ctx); err != nil {
+			return err
+		}
+	}
+	var expired int
+	var reclaimed uint64
+	for _, info := range infos {
+		zlog := log.With().Str("fileID", info.DocID).Str("uploadID", info.ID).Str("source", info.Source).Logger()
+
+		size := u.chunksSize(ctx, zlog, info.DocID)
+		if err := u.deleteChunks(ctx, u.bulker, info.Source, info.DocID); err != nil {
+			zlog.Warn().Err(err).Msg("failed to delete chunks of stale upload")
+			continue
+		}
+		if err := uploader.SetStatus(ctx, u.bulker, info, upload.StatusExpired); err != nil {
+			zlog.Warn().Err(err).Msg("failed to mark stale upload expired")
+			continue
+		}
+		expired++
+		reclaimed += size
+		zlog.Debug().Uint64("bytes", size).Time("upload_start", info.Start).Msg("expired stale upload")
+	}
+
+	cntUploadsExpired.Add(uint64(expired))
+	cntUploadBytesReclaimed.Add(reclaimed)
+	if expired > 0 {
+		log.Info().Int("count", expired).Uint64("bytes", reclaimed).Msg("expired stale uploads")
+	}
+	return nil
+}
+
+// deleteOrphanedChunks deletes chunk documents whose base ID has no upload metadata document.
+func (u *uploadsGC) deleteOrphanedChunks(ctx context.Context) error {
+	log := log.With().Str("ctx", "delete orphaned chunks").Logger()
+
+	var orphaned int
+	var reclaimed uint64
+	var after string
+	for {
+		bids, err := uploader.ListChunkBaseIDs(ctx, u.bulker, after, chunkBIDsBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list chunk base IDs: %w", err)
+		}
+		if len(bids) == 0 {
+			break
+		}
+		found, err := uploader.FindFileDocIDs(ctx, u.bulker, bids)
+		if err != nil {
+			return fmt.Errorf("failed to find upload metadata documents: %w", err)
+		}
+		if err := scheduler.CheckLease(ctx); err != nil {
+			return err
+		}
+
+		for _, bid := range bids {
+			if found[bid] {
+				continue
+			}
+			zlog := log.With().Str("fileID", bid).Logger()
+
+			size := u.chunksSize(ctx, zlog, bid)
+			if err := u.deleteChunks(ctx, u.bulker, "*", bid); err != nil {
+				zlog.Warn().Err(err).Msg("failed to delete orphaned chunks")
+				continue
+			}
+			orphaned++
+			reclaimed += size
+			zlog.Debug().Uint64("bytes", size).Msg("deleted orphaned chunks")
+		}
+
+		if len(bids) < chunkBIDsBatchSize {
+			break
+		}
+		after = bids[len(bids)-1]
+	}
+
+	cntOrphanedUploads.Add(uint64(orphaned))
+	cntUploadBytesReclaimed.Add(reclaimed)
+	if orphaned > 0 {
+		log.Info().Int("count", orphaned).Uint64("bytes", reclaimed).Msg("deleted chunks of uploads without metadata")
+	}
+	return nil
+}
+
+// chunksSize returns the size of the data stored in the chunks with the base ID, used for metrics only.
+func (u *uploadsGC) chunksSize(ctx context.Context, zlog zerolog.Logger, baseID string) uint64 {
+	chunks, err := u.chunkInfos(ctx, u.bulker, baseID)
+	if err != nil {
+		zlog.Debug().Err(err).Msg("unable to retrieve size of chunks")
+		return 0
+	}
+	var size uint64
+	for _, chunk := range chunks {
+		size += uint64(chunk.Size)
+	}
+	return size
+}
@@ -0,0 +1,94 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package gc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+	"github.com/elastic/fleet-server/v7/internal/pkg/uploader"
+)
+
+func bodyContains(s string) interface{} {
+	return mock.MatchedBy(func(body []byte) bool {
+		return bytes.Contains(body, []byte(s))
+	})
+}
+
+func newTestUploadsGC(bulker bulk.Bulk, deleted *[]string, failDelete string) *uploadsGC {
+	u := newUploadsGC(bulker, time.Hour)
+	u.deleteChunks = func(_ context.Context, _ bulk.Bulk, source string, baseID string) error {
+		if baseID == failDelete {
+			return errors.New("delete failed")
+		}
+		*deleted = append(*deleted, source+"/"+baseID)
+		return nil
+	}
+	u.chunkInfos = func(_ context.Context, _ bulk.Bulk, baseID string) ([]uploader.ChunkInfo, error) {
+		return []uploader.ChunkInfo{{BID: baseID, Size: 10}, {BID: baseID, Size: 5}}, nil
+	}
+	return u
+}
+
+func TestExpireStaleUploads(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx := context.Background()
+
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Search", mock.Anything, ".fleet-files-*", bodyContains(uploader.FieldUploadStart), mock.Anything).Return(&es.ResultT{
+		HitsT: es.HitsT{Hits: []es.HitT{
+			{ID: "file1", Source: []byte(`{"upload_id":"upload1","src":"endpoint","file":{"size":15,"ChunkSize":10,"Status":"UPLOADING"},"upload_start":1}`)},
+			{ID: "file2", Source: []byte(`{"upload_id":"upload2","src":"endpoint","file":{"size":15,"ChunkSize":10,"Status":"AWAITING_UPLOAD"},"upload_start":1}`)},
+		}},
+	}, nil).Once()
+	// only the upload whose chunks were deleted is marked failed
+	bulker.On("Update", mock.Anything, ".fleet-files-endpoint", "file1", bodyContains(`"EXPIRED"`), mock.Anything).Return(nil).Once()
+
+	var deleted []string
+	u := newTestUploadsGC(bulker, &deleted, "file2")
+
+	before := cntUploadBytesReclaimed.Get()
+	require.NoError(t, u.expireStaleUploads(ctx))
+	assert.Equal(t, []string{"endpoint/file1"}, deleted)
+	assert.Equal(t, uint64(15), cntUploadBytesReclaimed.Get()-before)
+	bulker.AssertExpectations(t)
+}
+
+func TestDeleteOrphanedChunks(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx := context.Background()
+
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Search", mock.Anything, ".fleet-file-data-*", mock.Anything, mock.Anything).Return(&es.ResultT{
+		Aggregations: map[string]es.Aggregation{
+			uploader.FieldBaseID: {Buckets: []es.Bucket{{Key: "live"}, {Key: "orphan"}}},
+		},
+	}, nil).Once()
+	bulker.On("Search", mock.Anything, ".fleet-files-*", bodyContains(`"_id"`), mock.Anything).Return(&es.ResultT{
+		HitsT: es.HitsT{Hits: []es.HitT{{ID: "live"}}},
+	}, nil).Once()
+
+	var deleted []string
+	u := newTestUploadsGC(bulker, &deleted, "")
+
+	before := cntOrphanedUploads.Get()
+	require.NoError(t, u.deleteOrphanedChunks(ctx))
+	assert.Equal(t, []string{"*/orphan"}, deleted)
+	assert.Equal(t, uint64(1), cntOrphanedUploads.Get()-before)
+	bulker.AssertExpectations(t)
+}
@@ -0,0 +1,171 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// latencyWeight is the weight of a new observation in the moving average of a LatencySignal.
+const latencyWeight = 0.2
+
+// LatencySignal is the exponentially weighted moving average of observed latencies, such as
+// the Elasticsearch bulk flush round trips. It is safe for concurrent use.
+type LatencySignal struct {
+	mut sync.Mutex
+	avg time.Duration
+}
+
+// NewLatencySignal returns a latency signal without observations.
+func NewLatencySignal() *LatencySignal {
+	return &LatencySignal{}
+}
+
+// Observe adds a latency to the moving average. Observe may be called on a nil signal.
+func (s *LatencySignal) Observe(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.avg == 0 {
+		s.avg = d
+		return
+	}
+	s.avg += time.Duration(latencyWeight * float64(d-s.avg))
+}
+
+// Value returns the moving average, 0 if nothing was observed. Value may be called on a nil signal.
+func (s *LatencySignal) Value() time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.avg
+}
+
+// adaptiveLimiter is a concurrency limit adjusted with additive increase, multiplicative decrease.
+//
+// The limit grows by one each time as many requests as the limit complete under the target latencies,
+// and is multiplied by the backoff ratio when a request completes over the target handler latency or while
+// the Elasticsearch latency signal is over its target. Decreases happen at most once per cooldown so that
+// the requests in flight at the time of a slowdown count as a single congestion event.
+type adaptiveLimiter struct {
+	min, max          float64
+	backoff           float64
+	targetLatency     time.Duration
+	bulkTargetLatency time.Duration
+	bulkLatency       *LatencySignal
+
+	mut          sync.Mutex
+	limit        float64
+	active       int64
+	lastDecrease time.Time
+	now          func() time.Time
+}
+
+// newAdaptiveLimiter returns an adaptive limiter, or nil if adaptive limits are disabled.
+func newAdaptiveLimiter(cfg *config.Limit, bulkLatency *LatencySignal) *adaptiveLimiter {
+	a := cfg.Adaptive
+	if !a.Enabled {
+		return nil
+	}
+	max := a.Max
+	if max == 0 {
+		max = cfg.Max
+	}
+	if max <= 0 {
+		log.Warn().Msg("adaptive limit disabled, it requires a max value")
+		return nil
+	}
+	min := a.Min
+	if min <= 0 || min > max {
+		min = 1
+	}
+	if a.TargetLatency <= 0 && (bulkLatency == nil || a.BulkTargetLatency <= 0) {
+		log.Warn().Msg("adaptive limit disabled, it requires a target latency")
+		return nil
+	}
+	return &adaptiveLimiter{
+		min:               float64(min),
+		max:               float64(max),
+		backoff:           a.Backoff,
+		targetLatency:     a.TargetLatency,
+		bulkTargetLatency: a.BulkTargetLatency,
+		bulkLatency:       bulkLatency,
+		limit:             float64(max),
+		now:               time.Now,
+	}
+}
+
+func (l *adaptiveLimiter) acquire() (func(), error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.active >= int64(l.limit) {
+		return nil, ErrMaxLimit
+	}
+	l.active++
+
+	start := l.now()
+	return func() {
+		l.release(l.now().Sub(start))
+	}, nil
+}
+
+func (l *adaptiveLimiter) release(latency time.Duration) {
+	congested := l.targetLatency > 0 && latency > l.targetLatency
+	if l.bulkTargetLatency > 0 && l.bulkLatency.Value() > l.bulkTargetLatency {
+		congested = true
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.active--
+
+	if !congested {
+		l.limit += 1 / l.limit
+		if l.limit > l.max {
+			l.limit = l.max
+		}
+		return
+	}
+	now := l.now()
+	if now.Sub(l.lastDecrease) < l.cooldown() {
+		return
+	}
+	l.lastDecrease = now
+	l.limit *= l.backoff
+	if l.limit < l.min {
+		l.limit = l.min
+	}
+}
+
+// cooldown is the time between two decreases, long enough for the requests affected by a slowdown to complete.
+func (l *adaptiveLimiter) cooldown() time.Duration {
+	if l.targetLatency > l.bulkTargetLatency {
+		return l.targetLatency
+	}
+	return l.bulkTargetLatency
+}
+
+// inFlight returns the number of requests holding the limit.
+func (l *adaptiveLimiter) inFlight() int64 {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.active
+}
+
+// Limit returns the current concurrency limit.
+func (l *adaptiveLimiter) Limit() int64 {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return int64(l.limit)
+}
@@ -0,0 +1,108 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func TestLatencySignal(t *testing.T) {
+	var nilSignal *LatencySignal
+	assert.Zero(t, nilSignal.Value())
+
+	s := NewLatencySignal()
+	assert.Zero(t, s.Value())
+	s.Observe(time.Second)
+	assert.Equal(t, time.Second, s.Value())
+	s.Observe(2 * time.Second)
+	assert.Equal(t, 1200*time.Millisecond, s.Value())
+}
+
+func TestNewAdaptiveLimiter(t *testing.T) {
+	adaptive := config.AdaptiveLimit{Enabled: true, TargetLatency: time.Second, Backoff: 0.5}
+
+	assert.Nil(t, newAdaptiveLimiter(&config.Limit{Max: 10}, nil), "disabled")
+	assert.Nil(t, newAdaptiveLimiter(&config.Limit{Adaptive: adaptive}, nil), "no max")
+	assert.Nil(t, newAdaptiveLimiter(&config.Limit{Max: 10, Adaptive: config.AdaptiveLimit{Enabled: true, BulkTargetLatency: time.Second}}, nil), "no latency target")
+
+	l := newAdaptiveLimiter(&config.Limit{Max: 10, Adaptive: adaptive}, nil)
+	require.NotNil(t, l)
+	assert.Equal(t, int64(10), l.Limit(), "starts at max")
+
+	// the static semaphore is replaced by the adaptive limit
+	lim := NewLimiter(&config.Limit{Max: 10, Adaptive: adaptive}, nil, nil)
+	assert.Nil(t, lim.maxLimit)
+	assert.NotNil(t, lim.adaptive)
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	now := time.Now()
+	bulk := NewLatencySignal()
+	l := newAdaptiveLimiter(&config.Limit{Adaptive: config.AdaptiveLimit{
+		Enabled:           true,
+		Min:               2,
+		Max:               8,
+		TargetLatency:     time.Second,
+		BulkTargetLatency: 500 * time.Millisecond,
+		Backoff:           0.5,
+	}}, bulk)
+	require.NotNil(t, l)
+	l.now = func() time.Time { return now }
+
+	// concurrency is limited to the current limit
+	var releases []func()
+	for i := 0; i < 8; i++ {
+		release, err := l.acquire()
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	_, err := l.acquire()
+	require.ErrorIs(t, err, ErrMaxLimit)
+
+	// slow requests decrease the limit once per cooldown
+	now = now.Add(2 * time.Second)
+	releases[0]()
+	assert.Equal(t, int64(4), l.Limit())
+	releases[1]()
+	assert.Equal(t, int64(4), l.Limit(), "decreased at most once per cooldown")
+
+	now = now.Add(2 * time.Second)
+	releases[2]()
+	assert.Equal(t, int64(2), l.Limit())
+	now = now.Add(2 * time.Second)
+	releases[3]()
+	assert.Equal(t, int64(2), l.Limit(), "bounded by min")
+	for _, release := range releases[4:] {
+		release()
+	}
+
+	// fast requests increase the limit
+	for i := 0; i < 20; i++ {
+		release, err := l.acquire()
+		require.NoError(t, err)
+		release()
+	}
+	assert.Equal(t, int64(6), l.Limit())
+	for i := 0; i < 100; i++ {
+		release, err := l.acquire()
+		require.NoError(t, err)
+		release()
+	}
+	assert.Equal(t, int64(8), l.Limit(), "bounded by max")
+
+	// slow Elasticsearch decreases the limit of fast requests
+	now = now.Add(2 * time.Second)
+	bulk.Observe(time.Second)
+	release, err := l.acquire()
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, int64(4), l.Limit())
+}
@@ -0,0 +1,52 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// entries tracks the limits of the clients of a limiter.
+//
+// The idle entries are kept in an LRU of bounded size; the entries in use are kept apart until
+// they are released so that they are never evicted, their number is bounded by the requests or
+// connections in flight.
+type entries[K comparable, E any] struct {
+	idle  *lru.Cache[K, *E]
+	inUse map[K]*E
+}
+
+func newEntries[K comparable, E any](size int) (*entries[K, E], error) {
+	idle, err := lru.New[K, *E](size)
+	if err != nil {
+		return nil, err
+	}
+	return &entries[K, E]{idle: idle, inUse: make(map[K]*E)}, nil
+}
+
+// get returns the entry of key, false if it is not tracked.
+func (t *entries[K, E]) get(key K) (*E, bool) {
+	if e, ok := t.inUse[key]; ok {
+		return e, true
+	}
+	return t.idle.Get(key)
+}
+
+// add adds the idle entry of key, it may evict the least recently used idle entry.
+func (t *entries[K, E]) add(key K, e *E) {
+	t.idle.Add(key, e)
+}
+
+// use marks the entry of key in use, it is not evicted until it is idle again.
+func (t *entries[K, E]) use(key K, e *E) {
+	t.idle.Remove(key)
+	t.inUse[key] = e
+}
+
+// unuse marks the entry of key idle.
+func (t *entries[K, E]) unuse(key K, e *E) {
+	delete(t.inUse, key)
+	t.idle.Add(key, e)
+}
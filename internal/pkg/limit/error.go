@@ -7,7 +7,9 @@ package limit
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/rs/zerolog/log"
 )
@@ -15,15 +17,25 @@ import (
 var (
 	ErrRateLimit = errors.New("rate limit")
 	ErrMaxLimit  = errors.New("max limit")
+
+	// ErrKeyedRateLimit and ErrKeyedMaxLimit are the errors of limits applied per client.
+	ErrKeyedRateLimit = fmt.Errorf("keyed %w", ErrRateLimit)
+	ErrKeyedMaxLimit  = fmt.Errorf("keyed %w", ErrMaxLimit)
+
+	// Errors of the connections closed by the listeners, reported to their RejectFunc.
+	ErrMaxConnections       = errors.New("max connections")
+	ErrSourceMaxConnections = fmt.Errorf("source %w", ErrMaxConnections)
+	ErrSourceConnectionRate = errors.New("source connection rate")
 )
 
 // writeError recreates the behaviour of api/error.go.
 // It is defined separately here to stop a circular import
 func writeError(w http.ResponseWriter, err error) error {
 	resp := struct {
-		Status  int    `json:"statusCode"`
-		Error   string `json:"error"`
-		Message string `json:"message"`
+		Status     int    `json:"statusCode"`
+		Error      string `json:"error"`
+		Message    string `json:"message"`
+		RetryAfter int    `json:"retryAfter,omitempty"`
 	}{
 		Status:  http.StatusTooManyRequests,
 		Error:   "UnknownLimiterError",
@@ -39,6 +51,10 @@ func writeError(w http.ResponseWriter, err error) error {
 	default:
 		log.Error().Err(err).Msg("Encountered unknown limiter error")
 	}
+	if after, ok := RetryAfter(err); ok {
+		resp.RetryAfter = after
+		w.Header().Set("Retry-After", strconv.Itoa(after))
+	}
 	p, wErr := json.Marshal(&resp)
 	if wErr != nil {
 		return wErr
@@ -9,16 +9,19 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestWriteError(t *testing.T) {
 	tests := []struct {
-		name string
-		err  error
-		want string
+		name       string
+		err        error
+		want       string
+		retryAfter int
 	}{{
 		name: "unknown",
 		err:  errors.New("unknown"),
@@ -31,6 +34,11 @@ func TestWriteError(t *testing.T) {
 		name: "max limit",
 		err:  ErrMaxLimit,
 		want: "MaxLimit",
+	}, {
+		name:       "retry after",
+		err:        &RetryAfterError{Err: ErrRateLimit, After: 2 * time.Second},
+		want:       "RateLimit",
+		retryAfter: 2,
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -43,14 +51,19 @@ func TestWriteError(t *testing.T) {
 			require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
 
 			var body struct {
-				Status int    `json:"statusCode"`
-				Error  string `json:"error"`
+				Status     int    `json:"statusCode"`
+				Error      string `json:"error"`
+				RetryAfter int    `json:"retryAfter"`
 			}
 			dec := json.NewDecoder(resp.Body)
 			err = dec.Decode(&body)
 			require.NoError(t, err)
 			require.Equal(t, http.StatusTooManyRequests, body.Status)
 			require.Equal(t, tt.want, body.Error)
+			require.Equal(t, tt.retryAfter, body.RetryAfter)
+			if tt.retryAfter > 0 {
+				require.Equal(t, strconv.Itoa(tt.retryAfter), resp.Header.Get("Retry-After"))
+			}
 		})
 	}
 }
@@ -0,0 +1,104 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// KeyFunc returns the key identifying the client of a request, or an empty string if it has none.
+type KeyFunc func(r *http.Request) string
+
+// keyedLimiter applies a token bucket and a concurrency limit per key.
+//
+// The number of idle keys tracked is bounded by an LRU; a client that is dropped from it starts
+// over with a full bucket. The keys with requests in flight are not dropped.
+type keyedLimiter struct {
+	keyFn    KeyFunc
+	interval time.Duration
+	burst    int
+	max      int64
+
+	mut     sync.Mutex
+	entries *entries[string, keyedEntry]
+}
+
+type keyedEntry struct {
+	rateLimit *rate.Limiter
+	active    int64
+}
+
+// newKeyedLimiter returns a keyed limiter, or nil if keyed limits are disabled.
+func newKeyedLimiter(cfg *config.KeyedLimit, keyFn KeyFunc) *keyedLimiter {
+	if keyFn == nil || !cfg.Enabled() {
+		return nil
+	}
+	entries, err := newEntries[string, keyedEntry](cfg.MaxKeys)
+	if err != nil {
+		return nil
+	}
+	// a token bucket without burst rejects every request
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	return &keyedLimiter{
+		keyFn:    keyFn,
+		interval: cfg.Interval,
+		burst:    burst,
+		max:      cfg.Max,
+		entries:  entries,
+	}
+}
+
+func (l *keyedLimiter) acquire(r *http.Request) (releaseFunc, error) {
+	if l == nil {
+		return noop, nil
+	}
+	key := l.keyFn(r)
+	if key == "" {
+		return noop, nil
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	e, ok := l.entries.get(key)
+	if !ok {
+		e = &keyedEntry{}
+		if l.interval > 0 {
+			e.rateLimit = rate.NewLimiter(rate.Every(l.interval), l.burst)
+		}
+		l.entries.add(key, e)
+	}
+
+	if e.rateLimit != nil && !e.rateLimit.Allow() {
+		return nil, withRetryAfter(ErrKeyedRateLimit, tokenDelay(e.rateLimit))
+	}
+	if l.max > 0 {
+		if e.active >= l.max {
+			return nil, ErrKeyedMaxLimit
+		}
+		if e.active == 0 {
+			l.entries.use(key, e)
+		}
+		e.active++
+		return func() {
+			l.mut.Lock()
+			e.active--
+			if e.active == 0 {
+				l.entries.unuse(key, e)
+			}
+			l.mut.Unlock()
+		}, nil
+	}
+	return noop, nil
+}
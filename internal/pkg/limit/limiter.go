@@ -6,7 +6,9 @@
 package limit
 
 import (
+	"errors"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
@@ -25,48 +27,94 @@ type StatIncer interface {
 	IncStart() func()
 }
 
+// LimitSetter is implemented by the stats of a limiter that report its adaptive concurrency limit.
+type LimitSetter interface {
+	SetLimit(int64)
+}
+
 type Limiter struct {
 	rateLimit *rate.Limiter
 	maxLimit  *semaphore.Weighted
+	adaptive  *adaptiveLimiter
+	keyed     *keyedLimiter
+	latency   *LatencySignal // request duration
+	inFlight  atomic.Int64   // requests holding the max limit semaphore
 }
 
-func NewLimiter(cfg *config.Limit) *Limiter {
-	l := &Limiter{}
+// NewLimiter returns a limiter for the limits of cfg. The keyed limits of cfg are applied to
+// the clients identified by keyFn, if any. The adaptive limit of cfg, if enabled, follows the
+// Elasticsearch latency of bulkLatency.
+func NewLimiter(cfg *config.Limit, keyFn KeyFunc, bulkLatency *LatencySignal) *Limiter {
+	l := &Limiter{latency: NewLatencySignal()}
 
 	if cfg == nil {
 		return l
 	}
 
+	l.keyed = newKeyedLimiter(&cfg.Keyed, keyFn)
+	l.adaptive = newAdaptiveLimiter(cfg, bulkLatency)
+
 	if cfg.Interval != time.Duration(0) {
 		l.rateLimit = rate.NewLimiter(rate.Every(cfg.Interval), cfg.Burst)
 	}
 
-	if cfg.Max != 0 {
+	if cfg.Max != 0 && l.adaptive == nil {
 		l.maxLimit = semaphore.NewWeighted(cfg.Max)
 	}
 
 	return l
 }
 
-func (l *Limiter) acquire() (releaseFunc, error) {
-	releaseFunc := noop
+// acquire applies the keyed limits first so that a client over its own limits does not
+// consume the limits shared by all clients.
+//
+// Errors carry a retry hint: the time until the token bucket refills for rate limits, the
+// average request duration divided by the requests in flight for the shared concurrency limits,
+// as a slot frees about that often, and the average request duration for the keyed limits.
+func (l *Limiter) acquire(r *http.Request) (releaseFunc, error) {
+	keyedRelease, err := l.keyed.acquire(r)
+	if errors.Is(err, ErrKeyedMaxLimit) {
+		return nil, withRetryAfter(err, l.latency.Value())
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	if l.rateLimit != nil && !l.rateLimit.Allow() {
-		return nil, ErrRateLimit
+		keyedRelease()
+		return nil, withRetryAfter(ErrRateLimit, tokenDelay(l.rateLimit))
+	}
+
+	if l.adaptive != nil {
+		adaptiveRelease, err := l.adaptive.acquire()
+		if err != nil {
+			keyedRelease()
+			return nil, withRetryAfter(err, slotDelay(l.latency.Value(), l.adaptive.inFlight()))
+		}
+		return func() {
+			adaptiveRelease()
+			keyedRelease()
+		}, nil
 	}
 
 	if l.maxLimit != nil {
 		if !l.maxLimit.TryAcquire(1) {
-			return nil, ErrMaxLimit
+			keyedRelease()
+			return nil, withRetryAfter(ErrMaxLimit, slotDelay(l.latency.Value(), l.inFlight.Load()))
 		}
-		releaseFunc = l.release
+		l.inFlight.Add(1)
+		return func() {
+			l.release()
+			keyedRelease()
+		}, nil
 	}
 
-	return releaseFunc, nil
+	return keyedRelease, nil
 }
 
 func (l *Limiter) release() {
 	if l.maxLimit != nil {
+		l.inFlight.Add(-1)
 		l.maxLimit.Release(1)
 	}
 }
@@ -79,7 +127,7 @@ func (l *Limiter) Wrap(name string, si StatIncer, ll zerolog.Level) func(http.Ha
 				defer dfunc()
 			}
 
-			lf, err := l.acquire()
+			lf, err := l.acquire(r)
 			if err != nil {
 				hlog.FromRequest(r).WithLevel(ll).Str("route", name).Err(err).Msg("limit reached")
 				if wErr := writeError(w, err); wErr != nil {
@@ -90,7 +138,15 @@ func (l *Limiter) Wrap(name string, si StatIncer, ll zerolog.Level) func(http.Ha
 				}
 				return
 			}
-			defer lf()
+			start := time.Now()
+			defer func() {
+				l.latency.Observe(time.Since(start))
+				lf()
+				// report the adaptive limit once adjusted to the latency of the request
+				if ls, ok := si.(LimitSetter); ok && l.adaptive != nil {
+					ls.SetLimit(l.adaptive.Limit())
+				}
+			}()
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -5,15 +5,20 @@
 package limit
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/time/rate"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 )
 
 type mockIncer struct {
@@ -29,6 +34,12 @@ func (m *mockIncer) IncStart() func() {
 	return args.Get(0).(func())
 }
 
+func isError(target error) func(error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
 func stubHandle() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -58,7 +69,7 @@ func Test_Limiter_Wrap(t *testing.T) {
 		stats: func() *mockIncer {
 			m := &mockIncer{}
 			m.On("IncStart").Return(noop).Once()
-			m.On("IncError", ErrMaxLimit).Once()
+			m.On("IncError", mock.MatchedBy(isError(ErrMaxLimit))).Once()
 			return m
 		},
 		status: http.StatusTooManyRequests,
@@ -70,7 +81,7 @@ func Test_Limiter_Wrap(t *testing.T) {
 		stats: func() *mockIncer {
 			m := &mockIncer{}
 			m.On("IncStart").Return(noop).Once()
-			m.On("IncError", ErrRateLimit).Once()
+			m.On("IncError", mock.MatchedBy(isError(ErrRateLimit))).Once()
 			return m
 		},
 		status: http.StatusTooManyRequests,
@@ -86,7 +97,144 @@ func Test_Limiter_Wrap(t *testing.T) {
 			resp := w.Result()
 			resp.Body.Close()
 			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.status == http.StatusTooManyRequests {
+				assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+			}
 			mi.AssertExpectations(t)
 		})
 	}
 }
+
+func Test_Limiter_Keyed(t *testing.T) {
+	key := func(r *http.Request) string { return r.Header.Get("X-Key") }
+	request := func(k string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Key", k)
+		return r
+	}
+
+	t.Run("rate limit", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Keyed: config.KeyedLimit{By: config.LimitByAgentID, Interval: time.Hour, Burst: 1, MaxKeys: 1}}, key, nil)
+
+		release, err := l.acquire(request("a"))
+		require.NoError(t, err)
+		release()
+		_, err = l.acquire(request("a"))
+		require.ErrorIs(t, err, ErrKeyedRateLimit)
+		require.ErrorIs(t, err, ErrRateLimit)
+
+		// requests without key are not limited
+		_, err = l.acquire(request(""))
+		require.NoError(t, err)
+
+		// "b" evicts "a" from the tracked keys
+		_, err = l.acquire(request("b"))
+		require.NoError(t, err)
+		_, err = l.acquire(request("a"))
+		require.NoError(t, err)
+	})
+
+	t.Run("max limit", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Keyed: config.KeyedLimit{By: config.LimitByAgentID, Max: 1, MaxKeys: 10}}, key, nil)
+
+		release, err := l.acquire(request("a"))
+		require.NoError(t, err)
+		_, err = l.acquire(request("a"))
+		require.ErrorIs(t, err, ErrKeyedMaxLimit)
+		_, err = l.acquire(request("b"))
+		require.NoError(t, err)
+
+		release()
+		_, err = l.acquire(request("a"))
+		require.NoError(t, err)
+	})
+
+	t.Run("keys in use are not evicted", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Keyed: config.KeyedLimit{By: config.LimitByAgentID, Max: 1, MaxKeys: 1}}, key, nil)
+
+		release, err := l.acquire(request("a"))
+		require.NoError(t, err)
+		_, err = l.acquire(request("b"))
+		require.NoError(t, err)
+		_, err = l.acquire(request("a"))
+		require.ErrorIs(t, err, ErrKeyedMaxLimit)
+
+		release()
+		_, err = l.acquire(request("a"))
+		require.NoError(t, err)
+	})
+
+	t.Run("rate limit without burst", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Keyed: config.KeyedLimit{By: config.LimitByAgentID, Interval: time.Hour, MaxKeys: 1}}, key, nil)
+
+		_, err := l.acquire(request("a"))
+		require.NoError(t, err)
+		_, err = l.acquire(request("a"))
+		require.ErrorIs(t, err, ErrKeyedRateLimit)
+	})
+
+	t.Run("global limit releases keyed limit", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Keyed: config.KeyedLimit{By: config.LimitByAgentID, Max: 1, MaxKeys: 10}}, key, nil)
+		l.maxLimit = semaphore.NewWeighted(0)
+
+		_, err := l.acquire(request("a"))
+		require.ErrorIs(t, err, ErrMaxLimit)
+		require.NotErrorIs(t, err, ErrKeyedMaxLimit)
+		l.maxLimit = nil
+		_, err = l.acquire(request("a"))
+		require.NoError(t, err)
+	})
+}
+
+func Test_Limiter_RetryAfter(t *testing.T) {
+	retryAfter := func(t *testing.T, err error) time.Duration {
+		t.Helper()
+		var rErr *RetryAfterError
+		require.True(t, errors.As(err, &rErr))
+		return rErr.After
+	}
+	request := func(k string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Key", k)
+		return r
+	}
+
+	t.Run("max limit is scaled by the requests in flight", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Max: 4}, nil, nil)
+		l.latency.Observe(8 * time.Second)
+		for i := 0; i < 4; i++ {
+			_, err := l.acquire(request(""))
+			require.NoError(t, err)
+		}
+		_, err := l.acquire(request(""))
+		require.ErrorIs(t, err, ErrMaxLimit)
+		after := retryAfter(t, err)
+		assert.GreaterOrEqual(t, after, 2*time.Second)
+		assert.Less(t, after, 3*time.Second)
+	})
+
+	t.Run("adaptive limit is scaled by the requests in flight", func(t *testing.T) {
+		l := NewLimiter(&config.Limit{Max: 4, Adaptive: config.AdaptiveLimit{Enabled: true, TargetLatency: time.Minute, Backoff: 0.5}}, nil, nil)
+		l.latency.Observe(8 * time.Second)
+		for i := 0; i < 4; i++ {
+			_, err := l.acquire(request(""))
+			require.NoError(t, err)
+		}
+		_, err := l.acquire(request(""))
+		require.ErrorIs(t, err, ErrMaxLimit)
+		after := retryAfter(t, err)
+		assert.GreaterOrEqual(t, after, 2*time.Second)
+		assert.Less(t, after, 3*time.Second)
+	})
+
+	t.Run("keyed max limit is not scaled", func(t *testing.T) {
+		key := func(r *http.Request) string { return r.Header.Get("X-Key") }
+		l := NewLimiter(&config.Limit{Keyed: config.KeyedLimit{By: config.LimitByAgentID, Max: 1, MaxKeys: 10}}, key, nil)
+		l.latency.Observe(8 * time.Second)
+		_, err := l.acquire(request("a"))
+		require.NoError(t, err)
+		_, err = l.acquire(request("a"))
+		require.ErrorIs(t, err, ErrKeyedMaxLimit)
+		assert.GreaterOrEqual(t, retryAfter(t, err), 8*time.Second)
+	})
+}
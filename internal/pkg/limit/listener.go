@@ -13,6 +13,9 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// RejectFunc is called with the reason of every connection closed by a listener.
+type RejectFunc func(err error)
+
 // Derived from netutil.LimitListener but works slightly differently.
 // Instead of blocking on the semaphore before acception connection,
 // this implementation immediately accepts connections and if cannot
@@ -22,16 +25,18 @@ import (
 // The downside to this is that it will Close() valid connections
 // indiscriminately.
 
-func Listener(l net.Listener, n int) net.Listener {
+func Listener(l net.Listener, n int, onReject RejectFunc) net.Listener {
 	return &limitListener{
 		Listener: l,
 		sem:      make(chan struct{}, n),
 		done:     make(chan struct{}),
+		onReject: onReject,
 	}
 }
 
 type limitListener struct {
 	net.Listener
+	onReject  RejectFunc
 	sem       chan struct{}
 	closeOnce sync.Once     // ensures the done chan is only closed once
 	done      chan struct{} // no values sent; closed when Close is called
@@ -69,6 +74,9 @@ func (l *limitListener) Accept() (net.Conn, error) {
 			zlog.Err(err)
 		}
 		zlog.Int("max", cap(l.sem)).Msg("Connection closed due to max limit")
+		if l.onReject != nil {
+			l.onReject(ErrMaxConnections)
+		}
 
 		return c, nil
 	}
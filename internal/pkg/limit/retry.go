@@ -0,0 +1,80 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	minRetryAfter = time.Second
+	maxRetryAfter = time.Minute
+
+	// retrySpreadPercent is the maximum random delay added to a retry hint, as a percentage of the hint,
+	// so that the clients rejected by the same burst do not retry together.
+	retrySpreadPercent = 50
+)
+
+// RetryAfterError is a limit error with the time after which the request is expected to be accepted.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns the number of seconds after which a request rejected with err may be retried,
+// as used by the Retry-After header, and false if err has no retry hint.
+func RetryAfter(err error) (int, bool) {
+	var rErr *RetryAfterError
+	if !errors.As(err, &rErr) {
+		return 0, false
+	}
+	return int(math.Ceil(rErr.After.Seconds())), true
+}
+
+// withRetryAfter returns err with the retry hint d bounded and randomly spread.
+func withRetryAfter(err error, d time.Duration) error {
+	if d < minRetryAfter {
+		d = minRetryAfter
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	d += time.Duration(rand.Int63n(int64(d) * retrySpreadPercent / 100)) //nolint:gosec // used for timing offsets
+	return &RetryAfterError{Err: err, After: d}
+}
+
+// tokenDelay returns the time until the token bucket holds a token, as the delay of a reservation.
+func tokenDelay(l *rate.Limiter) time.Duration {
+	if l.Limit() <= 0 {
+		return maxRetryAfter
+	}
+	missing := 1 - l.Tokens()
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(l.Limit()) * float64(time.Second))
+}
+
+// slotDelay returns the expected time until one of the inFlight requests of average duration latency
+// completes and frees its concurrency slot.
+func slotDelay(latency time.Duration, inFlight int64) time.Duration {
+	if inFlight < 1 {
+		inFlight = 1
+	}
+	return latency / time.Duration(inFlight)
+}
@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestWithRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		hint     time.Duration
+		min, max time.Duration
+	}{
+		{0, minRetryAfter, minRetryAfter * 3 / 2},
+		{10 * time.Second, 10 * time.Second, 15 * time.Second},
+		{time.Hour, maxRetryAfter, maxRetryAfter * 3 / 2},
+	} {
+		t.Run(tc.hint.String(), func(t *testing.T) {
+			seen := map[time.Duration]bool{}
+			for i := 0; i < 20; i++ {
+				err := withRetryAfter(ErrRateLimit, tc.hint)
+				require.ErrorIs(t, err, ErrRateLimit)
+
+				var rErr *RetryAfterError
+				require.True(t, errors.As(err, &rErr))
+				assert.GreaterOrEqual(t, rErr.After, tc.min)
+				assert.Less(t, rErr.After, tc.max)
+				seen[rErr.After] = true
+			}
+			assert.Greater(t, len(seen), 1, "retry hints are spread")
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	_, ok := RetryAfter(ErrMaxLimit)
+	assert.False(t, ok)
+
+	after, ok := RetryAfter(fmt.Errorf("wrapped: %w", &RetryAfterError{Err: ErrMaxLimit, After: 1500 * time.Millisecond}))
+	assert.True(t, ok)
+	assert.Equal(t, 2, after)
+}
+
+func TestTokenDelay(t *testing.T) {
+	l := rate.NewLimiter(rate.Every(10*time.Second), 1)
+	assert.Zero(t, tokenDelay(l))
+	require.True(t, l.Allow())
+	assert.InDelta(t, float64(10*time.Second), float64(tokenDelay(l)), float64(100*time.Millisecond))
+
+	assert.Equal(t, maxRetryAfter, tokenDelay(rate.NewLimiter(0, 0)))
+}
+
+func TestSlotDelay(t *testing.T) {
+	assert.Equal(t, 4*time.Second, slotDelay(4*time.Second, 0))
+	assert.Equal(t, 4*time.Second, slotDelay(4*time.Second, 1))
+	assert.Equal(t, time.Second, slotDelay(4*time.Second, 4))
+}
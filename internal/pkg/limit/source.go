@@ -0,0 +1,143 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+)
+
+// SourceListener limits the concurrent connections and the rate of new connections of every
+// source, see config.SourceConnLimit. Connections over the limits are closed when accepted, as
+// with Listener, and reported to onReject. Connections without an IP address, such as unix
+// socket ones, are not limited.
+func SourceListener(l net.Listener, cfg *config.SourceConnLimit, onReject RejectFunc) (net.Listener, error) {
+	allow, err := config.ParseNetworks(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := newEntries[netip.Prefix, sourceEntry](cfg.MaxSources)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceListener{
+		Listener: l,
+		cfg:      *cfg,
+		allow:    allow,
+		onReject: onReject,
+		sources:  sources,
+	}, nil
+}
+
+type sourceListener struct {
+	net.Listener
+	cfg      config.SourceConnLimit
+	allow    []netip.Prefix
+	onReject RejectFunc
+
+	mut     sync.Mutex
+	sources *entries[netip.Prefix, sourceEntry]
+}
+
+type sourceEntry struct {
+	rateLimit *rate.Limiter
+	active    int
+}
+
+func (l *sourceListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		source, ok := l.source(c.RemoteAddr())
+		if !ok {
+			return c, nil
+		}
+		release, err := l.acquire(source)
+		if err != nil {
+			cerr := c.Close()
+			log.Debug().
+				Err(err).
+				Str(logger.ECSServerAddress, c.LocalAddr().String()).
+				Str(logger.ECSClientAddress, c.RemoteAddr().String()).
+				AnErr("close", cerr).
+				Str("source", source.String()).
+				Msg("Connection closed due to source limit")
+			if l.onReject != nil {
+				l.onReject(err)
+			}
+			continue
+		}
+		return &limitListenerConn{Conn: c, release: release}, nil
+	}
+}
+
+// source returns the network the remote address belongs to, false if the address is not limited.
+func (l *sourceListener) source(addr net.Addr) (netip.Prefix, bool) {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ip = ip.Unmap()
+	for _, n := range l.allow {
+		if n.Contains(ip) {
+			return netip.Prefix{}, false
+		}
+	}
+	bits := l.cfg.PrefixIPv6
+	if ip.Is4() {
+		bits = l.cfg.PrefixIPv4
+	}
+	source, err := ip.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return source, true
+}
+
+func (l *sourceListener) acquire(source netip.Prefix) (func(), error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	e, ok := l.sources.get(source)
+	if !ok {
+		e = &sourceEntry{}
+		if l.cfg.Interval > 0 {
+			e.rateLimit = rate.NewLimiter(rate.Every(l.cfg.Interval), l.cfg.Burst)
+		}
+		l.sources.add(source, e)
+	}
+
+	if e.rateLimit != nil && !e.rateLimit.Allow() {
+		return nil, ErrSourceConnectionRate
+	}
+	if l.cfg.Max > 0 && e.active >= l.cfg.Max {
+		return nil, ErrSourceMaxConnections
+	}
+	if e.active == 0 {
+		l.sources.use(source, e)
+	}
+	e.active++
+	return func() {
+		l.mut.Lock()
+		e.active--
+		if e.active == 0 {
+			l.sources.unuse(source, e)
+		}
+		l.mut.Unlock()
+	}, nil
+}
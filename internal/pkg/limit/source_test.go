@@ -0,0 +1,156 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package limit
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// fakeListener accepts connections from the remote addresses sent to it.
+type fakeListener struct {
+	addrs chan net.Addr
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	addr, ok := <-l.addrs
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	c, _ := net.Pipe()
+	return &fakeConn{Conn: c, remote: addr}, nil
+}
+
+func (l *fakeListener) Close() error   { return nil }
+func (l *fakeListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+type fakeConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *fakeConn) RemoteAddr() net.Addr { return c.remote }
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 4321}
+}
+
+func TestSourceListener(t *testing.T) {
+	cfg := config.SourceConnLimit{
+		Max:        2,
+		Interval:   time.Hour,
+		Burst:      3,
+		PrefixIPv4: 24,
+		Allow:      []string{"192.0.2.100"},
+		MaxSources: 100,
+	}
+	var rejected []error
+	inner := &fakeListener{addrs: make(chan net.Addr, 100)}
+	ln, err := SourceListener(inner, &cfg, func(err error) { rejected = append(rejected, err) })
+	require.NoError(t, err)
+
+	// accept sends the addresses to the listener, and returns the remote address of the accepted connection
+	accept := func(addrs ...string) net.Conn {
+		t.Helper()
+		for _, a := range addrs {
+			inner.addrs <- tcpAddr(a)
+		}
+		c, err := ln.Accept()
+		require.NoError(t, err)
+		return c
+	}
+
+	c1 := accept("192.0.2.1")
+	c2 := accept("192.0.2.2")
+	// the third connection of the network is over the max, the next source is accepted
+	c3 := accept("192.0.2.3", "198.51.100.1")
+	assert.Equal(t, "198.51.100.1:4321", c3.RemoteAddr().String())
+	require.Len(t, rejected, 1)
+	assert.ErrorIs(t, rejected[0], ErrSourceMaxConnections)
+
+	// closing a connection releases its slot, but the burst of new connections is exhausted
+	require.NoError(t, c1.Close())
+	c4 := accept("192.0.2.4", "198.51.100.2")
+	assert.Equal(t, "198.51.100.2:4321", c4.RemoteAddr().String())
+	require.Len(t, rejected, 2)
+	assert.ErrorIs(t, rejected[1], ErrSourceConnectionRate)
+
+	// allowed sources are not limited
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "192.0.2.100:4321", accept("192.0.2.100").RemoteAddr().String())
+	}
+	assert.Len(t, rejected, 2)
+
+	// connections without an ip address are not limited
+	inner.addrs <- &net.UnixAddr{Name: "/run/fleet-server.sock", Net: "unix"}
+	c, err := ln.Accept()
+	require.NoError(t, err)
+	assert.IsType(t, &fakeConn{}, c)
+
+	require.NoError(t, c2.Close())
+	close(inner.addrs)
+	_, err = ln.Accept()
+	assert.True(t, errors.Is(err, net.ErrClosed))
+}
+
+func TestSourceListenerActiveSources(t *testing.T) {
+	cfg := config.SourceConnLimit{
+		Max:        1,
+		PrefixIPv4: 32,
+		MaxSources: 1,
+	}
+	var rejected []error
+	inner := &fakeListener{addrs: make(chan net.Addr, 100)}
+	ln, err := SourceListener(inner, &cfg, func(err error) { rejected = append(rejected, err) })
+	require.NoError(t, err)
+
+	accept := func(addrs ...string) net.Conn {
+		t.Helper()
+		for _, a := range addrs {
+			inner.addrs <- tcpAddr(a)
+		}
+		c, err := ln.Accept()
+		require.NoError(t, err)
+		return c
+	}
+
+	// the sources with open connections are not dropped from the table when it is full
+	c1 := accept("192.0.2.1")
+	c2 := accept("192.0.2.2")
+	c3 := accept("192.0.2.1", "192.0.2.3")
+	assert.Equal(t, "192.0.2.3:4321", c3.RemoteAddr().String())
+	require.Len(t, rejected, 1)
+	assert.ErrorIs(t, rejected[0], ErrSourceMaxConnections)
+
+	require.NoError(t, c1.Close())
+	c4 := accept("192.0.2.1")
+	assert.Equal(t, "192.0.2.1:4321", c4.RemoteAddr().String())
+
+	for _, c := range []net.Conn{c2, c3, c4} {
+		require.NoError(t, c.Close())
+	}
+}
+
+func TestListenerReject(t *testing.T) {
+	inner := &fakeListener{addrs: make(chan net.Addr, 2)}
+	var rejected []error
+	ln := Listener(inner, 1, func(err error) { rejected = append(rejected, err) })
+
+	inner.addrs <- tcpAddr("192.0.2.1")
+	inner.addrs <- tcpAddr("192.0.2.2")
+	_, err := ln.Accept()
+	require.NoError(t, err)
+	_, err = ln.Accept()
+	require.NoError(t, err, "connections over the limit are closed once accepted")
+	require.Len(t, rejected, 1)
+	assert.ErrorIs(t, rejected[0], ErrMaxConnections)
+}
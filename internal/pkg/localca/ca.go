@@ -0,0 +1,359 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package localca issues the TLS certificate of the server from a certificate authority generated
+// on the first start, or shared by the fleet-servers, for deployments without certificates of their own.
+package localca
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/rs/zerolog/log"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+const (
+	caCertFile     = "ca.crt"
+	caKeyFile      = "ca.key"
+	serverCertFile = "server.crt"
+	serverKeyFile  = "server.key"
+
+	kCAValidity     = 10 * 365 * 24 * time.Hour
+	kCheckInterval  = time.Hour
+	kClockSkew      = 5 * time.Minute // certificates are valid from a bit earlier, for clients with late clocks
+	kSerialNumberSz = 128
+)
+
+// CA is the local certificate authority issuing the certificate of the server.
+//
+// The certificate authority and the server certificate are stored in a directory, and reused
+// until they expire within the renewal period. A shared certificate authority is read from its
+// own files and only used to issue the server certificate, it is never generated nor renewed.
+type CA struct {
+	dir         string
+	caCertPath  string
+	caKeyPath   string
+	shared      bool
+	hosts       []string
+	validity    time.Duration
+	renewBefore time.Duration
+	now         func() time.Time
+
+	mut    sync.Mutex
+	caCert *x509.Certificate
+	caKey  crypto.Signer
+}
+
+// New returns the certificate authority of cfg, issuing a server certificate for the hosts.
+// The certificates are loaded or generated by Ensure.
+func New(cfg *config.TLSBootstrap, hosts []string) *CA {
+	c := &CA{
+		dir:         cfg.Path,
+		caCertPath:  filepath.Join(cfg.Path, caCertFile),
+		caKeyPath:   filepath.Join(cfg.Path, caKeyFile),
+		hosts:       hosts,
+		validity:    cfg.Validity,
+		renewBefore: cfg.RenewBefore,
+		now:         time.Now,
+	}
+	if cfg.CertificateAuthority != "" {
+		c.caCertPath, c.caKeyPath = cfg.CertificateAuthority, cfg.CertificateAuthorityKey
+		c.shared = true
+	}
+	return c
+}
+
+// Shared returns true if the certificate authority is shared by the fleet-servers rather than
+// generated by this one.
+func (c *CA) Shared() bool {
+	return c.shared
+}
+
+// ServerConfig returns the TLS configuration serving the server certificate.
+func (c *CA) ServerConfig() *tlscommon.ServerConfig {
+	enabled := true
+	return &tlscommon.ServerConfig{
+		Enabled: &enabled,
+		Certificate: tlscommon.CertificateConfig{
+			Certificate: filepath.Join(c.dir, serverCertFile),
+			Key:         filepath.Join(c.dir, serverKeyFile),
+		},
+	}
+}
+
+// CAFile returns the path of the certificate of the certificate authority.
+func (c *CA) CAFile() string {
+	return c.caCertPath
+}
+
+// Fingerprint returns the base64 SHA-256 of the public key of the certificate authority, as
+// pinned by the ca_sha256 TLS setting of the clients. It is empty until Ensure succeeds.
+func (c *CA) Fingerprint() string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.caCert == nil {
+		return ""
+	}
+	return tlscommon.Fingerprint(c.caCert)
+}
+
+// Ensure loads the certificate authority and the server certificate, and generates them when
+// they are missing, expire within the renewal period or, for the server certificate, do not cover
+// all the hosts. It returns true if the server certificate was issued.
+func (c *CA) Ensure() (bool, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return false, err
+	}
+
+	now := c.now()
+	if c.caCert == nil {
+		cert, key, err := loadPair(c.caCertPath, c.caKeyPath)
+		if err != nil && (c.shared || !errors.Is(err, fs.ErrNotExist)) {
+			return false, err
+		}
+		c.caCert, c.caKey = cert, key
+	}
+	switch {
+	case c.shared:
+		if !now.Before(c.caCert.NotAfter) {
+			return false, fmt.Errorf("shared certificate authority %s expired", c.caCertPath)
+		}
+		if now.Add(c.renewBefore).After(c.caCert.NotAfter) {
+			log.Warn().Str("ca", c.caCertPath).Time("expires", c.caCert.NotAfter).Msg("shared certificate authority expires soon, it has to be replaced")
+		}
+	case c.caCert == nil || now.Add(c.renewBefore).After(c.caCert.NotAfter):
+		if c.caCert != nil {
+			log.Warn().Msg("local certificate authority expires soon, generating a new one; clients pinning the previous one have to be updated")
+		}
+		if err := c.generateCA(now); err != nil {
+			return false, err
+		}
+		log.Info().
+			Str("ca", c.CAFile()).
+			Str("fingerprint", tlscommon.Fingerprint(c.caCert)).
+			Msg("local certificate authority generated")
+	}
+
+	cert, _, err := loadPair(filepath.Join(c.dir, serverCertFile), filepath.Join(c.dir, serverKeyFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn().Err(err).Msg("unable to load the local server certificate, issuing a new one")
+	}
+	if cert != nil && c.valid(cert, now) {
+		return false, nil
+	}
+	if err := c.issue(now); err != nil {
+		return false, err
+	}
+	log.Info().Strs("hosts", c.hosts).Msg("local server certificate issued")
+	return true, nil
+}
+
+// Run renews the server certificate before it expires until ctx is cancelled, onRenew is called
+// once a new certificate is written.
+func (c *CA) Run(ctx context.Context, onRenew func()) error {
+	t := time.NewTicker(kCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			renewed, err := c.Ensure()
+			if err != nil {
+				log.Error().Err(err).Msg("unable to renew the local server certificate")
+				continue
+			}
+			if renewed && onRenew != nil {
+				onRenew()
+			}
+		}
+	}
+}
+
+// valid returns true if cert is issued by the certificate authority, is not within its renewal
+// period and covers all the hosts.
+func (c *CA) valid(cert *x509.Certificate, now time.Time) bool {
+	if cert.CheckSignatureFrom(c.caCert) != nil || now.Add(c.renewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, host := range c.hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !containsIP(cert.IPAddresses, ip) {
+				return false
+			}
+		} else if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *CA) generateCA(now time.Time) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "fleet-server local CA"},
+		NotBefore:             now.Add(-kClockSkew),
+		NotAfter:              now.Add(kCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	if err := writePair(c.caCertPath, c.caKeyPath, der, key); err != nil {
+		return err
+	}
+	c.caCert, c.caKey = cert, key
+	return nil
+}
+
+func (c *CA) issue(now time.Time) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "fleet-server"},
+		NotBefore:    now.Add(-kClockSkew),
+		NotAfter:     now.Add(c.validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range c.hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	if tmpl.NotAfter.After(c.caCert.NotAfter) {
+		tmpl.NotAfter = c.caCert.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.caCert, &key.PublicKey, c.caKey)
+	if err != nil {
+		return err
+	}
+	return writePair(filepath.Join(c.dir, serverCertFile), filepath.Join(c.dir, serverKeyFile), der, key)
+}
+
+// loadPair loads a certificate and its private key.
+func loadPair(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("%s: no certificate", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", certPath, err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("%s: no private key", keyPath)
+	}
+	key, err := parsePrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", keyPath, err)
+	}
+	return cert, key, nil
+}
+
+// parsePrivateKey parses the EC private keys written by writePair, and the PKCS #8 keys of the
+// shared certificate authorities.
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// writePair writes a certificate and its private key, replacing the previous files once written
+// so that they are never read partially written.
+func writePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})); err != nil {
+		return err
+	}
+	return writeFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), kSerialNumberSz))
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
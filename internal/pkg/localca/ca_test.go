@@ -0,0 +1,164 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package localca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+func testCA(t *testing.T, dir string, hosts ...string) *CA {
+	t.Helper()
+	cfg := config.TLSBootstrap{Enabled: true}
+	cfg.InitDefaults()
+	cfg.Path = dir
+	return New(&cfg, hosts)
+}
+
+// verifyServerCert verifies the server certificate against the certificate authority for host.
+func verifyServerCert(t *testing.T, ca *CA, host string) (*x509.Certificate, error) {
+	t.Helper()
+	srvCfg := ca.ServerConfig()
+	pair, err := tls.LoadX509KeyPair(srvCfg.Certificate.Certificate, srvCfg.Certificate.Key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+
+	caPEM, err := os.ReadFile(ca.CAFile())
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, CurrentTime: ca.now()})
+	return cert, err
+}
+
+func TestEnsure(t *testing.T) {
+	dir := t.TempDir()
+	ca := testCA(t, dir, "localhost", "fleet.example.com", "10.0.0.1")
+
+	renewed, err := ca.Ensure()
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	fingerprint := ca.Fingerprint()
+	require.NotEmpty(t, fingerprint)
+
+	for _, host := range []string{"localhost", "fleet.example.com", "10.0.0.1"} {
+		_, err := verifyServerCert(t, ca, host)
+		assert.NoError(t, err, host)
+	}
+	_, err = verifyServerCert(t, ca, "other.example.com")
+	assert.Error(t, err)
+
+	t.Run("reused on restart", func(t *testing.T) {
+		ca := testCA(t, dir, "localhost", "fleet.example.com", "10.0.0.1")
+		renewed, err := ca.Ensure()
+		require.NoError(t, err)
+		assert.False(t, renewed)
+		assert.Equal(t, fingerprint, ca.Fingerprint())
+	})
+
+	t.Run("new host", func(t *testing.T) {
+		ca := testCA(t, dir, "localhost", "fleet2.example.com")
+		renewed, err := ca.Ensure()
+		require.NoError(t, err)
+		assert.True(t, renewed)
+		assert.Equal(t, fingerprint, ca.Fingerprint(), "the certificate authority is kept")
+		_, err = verifyServerCert(t, ca, "fleet2.example.com")
+		assert.NoError(t, err)
+	})
+
+	t.Run("renewal", func(t *testing.T) {
+		ca := testCA(t, dir, "localhost", "fleet2.example.com")
+		ca.now = func() time.Time { return time.Now().Add(61 * 24 * time.Hour) }
+		renewed, err := ca.Ensure()
+		require.NoError(t, err)
+		assert.True(t, renewed, "renewed within 30 days of expiry")
+		assert.Equal(t, fingerprint, ca.Fingerprint())
+		cert, err := verifyServerCert(t, ca, "localhost")
+		require.NoError(t, err)
+		assert.True(t, cert.NotAfter.After(time.Now().Add(150*24*time.Hour)))
+
+		renewed, err = ca.Ensure()
+		require.NoError(t, err)
+		assert.False(t, renewed)
+	})
+}
+
+func TestEnsureSharedCA(t *testing.T) {
+	// the shared certificate authority is generated by another instance
+	shared := testCA(t, t.TempDir(), "localhost")
+	_, err := shared.Ensure()
+	require.NoError(t, err)
+
+	newCA := func(dir string) *CA {
+		cfg := config.TLSBootstrap{Enabled: true}
+		cfg.InitDefaults()
+		cfg.Path = dir
+		cfg.CertificateAuthority = shared.CAFile()
+		cfg.CertificateAuthorityKey = filepath.Join(filepath.Dir(shared.CAFile()), caKeyFile)
+		return New(&cfg, []string{"localhost"})
+	}
+
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range dirs {
+		ca := newCA(dir)
+		assert.True(t, ca.Shared())
+		renewed, err := ca.Ensure()
+		require.NoError(t, err)
+		assert.True(t, renewed)
+		assert.Equal(t, shared.Fingerprint(), ca.Fingerprint(), "the servers share the certificate authority")
+		_, err = verifyServerCert(t, ca, "localhost")
+		assert.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dir, caCertFile))
+		assert.ErrorIs(t, err, fs.ErrNotExist, "no certificate authority is generated")
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		cfg := config.TLSBootstrap{Enabled: true}
+		cfg.InitDefaults()
+		cfg.Path = t.TempDir()
+		cfg.CertificateAuthority = filepath.Join(cfg.Path, "missing.crt")
+		cfg.CertificateAuthorityKey = filepath.Join(cfg.Path, "missing.key")
+		_, err := New(&cfg, []string{"localhost"}).Ensure()
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("not renewed", func(t *testing.T) {
+		ca := newCA(dirs[0])
+		ca.now = func() time.Time { return time.Now().Add(11 * 365 * 24 * time.Hour) }
+		_, err := ca.Ensure()
+		assert.Error(t, err, "an expired shared certificate authority is not replaced")
+	})
+}
+
+func TestHosts(t *testing.T) {
+	cfg := &config.Server{}
+	cfg.InitDefaults()
+	cfg.Listeners = []config.Listener{
+		{Name: "agents", Host: "fleet.example.com", Port: 8220},
+		{Name: "local", Socket: "/run/fleet-server.sock"},
+	}
+	cfg.TLSBootstrap.Hosts = []string{"10.0.0.1", "localhost"}
+
+	hosts := Hosts(cfg)
+	assert.Subset(t, hosts, []string{"localhost", "127.0.0.1", "::1", "fleet.example.com", "10.0.0.1"})
+	assert.NotContains(t, hosts, "0.0.0.0")
+	assert.NotContains(t, hosts, "")
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		assert.False(t, seen[h], "duplicate host %s", h)
+		seen[h] = true
+	}
+}
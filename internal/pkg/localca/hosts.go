@@ -0,0 +1,46 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package localca
+
+import (
+	"net"
+	"os"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// Hosts returns the host names and IPs of the server certificate: the loopback addresses, the
+// host name of the machine, the hosts the server and its listeners bind to, and the additional
+// hosts of the configuration. Unspecified addresses such as 0.0.0.0 are skipped.
+func Hosts(cfg *config.Server) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hostname)
+	}
+	hosts = append(hosts, cfg.Host)
+	for _, l := range cfg.Listeners {
+		if l.Socket == "" {
+			hosts = append(hosts, l.Host)
+		}
+	}
+	hosts = append(hosts, cfg.TLSBootstrap.Hosts...)
+
+	seen := make(map[string]struct{}, len(hosts))
+	result := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			continue
+		}
+		if _, ok := seen[host]; ok {
+			continue
+		}
+		seen[host] = struct{}{}
+		result = append(result, host)
+	}
+	return result
+}
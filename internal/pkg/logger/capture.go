@@ -0,0 +1,151 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// maxCaptureBytes is the size of the request and response bodies captured for log targets.
+const maxCaptureBytes = 64 * 1024
+
+// redacted replaces the values of the sensitive fields of captured bodies.
+const redacted = "[REDACTED]"
+
+// captureBuffer keeps the first maxCaptureBytes bytes written to it.
+type captureBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *captureBuffer) capture(p []byte) {
+	if room := maxCaptureBytes - b.Len(); room < len(p) {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.Write(p)
+}
+
+// log adds the redacted body to the event as the field key. Only JSON bodies are logged, as
+// other bodies can not be redacted.
+func (b *captureBuffer) log(e *zerolog.Event, key, encoding string) {
+	if b.Len() == 0 {
+		return
+	}
+	body := b.Bytes()
+	if strings.EqualFold(encoding, "gzip") {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			e.Str(key, "[not captured: invalid gzip encoding]")
+			return
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, maxCaptureBytes+1))
+		if err != nil && !b.truncated {
+			e.Str(key, "[not captured: invalid gzip encoding]")
+			return
+		}
+	}
+	switch {
+	case b.truncated || len(body) > maxCaptureBytes:
+		e.Str(key, "[not captured: body too large]")
+	case !json.Valid(body):
+		e.Str(key, "[not captured: not json]")
+	default:
+		e.Str(key, string(redactJSON(body)))
+	}
+}
+
+// redactJSON replaces the values of the sensitive fields of a valid JSON document.
+func redactJSON(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []byte(`"` + redacted + `"`)
+	}
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return []byte(`"` + redacted + `"`)
+	}
+	return data
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if sensitiveField(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redactValue(val)
+		}
+	}
+	return v
+}
+
+// sensitiveField returns true if the values of the field are secrets, such as API keys, tokens,
+// passwords or private keys.
+func sensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	if name == "key" || strings.HasSuffix(name, "_key") || strings.HasSuffix(name, ".key") {
+		return true
+	}
+	for _, s := range []string{"password", "passphrase", "secret", "token", "authorization"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// captureReader captures the request body read by the handler.
+type captureReader struct {
+	io.ReadCloser
+	buf captureBuffer
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.buf.capture(p[:n])
+	return n, err
+}
+
+// captureWriter captures the response body and status code.
+type captureWriter struct {
+	http.ResponseWriter
+	buf        captureBuffer
+	statusCode int
+}
+
+func (w *captureWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.buf.capture(p[:n])
+	return n, err
+}
+
+// Unwrap unwraps the underlying ResponseWriter
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
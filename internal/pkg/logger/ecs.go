@@ -16,12 +16,14 @@ const (
 	ECSErrorMessage  = "error.message"
 
 	// HTTP
-	ECSHTTPVersion           = "http.version"
-	ECSHTTPRequestID         = "http.request.id"
-	ECSHTTPRequestMethod     = "http.request.method"
-	ECSHTTPRequestBodyBytes  = "http.request.body.bytes"
-	ECSHTTPResponseCode      = "http.response.status_code"
-	ECSHTTPResponseBodyBytes = "http.response.body.bytes"
+	ECSHTTPVersion             = "http.version"
+	ECSHTTPRequestID           = "http.request.id"
+	ECSHTTPRequestMethod       = "http.request.method"
+	ECSHTTPRequestBodyBytes    = "http.request.body.bytes"
+	ECSHTTPRequestBodyContent  = "http.request.body.content"
+	ECSHTTPResponseCode        = "http.response.status_code"
+	ECSHTTPResponseBodyBytes   = "http.response.body.bytes"
+	ECSHTTPResponseBodyContent = "http.response.body.content"
 
 	// URL
 	ECSURLFull   = "url.full"
@@ -65,4 +67,5 @@ const (
 	EnrollAPIKeyID        = "fleet.enroll.apikey.id"
 	AccessAPIKeyID        = "fleet.access.apikey.id"
 	DefaultOutputAPIKeyID = "fleet.default.apikey.id"
+	LogTargetID           = "fleet.log_target.id"
 )
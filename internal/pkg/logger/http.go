@@ -103,6 +103,9 @@ func splitAddr(addr string) (host string, port int) {
 		if v, err := strconv.Atoi(portS); err == nil {
 			port = v
 		}
+	} else {
+		// the address of a client behind a trusted proxy has no port
+		host = addr
 	}
 
 	return //nolint:nakedret // short function
@@ -258,6 +261,49 @@ func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// TargetMiddleware replaces the request logger of the requests of the log targets with the logger
+// of the target, and logs the redacted request and response bodies of the targets that capture
+// them. agentID returns the agent id of a request, if any. It must follow Middleware.
+func TargetMiddleware(targets *Targets, agentID func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if targets == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var apiKeyID string
+			// the key is not authenticated yet, its id is only used to select the logger
+			if apiKey, err := apikey.ExtractAPIKey(r); err == nil {
+				apiKeyID = apiKey.ID
+			}
+			target, ok := targets.Match(agentID(r), apiKeyID)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addr, _ := r.Context().Value(http.LocalAddrContextKey).(string)
+			zlog := target.Logger().With().Str(ECSHTTPRequestID, w.Header().Get(HeaderRequestID)).Str(ECSServerAddress, addr).Logger()
+			r = r.WithContext(zlog.WithContext(r.Context()))
+			if !target.Capture {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			reqBody := &captureReader{ReadCloser: r.Body}
+			r.Body = reqBody
+			resp := &captureWriter{ResponseWriter: w}
+			next.ServeHTTP(resp, r)
+
+			e := zlog.WithLevel(target.level)
+			httpMeta(r, e)
+			e.Int(ECSHTTPResponseCode, resp.statusCode)
+			reqBody.buf.log(e, ECSHTTPRequestBodyContent, r.Header.Get("Content-Encoding"))
+			resp.buf.log(e, ECSHTTPResponseBodyContent, resp.Header().Get("Content-Encoding"))
+			e.Msg("HTTP request capture")
+		})
+	}
+}
+
 func TLSVersionToString(vers uint16) string {
 	switch vers {
 	case tls.VersionTLS10:
@@ -34,7 +34,7 @@ type WriterSync interface {
 // Logger for the Fleet Server.
 //
 // Logger will manage the zerolog/log.Logger variable.
-// An instance with TraceLevel is always created and log level is controlled through zerolog.GlobalLevel.
+// An instance with TraceLevel is always created and log level is controlled through the level gate of log.Logger.
 type Logger struct {
 	cfg  *config.Config
 	sync WriterSync
@@ -42,10 +42,10 @@ type Logger struct {
 }
 
 // Reload reloads the logger configuration.
-// If only the log level has changed then only GlobalLogLevel is set.
+// If only the log level has changed then only the level gate is set.
 func (l *Logger) Reload(_ context.Context, cfg *config.Config) error {
 	if levelChanged(cfg) {
-		zerolog.SetGlobalLevel(level(cfg))
+		levels.setConfigured(level(cfg))
 	}
 	if !l.cfg.Logging.EqualExcludeLevel(cfg.Logging) {
 		// sync before reload
@@ -56,7 +56,7 @@ func (l *Logger) Reload(_ context.Context, cfg *config.Config) error {
 		if err != nil {
 			return err
 		}
-		log.Logger = logger
+		setLogger(logger)
 		l.sync = w
 	}
 	l.cfg = cfg
@@ -74,7 +74,7 @@ func (l *Logger) Sync() {
 func Init(cfg *config.Config, svcName string) (*Logger, error) {
 	var err error
 	once.Do(func() {
-		zerolog.SetGlobalLevel(level(cfg))
+		levels.setConfigured(level(cfg))
 
 		var l zerolog.Logger
 		var w WriterSync
@@ -83,7 +83,7 @@ func Init(cfg *config.Config, svcName string) (*Logger, error) {
 			return
 		}
 
-		log.Logger = l
+		setLogger(l)
 		gLogger = &Logger{
 			cfg:  cfg,
 			sync: w,
@@ -93,11 +93,20 @@ func Init(cfg *config.Config, svcName string) (*Logger, error) {
 	return gLogger, err
 }
 
+// setLogger sets the global logger, the events under the configured level are sampled out by the
+// level gate.
+func setLogger(l zerolog.Logger) {
+	base.Store(&l)
+	log.Logger = l.Sample(levels)
+}
+
+// Level returns the configured log level.
+func Level() zerolog.Level {
+	return levels.configured()
+}
+
 func levelChanged(cfg *config.Config) bool {
-	if cfg.Fleet.Agent.Logging.LogLevel() != zerolog.GlobalLevel() {
-		return true
-	}
-	return level(cfg) != zerolog.GlobalLevel()
+	return level(cfg) != levels.configured()
 }
 
 func level(cfg *config.Config) zerolog.Level {
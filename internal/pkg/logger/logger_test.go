@@ -47,7 +47,7 @@ func Test_Logger_Reload(t *testing.T) {
 		require.NoError(t, err)
 		log.Info().Msg("Hello, World!")
 
-		assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+		assert.Equal(t, zerolog.InfoLevel, Level())
 		assert.NotEmpty(t, b, "expected something to be written")
 	})
 
@@ -63,7 +63,7 @@ func Test_Logger_Reload(t *testing.T) {
 		require.NoError(t, err)
 		log.Info().Msg("Hello, World!")
 
-		assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
+		assert.Equal(t, zerolog.DebugLevel, Level())
 		assert.NotEmpty(t, b, "expected something to be written")
 	})
 
@@ -79,7 +79,7 @@ func Test_Logger_Reload(t *testing.T) {
 		require.NoError(t, err)
 		log.Info().Msg("Hello, World!")
 
-		assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+		assert.Equal(t, zerolog.InfoLevel, Level())
 		assert.Empty(t, b, "write went to original logger")
 	})
 
@@ -96,7 +96,7 @@ func Test_Logger_Reload(t *testing.T) {
 		require.NoError(t, err)
 		log.Info().Msg("Hello, World!")
 
-		assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
+		assert.Equal(t, zerolog.DebugLevel, Level())
 		assert.Empty(t, b, "write went to original logger")
 	})
 }
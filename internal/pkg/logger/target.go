@@ -0,0 +1,218 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultTargetDuration = 15 * time.Minute
+	maxTargetDuration     = 24 * time.Hour
+)
+
+var (
+	ErrInvalidTarget  = errors.New("invalid log target")
+	ErrTargetNotFound = errors.New("log target not found")
+)
+
+// Target elevates the log level of the requests of a set of agents and API keys until it expires.
+// The redacted request and response bodies are logged as well if Capture is set.
+type Target struct {
+	ID        string    `json:"id"`
+	AgentIDs  []string  `json:"agent_ids,omitempty"`
+	APIKeyIDs []string  `json:"api_key_ids,omitempty"`
+	Level     string    `json:"level"`
+	Capture   bool      `json:"capture"`
+	Expires   time.Time `json:"expires"`
+
+	level zerolog.Level
+}
+
+// Targets are the active log targets. Targets are removed when they expire.
+//
+// Targets only change the level of the loggers of the requests they match, see Target.Logger; the
+// other loggers keep the configured level.
+type Targets struct {
+	mut     sync.RWMutex
+	targets map[string]*targetEntry
+}
+
+type targetEntry struct {
+	Target
+	agents  map[string]struct{}
+	apiKeys map[string]struct{}
+	timer   *time.Timer
+}
+
+// NewTargets returns an empty set of log targets.
+func NewTargets() *Targets {
+	return &Targets{targets: make(map[string]*targetEntry)}
+}
+
+// Add adds a target for the duration d, the default duration is used if d is 0. The target level
+// defaults to trace.
+func (t *Targets) Add(target Target, d time.Duration) (Target, error) {
+	if len(target.AgentIDs) == 0 && len(target.APIKeyIDs) == 0 {
+		return Target{}, fmt.Errorf("%w: agent_ids or api_key_ids are required", ErrInvalidTarget)
+	}
+	if d < 0 || d > maxTargetDuration {
+		return Target{}, fmt.Errorf("%w: duration must be at most %s", ErrInvalidTarget, maxTargetDuration)
+	}
+	if d == 0 {
+		d = defaultTargetDuration
+	}
+	if target.Level == "" {
+		target.Level = zerolog.TraceLevel.String()
+	}
+	level, err := zerolog.ParseLevel(target.Level)
+	if err != nil || level == zerolog.NoLevel || level == zerolog.Disabled {
+		return Target{}, fmt.Errorf("%w: unknown level %q", ErrInvalidTarget, target.Level)
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return Target{}, err
+	}
+	target.ID = id.String()
+	target.level = level
+	target.Expires = time.Now().UTC().Add(d)
+
+	e := &targetEntry{
+		Target:  target,
+		agents:  set(target.AgentIDs),
+		apiKeys: set(target.APIKeyIDs),
+	}
+	t.mut.Lock()
+	t.targets[target.ID] = e
+	e.timer = time.AfterFunc(d, func() {
+		t.Remove(target.ID) //nolint:errcheck // the target may have been removed already
+	})
+	t.mut.Unlock()
+
+	log.Info().
+		Str(LogTargetID, target.ID).
+		Strs("agent_ids", target.AgentIDs).
+		Strs("api_key_ids", target.APIKeyIDs).
+		Str("level", target.Level).
+		Bool("capture", target.Capture).
+		Time("expires", target.Expires).
+		Msg("Log target added")
+	return target, nil
+}
+
+// Remove removes a target before it expires.
+func (t *Targets) Remove(id string) error {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	e, ok := t.targets[id]
+	if !ok {
+		return ErrTargetNotFound
+	}
+	e.timer.Stop()
+	delete(t.targets, id)
+	log.Info().Str(LogTargetID, id).Msg("Log target removed")
+	return nil
+}
+
+// List returns the targets, ordered by expiration.
+func (t *Targets) List() []Target {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	targets := make([]Target, 0, len(t.targets))
+	for _, e := range t.targets {
+		targets = append(targets, e.Target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Expires.Before(targets[j].Expires)
+	})
+	return targets
+}
+
+// Match returns the target of the agent or API key with the lowest level; the ids may be empty.
+func (t *Targets) Match(agentID, apiKeyID string) (Target, bool) {
+	if t == nil {
+		return Target{}, false
+	}
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	var match *targetEntry
+	for _, e := range t.targets {
+		if !e.matches(agentID, apiKeyID) {
+			continue
+		}
+		if match == nil || e.level < match.level || (e.level == match.level && e.Capture) {
+			match = e
+		}
+	}
+	if match == nil {
+		return Target{}, false
+	}
+	return match.Target, true
+}
+
+func (e *targetEntry) matches(agentID, apiKeyID string) bool {
+	if _, ok := e.agents[agentID]; ok && agentID != "" {
+		return true
+	}
+	_, ok := e.apiKeys[apiKeyID]
+	return ok && apiKeyID != ""
+}
+
+// Logger returns the logger of the requests of the target. It is not subject to the
+// configured log level.
+func (target Target) Logger() zerolog.Logger {
+	l := log.Logger
+	if b := base.Load(); b != nil {
+		l = *b
+	}
+	return l.Level(target.level).With().Str(LogTargetID, target.ID).Logger()
+}
+
+func set(values []string) map[string]struct{} {
+	m := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		m[v] = struct{}{}
+	}
+	return m
+}
+
+// base is the logger without the level gate, the logger of the targets is derived from it.
+var base atomic.Pointer[zerolog.Logger]
+
+// levels is the level gate of the global logger.
+var levels = &levelGate{}
+
+// levelGate samples out the events under the configured level, before they are built. It applies
+// to the global logger and every logger derived from it; the loggers of the log targets are derived
+// from base instead, so that they can log under the configured level while the other loggers do not.
+//
+// The zerolog global level is left at trace, it would discard the events of the targets otherwise.
+type levelGate struct {
+	level atomic.Int32
+}
+
+func (g *levelGate) Sample(level zerolog.Level) bool {
+	return level >= zerolog.Level(g.level.Load())
+}
+
+// setConfigured sets the configured log level.
+func (g *levelGate) setConfigured(level zerolog.Level) {
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	g.level.Store(int32(level))
+}
+
+// configured returns the configured log level.
+func (g *levelGate) configured() zerolog.Level {
+	return zerolog.Level(g.level.Load())
+}
@@ -0,0 +1,173 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogger replaces the global logger with one writing to the returned buffer at the level.
+func testLogger(t *testing.T, level zerolog.Level) *bytes.Buffer {
+	t.Helper()
+	prevLogger, prevBase, prevLevel := log.Logger, base.Load(), levels.configured()
+	t.Cleanup(func() {
+		log.Logger = prevLogger
+		base.Store(prevBase)
+		levels.setConfigured(prevLevel)
+	})
+	var b bytes.Buffer
+	setLogger(zerolog.New(zerolog.SyncWriter(&b)))
+	levels.setConfigured(level)
+	return &b
+}
+
+func TestTargets(t *testing.T) {
+	b := testLogger(t, zerolog.InfoLevel)
+	targets := NewTargets()
+
+	_, err := targets.Add(Target{}, 0)
+	assert.ErrorIs(t, err, ErrInvalidTarget, "ids are required")
+	_, err = targets.Add(Target{AgentIDs: []string{"agent"}, Level: "verbose"}, 0)
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+	_, err = targets.Add(Target{AgentIDs: []string{"agent"}}, 48*time.Hour)
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	debug, err := targets.Add(Target{APIKeyIDs: []string{"key"}, Level: "debug"}, time.Hour)
+	require.NoError(t, err)
+	trace, err := targets.Add(Target{AgentIDs: []string{"agent"}, Capture: true}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "trace", trace.Level)
+	assert.WithinDuration(t, time.Now().Add(defaultTargetDuration), trace.Expires, time.Minute)
+	assert.Equal(t, []Target{trace, debug}, targets.List())
+	assert.Equal(t, zerolog.InfoLevel, Level(), "targets do not change the configured level")
+
+	match, ok := targets.Match("agent", "key")
+	require.True(t, ok)
+	assert.Equal(t, trace.ID, match.ID, "the lowest level target matches")
+	match, ok = targets.Match("other", "key")
+	require.True(t, ok)
+	assert.Equal(t, debug.ID, match.ID)
+	_, ok = targets.Match("other", "")
+	assert.False(t, ok)
+
+	t.Run("other loggers keep the configured level", func(t *testing.T) {
+		b.Reset()
+		log.Debug().Msg("fleet debug")
+		log.Info().Msg("fleet info")
+		l := match.Logger()
+		l.Debug().Msg("target debug")
+		l.Trace().Msg("target trace")
+		assert.NotContains(t, b.String(), "fleet debug")
+		assert.Contains(t, b.String(), "fleet info")
+		assert.Contains(t, b.String(), "target debug")
+		assert.NotContains(t, b.String(), "target trace")
+	})
+
+	require.NoError(t, targets.Remove(trace.ID))
+	assert.ErrorIs(t, targets.Remove(trace.ID), ErrTargetNotFound)
+
+	t.Run("expires", func(t *testing.T) {
+		_, err := targets.Add(Target{AgentIDs: []string{"agent"}}, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, targets.Remove(debug.ID))
+		assert.Eventually(t, func() bool {
+			return len(targets.List()) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestTargetMiddleware(t *testing.T) {
+	b := testLogger(t, zerolog.InfoLevel)
+	targets := NewTargets()
+	target, err := targets.Add(Target{AgentIDs: []string{"agent"}, Capture: true}, time.Minute)
+	require.NoError(t, err)
+	defer targets.Remove(target.ID) //nolint:errcheck // test cleanup
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		zerolog.Ctx(r.Context()).Trace().Msg("handler trace")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"action":"policy","outputs":{"default":{"api_key":"secret:key","hosts":["es:9200"]}}}`))
+	})
+	agentID := func(r *http.Request) string {
+		return strings.TrimPrefix(r.URL.Path, "/")
+	}
+	handler := Middleware(TargetMiddleware(targets, agentID)(h))
+
+	t.Run("other agent", func(t *testing.T) {
+		b.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/other", strings.NewReader(`{"status":"online"}`))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.NotContains(t, b.String(), "handler trace")
+		assert.NotContains(t, b.String(), "HTTP request capture")
+	})
+
+	t.Run("target", func(t *testing.T) {
+		b.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/agent", strings.NewReader(`{"status":"online","enrollment_token":"abc"}`))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Contains(t, b.String(), "handler trace")
+
+		var capture map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+			var m map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &m))
+			if m["message"] == "HTTP request capture" {
+				capture = m
+			}
+		}
+		require.NotNil(t, capture)
+		assert.Equal(t, target.ID, capture[LogTargetID])
+		assert.JSONEq(t, `{"status":"online","enrollment_token":"[REDACTED]"}`, capture[ECSHTTPRequestBodyContent].(string))
+		assert.JSONEq(t, `{"action":"policy","outputs":{"default":{"api_key":"[REDACTED]","hosts":["es:9200"]}}}`, capture[ECSHTTPResponseBodyContent].(string))
+	})
+}
+
+func TestCaptureBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		expect string
+	}{{
+		name:   "json",
+		body:   []byte(`[{"password":"p","ssl":{"key":"k","certificate":"c"},"access_api_key_id":"id"}]`),
+		expect: `[{"access_api_key_id":"id","password":"[REDACTED]","ssl":{"certificate":"c","key":"[REDACTED]"}}]`,
+	}, {
+		name:   "not json",
+		body:   []byte("token=abc"),
+		expect: "[not captured: not json]",
+	}, {
+		name:   "too large",
+		body:   bytes.Repeat([]byte(" "), maxCaptureBytes+1),
+		expect: "[not captured: body too large]",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf captureBuffer
+			buf.capture(tc.body)
+			var out bytes.Buffer
+			l := zerolog.New(&out)
+			e := l.Log()
+			buf.log(e, "body", "")
+			e.Send()
+			var m map[string]string
+			require.NoError(t, json.Unmarshal(out.Bytes(), &m))
+			assert.Equal(t, tc.expect, m["body"])
+		})
+	}
+}
@@ -133,6 +133,9 @@ type Agent struct {
 	Active bool           `json:"active"`
 	Agent  *AgentMetadata `json:"agent,omitempty"`
 
+	// Identity of the client certificate the Elastic Agent enrolled with, required on its requests when agent certificate authentication is enabled
+	ClientCertificateIdentity string `json:"client_certificate_identity,omitempty"`
+
 	// Elastic Agent components detailed status information
 	Components json.RawMessage `json:"components,omitempty"`
 
@@ -178,6 +181,9 @@ type Agent struct {
 	// Deprecated. Use Outputs instead. The policy output permissions hash
 	PolicyOutputPermissionsHash string `json:"policy_output_permissions_hash,omitempty"`
 
+	// When set, the revision index of the policy that is delivered to the Elastic Agent instead of the latest revision
+	PolicyPinnedRevisionIdx int64 `json:"policy_pinned_revision_idx,omitempty"`
+
 	// The current policy revision_idx for the Elastic Agent
 	PolicyRevisionIdx int64 `json:"policy_revision_idx,omitempty"`
 
@@ -337,6 +343,9 @@ type Policy struct {
 
 	// Timeout (seconds) that an Elastic Agent should be un-enrolled.
 	UnenrollTimeout int64 `json:"unenroll_timeout,omitempty"`
+
+	// Set by Fleet Server when the policy revision failed validation and is not delivered to Elastic Agents
+	ValidationError string `json:"validation_error,omitempty"`
 }
 
 // PolicyLeader The current leader Fleet Server for a policy
@@ -368,6 +377,70 @@ type PolicyOutput struct {
 	Type string `json:"type"`
 }
 
+// PolicyPin The revision a policy is pinned to, kept across the revisions of the policy
+type PolicyPin struct {
+	ESDocument
+
+	// When set, the revision index of the policy that is delivered to agents instead of the latest revision
+	PinnedRevisionIdx int64 `json:"pinned_revision_idx,omitempty"`
+
+	// The ID of the policy
+	PolicyID string `json:"policy_id"`
+
+	// Date/time the pin was set
+	Timestamp string `json:"@timestamp,omitempty"`
+}
+
+// PolicyRollout The state of the canary rollout of a policy revision, shared by the Fleet Servers
+type PolicyRollout struct {
+	ESDocument
+
+	// The coordinator index of the policy revision rolled out
+	CoordinatorIdx int64 `json:"coordinator_idx"`
+
+	// The coordinator index of the last released revision delivered to the agents held by the rollout
+	GoodCoordinatorIdx int64 `json:"good_coordinator_idx,omitempty"`
+
+	// The revision index of the last released revision delivered to the agents held by the rollout
+	GoodRevisionIdx int64 `json:"good_revision_idx,omitempty"`
+
+	// The ID of the policy
+	PolicyID string `json:"policy_id"`
+
+	// The revision index of the policy revision rolled out
+	RevisionIdx int64 `json:"revision_idx"`
+
+	// The number of state changes of the rollout, a state is only applied over an earlier one
+	Seq int64 `json:"seq,omitempty"`
+
+	// Date/time the revision is released unless the rollout is halted
+	SoakUntil string `json:"soak_until,omitempty"`
+
+	// The state of the rollout
+	State string `json:"state"`
+
+	// Date/time the state was set
+	Timestamp string `json:"@timestamp,omitempty"`
+}
+
+// ScheduleLease The Fleet Server that holds the lease to run a scheduled job
+type ScheduleLease struct {
+	ESDocument
+
+	// Date/time the lease expires unless it is renewed
+	ExpiresAt string `json:"expires_at,omitempty"`
+
+	// The name of the scheduled job
+	Schedule string          `json:"schedule"`
+	Server   *ServerMetadata `json:"server"`
+
+	// Date/time the lease was acquired or renewed
+	Timestamp string `json:"@timestamp,omitempty"`
+
+	// Fencing token, incremented each time the lease is acquired by a Fleet Server
+	Token int64 `json:"token"`
+}
+
 // Server A Fleet Server
 type Server struct {
 	ESDocument
@@ -0,0 +1,302 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.elastic.co/apm/v2/model"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// scopeName is the instrumentation scope of the spans and metrics, the APM agent records them.
+const scopeName = "go.elastic.co/apm"
+
+// metadata is the first object of an APM intake stream.
+type metadata struct {
+	Service model.Service  `json:"service"`
+	System  model.System   `json:"system"`
+	Process model.Process  `json:"process"`
+	Labels  model.IfaceMap `json:"labels,omitempty"`
+}
+
+// resource returns the OpenTelemetry resource of the service of the stream.
+func (m *metadata) resource() *resourcepb.Resource {
+	var attrs []*commonpb.KeyValue
+	attrs = appendString(attrs, "service.name", m.Service.Name)
+	attrs = appendString(attrs, "service.version", m.Service.Version)
+	attrs = appendString(attrs, "deployment.environment", m.Service.Environment)
+	if m.Service.Node != nil {
+		attrs = appendString(attrs, "service.instance.id", m.Service.Node.ConfiguredName)
+	}
+	attrs = appendString(attrs, "host.name", m.System.Hostname)
+	if m.Process.Pid != 0 {
+		attrs = append(attrs, keyValue("process.pid", m.Process.Pid))
+	}
+	attrs = appendString(attrs, "telemetry.sdk.language", "go")
+	if m.Service.Agent != nil {
+		attrs = appendString(attrs, "telemetry.sdk.name", m.Service.Agent.Name)
+		attrs = appendString(attrs, "telemetry.sdk.version", m.Service.Agent.Version)
+	}
+	for _, l := range m.Labels {
+		attrs = append(attrs, keyValue(l.Key, l.Value))
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+// scope returns the instrumentation scope of the stream.
+func (m *metadata) scope() *commonpb.InstrumentationScope {
+	scope := &commonpb.InstrumentationScope{Name: scopeName}
+	if m.Service.Agent != nil {
+		scope.Version = m.Service.Agent.Version
+	}
+	return scope
+}
+
+// transactionSpan returns the OpenTelemetry span of the transaction, nil if it is not sampled.
+func transactionSpan(tx *model.Transaction) *tracepb.Span {
+	if tx.Sampled != nil && !*tx.Sampled {
+		return nil
+	}
+	span := &tracepb.Span{
+		TraceId:      tx.TraceID[:],
+		SpanId:       tx.ID[:],
+		ParentSpanId: parentID(tx.ParentID),
+		Name:         tx.Name,
+		Kind:         tracepb.Span_SPAN_KIND_INTERNAL,
+		Links:        links(tx.Links),
+		Status:       status(tx.Outcome),
+	}
+	span.StartTimeUnixNano, span.EndTimeUnixNano = timestamps(tx.Timestamp, tx.Duration)
+	if tx.Type == "request" {
+		span.Kind = tracepb.Span_SPAN_KIND_SERVER
+	}
+	if tx.OTel != nil {
+		span.Kind = spanKind(tx.OTel.SpanKind, span.Kind)
+	}
+
+	attrs := appendString(nil, "transaction.type", tx.Type)
+	attrs = appendString(attrs, "transaction.result", tx.Result)
+	if c := tx.Context; c != nil {
+		if c.Request != nil {
+			attrs = appendString(attrs, "http.method", c.Request.Method)
+			attrs = appendString(attrs, "http.scheme", c.Request.URL.Protocol)
+			attrs = appendString(attrs, "http.target", c.Request.URL.Path)
+			attrs = appendString(attrs, "http.flavor", c.Request.HTTPVersion)
+		}
+		if c.Response != nil && c.Response.StatusCode != 0 {
+			attrs = append(attrs, keyValue("http.status_code", c.Response.StatusCode))
+		}
+		attrs = appendLabels(attrs, c.Tags)
+	}
+	span.Attributes = attrs
+	return span
+}
+
+// spanSpan returns the OpenTelemetry span of the APM span.
+func spanSpan(s *model.Span) *tracepb.Span {
+	span := &tracepb.Span{
+		TraceId:      s.TraceID[:],
+		SpanId:       s.ID[:],
+		ParentSpanId: parentID(s.ParentID),
+		Name:         s.Name,
+		Kind:         tracepb.Span_SPAN_KIND_INTERNAL,
+		Links:        links(s.Links),
+		Status:       status(s.Outcome),
+	}
+	span.StartTimeUnixNano, span.EndTimeUnixNano = timestamps(s.Timestamp, s.Duration)
+
+	attrs := appendString(nil, "span.type", s.Type)
+	attrs = appendString(attrs, "span.subtype", s.Subtype)
+	attrs = appendString(attrs, "span.action", s.Action)
+	if c := s.Context; c != nil {
+		if c.HTTP != nil || c.Database != nil || c.Destination != nil {
+			span.Kind = tracepb.Span_SPAN_KIND_CLIENT
+		}
+		if c.HTTP != nil {
+			if c.HTTP.URL != nil {
+				attrs = appendString(attrs, "http.url", c.HTTP.URL.String())
+			}
+			if c.HTTP.StatusCode != 0 {
+				attrs = append(attrs, keyValue("http.status_code", c.HTTP.StatusCode))
+			}
+		}
+		if c.Database != nil {
+			attrs = appendString(attrs, "db.system", s.Subtype)
+			attrs = appendString(attrs, "db.statement", c.Database.Statement)
+		}
+		if c.Destination != nil {
+			attrs = appendString(attrs, "net.peer.name", c.Destination.Address)
+			if c.Destination.Port != 0 {
+				attrs = append(attrs, keyValue("net.peer.port", c.Destination.Port))
+			}
+		}
+		attrs = appendLabels(attrs, c.Tags)
+	}
+	if s.OTel != nil {
+		span.Kind = spanKind(s.OTel.SpanKind, span.Kind)
+	}
+	span.Attributes = attrs
+	return span
+}
+
+// addMetrics adds the samples of the metricset to the metrics by name, as gauges or histograms.
+func addMetrics(metrics map[string]*metricspb.Metric, ms *model.Metrics) {
+	var attrs []*commonpb.KeyValue
+	attrs = appendString(attrs, "transaction.name", ms.Transaction.Name)
+	attrs = appendString(attrs, "transaction.type", ms.Transaction.Type)
+	attrs = appendString(attrs, "span.type", ms.Span.Type)
+	attrs = appendString(attrs, "span.subtype", ms.Span.Subtype)
+	for _, l := range ms.Labels {
+		attrs = appendString(attrs, l.Key, l.Value)
+	}
+	ts := uint64(time.Time(ms.Timestamp).UnixNano())
+
+	for name, sample := range ms.Samples {
+		if sample.Type == "histogram" || len(sample.Values) > 0 {
+			addHistogram(metrics, name, attrs, ts, sample)
+			continue
+		}
+		m, ok := metrics[name]
+		if !ok {
+			m = &metricspb.Metric{Name: name, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}}
+			metrics[name] = m
+		}
+		gauge, ok := m.Data.(*metricspb.Metric_Gauge)
+		if !ok {
+			// the name is taken by a histogram
+			continue
+		}
+		gauge.Gauge.DataPoints = append(gauge.Gauge.DataPoints, &metricspb.NumberDataPoint{
+			Attributes:   attrs,
+			TimeUnixNano: ts,
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: sample.Value},
+		})
+	}
+}
+
+// addHistogram adds the histogram sample to the metrics by name. The APM histograms hold the
+// representative value of every bucket and its count over the reporting interval; the bounds of the
+// OTLP buckets are the middle points between the values, and the sum is estimated from the values.
+func addHistogram(metrics map[string]*metricspb.Metric, name string, attrs []*commonpb.KeyValue, ts uint64, sample model.Metric) {
+	if len(sample.Values) == 0 || len(sample.Values) != len(sample.Counts) {
+		return
+	}
+	m, ok := metrics[name]
+	if !ok {
+		m = &metricspb.Metric{Name: name, Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		}}}
+		metrics[name] = m
+	}
+	histogram, ok := m.Data.(*metricspb.Metric_Histogram)
+	if !ok {
+		// the name is taken by a gauge
+		return
+	}
+
+	point := &metricspb.HistogramDataPoint{
+		Attributes:     attrs,
+		TimeUnixNano:   ts,
+		BucketCounts:   sample.Counts,
+		ExplicitBounds: make([]float64, 0, len(sample.Values)-1),
+	}
+	var sum float64
+	for i, v := range sample.Values {
+		point.Count += sample.Counts[i]
+		sum += v * float64(sample.Counts[i])
+		if i > 0 {
+			point.ExplicitBounds = append(point.ExplicitBounds, (sample.Values[i-1]+v)/2)
+		}
+	}
+	point.Sum = &sum
+	histogram.Histogram.DataPoints = append(histogram.Histogram.DataPoints, point)
+}
+
+// sortedMetrics returns the metrics sorted by name.
+func sortedMetrics(metrics map[string]*metricspb.Metric) []*metricspb.Metric {
+	list := make([]*metricspb.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func timestamps(start model.Time, durationMs float64) (uint64, uint64) {
+	t := time.Time(start)
+	end := t.Add(time.Duration(durationMs * float64(time.Millisecond)))
+	return uint64(t.UnixNano()), uint64(end.UnixNano())
+}
+
+func parentID(id model.SpanID) []byte {
+	if id == (model.SpanID{}) {
+		return nil
+	}
+	return id[:]
+}
+
+func links(l []model.SpanLink) []*tracepb.Span_Link {
+	if len(l) == 0 {
+		return nil
+	}
+	out := make([]*tracepb.Span_Link, 0, len(l))
+	for i := range l {
+		out = append(out, &tracepb.Span_Link{TraceId: l[i].TraceID[:], SpanId: l[i].SpanID[:]})
+	}
+	return out
+}
+
+func status(outcome string) *tracepb.Status {
+	if outcome == "failure" {
+		return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}
+	}
+	return nil
+}
+
+func spanKind(kind string, def tracepb.Span_SpanKind) tracepb.Span_SpanKind {
+	if k, ok := tracepb.Span_SpanKind_value["SPAN_KIND_"+kind]; ok {
+		return tracepb.Span_SpanKind(k)
+	}
+	return def
+}
+
+func appendLabels(attrs []*commonpb.KeyValue, labels model.IfaceMap) []*commonpb.KeyValue {
+	for _, l := range labels {
+		attrs = append(attrs, keyValue("labels."+l.Key, l.Value))
+	}
+	return attrs
+}
+
+func appendString(attrs []*commonpb.KeyValue, key, value string) []*commonpb.KeyValue {
+	if value == "" {
+		return attrs
+	}
+	return append(attrs, keyValue(key, value))
+}
+
+func keyValue(key string, value interface{}) *commonpb.KeyValue {
+	var v commonpb.AnyValue
+	switch value := value.(type) {
+	case string:
+		v.Value = &commonpb.AnyValue_StringValue{StringValue: value}
+	case bool:
+		v.Value = &commonpb.AnyValue_BoolValue{BoolValue: value}
+	case int:
+		v.Value = &commonpb.AnyValue_IntValue{IntValue: int64(value)}
+	case int64:
+		v.Value = &commonpb.AnyValue_IntValue{IntValue: value}
+	case float64:
+		v.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: value}
+	default:
+		v.Value = &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(value)}
+	}
+	return &commonpb.KeyValue{Key: key, Value: &v}
+}
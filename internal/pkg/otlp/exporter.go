@@ -0,0 +1,146 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// exporter sends the traces and metrics to an OpenTelemetry collector.
+type exporter interface {
+	exportTraces(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error
+	exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error
+	close() error
+}
+
+// grpcExporter exports to the gRPC collector service.
+type grpcExporter struct {
+	conn    *grpc.ClientConn
+	traces  coltracepb.TraceServiceClient
+	metrics colmetricspb.MetricsServiceClient
+	md      grpcmetadata.MD
+}
+
+// newGRPCExporter returns an exporter to the host:port endpoint; an http:// scheme disables tls.
+func newGRPCExporter(endpoint string, headers map[string]string, tlsConfig *tls.Config) (*grpcExporter, error) {
+	switch {
+	case strings.HasPrefix(endpoint, "http://"):
+		endpoint, tlsConfig = strings.TrimPrefix(endpoint, "http://"), nil
+	case strings.HasPrefix(endpoint, "https://"):
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+	}
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(strings.TrimSuffix(endpoint, "/"), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("otlp grpc dial %s: %w", endpoint, err)
+	}
+	return &grpcExporter{
+		conn:    conn,
+		traces:  coltracepb.NewTraceServiceClient(conn),
+		metrics: colmetricspb.NewMetricsServiceClient(conn),
+		md:      grpcmetadata.New(headers),
+	}, nil
+}
+
+func (e *grpcExporter) exportTraces(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error {
+	_, err := e.traces.Export(grpcmetadata.NewOutgoingContext(ctx, e.md), req)
+	return err
+}
+
+func (e *grpcExporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	_, err := e.metrics.Export(grpcmetadata.NewOutgoingContext(ctx, e.md), req)
+	return err
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
+
+// httpExporter posts the protobuf requests to the /v1/traces and /v1/metrics paths of the collector.
+type httpExporter struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+// newHTTPExporter returns an exporter to the endpoint URL.
+func newHTTPExporter(endpoint string, headers map[string]string, tlsConfig *tls.Config) *httpExporter {
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https://"
+		if tlsConfig == nil {
+			scheme = "http://"
+		}
+		endpoint = scheme + endpoint
+	}
+	return &httpExporter{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		url:     strings.TrimSuffix(endpoint, "/"),
+		headers: headers,
+	}
+}
+
+func (e *httpExporter) exportTraces(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error {
+	return e.post(ctx, "/v1/traces", req)
+}
+
+func (e *httpExporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	return e.post(ctx, "/v1/metrics", req)
+}
+
+func (e *httpExporter) post(ctx context.Context, path string, msg proto.Message) error {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp export to %s failed with status %d: %s", e.url+path, resp.StatusCode, msg)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
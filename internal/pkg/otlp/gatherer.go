@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"context"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"go.elastic.co/apm/v2"
+)
+
+// metricPrefix prefixes the names of the metrics of the monitoring registries.
+const metricPrefix = "fleet_server."
+
+// RegistryGatherer gathers the numeric metrics of monitoring registries, such as the route and bulk
+// metrics, so that the tracer sends them with its own metrics.
+type RegistryGatherer struct {
+	names []string
+}
+
+// NewRegistryGatherer returns a gatherer of the registries of the default namespace with the names.
+func NewRegistryGatherer(names ...string) *RegistryGatherer {
+	return &RegistryGatherer{names: names}
+}
+
+// GatherMetrics adds the metrics of the registries, named after their path in the registry.
+func (g *RegistryGatherer) GatherMetrics(ctx context.Context, m *apm.Metrics) error {
+	for _, name := range g.names {
+		registry := monitoring.Default.GetRegistry(name)
+		if registry == nil {
+			continue
+		}
+		snapshot := monitoring.CollectFlatSnapshot(registry, monitoring.Full, false)
+		for k, v := range snapshot.Ints {
+			m.Add(metricPrefix+name+"."+k, nil, float64(v))
+		}
+		for k, v := range snapshot.Floats {
+			m.Add(metricPrefix+name+"."+k, nil, v)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
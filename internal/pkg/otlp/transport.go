@@ -0,0 +1,174 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package otlp exports the traces and metrics of the APM tracer to an OpenTelemetry collector.
+//
+// The instrumentation of fleet-server is the Elastic APM agent; Transport replaces the transport
+// of the tracer to the APM server and converts the transactions, spans and metricsets sent by the
+// tracer to OTLP spans and metrics, so that the same spans, span links and trace context
+// propagation are used with both backends.
+package otlp
+
+import (
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.elastic.co/apm/v2/model"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// Transport is an APM tracer transport exporting to an OpenTelemetry collector.
+type Transport struct {
+	exporter exporter
+	cfg      config.InstrumentationOTLP
+}
+
+// NewTransport returns the transport to the collector of cfg.
+func NewTransport(cfg *config.Instrumentation) (*Transport, error) {
+	tlsConfig, err := cfg.OTLPTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	t := &Transport{cfg: cfg.OTLP}
+	switch cfg.OTLP.GetProtocol() {
+	case config.OTLPProtocolHTTP:
+		t.exporter = newHTTPExporter(cfg.OTLP.GetEndpoint(), cfg.OTLP.Headers, tlsConfig)
+	default:
+		t.exporter, err = newGRPCExporter(cfg.OTLP.GetEndpoint(), cfg.OTLP.Headers, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// SendStream converts the APM intake stream and exports it once the tracer closes the stream.
+func (t *Transport) SendStream(ctx context.Context, stream io.Reader) error {
+	// the tracer blocks until the stream is read entirely; the reader is reused for the next
+	// stream once it returned io.EOF, so it is read until then only
+	r := &eofReader{r: stream}
+	defer func() {
+		if !r.eof {
+			io.Copy(io.Discard, r) //nolint:errcheck // draining the stream
+		}
+	}()
+
+	traces, metrics, err := convertStream(r)
+	if err != nil {
+		return fmt.Errorf("otlp stream conversion: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.GetTimeout())
+	defer cancel()
+	if traces != nil {
+		if err := t.exporter.exportTraces(ctx, traces); err != nil {
+			return fmt.Errorf("otlp traces export: %w", err)
+		}
+	}
+	if metrics != nil {
+		if err := t.exporter.exportMetrics(ctx, metrics); err != nil {
+			return fmt.Errorf("otlp metrics export: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to the collector.
+func (t *Transport) Close() error {
+	return t.exporter.close()
+}
+
+// eofReader records that the reader returned io.EOF.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	n, err := r.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		r.eof = true
+	}
+	return n, err
+}
+
+// convertStream returns the export requests of the zlib compressed APM intake stream, nil if the
+// stream has no span or metric. Errors are not converted, the spans they belong to have the
+// failure outcome.
+func convertStream(stream io.Reader) (*coltracepb.ExportTraceServiceRequest, *colmetricspb.ExportMetricsServiceRequest, error) {
+	r, err := zlib.NewReader(stream)
+	if errors.Is(err, io.EOF) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	dec := json.NewDecoder(r)
+
+	var meta struct {
+		Metadata metadata `json:"metadata"`
+	}
+	if err := dec.Decode(&meta); errors.Is(err, io.EOF) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var spans []*tracepb.Span
+	metrics := make(map[string]*metricspb.Metric)
+	for {
+		var event struct {
+			Transaction *model.Transaction `json:"transaction"`
+			Span        *model.Span        `json:"span"`
+			Metrics     *model.Metrics     `json:"metricset"`
+		}
+		if err := dec.Decode(&event); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case event.Transaction != nil:
+			if span := transactionSpan(event.Transaction); span != nil {
+				spans = append(spans, span)
+			}
+		case event.Span != nil:
+			spans = append(spans, spanSpan(event.Span))
+		case event.Metrics != nil:
+			addMetrics(metrics, event.Metrics)
+		}
+	}
+
+	var traces *coltracepb.ExportTraceServiceRequest
+	if len(spans) > 0 {
+		traces = &coltracepb.ExportTraceServiceRequest{
+			ResourceSpans: []*tracepb.ResourceSpans{{
+				Resource:   meta.Metadata.resource(),
+				ScopeSpans: []*tracepb.ScopeSpans{{Scope: meta.Metadata.scope(), Spans: spans}},
+			}},
+		}
+	}
+	var metricsReq *colmetricspb.ExportMetricsServiceRequest
+	if len(metrics) > 0 {
+		metricsReq = &colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricspb.ResourceMetrics{{
+				Resource:     meta.Metadata.resource(),
+				ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: meta.Metadata.scope(), Metrics: sortedMetrics(metrics)}},
+			}},
+		}
+	}
+	return traces, metricsReq, nil
+}
@@ -0,0 +1,228 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.elastic.co/apm/v2"
+	"go.elastic.co/apm/v2/model"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+)
+
+// collector records the export requests it receives.
+type collector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	colmetricspb.UnimplementedMetricsServiceServer
+
+	mut     sync.Mutex
+	traces  []*coltracepb.ExportTraceServiceRequest
+	metrics []*colmetricspb.ExportMetricsServiceRequest
+	headers []string
+}
+
+func (c *collector) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.traces = append(c.traces, req)
+	md, _ := grpcmetadata.FromIncomingContext(ctx)
+	c.headers = append(c.headers, md.Get("authorization")...)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.headers = append(c.headers, r.Header.Get("Authorization"))
+	switch r.URL.Path {
+	case "/v1/traces":
+		var req coltracepb.ExportTraceServiceRequest
+		err = proto.Unmarshal(body, &req)
+		c.traces = append(c.traces, &req)
+	case "/v1/metrics":
+		var req colmetricspb.ExportMetricsServiceRequest
+		err = proto.Unmarshal(body, &req)
+		c.metrics = append(c.metrics, &req)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (c *collector) spans() map[string]*tracepb.Span {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	spans := make(map[string]*tracepb.Span)
+	for _, req := range c.traces {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func testTracer(t *testing.T, cfg *config.Instrumentation) *apm.Tracer {
+	t.Helper()
+	transport, err := NewTransport(cfg)
+	require.NoError(t, err)
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
+		ServiceName:    "fleet-server",
+		ServiceVersion: "8.8.0",
+		Transport:      transport,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		tracer.Close()
+		transport.Close()
+	})
+	return tracer
+}
+
+func TestTransportHTTP(t *testing.T) {
+	var c collector
+	srv := httptest.NewServer(&c)
+	defer srv.Close()
+
+	tracer := testTracer(t, &config.Instrumentation{OTLP: config.InstrumentationOTLP{
+		Enabled:  true,
+		Protocol: config.OTLPProtocolHTTP,
+		Endpoint: srv.URL,
+		Headers:  map[string]string{"Authorization": "ApiKey key"},
+	}})
+	registry := monitoring.Default.NewRegistry("otlp_test")
+	defer monitoring.Default.Remove("otlp_test")
+	monitoring.NewUint(registry, "total").Add(3)
+	tracer.RegisterMetricsGatherer(NewRegistryGatherer("otlp_test"))
+
+	request := tracer.StartTransaction("POST /api/fleet/agents/:id/checkin", "request")
+	ctx := apm.ContextWithTransaction(context.Background(), request)
+	span, _ := apm.StartSpan(ctx, "authAPIKey", "auth")
+	span.End()
+	request.End()
+	flush := tracer.StartTransactionOptions("Flush queue bulk", "bulker", apm.TransactionOptions{
+		Links: []apm.SpanLink{{Trace: request.TraceContext().Trace, Span: request.TraceContext().Span}},
+	})
+	flush.Outcome = "failure"
+	flush.End()
+	tracer.SendMetrics(nil)
+	tracer.Flush(nil)
+
+	spans := c.spans()
+	require.Len(t, spans, 3)
+	checkin := spans["POST /api/fleet/agents/:id/checkin"]
+	require.NotNil(t, checkin)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, checkin.Kind)
+	assert.Empty(t, checkin.ParentSpanId)
+
+	auth := spans["authAPIKey"]
+	require.NotNil(t, auth)
+	assert.Equal(t, checkin.TraceId, auth.TraceId)
+	assert.Equal(t, checkin.SpanId, auth.ParentSpanId)
+	assert.GreaterOrEqual(t, auth.EndTimeUnixNano, auth.StartTimeUnixNano)
+
+	bulk := spans["Flush queue bulk"]
+	require.NotNil(t, bulk)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_INTERNAL, bulk.Kind)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, bulk.Status.GetCode())
+	require.Len(t, bulk.Links, 1)
+	assert.Equal(t, checkin.TraceId, bulk.Links[0].TraceId)
+	assert.Equal(t, checkin.SpanId, bulk.Links[0].SpanId)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	var found bool
+	for _, req := range c.metrics {
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "fleet_server.otlp_test.total" {
+						found = true
+						assert.Equal(t, float64(3), m.GetGauge().DataPoints[0].GetAsDouble())
+					}
+				}
+			}
+		}
+	}
+	assert.True(t, found, "registry metrics are exported")
+	assert.Contains(t, c.headers, "ApiKey key")
+}
+
+func TestAddMetricsHistogram(t *testing.T) {
+	metrics := make(map[string]*metricspb.Metric)
+	addMetrics(metrics, &model.Metrics{
+		Timestamp: model.Time(time.Unix(1, 0)),
+		Samples: map[string]model.Metric{
+			"latency": {Type: "histogram", Values: []float64{1, 3, 7}, Counts: []uint64{2, 0, 1}},
+			"total":   {Value: 5},
+		},
+	})
+
+	require.Len(t, metrics, 2)
+	assert.Equal(t, float64(5), metrics["total"].GetGauge().DataPoints[0].GetAsDouble())
+	histogram := metrics["latency"].GetHistogram()
+	require.NotNil(t, histogram)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, histogram.AggregationTemporality)
+	require.Len(t, histogram.DataPoints, 1)
+	point := histogram.DataPoints[0]
+	assert.Equal(t, uint64(3), point.Count)
+	assert.Equal(t, float64(9), point.GetSum())
+	assert.Equal(t, []uint64{2, 0, 1}, point.BucketCounts)
+	assert.Equal(t, []float64{2, 5}, point.ExplicitBounds)
+	assert.Equal(t, uint64(time.Second), point.TimeUnixNano)
+}
+
+func TestTransportGRPC(t *testing.T) {
+	var c collector
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, &c)
+	go srv.Serve(lis) //nolint:errcheck // test server
+	defer srv.Stop()
+
+	tracer := testTracer(t, &config.Instrumentation{OTLP: config.InstrumentationOTLP{
+		Enabled:  true,
+		Endpoint: lis.Addr().String(),
+		Insecure: true,
+		Headers:  map[string]string{"authorization": "Bearer token"},
+	}})
+	tracer.StartTransaction("Flush queue read", "bulker").End()
+	tracer.Flush(nil)
+
+	assert.Contains(t, c.spans(), "Flush queue read")
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	assert.Contains(t, c.headers, "Bearer token")
+}
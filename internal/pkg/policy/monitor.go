@@ -14,6 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
@@ -56,10 +57,66 @@ type Monitor interface {
 	Run(ctx context.Context) error
 
 	// Subscribe creates a new subscription for a policy update.
-	Subscribe(agentID string, policyID string, revisionIdx int64, coordinatorIdx int64) (Subscription, error)
+	Subscribe(agentID string, policyID string, revisionIdx int64, coordinatorIdx int64, opts ...SubscribeOpt) (Subscription, error)
 
 	// Unsubscribe removes the current subscription.
 	Unsubscribe(sub Subscription) error
+
+	// LookupRevision returns the given revision of a policy if it is the latest or
+	// one of the recent revisions retained by the monitor.
+	LookupRevision(policyID string, revisionIdx int64, coordinatorIdx int64) (*ParsedPolicy, bool)
+
+	// ReportFailure reports that an agent failed to apply or run a policy revision.
+	ReportFailure(agentID string, policyID string, revisionIdx int64, coordinatorIdx int64)
+
+	// PinnedRevision returns the pinned revision of a policy that is delivered to an agent
+	// with the given pinned revision index, or false if the agent follows the latest revision.
+	PinnedRevision(policyID string, pinnedRevisionIdx int64) (Revision, bool)
+
+	// ResumeRollout resumes the halted rollout of the latest revision of a policy.
+	ResumeRollout(policyID string) error
+
+	// AbortRollout aborts the halted rollout of the latest revision of a policy.
+	AbortRollout(policyID string) error
+}
+
+// MonitorOpt is an option for the policy monitor.
+type MonitorOpt func(*monitorT)
+
+// WithRevisionHistory sets the number of previous revisions retained per policy.
+// A value of 0 retains only the latest revision.
+func WithRevisionHistory(n int) MonitorOpt {
+	return func(m *monitorT) {
+		if n > 0 {
+			m.history = n
+		}
+	}
+}
+
+// WithPolicyPinMonitor sets the monitor of the policy pin index that the changes of the policy pins
+// are received from.
+func WithPolicyPinMonitor(pinMonitor monitor.SimpleMonitor) MonitorOpt {
+	return func(m *monitorT) {
+		m.pinMonitor = pinMonitor
+	}
+}
+
+// WithPolicyRolloutMonitor sets the monitor of the policy rollout index that the changes of the rollout
+// state made by the other fleet-servers are received from. The rollout state is only kept in memory
+// unless it is set.
+func WithPolicyRolloutMonitor(rolloutMonitor monitor.SimpleMonitor) MonitorOpt {
+	return func(m *monitorT) {
+		m.rolloutMonitor = rolloutMonitor
+	}
+}
+
+// WithRollouts sets the canary rollout ordering used when delivering new revisions of the given policies.
+func WithRollouts(rollouts []config.PolicyRollout) MonitorOpt {
+	return func(m *monitorT) {
+		for _, r := range rollouts {
+			m.rollouts[r.PolicyID] = r
+		}
+	}
 }
 
 type policyFetcher func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option) ([]model.Policy, error)
@@ -67,6 +124,15 @@ type policyFetcher func(ctx context.Context, bulker bulk.Bulk, opt ...dl.Option)
 type policyT struct {
 	pp   ParsedPolicy
 	head *subT
+
+	// previous revisions, oldest first
+	history []ParsedPolicy
+
+	// canary rollout of the latest revision, nil if not configured
+	rollout *rolloutT
+
+	// pinned revisions loaded on demand, nil if a revision is not available
+	pins map[int64]*ParsedPolicy
 }
 
 type monitorT struct {
@@ -78,32 +144,77 @@ type monitorT struct {
 
 	kickCh   chan struct{}
 	deployCh chan struct{}
+	pinCh    chan struct{}
+	saveCh   chan struct{}
 
 	policies map[string]policyT
 	pendingQ *subT
-
-	policyF       policyFetcher
-	policiesIndex string
-	throttle      time.Duration
+	pinLoads map[pinKey]struct{}
+
+	// pinned revision index per policy, kept across revisions
+	policyPins map[string]int64
+	pinMonitor monitor.SimpleMonitor
+
+	// policy rollout documents to write, keyed by document ID
+	rolloutSaves   map[string]rolloutSave
+	rolloutMonitor monitor.SimpleMonitor
+
+	policyF             policyFetcher
+	revisionF           revisionFetcher
+	policyPinF          policyPinFetcher
+	rolloutF            policyRolloutFetcher
+	rolloutCreateF      policyRolloutWriter
+	rolloutSetF         policyRolloutWriter
+	policiesIndex       string
+	policyPinsIndex     string
+	policyRolloutsIndex string
+	throttle            time.Duration
+	history             int
+	rollouts            map[string]config.PolicyRollout
+	reporter            *QuarantineReporter
+
+	// latest quarantined revision per policy; only accessed by Run
+	quarantined map[string]model.Policy
+
+	// policy pins are loaded; only accessed by Run
+	policyPinsLoaded bool
 
 	startCh chan struct{}
 }
 
 // NewMonitor creates the policy monitor for subscribing agents.
-func NewMonitor(bulker bulk.Bulk, monitor monitor.Monitor, throttle time.Duration) Monitor {
-	return &monitorT{
-		log:           log.With().Str("ctx", "policy agent monitor").Logger(),
-		bulker:        bulker,
-		monitor:       monitor,
-		kickCh:        make(chan struct{}, 1),
-		deployCh:      make(chan struct{}, 1),
-		policies:      make(map[string]policyT),
-		pendingQ:      makeHead(),
-		throttle:      throttle,
-		policyF:       dl.QueryLatestPolicies,
-		policiesIndex: dl.FleetPolicies,
-		startCh:       make(chan struct{}),
+func NewMonitor(bulker bulk.Bulk, monitor monitor.Monitor, throttle time.Duration, opts ...MonitorOpt) Monitor {
+	m := &monitorT{
+		log:                 log.With().Str("ctx", "policy agent monitor").Logger(),
+		bulker:              bulker,
+		monitor:             monitor,
+		kickCh:              make(chan struct{}, 1),
+		deployCh:            make(chan struct{}, 1),
+		pinCh:               make(chan struct{}, 1),
+		saveCh:              make(chan struct{}, 1),
+		policies:            make(map[string]policyT),
+		rollouts:            make(map[string]config.PolicyRollout),
+		quarantined:         make(map[string]model.Policy),
+		pendingQ:            makeHead(),
+		pinLoads:            make(map[pinKey]struct{}),
+		policyPins:          make(map[string]int64),
+		rolloutSaves:        make(map[string]rolloutSave),
+		throttle:            throttle,
+		policyF:             dl.QueryLatestPolicies,
+		revisionF:           dl.FindPolicyRevision,
+		policyPinF:          dl.FindPolicyPins,
+		rolloutF:            dl.FindPolicyRollout,
+		rolloutCreateF:      dl.CreatePolicyRollout,
+		rolloutSetF:         dl.SetPolicyRollout,
+		policiesIndex:       dl.FleetPolicies,
+		policyPinsIndex:     dl.FleetPolicyPins,
+		policyRolloutsIndex: dl.FleetPolicyRollouts,
+		startCh:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // Run runs the monitor.
@@ -115,6 +226,17 @@ func (m *monitorT) Run(ctx context.Context) error {
 	s := m.monitor.Subscribe()
 	defer m.monitor.Unsubscribe(s)
 
+	var pinHits <-chan []es.HitT
+	if m.pinMonitor != nil {
+		pinHits = m.pinMonitor.Output()
+		m.ensurePolicyPins(ctx)
+	}
+
+	var rolloutHits <-chan []es.HitT
+	if m.rolloutMonitor != nil {
+		rolloutHits = m.rolloutMonitor.Output()
+	}
+
 	// If no throttle set, setup a minimal spin rate.
 	dur := m.throttle
 	if dur == 0 {
@@ -148,17 +270,35 @@ LOOP:
 	for {
 		select {
 		case <-m.kickCh:
+			if m.pinMonitor != nil {
+				m.ensurePolicyPins(ctx)
+			}
 			if err := m.loadPolicies(ctx); err != nil {
 				return err
 			}
 			startDeploy()
 		case <-m.deployCh:
 			startDeploy()
+		case <-m.pinCh:
+			m.loadPins(ctx)
+			startDeploy()
+		case <-m.saveCh:
+			m.saveRollouts(ctx)
 		case hits := <-s.Output():
 			if err := m.processHits(ctx, hits); err != nil {
 				return err
 			}
 			startDeploy()
+		case hits := <-pinHits:
+			if err := m.processPolicyPinHits(hits); err != nil {
+				m.log.Error().Err(err).Msg("fail unmarshal policy pin hits")
+			}
+			startDeploy()
+		case hits := <-rolloutHits:
+			if err := m.processPolicyRolloutHits(hits); err != nil {
+				m.log.Error().Err(err).Msg("fail unmarshal policy rollout hits")
+			}
+			startDeploy()
 		case <-ticker.C:
 			if done := m.dispatchPending(); done {
 				stopDeploy()
@@ -171,6 +311,19 @@ LOOP:
 	return nil
 }
 
+// ensurePolicyPins loads the policy pins unless they are loaded, a failed load is retried on the
+// next policy load.
+func (m *monitorT) ensurePolicyPins(ctx context.Context) {
+	if m.policyPinsLoaded {
+		return
+	}
+	if err := m.loadPolicyPins(ctx); err != nil {
+		m.log.Error().Err(err).Msg("failed to load policy pins")
+		return
+	}
+	m.policyPinsLoaded = true
+}
+
 func unmarshalHits(hits []es.HitT) ([]model.Policy, error) {
 
 	policies := make([]model.Policy, len(hits))
@@ -223,13 +376,28 @@ func (m *monitorT) dispatchPending() bool {
 		return done
 	}
 
+	// A newer revision may have started a rollout after the subscription was queued,
+	// or the pinned revision may not be loaded yet.
+	if !m.deliverable(policy, s) {
+		policy.head.pushBack(s)
+		m.log.Debug().
+			Str(logger.AgentID, s.agentID).
+			Str(logger.PolicyID, s.policyID).
+			Msg("dispatch held for policy rollout or pinned revision")
+		return done
+	}
+	pp, pinned := m.resolve(policy, s)
+
 	select {
-	case s.ch <- &policy.pp:
+	case s.ch <- pp:
 		m.log.Debug().
 			Str(logger.AgentID, s.agentID).
 			Str(logger.PolicyID, s.policyID).
 			Int64("rev", s.revIdx).
 			Int64("coord", s.coordIdx).
+			Int64("targetRev", pp.Policy.RevisionIdx).
+			Int64("targetCoord", pp.Policy.CoordinatorIdx).
+			Bool("pinned", pinned).
 			Msg("dispatch")
 	default:
 		// Should never block on a channel; we created a channel of size one.
@@ -261,19 +429,27 @@ func (m *monitorT) loadPolicies(ctx context.Context) error {
 	return m.processPolicies(ctx, policies)
 }
 
-func (m *monitorT) processPolicies(_ context.Context, policies []model.Policy) error {
+func (m *monitorT) processPolicies(ctx context.Context, policies []model.Policy) error {
 	if len(policies) == 0 {
 		return nil
 	}
 
 	latest := m.groupByLatest(policies)
 	for _, policy := range latest {
-		pp, err := NewParsedPolicy(policy)
+		// A revision that fails validation never reaches the delivery path
+		pp, err := ValidatePolicy(policy)
 		if err != nil {
-			return err
+			if policy.CoordinatorIdx > 0 {
+				m.quarantine(ctx, policy, err)
+			}
+			continue
 		}
 
+		m.restoreRollout(ctx, policy)
 		m.updatePolicy(pp)
+		if policy.CoordinatorIdx > 0 {
+			m.release(policy)
+		}
 	}
 	return nil
 }
@@ -320,8 +496,9 @@ func (m *monitorT) updatePolicy(pp *ParsedPolicy) bool {
 	p, ok := m.policies[newPolicy.PolicyID]
 	if !ok {
 		p = policyT{
-			pp:   *pp,
-			head: makeHead(),
+			pp:      *pp,
+			head:    makeHead(),
+			rollout: m.startRollout(&newPolicy, nil, nil),
 		}
 		m.policies[newPolicy.PolicyID] = p
 		zlog.Info().Str(logger.PolicyID, newPolicy.PolicyID).Msg("New policy found on update and added")
@@ -329,19 +506,47 @@ func (m *monitorT) updatePolicy(pp *ParsedPolicy) bool {
 	}
 
 	// Cache the old stored policy for logging
-	oldPolicy := p.pp.Policy
+	oldPP := p.pp
+	oldPolicy := oldPP.Policy
+
+	// Retain the previous revision so updates can be sent as a patch against it
+	if m.history > 0 && oldPolicy.CoordinatorIdx > 0 && !isRevision(&oldPolicy, newPolicy.RevisionIdx, newPolicy.CoordinatorIdx) {
+		p.history = append(p.history, p.pp)
+		if n := len(p.history) - m.history; n > 0 {
+			p.history = append([]ParsedPolicy(nil), p.history[n:]...)
+		}
+	}
 
 	// Update the policy in our data structure
 	p.pp = *pp
+	p.rollout = m.startRollout(&newPolicy, &oldPP, p.rollout)
+	if !isRevision(&oldPolicy, newPolicy.RevisionIdx, newPolicy.CoordinatorIdx) {
+		p.pins = nil
+	}
 	m.policies[newPolicy.PolicyID] = p
 
-	// Iterate through the subscriptions on this policy;
-	// schedule any subscription for delivery that requires an update.
+	nQueued := m.queueUpdates(p)
+
+	zlog.Info().
+		Int64("oldRev", oldPolicy.RevisionIdx).
+		Int64("oldCoord", oldPolicy.CoordinatorIdx).
+		Int("nQueued", nQueued).
+		Str(logger.PolicyID, newPolicy.PolicyID).
+		Msg("New revision of policy received and added to the queue")
+
+	return true
+}
+
+// queueUpdates iterates through the subscriptions on the policy and schedules any
+// subscription for delivery that requires an update and is not held by a rollout.
+// The caller must hold the monitor lock.
+func (m *monitorT) queueUpdates(p policyT) int {
+	newPolicy := p.pp.Policy
 	nQueued := 0
 
 	iter := NewIterator(p.head)
 	for sub := iter.Next(); sub != nil; sub = iter.Next() {
-		if sub.isUpdate(&newPolicy) {
+		if m.deliverable(p, sub) {
 
 			// Unlink the target node from the list
 			iter.Unlink()
@@ -355,22 +560,18 @@ func (m *monitorT) updatePolicy(pp *ParsedPolicy) bool {
 				m.pendingQ.pushBack(sub)
 			}
 
-			zlog.Debug().
+			m.log.Debug().
 				Str(logger.AgentID, sub.agentID).
+				Str(logger.PolicyID, newPolicy.PolicyID).
+				Int64("rev", newPolicy.RevisionIdx).
+				Int64("coord", newPolicy.CoordinatorIdx).
 				Msg("scheduled pendingQ on policy revision")
 
 			nQueued += 1
 		}
 	}
 
-	zlog.Info().
-		Int64("oldRev", oldPolicy.RevisionIdx).
-		Int64("oldCoord", oldPolicy.CoordinatorIdx).
-		Int("nQueued", nQueued).
-		Str(logger.PolicyID, newPolicy.PolicyID).
-		Msg("New revision of policy received and added to the queue")
-
-	return true
+	return nQueued
 }
 
 func (m *monitorT) kickLoad() {
@@ -391,7 +592,7 @@ func (m *monitorT) kickDeploy() {
 }
 
 // Subscribe creates a new subscription for a policy update.
-func (m *monitorT) Subscribe(agentID string, policyID string, revisionIdx int64, coordinatorIdx int64) (Subscription, error) {
+func (m *monitorT) Subscribe(agentID string, policyID string, revisionIdx int64, coordinatorIdx int64, opts ...SubscribeOpt) (Subscription, error) {
 	if revisionIdx < 0 {
 		return nil, errors.New("revisionIdx must be greater than or equal to 0")
 	}
@@ -411,6 +612,7 @@ func (m *monitorT) Subscribe(agentID string, policyID string, revisionIdx int64,
 		agentID,
 		revisionIdx,
 		coordinatorIdx,
+		opts...,
 	)
 
 	m.mut.Lock()
@@ -427,7 +629,7 @@ func (m *monitorT) Subscribe(agentID string, policyID string, revisionIdx int64,
 		p.head.pushBack(s)
 		m.policies[policyID] = p
 		m.kickLoad()
-	case s.isUpdate(&p.pp.Policy):
+	case m.deliverable(p, s):
 		empty := m.pendingQ.isEmpty()
 		m.pendingQ.pushBack(s)
 		m.log.Debug().
@@ -463,3 +665,33 @@ func (m *monitorT) Unsubscribe(sub Subscription) error {
 
 	return nil
 }
+
+// LookupRevision returns the given revision of a policy if it is the latest or
+// one of the recent revisions retained by the monitor.
+func (m *monitorT) LookupRevision(policyID string, revisionIdx int64, coordinatorIdx int64) (*ParsedPolicy, bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p, ok := m.policies[policyID]
+	if !ok {
+		return nil, false
+	}
+	if isRevision(&p.pp.Policy, revisionIdx, coordinatorIdx) {
+		pp := p.pp
+		return &pp, true
+	}
+	for i := range p.history {
+		if isRevision(&p.history[i].Policy, revisionIdx, coordinatorIdx) {
+			pp := p.history[i]
+			return &pp, true
+		}
+	}
+	if pp := p.pins[revisionIdx]; pp != nil && isRevision(&pp.Policy, revisionIdx, coordinatorIdx) {
+		return pp, true
+	}
+	return nil, false
+}
+
+func isRevision(policy *model.Policy, revisionIdx int64, coordinatorIdx int64) bool {
+	return policy.CoordinatorIdx > 0 && policy.RevisionIdx == revisionIdx && policy.CoordinatorIdx == coordinatorIdx
+}
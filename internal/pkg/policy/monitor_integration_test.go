@@ -21,7 +21,7 @@ import (
 	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
 )
 
-var policyBytes = []byte(`{"outputs":{"default":{"type":"elasticsearch"}}}`)
+var policyBytes = []byte(`{"outputs":{"default":{"type":"elasticsearch"}},"output_permissions":{"default":{}}}`)
 
 func TestMonitor_Integration(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
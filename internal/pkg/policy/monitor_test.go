@@ -27,7 +27,7 @@ import (
 	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
 )
 
-var policyBytes = []byte(`{"outputs":{"default":{"type":"elasticsearch"}}}`)
+var policyBytes = []byte(`{"outputs":{"default":{"type":"elasticsearch"}},"output_permissions":{"default":{}}}`)
 
 func TestMonitor_NewPolicy(t *testing.T) {
 	_ = testlog.SetLogger(t)
@@ -370,3 +370,49 @@ func runTestMonitor_NewPolicyExists(t *testing.T, delay time.Duration) {
 		t.Fatal("never got policy update; timed out after 500ms")
 	}
 }
+
+func TestMonitor_LookupRevision(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	bulker := ftesting.NewMockBulk()
+	monitor := NewMonitor(bulker, mmock.NewMockMonitor(), 0, WithRevisionHistory(2))
+	pm := monitor.(*monitorT)
+
+	policyID := uuid.Must(uuid.NewV4()).String()
+	for rev := int64(1); rev <= 4; rev++ {
+		pp, err := NewParsedPolicy(model.Policy{
+			PolicyID:       policyID,
+			RevisionIdx:    rev,
+			CoordinatorIdx: 1,
+			Data:           policyBytes,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.updatePolicy(pp)
+	}
+
+	for _, tc := range []struct {
+		rev   int64
+		coord int64
+		found bool
+	}{
+		{1, 1, false}, // evicted from history
+		{2, 1, true},
+		{3, 1, true},
+		{4, 1, true}, // latest
+		{4, 2, false},
+		{5, 1, false},
+	} {
+		pp, ok := monitor.LookupRevision(policyID, tc.rev, tc.coord)
+		if ok != tc.found {
+			t.Fatalf("revision %d:%d expected found=%v", tc.rev, tc.coord, tc.found)
+		}
+		if ok && (pp.Policy.RevisionIdx != tc.rev || pp.Policy.CoordinatorIdx != tc.coord) {
+			t.Fatalf("revision %d:%d returned wrong policy revision %d:%d", tc.rev, tc.coord, pp.Policy.RevisionIdx, pp.Policy.CoordinatorIdx)
+		}
+	}
+
+	if _, ok := monitor.LookupRevision("unknown", 1, 1); ok {
+		t.Fatal("expected unknown policy not to be found")
+	}
+}
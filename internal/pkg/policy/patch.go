@@ -0,0 +1,139 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// JSON patch operations used when diffing policies.
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+)
+
+// PatchOp is a single RFC 6902 JSON patch operation.
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Diff returns the RFC 6902 JSON patch that transforms the policy fields in from into to.
+//
+// Objects are compared recursively, while arrays and scalar values are replaced as a whole
+// whenever they differ. Top level keys listed in skip are not compared.
+func Diff(from, to map[string]json.RawMessage, skip ...string) ([]PatchOp, error) {
+	ignore := make(map[string]bool, len(skip))
+	for _, k := range skip {
+		ignore[k] = true
+	}
+
+	var ops []PatchOp
+	for _, k := range sortedKeys(from) {
+		if ignore[k] {
+			continue
+		}
+		if _, ok := to[k]; !ok {
+			ops = append(ops, PatchOp{Op: PatchOpRemove, Path: "/" + escapePointer(k)})
+		}
+	}
+	for _, k := range sortedKeys(to) {
+		if ignore[k] {
+			continue
+		}
+		path := "/" + escapePointer(k)
+		fromRaw, ok := from[k]
+		if !ok {
+			ops = append(ops, PatchOp{Op: PatchOpAdd, Path: path, Value: to[k]})
+			continue
+		}
+		if bytes.Equal(fromRaw, to[k]) {
+			continue
+		}
+		a, err := decodeValue(fromRaw)
+		if err != nil {
+			return nil, err
+		}
+		b, err := decodeValue(to[k])
+		if err != nil {
+			return nil, err
+		}
+		if ops, err = diffValue(ops, path, a, b); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+func diffValue(ops []PatchOp, path string, a, b interface{}) ([]PatchOp, error) {
+	if reflect.DeepEqual(a, b) {
+		return ops, nil
+	}
+
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if !aok || !bok {
+		raw, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		return append(ops, PatchOp{Op: PatchOpReplace, Path: path, Value: raw}), nil
+	}
+
+	for _, k := range sortedKeys(am) {
+		if _, ok := bm[k]; !ok {
+			ops = append(ops, PatchOp{Op: PatchOpRemove, Path: path + "/" + escapePointer(k)})
+		}
+	}
+	for _, k := range sortedKeys(bm) {
+		p := path + "/" + escapePointer(k)
+		av, ok := am[k]
+		if !ok {
+			raw, err := json.Marshal(bm[k])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, PatchOp{Op: PatchOpAdd, Path: p, Value: raw})
+			continue
+		}
+		var err error
+		if ops, err = diffValue(ops, p, av, bm[k]); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+// decodeValue decodes raw JSON keeping numbers as json.Number so they are not rounded on re-encode.
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// escapePointer escapes a key for use as a JSON pointer (RFC 6901) reference token.
+func escapePointer(k string) string {
+	k = strings.ReplaceAll(k, "~", "~0")
+	return strings.ReplaceAll(k, "/", "~1")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
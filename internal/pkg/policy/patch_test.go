@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		skip   []string
+		expect []PatchOp
+	}{{
+		name:   "equal",
+		from:   `{"a":{"b":1},"c":[1,2]}`,
+		to:     `{"a":{"b":1},"c":[1,2]}`,
+		expect: nil,
+	}, {
+		name:   "equal with different formatting",
+		from:   `{"a":{"b":1,"c":2}}`,
+		to:     `{"a":{ "c":2, "b":1 }}`,
+		expect: nil,
+	}, {
+		name: "add and remove top level",
+		from: `{"a":1,"b":2}`,
+		to:   `{"b":2,"c":3}`,
+		expect: []PatchOp{
+			{Op: PatchOpRemove, Path: "/a"},
+			{Op: PatchOpAdd, Path: "/c", Value: json.RawMessage(`3`)},
+		},
+	}, {
+		name: "nested replace",
+		from: `{"inputs":{"x":{"enabled":true,"period":"10s"}}}`,
+		to:   `{"inputs":{"x":{"enabled":true,"period":"30s","new":{"k":"v"}}}}`,
+		expect: []PatchOp{
+			{Op: PatchOpAdd, Path: "/inputs/x/new", Value: json.RawMessage(`{"k":"v"}`)},
+			{Op: PatchOpReplace, Path: "/inputs/x/period", Value: json.RawMessage(`"30s"`)},
+		},
+	}, {
+		name: "arrays are replaced",
+		from: `{"a":[1,2,3]}`,
+		to:   `{"a":[1,3]}`,
+		expect: []PatchOp{
+			{Op: PatchOpReplace, Path: "/a", Value: json.RawMessage(`[1,3]`)},
+		},
+	}, {
+		name: "type change",
+		from: `{"a":{"b":1}}`,
+		to:   `{"a":null}`,
+		expect: []PatchOp{
+			{Op: PatchOpReplace, Path: "/a", Value: json.RawMessage(`null`)},
+		},
+	}, {
+		name: "large numbers are preserved",
+		from: `{"a":{"n":1}}`,
+		to:   `{"a":{"n":9007199254740993}}`,
+		expect: []PatchOp{
+			{Op: PatchOpReplace, Path: "/a/n", Value: json.RawMessage(`9007199254740993`)},
+		},
+	}, {
+		name: "keys are escaped",
+		from: `{"a":{"x/y":1,"m~n":1}}`,
+		to:   `{"a":{}}`,
+		expect: []PatchOp{
+			{Op: PatchOpRemove, Path: "/a/m~0n"},
+			{Op: PatchOpRemove, Path: "/a/x~1y"},
+		},
+	}, {
+		name:   "skipped keys",
+		from:   `{"outputs":{"a":1}}`,
+		to:     `{"outputs":{"a":2}}`,
+		skip:   []string{FieldOutputs},
+		expect: nil,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var from, to map[string]json.RawMessage
+			require.NoError(t, json.Unmarshal([]byte(tc.from), &from))
+			require.NoError(t, json.Unmarshal([]byte(tc.to), &to))
+
+			ops, err := Diff(from, to, tc.skip...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, ops)
+		})
+	}
+}
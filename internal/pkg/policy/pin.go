@@ -0,0 +1,242 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+/*
+An agent follows the latest revision of its policy unless it is pinned to a revision, either
+by the policy_pinned_revision_idx field of the agent document or, for all agents of a policy,
+by the pinned_revision_idx field of the policy pin document. The policy pin document is kept
+per policy, apart from the revision documents, so that the pin applies to new revisions of the
+policy until it is removed by setting it to 0. Pinning to an older revision rolls agents back
+to it. The agent pin takes precedence over the policy pin.
+
+Pinned revisions that are not retained by the monitor are loaded on demand. A pinned revision
+that does not exist is ignored and the agent follows the latest revision.
+*/
+
+// maxPolicyPins is the maximum number of policy pin documents loaded on start.
+const maxPolicyPins = 10000
+
+type revisionFetcher func(ctx context.Context, bulker bulk.Bulk, policyID string, revisionIdx int64, opt ...dl.Option) (model.Policy, error)
+
+type policyPinFetcher func(ctx context.Context, bulker bulk.Bulk, size int, opt ...dl.Option) (map[string]model.PolicyPin, error)
+
+type pinKey struct {
+	policyID string
+	revIdx   int64
+}
+
+// pinnedRevision returns the revision index the subscription is pinned to, or 0 if it follows the latest revision.
+// The caller must hold the monitor lock.
+func (m *monitorT) pinnedRevision(p policyT, s *subT) int64 {
+	revIdx := s.pinnedRevIdx
+	if revIdx == 0 {
+		revIdx = m.policyPins[s.policyID]
+	}
+	if revIdx == p.pp.Policy.RevisionIdx {
+		return 0
+	}
+	return revIdx
+}
+
+// retained returns the retained policy with the given revision index and the highest coordinator index.
+func (p *policyT) retained(revIdx int64) *ParsedPolicy {
+	if pp := p.pins[revIdx]; pp != nil {
+		return pp
+	}
+	var res *ParsedPolicy
+	for i := range p.history {
+		pp := &p.history[i]
+		if pp.Policy.RevisionIdx == revIdx && (res == nil || pp.Policy.CoordinatorIdx > res.Policy.CoordinatorIdx) {
+			res = pp
+		}
+	}
+	return res
+}
+
+// resolve returns the revision of the policy that is delivered to the subscription and whether
+// it is a pinned revision. A nil policy is returned while a pinned revision is being loaded.
+// Unpinned subscriptions held by a rollout resolve to the last released revision.
+// The caller must hold the monitor lock.
+func (m *monitorT) resolve(p policyT, s *subT) (*ParsedPolicy, bool) {
+	revIdx := m.pinnedRevision(p, s)
+	if revIdx == 0 {
+		return p.rollout.revision(&p.pp, s), false
+	}
+	if pp := p.retained(revIdx); pp != nil {
+		return pp, true
+	}
+	if _, ok := p.pins[revIdx]; ok {
+		// pinned revision is not available, follow the latest
+		return p.rollout.revision(&p.pp, s), false
+	}
+	m.requestPin(s.policyID, revIdx)
+	return nil, true
+}
+
+// deliverable returns true if the subscription requires an update and may be scheduled for delivery.
+// Pinned revisions are not subject to canary rollouts so that a rollback reaches all agents quickly.
+// The caller must hold the monitor lock.
+func (m *monitorT) deliverable(p policyT, s *subT) bool {
+	pp, pinned := m.resolve(p, s)
+	switch {
+	case pp == nil:
+		return false
+	case pinned || p.rollout.rollsBack():
+		return s.revIdx != pp.Policy.RevisionIdx || s.coordIdx != pp.Policy.CoordinatorIdx
+	default:
+		return s.isUpdate(&pp.Policy)
+	}
+}
+
+// requestPin schedules a pinned revision to be loaded; the caller must hold the monitor lock.
+func (m *monitorT) requestPin(policyID string, revIdx int64) {
+	key := pinKey{policyID: policyID, revIdx: revIdx}
+	if _, ok := m.pinLoads[key]; ok {
+		return
+	}
+	m.pinLoads[key] = struct{}{}
+
+	select {
+	case m.pinCh <- struct{}{}:
+	default:
+	}
+}
+
+// loadPins loads the requested pinned revisions and schedules the subscriptions waiting on them.
+func (m *monitorT) loadPins(ctx context.Context) {
+	m.mut.Lock()
+	keys := make([]pinKey, 0, len(m.pinLoads))
+	for k := range m.pinLoads {
+		keys = append(keys, k)
+	}
+	m.mut.Unlock()
+
+	for _, k := range keys {
+		zlog := m.log.With().
+			Str(logger.PolicyID, k.policyID).
+			Int64("rev", k.revIdx).
+			Logger()
+
+		var pp *ParsedPolicy
+		policy, err := m.revisionF(ctx, m.bulker, k.policyID, k.revIdx, dl.WithIndexName(m.policiesIndex))
+		if err == nil && policy.CoordinatorIdx > 0 {
+			pp, err = NewParsedPolicy(policy)
+		}
+
+		m.mut.Lock()
+		delete(m.pinLoads, k)
+		switch {
+		case err != nil && !errors.Is(err, dl.ErrNotFound):
+			// retried the next time the revision is requested
+			zlog.Error().Err(err).Msg("failed to load pinned policy revision")
+			m.mut.Unlock()
+			continue
+		case pp == nil:
+			zlog.Warn().Msg("pinned policy revision not found, delivering latest revision")
+		default:
+			zlog.Info().Int64("coord", pp.Policy.CoordinatorIdx).Msg("loaded pinned policy revision")
+		}
+
+		p, ok := m.policies[k.policyID]
+		if !ok {
+			m.mut.Unlock()
+			continue
+		}
+		if p.pins == nil {
+			p.pins = make(map[int64]*ParsedPolicy)
+		}
+		p.pins[k.revIdx] = pp
+		m.policies[k.policyID] = p
+		m.queueUpdates(p)
+		m.mut.Unlock()
+	}
+}
+
+// PinnedRevision returns the pinned revision that is delivered for a policy to an agent with the given
+// pinned revision index, which is 0 if the agent itself is not pinned. Returns false if the agent follows
+// the latest revision or the pinned revision is not loaded.
+func (m *monitorT) PinnedRevision(policyID string, pinnedRevisionIdx int64) (Revision, bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p, ok := m.policies[policyID]
+	if !ok {
+		return Revision{}, false
+	}
+	revIdx := m.pinnedRevision(p, &subT{policyID: policyID, pinnedRevIdx: pinnedRevisionIdx})
+	if revIdx == 0 {
+		return Revision{}, false
+	}
+	pp := p.retained(revIdx)
+	if pp == nil {
+		return Revision{}, false
+	}
+	return RevisionFromPolicy(pp.Policy), true
+}
+
+// loadPolicyPins loads the policy pin documents; the changes that follow are received from the
+// policy pin index monitor.
+func (m *monitorT) loadPolicyPins(ctx context.Context) error {
+	pins, err := m.policyPinF(ctx, m.bulker, maxPolicyPins, dl.WithIndexName(m.policyPinsIndex))
+	if err != nil {
+		return err
+	}
+	m.updatePolicyPins(pins)
+	return nil
+}
+
+// processPolicyPinHits applies the policy pin documents changed since they were loaded.
+func (m *monitorT) processPolicyPinHits(hits []es.HitT) error {
+	pins := make(map[string]model.PolicyPin, len(hits))
+	for _, hit := range hits {
+		var pin model.PolicyPin
+		if err := hit.Unmarshal(&pin); err != nil {
+			return err
+		}
+		pins[pin.PolicyID] = pin
+	}
+	m.updatePolicyPins(pins)
+	return nil
+}
+
+// updatePolicyPins sets the pins of the policies and schedules the subscriptions that the
+// new pins apply to.
+func (m *monitorT) updatePolicyPins(pins map[string]model.PolicyPin) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	for policyID, pin := range pins {
+		if m.policyPins[policyID] == pin.PinnedRevisionIdx {
+			continue
+		}
+		if pin.PinnedRevisionIdx == 0 {
+			delete(m.policyPins, policyID)
+		} else {
+			m.policyPins[policyID] = pin.PinnedRevisionIdx
+		}
+
+		nQueued := 0
+		if p, ok := m.policies[policyID]; ok {
+			nQueued = m.queueUpdates(p)
+		}
+		m.log.Info().
+			Str(logger.PolicyID, policyID).
+			Int64("pinnedRev", pin.PinnedRevisionIdx).
+			Int("nQueued", nQueued).
+			Msg("policy pin updated")
+	}
+}
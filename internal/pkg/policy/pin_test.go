@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	mmock "github.com/elastic/fleet-server/v7/internal/pkg/monitor/mock"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+func newPinTestMonitor(t *testing.T) (*monitorT, *int) {
+	t.Helper()
+	_ = testlog.SetLogger(t)
+	m := NewMonitor(ftesting.NewMockBulk(), mmock.NewMockMonitor(), 0).(*monitorT)
+	loads := 0
+	m.revisionF = func(_ context.Context, _ bulk.Bulk, policyID string, revIdx int64, _ ...dl.Option) (model.Policy, error) {
+		loads++
+		if revIdx > 10 {
+			return model.Policy{}, dl.ErrNotFound
+		}
+		return model.Policy{PolicyID: policyID, RevisionIdx: revIdx, CoordinatorIdx: 1, Data: policyBytes}, nil
+	}
+	return m, &loads
+}
+
+func pinTestPolicy(m *monitorT, pinned int64) {
+	m.updatePolicyPins(map[string]model.PolicyPin{"policy": {PolicyID: "policy", PinnedRevisionIdx: pinned}})
+}
+
+func receivedRevision(t *testing.T, s Subscription) int64 {
+	t.Helper()
+	select {
+	case pp := <-s.Output():
+		return pp.Policy.RevisionIdx
+	default:
+		return 0
+	}
+}
+
+func TestPinPolicyRollback(t *testing.T) {
+	m, loads := newPinTestMonitor(t)
+	updateTestPolicy(t, m, 5)
+
+	s, err := m.Subscribe("agent", "policy", 5, 1)
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Zero(t, receivedRevision(t, s))
+
+	// pin the policy back to revision 3 with the policy pin document
+	pinTestPolicy(m, 3)
+	dispatchAll(m)
+	assert.Zero(t, receivedRevision(t, s), "pinned revision is loaded first")
+
+	m.loadPins(context.Background())
+	assert.Equal(t, 1, *loads)
+	dispatchAll(m)
+	assert.Equal(t, int64(3), receivedRevision(t, s))
+
+	rev, ok := m.PinnedRevision("policy", 0)
+	assert.True(t, ok)
+	assert.Equal(t, Revision{PolicyID: "policy", RevisionIdx: 3, CoordinatorIdx: 1}, rev)
+
+	// an agent on the pinned revision is not updated
+	s2, err := m.Subscribe("agent", "policy", 3, 1)
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Zero(t, receivedRevision(t, s2))
+
+	// the pin is kept for new revisions of the policy
+	updateTestPolicy(t, m, 6)
+	dispatchAll(m)
+	assert.Zero(t, receivedRevision(t, s2))
+	m.loadPins(context.Background())
+	dispatchAll(m)
+	assert.Zero(t, receivedRevision(t, s2))
+	rev, ok = m.PinnedRevision("policy", 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), rev.RevisionIdx)
+
+	// removing the pin resumes normal delivery
+	pinTestPolicy(m, 0)
+	dispatchAll(m)
+	assert.Equal(t, int64(6), receivedRevision(t, s2))
+	_, ok = m.PinnedRevision("policy", 0)
+	assert.False(t, ok)
+}
+
+func TestPinLoadPolicyPins(t *testing.T) {
+	m, _ := newPinTestMonitor(t)
+	m.policyPinF = func(_ context.Context, _ bulk.Bulk, _ int, _ ...dl.Option) (map[string]model.PolicyPin, error) {
+		return map[string]model.PolicyPin{"policy": {PolicyID: "policy", PinnedRevisionIdx: 4}}, nil
+	}
+	require.NoError(t, m.loadPolicyPins(context.Background()))
+	updateTestPolicy(t, m, 5)
+
+	s, err := m.Subscribe("agent", "policy", 5, 1)
+	require.NoError(t, err)
+	m.loadPins(context.Background())
+	dispatchAll(m)
+	assert.Equal(t, int64(4), receivedRevision(t, s))
+
+	// changes are received as policy pin index hits
+	require.NoError(t, m.processPolicyPinHits([]es.HitT{{ID: "policy", Source: []byte(`{"policy_id":"policy","pinned_revision_idx":0}`)}}))
+	s, err = m.Subscribe("agent", "policy", 4, 1)
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Equal(t, int64(5), receivedRevision(t, s))
+}
+
+func TestPinAgent(t *testing.T) {
+	m, loads := newPinTestMonitor(t)
+	m.history = 2
+	updateTestPolicy(t, m, 5)
+	updateTestPolicy(t, m, 6)
+
+	// revisions retained in history are not loaded
+	s0, err := m.Subscribe("agent0", "policy", 6, 1, WithPinnedRevision(5))
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Equal(t, int64(5), receivedRevision(t, s0))
+	assert.Zero(t, *loads)
+
+	s, err := m.Subscribe("agent", "policy", 6, 1, WithPinnedRevision(2))
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Zero(t, receivedRevision(t, s))
+	m.loadPins(context.Background())
+	dispatchAll(m)
+	assert.Equal(t, int64(2), receivedRevision(t, s))
+
+	// the agent pin takes precedence over the policy pin
+	pinTestPolicy(m, 4)
+	rev, ok := m.PinnedRevision("policy", 2)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), rev.RevisionIdx)
+
+	// pinning to the latest revision is the same as following it
+	s2, err := m.Subscribe("agent2", "policy", 5, 1, WithPinnedRevision(6))
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Equal(t, int64(6), receivedRevision(t, s2))
+}
+
+func TestPinUnknownRevision(t *testing.T) {
+	m, _ := newPinTestMonitor(t)
+	updateTestPolicy(t, m, 5)
+
+	s, err := m.Subscribe("agent", "policy", 4, 1, WithPinnedRevision(42))
+	require.NoError(t, err)
+	m.loadPins(context.Background())
+	dispatchAll(m)
+	assert.Equal(t, int64(5), receivedRevision(t, s), "unknown pinned revision follows the latest")
+}
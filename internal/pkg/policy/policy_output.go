@@ -15,6 +15,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/apikey"
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
@@ -394,13 +395,24 @@ func generateOutputAPIKey(
 	name := fmt.Sprintf("%s:%s", agentID, outputName)
 	zerolog.Ctx(ctx).Info().Msgf("generating output API key %s for agent ID %s",
 		name, agentID)
-	return bulk.APIKeyCreate(
+	key, err := bulk.APIKeyCreate(
 		ctx,
 		name,
 		"",
 		roles,
 		apikey.NewMetadata(agentID, outputName, apikey.TypeOutput),
 	)
+	e := audit.Event{
+		Action:     audit.ActionAPIKeyCreate,
+		Message:    "Agent output API key created",
+		AgentID:    agentID,
+		OutputName: outputName,
+	}
+	if key != nil {
+		e.APIKeyIDs = []string{key.ID}
+	}
+	audit.Log(ctx, e.WithErr(err))
+	return key, err
 }
 
 func setMapObj(obj map[string]interface{}, val interface{}, keys ...string) error {
@@ -0,0 +1,161 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/elastic/elastic-agent-client/v7/pkg/client"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	"github.com/elastic/fleet-server/v7/internal/pkg/state"
+)
+
+// WithReporter sets the reporter used to report policy revisions that fail validation.
+func WithReporter(reporter *QuarantineReporter) MonitorOpt {
+	return func(m *monitorT) {
+		m.reporter = reporter
+	}
+}
+
+// QuarantineReporter reports the state of the self monitor degraded by the quarantined policy revisions.
+// The self monitor reports its state through it, so that the state is restored when the quarantines
+// are released and a quarantine does not hide the state reported by the self monitor.
+type QuarantineReporter struct {
+	mut      sync.Mutex
+	reporter state.Reporter
+
+	reported bool
+	state    client.UnitState
+	message  string
+	payload  map[string]interface{}
+
+	// quarantined revision per policy
+	quarantined map[string]quarantinedRevision
+}
+
+type quarantinedRevision struct {
+	policy model.Policy
+	err    string
+}
+
+// NewQuarantineReporter returns a reporter reporting to reporter.
+func NewQuarantineReporter(reporter state.Reporter) *QuarantineReporter {
+	return &QuarantineReporter{
+		reporter:    reporter,
+		quarantined: make(map[string]quarantinedRevision),
+	}
+}
+
+// UpdateState reports the state, degraded if it is healthy and a policy revision is quarantined.
+func (r *QuarantineReporter) UpdateState(state client.UnitState, message string, payload map[string]interface{}) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.reported = true
+	r.state, r.message, r.payload = state, message, payload
+	return r.report()
+}
+
+func (r *QuarantineReporter) quarantine(policy model.Policy, err error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.quarantined[policy.PolicyID] = quarantinedRevision{policy: policy, err: err.Error()}
+	r.report() //nolint:errcheck // not clear what to do in failure cases
+}
+
+func (r *QuarantineReporter) release(policyID string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	delete(r.quarantined, policyID)
+	r.report() //nolint:errcheck // not clear what to do in failure cases
+}
+
+// report reports the current state; the caller must hold the lock.
+func (r *QuarantineReporter) report() error {
+	if !r.reported {
+		// the self monitor reports the state first
+		return nil
+	}
+	if len(r.quarantined) == 0 || (r.state != client.UnitStateHealthy && r.state != client.UnitStateDegraded) {
+		return r.reporter.UpdateState(r.state, r.message, r.payload)
+	}
+
+	policyIDs := make([]string, 0, len(r.quarantined))
+	for policyID := range r.quarantined {
+		policyIDs = append(policyIDs, policyID)
+	}
+	sort.Strings(policyIDs)
+
+	message := r.message
+	quarantined := make([]map[string]interface{}, 0, len(policyIDs))
+	for _, policyID := range policyIDs {
+		q := r.quarantined[policyID]
+		message += fmt.Sprintf("; policy %s revision %d failed validation: %s", policyID, q.policy.RevisionIdx, q.err)
+		quarantined = append(quarantined, map[string]interface{}{
+			"policy_id":       policyID,
+			"revision_idx":    q.policy.RevisionIdx,
+			"coordinator_idx": q.policy.CoordinatorIdx,
+			"error":           q.err,
+		})
+	}
+	payload := make(map[string]interface{}, len(r.payload)+1)
+	for k, v := range r.payload {
+		payload[k] = v
+	}
+	payload["quarantined_policies"] = quarantined
+	return r.reporter.UpdateState(client.UnitStateDegraded, message, payload)
+}
+
+// quarantine holds back a policy revision that failed validation; agents stay on the last good
+// revision of the policy. The failure degrades the state reported by the self monitor until the
+// quarantine is released and is recorded on the revision document so that it can be shown in Kibana.
+func (m *monitorT) quarantine(ctx context.Context, policy model.Policy, err error) {
+	if q, ok := m.quarantined[policy.PolicyID]; ok && q.RevisionIdx == policy.RevisionIdx && q.CoordinatorIdx == policy.CoordinatorIdx {
+		return
+	}
+	m.quarantined[policy.PolicyID] = policy
+
+	zlog := m.log.With().
+		Str(logger.PolicyID, policy.PolicyID).
+		Int64("rev", policy.RevisionIdx).
+		Int64("coord", policy.CoordinatorIdx).
+		Logger()
+	zlog.Error().Err(err).Msg("Policy revision failed validation and is quarantined")
+
+	if m.reporter != nil {
+		m.reporter.quarantine(policy, err)
+	}
+
+	if policy.Id != "" && policy.ValidationError != err.Error() {
+		if err := dl.SetPolicyValidationError(ctx, m.bulker, policy.Id, err.Error(), dl.WithIndexName(m.policiesIndex)); err != nil {
+			zlog.Warn().Err(err).Msg("unable to record validation error on policy revision")
+		}
+	}
+}
+
+// release clears the quarantine of a policy once a valid revision has been received.
+func (m *monitorT) release(policy model.Policy) {
+	q, ok := m.quarantined[policy.PolicyID]
+	if !ok {
+		return
+	}
+	delete(m.quarantined, policy.PolicyID)
+	if m.reporter != nil {
+		m.reporter.release(policy.PolicyID)
+	}
+
+	m.log.Info().
+		Str(logger.PolicyID, policy.PolicyID).
+		Int64("rev", policy.RevisionIdx).
+		Int64("coord", policy.CoordinatorIdx).
+		Int64("quarantinedRev", q.RevisionIdx).
+		Int64("quarantinedCoord", q.CoordinatorIdx).
+		Msg("Valid policy revision received, quarantine released")
+}
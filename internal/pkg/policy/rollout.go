@@ -0,0 +1,526 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+/*
+The state of a rollout is kept in the policy rollout document of the revision, so that it
+survives a restart and applies to all fleet-servers. The document is created when the rollout
+starts, without overwriting the document of a rollout started by another fleet-server, and set
+on every change of state. Each change increments the sequence number of the rollout; a document
+received from the policy rollout index monitor is applied only if its sequence number is higher
+than the one of the rollout, so a fleet-server does not apply its own changes again. The rollout
+of the latest revision is restored from its document on the initial load of the policies.
+*/
+
+type rolloutState int
+
+const (
+	rolloutCanary rolloutState = iota
+	rolloutReleased
+	rolloutHalted
+	rolloutAborted
+)
+
+// ErrRolloutNotHalted is returned when resuming or aborting the rollout of a policy that is not halted.
+var ErrRolloutNotHalted = errors.New("policy rollout is not halted")
+
+func parseRolloutState(s string) (rolloutState, bool) {
+	for _, state := range []rolloutState{rolloutCanary, rolloutReleased, rolloutHalted, rolloutAborted} {
+		if state.String() == s {
+			return state, true
+		}
+	}
+	return 0, false
+}
+
+func (s rolloutState) String() string {
+	switch s {
+	case rolloutCanary:
+		return "canary"
+	case rolloutReleased:
+		return "released"
+	case rolloutHalted:
+		return "halted"
+	case rolloutAborted:
+		return "aborted"
+	default:
+		return "unknown"
+	}
+}
+
+// rolloutT tracks the delivery of the latest revision of a policy to the canary agents
+// before it is released to the remaining subscriptions. The subscriptions held by the
+// rollout receive the last released revision instead.
+type rolloutT struct {
+	cfg      config.PolicyRollout
+	revIdx   int64
+	coordIdx int64
+	state    rolloutState
+	timer    *time.Timer
+
+	// number of changes of state, shared with the other fleet-servers by the policy rollout document
+	seq       int64
+	soakUntil time.Time
+
+	// last released revision of the policy
+	good *ParsedPolicy
+
+	// agents that the revision has been scheduled for during the canary phase
+	canaries map[string]struct{}
+}
+
+// isCanary returns true if the subscription belongs to the canary set, either by
+// one of its tags or by the agent ID falling within the canary percentage.
+func (r *rolloutT) isCanary(s *subT) bool {
+	for _, tag := range s.tags {
+		for _, ct := range r.cfg.CanaryTags {
+			if tag == ct {
+				return true
+			}
+		}
+	}
+	if r.cfg.CanaryPercent > 0 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(s.agentID))
+		return int(h.Sum32()%100) < r.cfg.CanaryPercent
+	}
+	return false
+}
+
+// holds returns true if delivery of the revision to the subscription has to wait for the rollout.
+// Safe to call on a nil rollout; the caller must hold the monitor lock.
+func (r *rolloutT) holds(s *subT) bool {
+	if r == nil || r.state == rolloutReleased {
+		return false
+	}
+	if r.state == rolloutCanary && r.isCanary(s) {
+		r.canaries[s.agentID] = struct{}{}
+		return false
+	}
+	return true
+}
+
+// revision returns the revision delivered to the subscription, the latest revision unless the
+// rollout holds the subscription, in which case it is the last released revision.
+// Safe to call on a nil rollout; the caller must hold the monitor lock.
+func (r *rolloutT) revision(latest *ParsedPolicy, s *subT) *ParsedPolicy {
+	if r.holds(s) {
+		return r.good
+	}
+	return latest
+}
+
+// rollsBack returns true if the rollout was aborted and the last released revision is delivered to
+// all subscriptions, including the canary agents that run a later revision.
+func (r *rolloutT) rollsBack() bool {
+	return r != nil && r.state == rolloutAborted
+}
+
+func (r *rolloutT) stop() {
+	if r != nil && r.timer != nil {
+		r.timer.Stop()
+	}
+}
+
+// doc returns the policy rollout document of the rollout.
+func (r *rolloutT) doc(policyID string) model.PolicyRollout {
+	return model.PolicyRollout{
+		PolicyID:           policyID,
+		RevisionIdx:        r.revIdx,
+		CoordinatorIdx:     r.coordIdx,
+		State:              r.state.String(),
+		Seq:                r.seq,
+		SoakUntil:          r.soakUntil.UTC().Format(time.RFC3339Nano),
+		GoodRevisionIdx:    r.good.Policy.RevisionIdx,
+		GoodCoordinatorIdx: r.good.Policy.CoordinatorIdx,
+		Timestamp:          time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+type policyRolloutFetcher func(ctx context.Context, bulker bulk.Bulk, policyID string, revisionIdx, coordinatorIdx int64, opt ...dl.Option) (model.PolicyRollout, error)
+
+type policyRolloutWriter func(ctx context.Context, bulker bulk.Bulk, rollout model.PolicyRollout, opt ...dl.Option) error
+
+type rolloutSave struct {
+	doc    model.PolicyRollout
+	create bool
+}
+
+// startRollout begins the rollout of a new revision that replaces the old latest revision,
+// replacing any rollout in progress. The rollout in progress is kept if the policy document
+// was updated without a new revision.
+// Returns nil if no rollout is configured for the policy or if there is no old revision to
+// deliver while the new one soaks, as on the initial load of the policies, so that a restart
+// does not start a new soak time; the rollout in progress is restored from its document instead.
+func (m *monitorT) startRollout(policy *model.Policy, old *ParsedPolicy, prev *rolloutT) *rolloutT {
+	if old != nil && isRevision(&old.Policy, policy.RevisionIdx, policy.CoordinatorIdx) {
+		return prev
+	}
+	if prev != nil && prev.revIdx == policy.RevisionIdx && prev.coordIdx == policy.CoordinatorIdx {
+		return prev
+	}
+	prev.stop()
+
+	cfg, ok := m.rollouts[policy.PolicyID]
+	if !ok || old == nil || old.Policy.CoordinatorIdx <= 0 {
+		return nil
+	}
+
+	// the revision of a rollout in progress was never released
+	good := old
+	if prev != nil && prev.state != rolloutReleased {
+		good = prev.good
+	}
+
+	r := &rolloutT{
+		cfg:       cfg,
+		revIdx:    policy.RevisionIdx,
+		coordIdx:  policy.CoordinatorIdx,
+		state:     rolloutCanary,
+		soakUntil: time.Now().Add(cfg.SoakTime),
+		good:      good,
+		canaries:  make(map[string]struct{}),
+	}
+	m.soakRollout(policy.PolicyID, r)
+	m.saveRollout(policy.PolicyID, r, true)
+
+	m.log.Info().
+		Str(logger.PolicyID, policy.PolicyID).
+		Int64("rev", r.revIdx).
+		Int64("coord", r.coordIdx).
+		Strs("canaryTags", cfg.CanaryTags).
+		Int("canaryPercent", cfg.CanaryPercent).
+		Dur("soakTime", cfg.SoakTime).
+		Int64("goodRev", good.Policy.RevisionIdx).
+		Int64("goodCoord", good.Policy.CoordinatorIdx).
+		Msg("Starting canary rollout of policy revision")
+
+	return r
+}
+
+// soakRollout releases the rollout once its soak time has passed.
+func (m *monitorT) soakRollout(policyID string, r *rolloutT) {
+	r.timer = time.AfterFunc(time.Until(r.soakUntil), func() {
+		m.releaseRollout(policyID, r)
+	})
+}
+
+// releaseRollout schedules the remaining subscriptions once the canary soak time has passed.
+func (m *monitorT) releaseRollout(policyID string, r *rolloutT) {
+	m.mut.Lock()
+	p, ok := m.policies[policyID]
+	if !ok || p.rollout != r || r.state != rolloutCanary {
+		m.mut.Unlock()
+		return
+	}
+	r.state = rolloutReleased
+	r.seq++
+	m.saveRollout(policyID, r, false)
+	nQueued := m.queueUpdates(p)
+	m.mut.Unlock()
+
+	m.log.Info().
+		Str(logger.PolicyID, policyID).
+		Int64("rev", r.revIdx).
+		Int64("coord", r.coordIdx).
+		Int("nCanaries", len(r.canaries)).
+		Int("nQueued", nQueued).
+		Msg("Canary soak time passed, releasing policy revision")
+
+	if nQueued > 0 {
+		m.kickDeploy()
+	}
+}
+
+// ReportFailure reports that an agent failed to apply or run a policy revision.
+// If the agent is a canary for the revision currently being rolled out the rollout is halted.
+func (m *monitorT) ReportFailure(agentID string, policyID string, revisionIdx int64, coordinatorIdx int64) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p, ok := m.policies[policyID]
+	if !ok {
+		return
+	}
+	r := p.rollout
+	if r == nil || r.state != rolloutCanary || r.revIdx != revisionIdx || r.coordIdx != coordinatorIdx {
+		return
+	}
+	if _, ok := r.canaries[agentID]; !ok {
+		return
+	}
+
+	r.state = rolloutHalted
+	r.seq++
+	r.stop()
+	m.saveRollout(policyID, r, false)
+
+	m.log.Error().
+		Str(logger.AgentID, agentID).
+		Str(logger.PolicyID, policyID).
+		Int64("rev", revisionIdx).
+		Int64("coord", coordinatorIdx).
+		Int("nCanaries", len(r.canaries)).
+		Msg("Canary agent reported a failure, halting rollout of policy revision")
+}
+
+// ResumeRollout resumes the canary phase of a halted rollout of a policy, the revision is
+// released to the remaining subscriptions once the soak time has passed again.
+func (m *monitorT) ResumeRollout(policyID string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	r := m.policies[policyID].rollout
+	if r == nil || r.state != rolloutHalted {
+		return ErrRolloutNotHalted
+	}
+	r.state = rolloutCanary
+	r.seq++
+	r.soakUntil = time.Now().Add(r.cfg.SoakTime)
+	m.soakRollout(policyID, r)
+	m.saveRollout(policyID, r, false)
+
+	m.log.Info().
+		Str(logger.PolicyID, policyID).
+		Int64("rev", r.revIdx).
+		Int64("coord", r.coordIdx).
+		Dur("soakTime", r.cfg.SoakTime).
+		Msg("Resuming halted rollout of policy revision")
+	return nil
+}
+
+// AbortRollout aborts a halted rollout of a policy, the canary agents are rolled back to the
+// last released revision that the other subscriptions keep receiving until a new revision.
+func (m *monitorT) AbortRollout(policyID string) error {
+	m.mut.Lock()
+	p, ok := m.policies[policyID]
+	r := p.rollout
+	if !ok || r == nil || r.state != rolloutHalted {
+		m.mut.Unlock()
+		return ErrRolloutNotHalted
+	}
+	r.state = rolloutAborted
+	r.seq++
+	m.saveRollout(policyID, r, false)
+	nQueued := m.queueUpdates(p)
+	m.mut.Unlock()
+
+	m.log.Warn().
+		Str(logger.PolicyID, policyID).
+		Int64("rev", r.revIdx).
+		Int64("coord", r.coordIdx).
+		Int64("goodRev", r.good.Policy.RevisionIdx).
+		Int64("goodCoord", r.good.Policy.CoordinatorIdx).
+		Int("nQueued", nQueued).
+		Msg("Aborted halted rollout of policy revision, rolling back canary agents")
+
+	if nQueued > 0 {
+		m.kickDeploy()
+	}
+	return nil
+}
+
+// saveRollout schedules the policy rollout document of the rollout to be written, it is created
+// unless the rollout changed state. The caller must hold the monitor lock.
+func (m *monitorT) saveRollout(policyID string, r *rolloutT, create bool) {
+	if m.rolloutMonitor == nil {
+		return
+	}
+	doc := r.doc(policyID)
+	id := dl.PolicyRolloutID(policyID, r.revIdx, r.coordIdx)
+	if prev, ok := m.rolloutSaves[id]; ok {
+		create = create && prev.create
+	}
+	m.rolloutSaves[id] = rolloutSave{doc: doc, create: create}
+
+	select {
+	case m.saveCh <- struct{}{}:
+	default:
+	}
+}
+
+// saveRollouts writes the scheduled policy rollout documents. A rollout that was created by another
+// fleet-server takes the state of its document.
+func (m *monitorT) saveRollouts(ctx context.Context) {
+	m.mut.Lock()
+	saves := m.rolloutSaves
+	m.rolloutSaves = make(map[string]rolloutSave)
+	m.mut.Unlock()
+
+	for _, save := range saves {
+		zlog := m.log.With().
+			Str(logger.PolicyID, save.doc.PolicyID).
+			Int64("rev", save.doc.RevisionIdx).
+			Int64("coord", save.doc.CoordinatorIdx).
+			Str("state", save.doc.State).
+			Logger()
+
+		if !save.create {
+			if err := m.rolloutSetF(ctx, m.bulker, save.doc, dl.WithIndexName(m.policyRolloutsIndex)); err != nil {
+				zlog.Error().Err(err).Msg("failed to save policy rollout state")
+			}
+			continue
+		}
+
+		err := m.rolloutCreateF(ctx, m.bulker, save.doc, dl.WithIndexName(m.policyRolloutsIndex))
+		if errors.Is(err, dl.ErrPolicyRolloutExists) {
+			var doc model.PolicyRollout
+			doc, err = m.rolloutF(ctx, m.bulker, save.doc.PolicyID, save.doc.RevisionIdx, save.doc.CoordinatorIdx, dl.WithIndexName(m.policyRolloutsIndex))
+			if err == nil {
+				m.applyRollout(doc)
+			}
+		}
+		if err != nil {
+			zlog.Error().Err(err).Msg("failed to save policy rollout state")
+		}
+	}
+}
+
+// processPolicyRolloutHits applies the policy rollout documents changed since the policies were loaded.
+func (m *monitorT) processPolicyRolloutHits(hits []es.HitT) error {
+	for _, hit := range hits {
+		var doc model.PolicyRollout
+		if err := hit.Unmarshal(&doc); err != nil {
+			return err
+		}
+		m.applyRollout(doc)
+	}
+	return nil
+}
+
+// applyRollout sets the state of the rollout in progress to the state of its policy rollout document
+// if the document is more recent than the rollout.
+func (m *monitorT) applyRollout(doc model.PolicyRollout) {
+	state, ok := parseRolloutState(doc.State)
+	if !ok {
+		return
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p, ok := m.policies[doc.PolicyID]
+	r := p.rollout
+	if !ok || r == nil || r.revIdx != doc.RevisionIdx || r.coordIdx != doc.CoordinatorIdx || doc.Seq <= r.seq {
+		return
+	}
+
+	prev := r.state
+	r.stop()
+	r.state = state
+	r.seq = doc.Seq
+
+	nQueued := 0
+	switch state {
+	case rolloutCanary:
+		if soakUntil, err := time.Parse(time.RFC3339Nano, doc.SoakUntil); err == nil {
+			r.soakUntil = soakUntil
+		}
+		m.soakRollout(doc.PolicyID, r)
+	case rolloutReleased, rolloutAborted:
+		nQueued = m.queueUpdates(p)
+		if nQueued > 0 {
+			m.kickDeploy()
+		}
+	}
+
+	m.log.Info().
+		Str(logger.PolicyID, doc.PolicyID).
+		Int64("rev", r.revIdx).
+		Int64("coord", r.coordIdx).
+		Stringer("prevState", prev).
+		Stringer("state", state).
+		Int("nQueued", nQueued).
+		Msg("Policy rollout state changed by another fleet-server")
+}
+
+// restoreRollout restores the rollout of the latest revision of a policy that is not loaded yet
+// from its policy rollout document, so that a restart neither releases a halted revision nor
+// skips the soak time. A revision without a rollout document is delivered to all subscriptions.
+func (m *monitorT) restoreRollout(ctx context.Context, policy model.Policy) {
+	cfg, ok := m.rollouts[policy.PolicyID]
+	if m.rolloutMonitor == nil || !ok {
+		return
+	}
+	m.mut.Lock()
+	loaded := m.policies[policy.PolicyID].pp.Policy.CoordinatorIdx > 0
+	m.mut.Unlock()
+	if loaded {
+		return
+	}
+
+	zlog := m.log.With().
+		Str(logger.PolicyID, policy.PolicyID).
+		Int64("rev", policy.RevisionIdx).
+		Int64("coord", policy.CoordinatorIdx).
+		Logger()
+
+	doc, err := m.rolloutF(ctx, m.bulker, policy.PolicyID, policy.RevisionIdx, policy.CoordinatorIdx, dl.WithIndexName(m.policyRolloutsIndex))
+	if errors.Is(err, dl.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		zlog.Error().Err(err).Msg("failed to load policy rollout, delivering revision to all agents")
+		return
+	}
+	state, ok := parseRolloutState(doc.State)
+	if !ok || state == rolloutReleased {
+		return
+	}
+
+	var good *ParsedPolicy
+	goodPolicy, err := m.revisionF(ctx, m.bulker, policy.PolicyID, doc.GoodRevisionIdx, dl.WithIndexName(m.policiesIndex))
+	if err == nil {
+		good, err = NewParsedPolicy(goodPolicy)
+	}
+	if err != nil {
+		zlog.Error().Err(err).Int64("goodRev", doc.GoodRevisionIdx).Msg("failed to load released policy revision of rollout, delivering revision to all agents")
+		return
+	}
+
+	r := &rolloutT{
+		cfg:      cfg,
+		revIdx:   doc.RevisionIdx,
+		coordIdx: doc.CoordinatorIdx,
+		state:    state,
+		seq:      doc.Seq,
+		good:     good,
+		canaries: make(map[string]struct{}),
+	}
+	r.soakUntil, _ = time.Parse(time.RFC3339Nano, doc.SoakUntil)
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	p, ok := m.policies[policy.PolicyID]
+	if !ok {
+		p = policyT{head: makeHead()}
+	}
+	if state == rolloutCanary {
+		m.soakRollout(policy.PolicyID, r)
+	}
+	p.rollout = r
+	m.policies[policy.PolicyID] = p
+
+	zlog.Info().
+		Stringer("state", state).
+		Time("soakUntil", r.soakUntil).
+		Int64("goodRev", good.Policy.RevisionIdx).
+		Int64("goodCoord", good.Policy.CoordinatorIdx).
+		Msg("Restored rollout of policy revision")
+}
@@ -0,0 +1,340 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/config"
+	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	mmock "github.com/elastic/fleet-server/v7/internal/pkg/monitor/mock"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+func newRolloutTestMonitor(t *testing.T, soak time.Duration) *monitorT {
+	t.Helper()
+	_ = testlog.SetLogger(t)
+	m := NewMonitor(ftesting.NewMockBulk(), mmock.NewMockMonitor(), 0, WithRollouts([]config.PolicyRollout{{
+		PolicyID:   "policy",
+		CanaryTags: []string{"canary"},
+		SoakTime:   soak,
+	}}))
+	return m.(*monitorT)
+}
+
+func updateTestPolicy(t *testing.T, m *monitorT, rev int64) {
+	t.Helper()
+	pp, err := NewParsedPolicy(model.Policy{PolicyID: "policy", RevisionIdx: rev, CoordinatorIdx: 1, Data: policyBytes})
+	require.NoError(t, err)
+	m.updatePolicy(pp)
+}
+
+func dispatchAll(m *monitorT) {
+	for !m.dispatchPending() {
+	}
+}
+
+func currentRolloutState(m *monitorT) rolloutState {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.policies["policy"].rollout.state
+}
+
+func received(s Subscription) bool {
+	select {
+	case <-s.Output():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestRolloutCanaryFirst(t *testing.T) {
+	m := newRolloutTestMonitor(t, 50*time.Millisecond)
+	updateTestPolicy(t, m, 1)
+
+	canary, err := m.Subscribe("agent-canary", "policy", 1, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+	other, err := m.Subscribe("agent-other", "policy", 1, 1, WithAgentTags("other"))
+	require.NoError(t, err)
+
+	updateTestPolicy(t, m, 2)
+	dispatchAll(m)
+	assert.True(t, received(canary), "canary receives the revision first")
+	assert.False(t, received(other), "other agents wait for the soak time")
+
+	// subscribing during the canary phase is held as well
+	late, err := m.Subscribe("agent-late", "policy", 1, 1)
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.False(t, received(late))
+
+	require.Eventually(t, func() bool {
+		dispatchAll(m)
+		return received(other)
+	}, time.Second, 10*time.Millisecond, "revision is released after the soak time")
+	assert.True(t, received(late))
+}
+
+func TestRolloutCanaryPercent(t *testing.T) {
+	r := &rolloutT{cfg: config.PolicyRollout{CanaryPercent: 100}}
+	assert.True(t, r.isCanary(&subT{agentID: "a"}))
+	r.cfg.CanaryPercent = 0
+	assert.False(t, r.isCanary(&subT{agentID: "a"}))
+
+	r.cfg.CanaryPercent = 50
+	n := 0
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		if r.isCanary(&subT{agentID: id}) {
+			n++
+		}
+		assert.Equal(t, r.isCanary(&subT{agentID: id}), r.isCanary(&subT{agentID: id}), "selection is stable")
+	}
+	assert.Greater(t, n, 0)
+	assert.Less(t, n, 10)
+}
+
+func TestRolloutHaltedOnCanaryFailure(t *testing.T) {
+	m := newRolloutTestMonitor(t, 50*time.Millisecond)
+	updateTestPolicy(t, m, 1)
+
+	canary, err := m.Subscribe("agent-canary", "policy", 1, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+	other, err := m.Subscribe("agent-other", "policy", 1, 1)
+	require.NoError(t, err)
+
+	updateTestPolicy(t, m, 2)
+	dispatchAll(m)
+	require.True(t, received(canary))
+
+	// failures from other agents or for other revisions are ignored
+	m.ReportFailure("agent-other", "policy", 2, 1)
+	m.ReportFailure("agent-canary", "policy", 1, 1)
+	assert.Equal(t, rolloutCanary, currentRolloutState(m))
+
+	m.ReportFailure("agent-canary", "policy", 2, 1)
+	assert.Equal(t, rolloutHalted, currentRolloutState(m))
+
+	time.Sleep(100 * time.Millisecond)
+	dispatchAll(m)
+	assert.False(t, received(other), "halted rollout is not released")
+
+	// a new revision starts a new rollout
+	updateTestPolicy(t, m, 3)
+	assert.Equal(t, rolloutCanary, currentRolloutState(m))
+}
+
+func TestRolloutSkippedOnInitialLoad(t *testing.T) {
+	m := newRolloutTestMonitor(t, time.Hour)
+	updateTestPolicy(t, m, 5)
+
+	m.mut.Lock()
+	assert.Nil(t, m.policies["policy"].rollout, "no soak time on the initial load")
+	m.mut.Unlock()
+
+	s, err := m.Subscribe("agent", "policy", 4, 1)
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.True(t, received(s))
+}
+
+func TestRolloutHeldAgentsReceiveReleasedRevision(t *testing.T) {
+	m := newRolloutTestMonitor(t, time.Hour)
+	updateTestPolicy(t, m, 1)
+	updateTestPolicy(t, m, 2)
+
+	// a new enrollment is not left without a policy while the revision soaks
+	s, err := m.Subscribe("agent-new", "policy", 0, 0)
+	require.NoError(t, err)
+	dispatchAll(m)
+	select {
+	case pp := <-s.Output():
+		assert.Equal(t, int64(1), pp.Policy.RevisionIdx)
+	default:
+		t.Fatal("held agent did not receive the released revision")
+	}
+
+	// a revision replacing an unreleased rollout keeps the released revision
+	updateTestPolicy(t, m, 3)
+	s, err = m.Subscribe("agent-other", "policy", 0, 0)
+	require.NoError(t, err)
+	dispatchAll(m)
+	select {
+	case pp := <-s.Output():
+		assert.Equal(t, int64(1), pp.Policy.RevisionIdx)
+	default:
+		t.Fatal("held agent did not receive the released revision")
+	}
+}
+
+func TestRolloutResume(t *testing.T) {
+	m := newRolloutTestMonitor(t, 50*time.Millisecond)
+	updateTestPolicy(t, m, 1)
+	assert.ErrorIs(t, m.ResumeRollout("policy"), ErrRolloutNotHalted)
+
+	canary, err := m.Subscribe("agent-canary", "policy", 1, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+	other, err := m.Subscribe("agent-other", "policy", 1, 1)
+	require.NoError(t, err)
+
+	updateTestPolicy(t, m, 2)
+	dispatchAll(m)
+	require.True(t, received(canary))
+	m.ReportFailure("agent-canary", "policy", 2, 1)
+	require.Equal(t, rolloutHalted, currentRolloutState(m))
+
+	require.NoError(t, m.ResumeRollout("policy"))
+	assert.Equal(t, rolloutCanary, currentRolloutState(m))
+	require.Eventually(t, func() bool {
+		dispatchAll(m)
+		return received(other)
+	}, time.Second, 10*time.Millisecond, "resumed revision is released after the soak time")
+}
+
+func TestRolloutAbort(t *testing.T) {
+	m := newRolloutTestMonitor(t, time.Hour)
+	updateTestPolicy(t, m, 1)
+	assert.ErrorIs(t, m.AbortRollout("policy"), ErrRolloutNotHalted)
+	assert.ErrorIs(t, m.AbortRollout("unknown"), ErrRolloutNotHalted)
+
+	canary, err := m.Subscribe("agent-canary", "policy", 1, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+
+	updateTestPolicy(t, m, 2)
+	dispatchAll(m)
+	require.True(t, received(canary))
+	m.ReportFailure("agent-canary", "policy", 2, 1)
+
+	canary, err = m.Subscribe("agent-canary", "policy", 2, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.False(t, received(canary), "halted rollout keeps the canary revision")
+
+	require.NoError(t, m.AbortRollout("policy"))
+	assert.Equal(t, rolloutAborted, currentRolloutState(m))
+	dispatchAll(m)
+	select {
+	case pp := <-canary.Output():
+		assert.Equal(t, int64(1), pp.Policy.RevisionIdx, "canary is rolled back")
+	default:
+		t.Fatal("canary was not rolled back")
+	}
+
+	// a new revision starts a new rollout
+	updateTestPolicy(t, m, 3)
+	assert.Equal(t, rolloutCanary, currentRolloutState(m))
+}
+
+// withRolloutStore makes the monitor keep the policy rollout documents in the returned map.
+func withRolloutStore(m *monitorT) map[string]model.PolicyRollout {
+	store := make(map[string]model.PolicyRollout)
+	m.rolloutMonitor = mmock.NewMockMonitor()
+	m.rolloutF = func(_ context.Context, _ bulk.Bulk, policyID string, revIdx, coordIdx int64, _ ...dl.Option) (model.PolicyRollout, error) {
+		doc, ok := store[dl.PolicyRolloutID(policyID, revIdx, coordIdx)]
+		if !ok {
+			return model.PolicyRollout{}, dl.ErrNotFound
+		}
+		return doc, nil
+	}
+	m.rolloutCreateF = func(_ context.Context, _ bulk.Bulk, doc model.PolicyRollout, _ ...dl.Option) error {
+		id := dl.PolicyRolloutID(doc.PolicyID, doc.RevisionIdx, doc.CoordinatorIdx)
+		if _, ok := store[id]; ok {
+			return dl.ErrPolicyRolloutExists
+		}
+		store[id] = doc
+		return nil
+	}
+	m.rolloutSetF = func(_ context.Context, _ bulk.Bulk, doc model.PolicyRollout, _ ...dl.Option) error {
+		store[dl.PolicyRolloutID(doc.PolicyID, doc.RevisionIdx, doc.CoordinatorIdx)] = doc
+		return nil
+	}
+	m.revisionF = func(_ context.Context, _ bulk.Bulk, policyID string, revIdx int64, _ ...dl.Option) (model.Policy, error) {
+		return model.Policy{PolicyID: policyID, RevisionIdx: revIdx, CoordinatorIdx: 1, Data: policyBytes}, nil
+	}
+	return store
+}
+
+func TestRolloutStateSaved(t *testing.T) {
+	m := newRolloutTestMonitor(t, time.Hour)
+	store := withRolloutStore(m)
+	updateTestPolicy(t, m, 1)
+
+	canary, err := m.Subscribe("agent-canary", "policy", 1, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+	updateTestPolicy(t, m, 2)
+	m.saveRollouts(context.Background())
+
+	doc := store[dl.PolicyRolloutID("policy", 2, 1)]
+	assert.Equal(t, "canary", doc.State)
+	assert.Equal(t, int64(0), doc.Seq)
+	assert.Equal(t, int64(1), doc.GoodRevisionIdx)
+	assert.NotEmpty(t, doc.SoakUntil)
+
+	dispatchAll(m)
+	require.True(t, received(canary))
+	m.ReportFailure("agent-canary", "policy", 2, 1)
+	m.saveRollouts(context.Background())
+
+	doc = store[dl.PolicyRolloutID("policy", 2, 1)]
+	assert.Equal(t, "halted", doc.State)
+	assert.Equal(t, int64(1), doc.Seq)
+}
+
+func TestRolloutRestoredOnLoad(t *testing.T) {
+	m := newRolloutTestMonitor(t, time.Hour)
+	store := withRolloutStore(m)
+	store[dl.PolicyRolloutID("policy", 2, 1)] = model.PolicyRollout{
+		PolicyID:           "policy",
+		RevisionIdx:        2,
+		CoordinatorIdx:     1,
+		State:              "halted",
+		Seq:                1,
+		GoodRevisionIdx:    1,
+		GoodCoordinatorIdx: 1,
+	}
+
+	require.NoError(t, m.processPolicies(context.Background(), []model.Policy{{PolicyID: "policy", RevisionIdx: 2, CoordinatorIdx: 1, Data: policyBytes}}))
+	assert.Equal(t, rolloutHalted, currentRolloutState(m), "halted rollout is restored on the initial load")
+
+	s, err := m.Subscribe("agent", "policy", 0, 0)
+	require.NoError(t, err)
+	dispatchAll(m)
+	assert.Equal(t, int64(1), receivedRevision(t, s), "halted revision is not delivered after a restart")
+}
+
+func TestRolloutStateFromOtherServer(t *testing.T) {
+	m := newRolloutTestMonitor(t, time.Hour)
+	store := withRolloutStore(m)
+	updateTestPolicy(t, m, 1)
+
+	canary, err := m.Subscribe("agent-canary", "policy", 1, 1, WithAgentTags("canary"))
+	require.NoError(t, err)
+
+	// another fleet-server started the rollout and halted it
+	store[dl.PolicyRolloutID("policy", 2, 1)] = model.PolicyRollout{PolicyID: "policy", RevisionIdx: 2, CoordinatorIdx: 1, State: "halted", Seq: 1, GoodRevisionIdx: 1, GoodCoordinatorIdx: 1}
+	updateTestPolicy(t, m, 2)
+	m.saveRollouts(context.Background())
+	assert.Equal(t, rolloutHalted, currentRolloutState(m), "rollout takes the state of the existing document")
+
+	// an earlier or own change of state is not applied again
+	m.applyRollout(model.PolicyRollout{PolicyID: "policy", RevisionIdx: 2, CoordinatorIdx: 1, State: "canary", Seq: 1})
+	assert.Equal(t, rolloutHalted, currentRolloutState(m))
+
+	dispatchAll(m)
+	assert.Equal(t, int64(0), receivedRevision(t, canary), "halted revision is not delivered")
+
+	m.applyRollout(model.PolicyRollout{PolicyID: "policy", RevisionIdx: 2, CoordinatorIdx: 1, State: "aborted", Seq: 2})
+	assert.Equal(t, rolloutAborted, currentRolloutState(m))
+}
@@ -13,6 +13,10 @@ type subT struct {
 	agentID  string // not logically necessary; cached for logging
 	revIdx   int64
 	coordIdx int64
+	tags     []string
+
+	// revision index the agent is pinned to, 0 if it follows the policy
+	pinnedRevIdx int64
 
 	next *subT
 	prev *subT
@@ -20,14 +24,35 @@ type subT struct {
 	ch chan *ParsedPolicy
 }
 
-func NewSub(policyID, agentID string, revIdx, coordIdx int64) *subT {
-	return &subT{
+// SubscribeOpt is an option for a policy subscription.
+type SubscribeOpt func(*subT)
+
+// WithAgentTags sets the tags of the subscribing agent; they are used to select canary agents.
+func WithAgentTags(tags ...string) SubscribeOpt {
+	return func(s *subT) {
+		s.tags = tags
+	}
+}
+
+// WithPinnedRevision pins the subscription to a revision of the policy; 0 follows the policy.
+func WithPinnedRevision(revIdx int64) SubscribeOpt {
+	return func(s *subT) {
+		s.pinnedRevIdx = revIdx
+	}
+}
+
+func NewSub(policyID, agentID string, revIdx, coordIdx int64, opts ...SubscribeOpt) *subT {
+	s := &subT{
 		policyID: policyID,
 		agentID:  agentID,
 		revIdx:   revIdx,
 		coordIdx: coordIdx,
 		ch:       make(chan *ParsedPolicy, 1),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func makeHead() *subT {
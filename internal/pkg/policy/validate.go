@@ -0,0 +1,54 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+)
+
+var (
+	ErrInvalidPolicy       = errors.New("invalid policy")
+	ErrPolicyIDMissing     = errors.New("policy_id is missing")
+	ErrPolicyDataMissing   = errors.New("policy data is missing")
+	ErrUnknownOutputType   = errors.New("unknown output type")
+	ErrOutputPermsNotFound = errors.New("output permissions not found")
+)
+
+// ValidatePolicy checks that a policy revision can be delivered to agents and returns the parsed policy.
+//
+// In addition to the checks done when parsing the policy; the outputs, default output and output
+// permissions, every output must be of a known type and elasticsearch outputs must have permissions
+// in order to generate their API keys. All errors wrap ErrInvalidPolicy.
+func ValidatePolicy(p model.Policy) (*ParsedPolicy, error) {
+	if p.PolicyID == "" {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, ErrPolicyIDMissing)
+	}
+	if len(p.Data) == 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, ErrPolicyDataMissing)
+	}
+
+	pp, err := NewParsedPolicy(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+
+	for _, name := range sortedKeys(pp.Outputs) {
+		output := pp.Outputs[name]
+		switch output.Type {
+		case OutputTypeElasticsearch:
+			if output.Role == nil {
+				return nil, fmt.Errorf("%w: output %q: %w", ErrInvalidPolicy, name, ErrOutputPermsNotFound)
+			}
+		case OutputTypeLogstash:
+		default:
+			return nil, fmt.Errorf("%w: output %q: %w %q", ErrInvalidPolicy, name, ErrUnknownOutputType, output.Type)
+		}
+	}
+
+	return pp, nil
+}
@@ -0,0 +1,158 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elastic/elastic-agent-client/v7/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/fleet-server/v7/internal/pkg/model"
+	mmock "github.com/elastic/fleet-server/v7/internal/pkg/monitor/mock"
+	ftesting "github.com/elastic/fleet-server/v7/internal/pkg/testing"
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy model.Policy
+		err    error
+	}{{
+		name:   "valid",
+		policy: model.Policy{PolicyID: "p", Data: policyBytes},
+	}, {
+		name:   "valid logstash",
+		policy: model.Policy{PolicyID: "p", Data: []byte(`{"outputs":{"default":{"type":"logstash"}}}`)},
+	}, {
+		name:   "missing policy id",
+		policy: model.Policy{Data: policyBytes},
+		err:    ErrPolicyIDMissing,
+	}, {
+		name:   "missing data",
+		policy: model.Policy{PolicyID: "p"},
+		err:    ErrPolicyDataMissing,
+	}, {
+		name:   "missing outputs",
+		policy: model.Policy{PolicyID: "p", Data: []byte(`{"inputs":[]}`)},
+		err:    ErrOutputsNotFound,
+	}, {
+		name:   "no default output",
+		policy: model.Policy{PolicyID: "p", Data: []byte(`{"outputs":{}}`)},
+		err:    ErrDefaultOutputNotFound,
+	}, {
+		name:   "missing permissions",
+		policy: model.Policy{PolicyID: "p", Data: []byte(`{"outputs":{"default":{"type":"elasticsearch"}}}`)},
+		err:    ErrOutputPermsNotFound,
+	}, {
+		name:   "unknown output type",
+		policy: model.Policy{PolicyID: "p", Data: []byte(`{"outputs":{"default":{"type":"elasticsearch"},"other":{"type":"unknown"}},"output_permissions":{"default":{}}}`)},
+		err:    ErrUnknownOutputType,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pp, err := ValidatePolicy(tc.policy)
+			if tc.err == nil {
+				require.NoError(t, err)
+				assert.NotNil(t, pp)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidPolicy)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Nil(t, pp)
+		})
+	}
+}
+
+type mockReporter struct {
+	mock.Mock
+}
+
+func (r *mockReporter) UpdateState(state client.UnitState, message string, payload map[string]interface{}) error {
+	args := r.Called(state, message, payload)
+	return args.Error(0)
+}
+
+func TestMonitor_Quarantine(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	ctx := context.Background()
+
+	bulker := ftesting.NewMockBulk()
+	bulker.On("Update", mock.Anything, mock.Anything, "bad-doc", mock.Anything, mock.Anything).Return(nil).Once()
+	reporter := &mockReporter{}
+	reporter.On("UpdateState", client.UnitStateHealthy, "Running", map[string]interface{}(nil)).Return(nil).Twice()
+	reporter.On("UpdateState", client.UnitStateDegraded, mock.Anything, mock.Anything).Return(nil).Once()
+	qr := NewQuarantineReporter(reporter)
+	require.NoError(t, qr.UpdateState(client.UnitStateHealthy, "Running", nil))
+
+	m := NewMonitor(bulker, mmock.NewMockMonitor(), 0, WithReporter(qr)).(*monitorT)
+
+	good := model.Policy{ESDocument: model.ESDocument{Id: "good-doc"}, PolicyID: "policy", RevisionIdx: 1, CoordinatorIdx: 1, Data: policyBytes}
+	require.NoError(t, m.processPolicies(ctx, []model.Policy{good}))
+
+	s, err := m.Subscribe("agent", "policy", 1, 1)
+	require.NoError(t, err)
+
+	bad := model.Policy{ESDocument: model.ESDocument{Id: "bad-doc"}, PolicyID: "policy", RevisionIdx: 2, CoordinatorIdx: 1, Data: []byte(`{"outputs":{}}`)}
+	require.NoError(t, m.processPolicies(ctx, []model.Policy{bad}))
+	dispatchAll(m)
+	assert.False(t, received(s), "quarantined revision is not delivered")
+
+	// the revision document updated with the error is seen again; it is only reported once
+	bad.ValidationError = "recorded"
+	require.NoError(t, m.processPolicies(ctx, []model.Policy{bad}))
+
+	m.mut.Lock()
+	assert.Equal(t, int64(1), m.policies["policy"].pp.Policy.RevisionIdx, "last good revision is kept")
+	m.mut.Unlock()
+	assert.Contains(t, m.quarantined, "policy")
+
+	fixed := model.Policy{ESDocument: model.ESDocument{Id: "fixed-doc"}, PolicyID: "policy", RevisionIdx: 3, CoordinatorIdx: 1, Data: policyBytes}
+	require.NoError(t, m.processPolicies(ctx, []model.Policy{fixed}))
+	dispatchAll(m)
+	assert.True(t, received(s))
+	assert.NotContains(t, m.quarantined, "policy")
+
+	bulker.AssertExpectations(t)
+	reporter.AssertExpectations(t)
+}
+
+func TestQuarantineReporter(t *testing.T) {
+	reporter := &FakeReporter{}
+	qr := NewQuarantineReporter(reporter)
+	bad := model.Policy{PolicyID: "policy", RevisionIdx: 2, CoordinatorIdx: 1}
+
+	// nothing is reported before the self monitor reports its state
+	qr.quarantine(bad, ErrInvalidPolicy)
+	state, msg, _ := reporter.Current()
+	assert.Equal(t, client.UnitStateStarting, state)
+	assert.Empty(t, msg)
+
+	require.NoError(t, qr.UpdateState(client.UnitStateHealthy, "Running", map[string]interface{}{"enrollment_token": "token"}))
+	state, msg, payload := reporter.Current()
+	assert.Equal(t, client.UnitStateDegraded, state)
+	assert.Contains(t, msg, "Running; policy policy revision 2 failed validation")
+	assert.Equal(t, "token", payload["enrollment_token"])
+	assert.Len(t, payload["quarantined_policies"], 1)
+
+	// states other than healthy or degraded are not hidden
+	require.NoError(t, qr.UpdateState(client.UnitStateConfiguring, "Re-configuring", nil))
+	state, _, _ = reporter.Current()
+	assert.Equal(t, client.UnitStateConfiguring, state)
+
+	require.NoError(t, qr.UpdateState(client.UnitStateHealthy, "Running", nil))
+	qr.release("policy")
+	state, msg, payload = reporter.Current()
+	assert.Equal(t, client.UnitStateHealthy, state)
+	assert.Equal(t, "Running", msg)
+	assert.Nil(t, payload)
+}
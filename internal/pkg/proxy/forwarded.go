@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const headerForwardedFor = "X-Forwarded-For"
+
+// Middleware sets the remote address of the requests received from the trusted proxies to the
+// client address of their X-Forwarded-For header, so that it is used by the logs, the traces and
+// the limits. The remote address is the client IP, without port.
+func Middleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := ForwardedFor(r, trusted); ok {
+				r.RemoteAddr = ip.String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ForwardedFor returns the client address of a request received from a trusted proxy: the last
+// address of its X-Forwarded-For header that is not a trusted proxy, as the previous ones may be
+// set by the client. It returns false if the request is not received from a trusted proxy or if
+// the header is missing or malformed.
+func ForwardedFor(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !Contains(trusted, peer) {
+		return netip.Addr{}, false
+	}
+
+	values := r.Header.Values(headerForwardedFor)
+	if len(values) == 0 {
+		return netip.Addr{}, false
+	}
+	addrs := strings.Split(strings.Join(values, ","), ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(addrs[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		ip = ip.Unmap()
+		if i == 0 || !Contains(trusted, ip) {
+			return ip, true
+		}
+	}
+	return netip.Addr{}, false
+}
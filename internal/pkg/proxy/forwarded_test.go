@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardedFor(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		ip         string
+	}{{
+		name:       "trusted proxy",
+		remoteAddr: "10.0.0.1:4321",
+		xff:        []string{"192.0.2.1"},
+		ip:         "192.0.2.1",
+	}, {
+		name:       "chain of trusted proxies",
+		remoteAddr: "10.0.0.1:4321",
+		xff:        []string{"198.51.100.1, 192.0.2.1", "10.0.0.2"},
+		ip:         "192.0.2.1",
+	}, {
+		name:       "only trusted proxies",
+		remoteAddr: "[2001:db8::1]:4321",
+		xff:        []string{"10.0.0.3, 10.0.0.2"},
+		ip:         "10.0.0.3",
+	}, {
+		name:       "untrusted peer",
+		remoteAddr: "192.0.2.2:4321",
+		xff:        []string{"192.0.2.1"},
+	}, {
+		name:       "missing header",
+		remoteAddr: "10.0.0.1:4321",
+	}, {
+		name:       "malformed header",
+		remoteAddr: "10.0.0.1:4321",
+		xff:        []string{"192.0.2.1, unknown"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add(headerForwardedFor, v)
+			}
+			ip, ok := ForwardedFor(r, trusted)
+			assert.Equal(t, tt.ip != "", ok)
+			if ok {
+				assert.Equal(t, tt.ip, ip.String())
+			}
+
+			var remoteAddr string
+			Middleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				remoteAddr = r.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if ok {
+				assert.Equal(t, tt.ip, remoteAddr)
+			} else {
+				assert.Equal(t, tt.remoteAddr, remoteAddr)
+			}
+		})
+	}
+}
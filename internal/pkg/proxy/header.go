@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidHeader is returned when a PROXY protocol header can not be parsed.
+var ErrInvalidHeader = errors.New("invalid proxy protocol header")
+
+// See https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	v1Prefix     = "PROXY "
+	v1MaxLen     = 107
+	v2HeaderLen  = 16
+	maxHeaderLen = 256 // read buffer size, larger than a v1 header and the v2 fixed header
+
+	v2CmdLocal = 0x0
+	v2CmdProxy = 0x1
+
+	v2FamTCP4 = 0x11
+	v2FamUDP4 = 0x12
+	v2FamTCP6 = 0x21
+	v2FamUDP6 = 0x22
+)
+
+// readHeader reads the PROXY protocol header, v1 or v2, at the start of r and returns the client
+// address it holds. The address is nil if r does not start with a header or if the header does
+// not hold the address of a proxied TCP or UDP connection.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(sig, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(sig, []byte(v1Prefix)):
+		return readV1(r)
+	default:
+		return nil, nil
+	}
+}
+
+// readV1 reads a text header: PROXY TCP4|TCP6|UNKNOWN <src ip> <dst ip> <src port> <dst port>\r\n
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	if len(line) > v1MaxLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: malformed v1 header", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: malformed v1 header", ErrInvalidHeader)
+	}
+
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	switch fields[1] {
+	case "TCP4":
+		if !ip.Is4() {
+			return nil, fmt.Errorf("%w: TCP4 with address %s", ErrInvalidHeader, ip)
+		}
+	case "TCP6":
+		if !ip.Is6() {
+			return nil, fmt.Errorf("%w: TCP6 with address %s", ErrInvalidHeader, ip)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown protocol %q", ErrInvalidHeader, fields[1])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid source port %q", ErrInvalidHeader, fields[4])
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// readV2 reads a binary header: the signature, version and command, address family, length of
+// the addresses, and the addresses followed by optional TLVs that are ignored.
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [v2HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, verCmd>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+	}
+
+	switch verCmd & 0xF {
+	case v2CmdLocal:
+		// health checks of the proxy itself
+		return nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("%w: unknown command %d", ErrInvalidHeader, verCmd&0xF)
+	}
+
+	var ip netip.Addr
+	var port uint16
+	switch fam {
+	case v2FamTCP4, v2FamUDP4:
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: short ipv4 addresses", ErrInvalidHeader)
+		}
+		ip = netip.AddrFrom4([4]byte(payload[0:4]))
+		port = binary.BigEndian.Uint16(payload[8:10])
+	case v2FamTCP6, v2FamUDP6:
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: short ipv6 addresses", ErrInvalidHeader)
+		}
+		ip = netip.AddrFrom16([16]byte(payload[0:16]))
+		port = binary.BigEndian.Uint16(payload[32:34])
+	default:
+		// unspecified or unix socket addresses
+		return nil, nil
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+}
@@ -0,0 +1,165 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package proxy resolves the address of the clients connecting through load balancers and proxies,
+// with the PROXY protocol or the X-Forwarded-For header.
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const kAcceptRetryDelay = 5 * time.Millisecond
+
+// Listener returns a listener reading the PROXY protocol header sent by the trusted sources, no
+// header is read if trusted is empty. The connections accepted from it report the client address
+// of the header as remote address.
+//
+// Headers are read in the background, within timeout, so that slow connections do not block Accept.
+func Listener(ln net.Listener, trusted []netip.Prefix, timeout time.Duration) net.Listener {
+	l := &listener{
+		Listener: ln,
+		trusted:  trusted,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+type listener struct {
+	net.Listener
+	trusted []netip.Prefix
+	timeout time.Duration
+
+	conns chan net.Conn
+	err   error // accept error, set before done is closed
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *listener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() {
+		l.err = net.ErrClosed
+		close(l.done)
+	})
+	return err
+}
+
+func (l *listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Temporary() { //nolint:staticcheck // same retry as http.Server
+			time.Sleep(kAcceptRetryDelay)
+			continue
+		}
+		if err != nil {
+			l.closeOnce.Do(func() {
+				l.err = err
+				close(l.done)
+			})
+			return
+		}
+		go l.handshake(c)
+	}
+}
+
+// handshake reads the PROXY header of c and passes it to Accept.
+func (l *listener) handshake(c net.Conn) {
+	conn, err := l.readHeader(c)
+	if err != nil {
+		log.Debug().Err(err).Str("remote", c.RemoteAddr().String()).Msg("invalid proxy protocol header, closing connection")
+		c.Close()
+		return
+	}
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+func (l *listener) readHeader(c net.Conn) (net.Conn, error) {
+	if !l.isTrusted(c.RemoteAddr()) {
+		return c, nil
+	}
+
+	if l.timeout > 0 {
+		if err := c.SetReadDeadline(time.Now().Add(l.timeout)); err != nil {
+			return nil, err
+		}
+	}
+	r := bufio.NewReaderSize(c, maxHeaderLen)
+	remote, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	conn := &conn{Conn: c, r: r, remote: c.RemoteAddr()}
+	if remote != nil {
+		conn.remote = remote
+	}
+	return conn, nil
+}
+
+func (l *listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return false
+	}
+	return Contains(l.trusted, ip)
+}
+
+// Contains returns true if ip is in one of the networks.
+func Contains(networks []netip.Prefix, ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// conn is a connection whose client address was read from its PROXY header.
+type conn struct {
+	net.Conn
+	r      *bufio.Reader // holds the data read after the header
+	remote net.Addr
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,183 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	var b bytes.Buffer
+	b.Write(v2Signature)
+	b.WriteByte(0x20 | cmd)
+	b.WriteByte(fam)
+	_ = binary.Write(&b, binary.BigEndian, uint16(len(addrs)))
+	b.Write(addrs)
+	return b.Bytes()
+}
+
+func TestReadHeader(t *testing.T) {
+	ipv4 := []byte{192, 0, 2, 1, 10, 0, 0, 1, 0x30, 0x39, 0x20, 0x1c}
+	ipv6 := append(append(netip.MustParseAddr("2001:db8::1").AsSlice(), netip.MustParseAddr("2001:db8::2").AsSlice()...), 0x30, 0x39, 0x20, 0x1c)
+
+	tests := []struct {
+		name   string
+		header []byte
+		addr   string
+		err    error
+	}{{
+		name:   "v1 tcp4",
+		header: []byte("PROXY TCP4 192.0.2.1 10.0.0.1 12345 8220\r\n"),
+		addr:   "192.0.2.1:12345",
+	}, {
+		name:   "v1 tcp6",
+		header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 8220\r\n"),
+		addr:   "[2001:db8::1]:12345",
+	}, {
+		name:   "v1 unknown",
+		header: []byte("PROXY UNKNOWN\r\n"),
+	}, {
+		name:   "v1 mismatched family",
+		header: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 12345 8220\r\n"),
+		err:    ErrInvalidHeader,
+	}, {
+		name:   "v1 missing fields",
+		header: []byte("PROXY TCP4 192.0.2.1 10.0.0.1 12345\r\n"),
+		err:    ErrInvalidHeader,
+	}, {
+		name:   "v1 too long",
+		header: []byte("PROXY TCP4 192.0.2.1 10.0.0.1 12345 8220 " + strings.Repeat("x", 100) + "\r\n"),
+		err:    ErrInvalidHeader,
+	}, {
+		name:   "v2 tcp4",
+		header: v2Header(v2CmdProxy, v2FamTCP4, ipv4),
+		addr:   "192.0.2.1:12345",
+	}, {
+		name:   "v2 tcp6 with tlv",
+		header: v2Header(v2CmdProxy, v2FamTCP6, append(ipv6, 0x04, 0x00, 0x01, 0x00)),
+		addr:   "[2001:db8::1]:12345",
+	}, {
+		name:   "v2 local",
+		header: v2Header(v2CmdLocal, 0x00, nil),
+	}, {
+		name:   "v2 short addresses",
+		header: v2Header(v2CmdProxy, v2FamTCP4, ipv4[:8]),
+		err:    ErrInvalidHeader,
+	}, {
+		name:   "no header",
+		header: []byte("GET /api/status HTTP/1.1\r\n"),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := "GET /api/status HTTP/1.1\r\n"
+			r := bufio.NewReaderSize(bytes.NewReader(append(tt.header, payload...)), maxHeaderLen)
+			addr, err := readHeader(r)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.addr == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tt.addr, addr.String())
+			}
+			if strings.HasPrefix(string(tt.header), "GET") {
+				return
+			}
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, payload, string(rest), "data following the header is preserved")
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	accept := func(t *testing.T, trusted []netip.Prefix, data string) (net.Conn, error) {
+		t.Helper()
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ln := Listener(inner, trusted, time.Second)
+		t.Cleanup(func() { ln.Close() })
+
+		client, err := net.Dial("tcp", inner.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		_, err = client.Write([]byte(data))
+		require.NoError(t, err)
+
+		type result struct {
+			c   net.Conn
+			err error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			c, err := ln.Accept()
+			ch <- result{c, err}
+		}()
+		select {
+		case res := <-ch:
+			return res.c, res.err
+		case <-time.After(500 * time.Millisecond):
+			return nil, errors.New("no connection accepted")
+		}
+	}
+
+	local := []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+
+	t.Run("trusted source", func(t *testing.T) {
+		c, err := accept(t, local, "PROXY TCP4 192.0.2.1 10.0.0.1 12345 8220\r\nping")
+		require.NoError(t, err)
+		defer c.Close()
+		assert.Equal(t, "192.0.2.1:12345", c.RemoteAddr().String())
+
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(c, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+	})
+
+	t.Run("untrusted source", func(t *testing.T) {
+		trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+		c, err := accept(t, trusted, "PROXY TCP4 192.0.2.1 10.0.0.1 12345 8220\r\n")
+		require.NoError(t, err)
+		defer c.Close()
+		assert.Contains(t, c.RemoteAddr().String(), "127.0.0.1:", "headers of untrusted sources are ignored")
+	})
+
+	t.Run("no trusted source", func(t *testing.T) {
+		c, err := accept(t, nil, "PROXY TCP4 192.0.2.1 10.0.0.1 12345 8220\r\n")
+		require.NoError(t, err)
+		defer c.Close()
+		assert.Contains(t, c.RemoteAddr().String(), "127.0.0.1:", "headers are not read without trusted sources")
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		_, err := accept(t, local, "PROXY TCP4 not-an-ip 10.0.0.1 12345 8220\r\n")
+		require.Error(t, err, "connections with invalid headers are closed")
+	})
+
+	t.Run("close", func(t *testing.T) {
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ln := Listener(inner, nil, time.Second)
+		require.NoError(t, ln.Close())
+		_, err = ln.Accept()
+		require.ErrorIs(t, err, net.ErrClosed)
+	})
+}
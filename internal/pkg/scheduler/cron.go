@@ -0,0 +1,158 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCron is returned when a cron expression can not be parsed.
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	min, max int
+}
+
+// minute, hour, day of month, month, day of week
+var cronFields = [5]cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// Cron is a parsed cron expression, evaluated in UTC.
+//
+// The standard five fields are supported: minute, hour, day of month, month and day of week,
+// each a list of values, ranges and steps such as "*/15", "1-5" or "0,30", as well as the
+// descriptors @yearly, @monthly, @weekly, @daily and @hourly. As in cron, when both the
+// day of month and day of week are restricted a day matching either is scheduled.
+type Cron struct {
+	expr   string
+	fields [5]uint64 // bit set of allowed values per field
+
+	domStar, dowStar bool
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%w %q: expected %d fields", ErrInvalidCron, expr, len(cronFields))
+	}
+
+	c := &Cron{expr: expr}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrInvalidCron, expr, err)
+		}
+		c.fields[i] = bits
+	}
+	// Sunday may be given as 7
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	c.domStar = strings.HasPrefix(parts[2], "*")
+	c.dowStar = strings.HasPrefix(parts[4], "*")
+	return c, nil
+}
+
+func parseCronField(part string, f cronField) (uint64, error) {
+	max := f.max
+	if f.max == 6 {
+		max = 7 // day of week
+	}
+
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := f.min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("invalid value %q", loStr)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("invalid value %q", hiStr)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < f.min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range [%d-%d]", rng, f.min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// String returns the cron expression.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first time matching the expression after t, or the zero time if there is none
+// within five years, for example for the 30th of February.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !c.match(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !c.match(1, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !c.match(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) match(field, v int) bool {
+	return c.fields[field]&(1<<v) != 0
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.match(2, t.Day())
+	dow := c.match(4, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
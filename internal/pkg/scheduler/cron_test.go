@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@often",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := ParseCron(expr)
+			assert.ErrorIs(t, err, ErrInvalidCron)
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Wednesday
+	from := time.Date(2023, time.March, 15, 10, 22, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2023, time.March, 15, 10, 23, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2023, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2023, time.March, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2023, time.March, 16, 2, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2023, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2023, time.March, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2023, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2023, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// day of month or day of week when both are restricted
+		{"0 0 20 * 5", time.Date(2023, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16,20 * 0", time.Date(2023, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCron(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, c.Next(from))
+		})
+	}
+}
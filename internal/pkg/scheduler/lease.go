@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// leaseTTLPercent is the lease time to live as a percentage of the schedule interval.
+// It has to exceed the splayed interval so that the holder renews the lease before it expires.
+const leaseTTLPercent = 150
+
+// releaseTimeout bounds the time spent releasing leases on shutdown.
+const releaseTimeout = 5 * time.Second
+
+// ErrLeaseLost is returned when the lease a schedule runs with has been acquired by another scheduler.
+var ErrLeaseLost = errors.New("schedule lease lost")
+
+// ErrLeaseHeld is recorded as the error of a triggered run that is skipped because another scheduler holds the lease.
+var ErrLeaseHeld = errors.New("schedule lease held by another instance")
+
+// Lease grants a single scheduler, across all fleet-server instances, the right to run a schedule.
+type Lease interface {
+	// Acquire acquires or renews the lease of the named schedule until ttl from now.
+	// Returns the fencing token of the lease and false if the lease is held by another scheduler.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (int64, bool, error)
+
+	// Release releases the lease of the named schedule if it is still held with the fencing token.
+	Release(ctx context.Context, name string, token int64) error
+
+	// Check returns ErrLeaseLost unless the lease of the named schedule is still held with the fencing token.
+	Check(ctx context.Context, name string, token int64) error
+}
+
+// WithLease runs every schedule only on the scheduler that holds its lease. Schedules are run on
+// another scheduler when the holder does not renew the lease within one and a half interval.
+func WithLease(lease Lease) OptFunc {
+	return func(s *Scheduler) error {
+		s.lease = lease
+		return nil
+	}
+}
+
+type fenceKey struct{}
+
+// fence is the lease a schedule runs with.
+type fence struct {
+	lease Lease
+	name  string
+	token int64
+}
+
+// FencingToken returns the fencing token of the lease a schedule runs with. The token increases whenever
+// the lease is acquired by another scheduler.
+func FencingToken(ctx context.Context) (int64, bool) {
+	f, ok := ctx.Value(fenceKey{}).(fence)
+	return f.token, ok
+}
+
+// CheckLease returns ErrLeaseLost if the lease a schedule runs with is no longer held with its fencing
+// token, for instance after the scheduler was paused for longer than the lease time to live. Work functions
+// call it before each write so that a stale run stops writing once another scheduler runs the schedule.
+// Returns nil if the schedule runs without a lease, as triggered runs do.
+func CheckLease(ctx context.Context) error {
+	f, ok := ctx.Value(fenceKey{}).(fence)
+	if !ok {
+		return nil
+	}
+	return f.lease.Check(ctx, f.name, f.token)
+}
+
+func withFence(ctx context.Context, lease Lease, name string, token int64) context.Context {
+	return context.WithValue(ctx, fenceKey{}, fence{lease: lease, name: name, token: token})
+}
+
+func leaseTTL(interval time.Duration) time.Duration {
+	return interval / 100 * leaseTTLPercent
+}
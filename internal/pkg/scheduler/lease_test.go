@@ -0,0 +1,154 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !integration
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
+)
+
+// fakeLease is a lease shared by the schedulers of a test, each scheduler has its own holder name.
+type fakeLease struct {
+	mut      sync.Mutex
+	holder   string
+	token    int64
+	expires  time.Time
+	released int
+}
+
+func (l *fakeLease) acquire(holder string, ttl time.Duration) (int64, bool) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	now := time.Now()
+	if l.holder != "" && l.holder != holder && now.Before(l.expires) {
+		return 0, false
+	}
+	if l.holder != holder {
+		l.token++
+		l.holder = holder
+	}
+	l.expires = now.Add(ttl)
+	return l.token, true
+}
+
+type holderLease struct {
+	*fakeLease
+	name string
+}
+
+func (h holderLease) Acquire(_ context.Context, _ string, ttl time.Duration) (int64, bool, error) {
+	token, ok := h.acquire(h.name, ttl)
+	return token, ok, nil
+}
+
+func (h holderLease) Release(_ context.Context, _ string, token int64) error {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if h.holder == h.name && h.token == token {
+		h.expires = time.Time{}
+		h.released++
+	}
+	return nil
+}
+
+func (h holderLease) Check(_ context.Context, _ string, token int64) error {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if h.holder != h.name || h.token != token {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func TestSchedulerLease(t *testing.T) {
+	_ = testlog.SetLogger(t)
+	const interval = 50 * time.Millisecond
+
+	shared := &fakeLease{}
+	var mut sync.Mutex
+	calls := map[string]int{}
+	var tokens []int64
+
+	newScheduler := func(name string) *Scheduler {
+		s, err := New([]Schedule{{
+			Name:     "test schedule",
+			Interval: interval,
+			WorkFn: func(ctx context.Context) error {
+				token, ok := FencingToken(ctx)
+				assert.True(t, ok)
+				mut.Lock()
+				calls[name]++
+				tokens = append(tokens, token)
+				mut.Unlock()
+				return nil
+			},
+		}}, WithFirstRunDelay(0), WithLease(holderLease{fakeLease: shared, name: name}))
+		require.NoError(t, err)
+		return s
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan struct{})
+	go func() {
+		_ = newScheduler("first").Run(ctx1)
+		close(done1)
+	}()
+	// let the first scheduler take the lease
+	time.Sleep(interval / 2)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go func() {
+		_ = newScheduler("second").Run(ctx2)
+	}()
+
+	time.Sleep(4 * interval)
+	mut.Lock()
+	assert.Positive(t, calls["first"])
+	assert.Zero(t, calls["second"], "schedule must only run on the lease holder")
+	mut.Unlock()
+
+	// the holder stops, releasing the lease, the other scheduler takes over
+	cancel1()
+	<-done1
+	assert.Equal(t, 1, shared.released)
+
+	require.Eventually(t, func() bool {
+		mut.Lock()
+		defer mut.Unlock()
+		return calls["second"] > 0
+	}, 10*interval, interval/5)
+
+	mut.Lock()
+	defer mut.Unlock()
+	assert.Equal(t, int64(1), tokens[0])
+	assert.Equal(t, int64(2), tokens[len(tokens)-1], "fencing token increases when the lease changes holder")
+}
+
+func TestCheckLease(t *testing.T) {
+	assert.NoError(t, CheckLease(context.Background()), "runs without a lease are not fenced")
+
+	shared := &fakeLease{}
+	first := holderLease{fakeLease: shared, name: "first"}
+	token, ok := shared.acquire("first", time.Hour)
+	require.True(t, ok)
+	ctx := withFence(context.Background(), first, "schedule", token)
+	assert.NoError(t, CheckLease(ctx))
+
+	// the lease expires and is acquired by another scheduler while the run is paused
+	shared.expires = time.Time{}
+	_, ok = shared.acquire("second", time.Hour)
+	require.True(t, ok)
+	assert.ErrorIs(t, CheckLease(ctx), ErrLeaseLost)
+}
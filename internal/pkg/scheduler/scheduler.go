@@ -8,6 +8,8 @@ package scheduler
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"math/rand"
@@ -22,6 +24,9 @@ const (
 	defaultFirstRunDelay = 10 * time.Second
 )
 
+// ErrScheduleNotFound is returned when triggering a schedule that does not exist.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
 // WorkFunc is the type of function a Scheduler can run.
 type WorkFunc func(ctx context.Context) error
 
@@ -29,6 +34,7 @@ type WorkFunc func(ctx context.Context) error
 type Schedule struct {
 	Name     string
 	Interval time.Duration // Time between executions
+	Cron     string        // Cron expression, used instead of Interval when set
 	WorkFn   WorkFunc
 }
 
@@ -39,8 +45,9 @@ type Scheduler struct {
 	splayPercent  int
 	firstRunDelay time.Duration // Interval to run the scheduled function for the first time since the scheduler started, splayed as well.
 
-	rand      *rand.Rand
-	schedules []Schedule
+	rand    *rand.Rand
+	entries []*entry
+	lease   Lease
 }
 
 // OptFunc is a functional option used to configure a scheduler.
@@ -74,7 +81,23 @@ func New(schedules []Schedule, opts ...OptFunc) (*Scheduler, error) {
 		splayPercent:  defaultSplayPercent,
 		firstRunDelay: defaultFirstRunDelay,
 		rand:          rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec // used for timing offsets
-		schedules:     schedules,
+	}
+
+	names := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		if names[schedule.Name] {
+			return nil, fmt.Errorf("duplicate schedule name %q", schedule.Name)
+		}
+		names[schedule.Name] = true
+
+		var cron *Cron
+		if schedule.Cron != "" {
+			var err error
+			if cron, err = ParseCron(schedule.Cron); err != nil {
+				return nil, fmt.Errorf("schedule %q: %w", schedule.Name, err)
+			}
+		}
+		s.entries = append(s.entries, newEntry(schedule, cron))
 	}
 
 	for _, opt := range opts {
@@ -89,42 +112,141 @@ func New(schedules []Schedule, opts ...OptFunc) (*Scheduler, error) {
 
 // Run executes all scheduled function according to their schedules.
 // Schedule Interval times are guaranteed minium values (if the execution takes a very long time, the scheduler will wait Interval before running the function again).
+// Cron schedules run at the next time matching their expression once the previous execution completes.
 func (s *Scheduler) Run(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 
-	for _, schedule := range s.schedules {
-		g.Go(s.getRunScheduleFunc(ctx, schedule))
+	for _, e := range s.entries {
+		g.Go(s.getRunScheduleFunc(ctx, e))
 	}
 	return g.Wait()
 }
 
-func (s *Scheduler) getRunScheduleFunc(ctx context.Context, schedule Schedule) func() error {
+// Trigger runs the named schedule as soon as possible. The triggered run takes the schedule lease
+// like a scheduled run, it is skipped if another instance holds the lease.
+// A trigger made while a previous one is still pending is coalesced with it.
+func (s *Scheduler) Trigger(name string) error {
+	for _, e := range s.entries {
+		if e.Name != name {
+			continue
+		}
+		select {
+		case e.trigger <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	return ErrScheduleNotFound
+}
+
+// Statuses returns the state and the recent runs of every schedule.
+func (s *Scheduler) Statuses() []Status {
+	statuses := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, e.status())
+	}
+	return statuses
+}
+
+func (s *Scheduler) getRunScheduleFunc(ctx context.Context, e *entry) func() error {
 	return func() error {
-		log := log.With().Str("schedule", schedule.Name).Logger()
+		log := log.With().Str("schedule", e.Name).Logger()
 
-		t := time.NewTimer(s.intervalWithSplay(s.firstRunDelay)) // Initial schedule to run right away with splayed randomly delay
+		t := time.NewTimer(s.nextDelay(e, true)) // Initial schedule to run right away with splayed randomly delay
 		defer t.Stop()
 
+		var token int64 // fencing token of the lease held, 0 if not held
 		for {
 			select {
 			case <-ctx.Done():
+				s.release(log, e.Schedule, token)
 				log.Debug().Msg("exiting on context cancel")
 				return nil
 			case <-t.C:
-				runSchedule(ctx, log, schedule)
-				t.Reset(s.intervalWithSplay(schedule.Interval))
+				token = s.runSchedule(ctx, log, e, false)
+				t.Reset(s.nextDelay(e, false))
+			case <-e.trigger:
+				log.Info().Msg("running triggered schedule")
+				token = s.runSchedule(ctx, log, e, true)
 			}
 		}
 	}
 }
 
+// nextDelay returns the time until the next scheduled run of the entry and records it in the entry status.
+func (s *Scheduler) nextDelay(e *entry, first bool) time.Duration {
+	now := time.Now()
+	var delay time.Duration
+	switch {
+	case e.cron != nil:
+		next := e.cron.Next(now)
+		if next.IsZero() {
+			// no matching time, wait for triggers only
+			e.setNext(time.Time{})
+			return time.Duration(math.MaxInt64)
+		}
+		delay = next.Sub(now)
+	case first:
+		delay = s.intervalWithSplay(s.firstRunDelay)
+	default:
+		delay = s.intervalWithSplay(e.Interval)
+	}
+	e.setNext(now.Add(delay))
+	return delay
+}
+
 func (s *Scheduler) intervalWithSplay(interval time.Duration) time.Duration {
 	percent := 100 - s.splayPercent + s.rand.Intn(2*s.splayPercent+1)
 	return time.Duration(int64(interval) / int64(100.0) * int64(percent))
 }
 
-func runSchedule(ctx context.Context, log zerolog.Logger, schedule Schedule) {
-	log.Debug().Dur("interval", schedule.Interval).Msg("started")
+// runSchedule runs the schedule if the lease is held, and returns the fencing token of the lease held.
+func (s *Scheduler) runSchedule(ctx context.Context, log zerolog.Logger, e *entry, triggered bool) int64 {
+	started := e.start()
+
+	var token int64
+	if s.lease != nil {
+		var ok bool
+		var err error
+		token, ok, err = s.lease.Acquire(ctx, e.Name, leaseTTL(e.period(started)))
+		if err != nil {
+			log.Error().Err(err).Msg("failed to acquire schedule lease")
+			e.finish(started, OutcomeFailure, err, triggered)
+			return 0
+		}
+		if !ok {
+			if triggered {
+				// the run is recorded with the reason so the caller can trigger it on the lease holder
+				log.Warn().Msg("schedule lease held by another instance, skipping triggered run")
+				e.finish(started, OutcomeSkipped, ErrLeaseHeld, true)
+				return 0
+			}
+			log.Debug().Msg("schedule lease held by another instance, skipping")
+			e.finish(started, OutcomeSkipped, nil, false)
+			return 0
+		}
+		log = log.With().Int64("fencing_token", token).Logger()
+		ctx = withFence(ctx, s.lease, e.Name, token)
+	}
+
+	err := runWork(ctx, log, e.Schedule)
+	e.finish(started, outcome(err), err, triggered)
+	return token
+}
+
+func (s *Scheduler) release(log zerolog.Logger, schedule Schedule, token int64) {
+	if s.lease == nil || token == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := s.lease.Release(ctx, schedule.Name, token); err != nil {
+		log.Warn().Err(err).Msg("failed to release schedule lease")
+	}
+}
+
+func runWork(ctx context.Context, log zerolog.Logger, schedule Schedule) error {
+	log.Debug().Dur("interval", schedule.Interval).Str("cron", schedule.Cron).Msg("started")
 
 	err := schedule.WorkFn(ctx)
 	if err != nil {
@@ -132,4 +254,12 @@ func runSchedule(ctx context.Context, log zerolog.Logger, schedule Schedule) {
 	}
 
 	log.Debug().Msg("finished")
+	return err
+}
+
+func outcome(err error) Outcome {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
 }
@@ -9,6 +9,7 @@ package scheduler
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,6 +17,8 @@ import (
 	testlog "github.com/elastic/fleet-server/v7/internal/pkg/testing/log"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -81,3 +84,112 @@ func TestScheduler(t *testing.T) {
 	}
 
 }
+
+func TestSchedulerNew(t *testing.T) {
+	noop := func(context.Context) error { return nil }
+
+	_, err := New([]Schedule{{Name: "a", Cron: "61 * * * *", WorkFn: noop}})
+	require.ErrorIs(t, err, ErrInvalidCron)
+
+	_, err = New([]Schedule{{Name: "a", Interval: time.Hour, WorkFn: noop}, {Name: "a", Interval: time.Hour, WorkFn: noop}})
+	require.Error(t, err)
+}
+
+func TestSchedulerTrigger(t *testing.T) {
+	_ = testlog.SetLogger(t)
+
+	var calls int32
+	done := make(chan struct{})
+	fail := errors.New("cleanup failed")
+	lease := &fakeLease{holder: "other", expires: time.Now().Add(time.Hour)}
+	sched, err := New([]Schedule{{
+		Name:     "triggered",
+		Interval: time.Hour,
+		WorkFn: func(ctx context.Context) error {
+			defer func() { done <- struct{}{} }()
+			if err := CheckLease(ctx); err != nil {
+				return err
+			}
+			if atomic.AddInt32(&calls, 1) > 1 {
+				return fail
+			}
+			return nil
+		},
+	}, {
+		Name:   "cron",
+		Cron:   "@yearly",
+		WorkFn: func(ctx context.Context) error { return nil },
+	}}, WithFirstRunDelay(time.Hour), WithLease(holderLease{fakeLease: lease, name: "test"}))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, sched.Trigger("unknown"), ErrScheduleNotFound)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = sched.Run(ctx)
+	}()
+
+	// triggered runs are skipped while another instance holds the lease
+	require.NoError(t, sched.Trigger("triggered"))
+	require.Eventually(t, func() bool {
+		return len(sched.Statuses()[0].History) == 1
+	}, time.Second, 10*time.Millisecond)
+	skipped := sched.Statuses()[0].History[0]
+	assert.Equal(t, OutcomeSkipped, skipped.Outcome)
+	assert.Equal(t, ErrLeaseHeld.Error(), skipped.Error)
+	assert.True(t, skipped.Triggered)
+	assert.Zero(t, atomic.LoadInt32(&calls))
+
+	// triggered runs take the lease once it expired and run fenced by it
+	lease.mut.Lock()
+	lease.expires = time.Time{}
+	lease.mut.Unlock()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sched.Trigger("triggered"))
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("triggered schedule did not run")
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		return len(sched.Statuses()[0].History) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	statuses := sched.Statuses()
+	require.Len(t, statuses, 2)
+
+	st := statuses[0]
+	assert.Equal(t, "triggered", st.Name)
+	assert.Equal(t, "1h0m0s", st.Interval)
+	assert.False(t, st.Running)
+	require.NotNil(t, st.NextRun)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *st.NextRun, 10*time.Minute)
+	require.NotNil(t, st.LastRun)
+	assert.Equal(t, st.History[0], *st.LastRun)
+	assert.Equal(t, OutcomeFailure, st.History[0].Outcome)
+	assert.Equal(t, fail.Error(), st.History[0].Error)
+	assert.True(t, st.History[0].Triggered)
+	assert.Equal(t, OutcomeSuccess, st.History[1].Outcome)
+
+	st = statuses[1]
+	assert.Equal(t, "cron", st.Name)
+	assert.Equal(t, "@yearly", st.Cron)
+	assert.Empty(t, st.Interval)
+	require.NotNil(t, st.NextRun)
+	assert.Equal(t, time.Date(time.Now().UTC().Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC), *st.NextRun)
+	assert.Nil(t, st.LastRun)
+}
+
+func TestSchedulerHistory(t *testing.T) {
+	e := newEntry(Schedule{Name: "test", Interval: time.Minute}, nil)
+	for i := 0; i < historySize+5; i++ {
+		e.finish(e.start(), OutcomeSkipped, nil, false)
+	}
+	st := e.status()
+	assert.Len(t, st.History, historySize)
+	assert.Equal(t, OutcomeSkipped, st.LastRun.Outcome)
+	assert.Nil(t, st.NextRun)
+}
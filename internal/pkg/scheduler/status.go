@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// historySize is the number of runs kept in memory for every schedule.
+const historySize = 10
+
+// Outcome is the result of a schedule run.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	// OutcomeSkipped is the outcome of a run skipped as the schedule lease is held by another instance.
+	OutcomeSkipped Outcome = "skipped"
+)
+
+// Run is a past run of a schedule.
+type Run struct {
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"`
+	Outcome   Outcome   `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Triggered bool      `json:"triggered"` // Run on demand rather than on schedule
+}
+
+// Status is the state of a schedule.
+type Status struct {
+	Name     string     `json:"name"`
+	Interval string     `json:"interval,omitempty"`
+	Cron     string     `json:"cron,omitempty"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	LastRun  *Run       `json:"last_run,omitempty"`
+	History  []Run      `json:"history"` // Most recent run first
+}
+
+// entry is a schedule and its state.
+type entry struct {
+	Schedule
+
+	cron    *Cron
+	trigger chan struct{} // pending on demand run
+
+	mut     sync.Mutex
+	running bool
+	next    time.Time
+	history []Run
+}
+
+func newEntry(schedule Schedule, cron *Cron) *entry {
+	return &entry{
+		Schedule: schedule,
+		cron:     cron,
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+func (e *entry) setNext(next time.Time) {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.next = next
+}
+
+func (e *entry) start() time.Time {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.running = true
+	return time.Now()
+}
+
+func (e *entry) finish(started time.Time, outcome Outcome, err error, triggered bool) {
+	run := Run{
+		StartedAt: started.UTC(),
+		Duration:  time.Since(started).String(),
+		Outcome:   outcome,
+		Triggered: triggered,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.running = false
+	if len(e.history) == historySize {
+		e.history = e.history[:historySize-1]
+	}
+	e.history = append([]Run{run}, e.history...)
+}
+
+func (e *entry) status() Status {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	st := Status{
+		Name:    e.Name,
+		Running: e.running,
+		History: make([]Run, len(e.history)),
+	}
+	if e.cron != nil {
+		st.Cron = e.cron.String()
+	} else {
+		st.Interval = e.Interval.String()
+	}
+	if !e.next.IsZero() {
+		next := e.next.UTC()
+		st.NextRun = &next
+	}
+	copy(st.History, e.history)
+	if len(st.History) > 0 {
+		last := st.History[0]
+		st.LastRun = &last
+	}
+	return st
+}
+
+// period returns the time between two runs of the entry after t.
+func (e *entry) period(t time.Time) time.Duration {
+	if e.cron == nil {
+		return e.Interval
+	}
+	next := e.cron.Next(t)
+	return e.cron.Next(next).Sub(next)
+}
@@ -153,7 +153,7 @@ func TestAgent(t *testing.T) {
 		return nil
 	}, ftesting.RetrySleep(100*time.Millisecond), ftesting.RetryCount(120))
 
-	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel(), "expected log level info got: %s", zerolog.GlobalLevel())
+	assert.Equal(t, zerolog.InfoLevel, logger.Level(), "expected log level info got: %s", logger.Level())
 
 	t.Log("Test bad configuration can recover")
 	// trigger update with bad configuration
@@ -201,7 +201,7 @@ func TestAgent(t *testing.T) {
 		return nil
 	}, ftesting.RetrySleep(100*time.Millisecond), ftesting.RetryCount(120))
 
-	assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel(), "expected log level debug got: %s", zerolog.GlobalLevel())
+	assert.Equal(t, zerolog.DebugLevel, logger.Level(), "expected log level debug got: %s", logger.Level())
 
 	t.Log("Test stop")
 	// trigger stop
@@ -8,12 +8,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/elastic/elastic-agent-client/v7/pkg/client"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 	"github.com/elastic/fleet-server/v7/internal/pkg/state"
 
 	"go.elastic.co/apm/v2"
@@ -21,6 +24,7 @@ import (
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/action"
 	"github.com/elastic/fleet-server/v7/internal/pkg/api"
+	"github.com/elastic/fleet-server/v7/internal/pkg/audit"
 	"github.com/elastic/fleet-server/v7/internal/pkg/build"
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/cache"
@@ -30,12 +34,17 @@ import (
 	"github.com/elastic/fleet-server/v7/internal/pkg/dl"
 	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/gc"
+	"github.com/elastic/fleet-server/v7/internal/pkg/limit"
+	"github.com/elastic/fleet-server/v7/internal/pkg/localca"
+	"github.com/elastic/fleet-server/v7/internal/pkg/logger"
 	"github.com/elastic/fleet-server/v7/internal/pkg/monitor"
+	"github.com/elastic/fleet-server/v7/internal/pkg/otlp"
 	"github.com/elastic/fleet-server/v7/internal/pkg/policy"
 	"github.com/elastic/fleet-server/v7/internal/pkg/profile"
 	"github.com/elastic/fleet-server/v7/internal/pkg/scheduler"
 	"github.com/elastic/fleet-server/v7/internal/pkg/ver"
 
+	"github.com/gofrs/uuid"
 	"github.com/hashicorp/go-version"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -44,6 +53,10 @@ import (
 
 const kUAFleetServer = "Fleet-Server"
 
+// kShutdownTimeout bounds the time to stop the subsystems once the servers drained, including the
+// final flush of the pending checkins and bulk operations.
+const kShutdownTimeout = 25 * time.Second
+
 // Fleet is an instance of the fleet-server.
 type Fleet struct {
 	standAlone bool
@@ -53,6 +66,13 @@ type Fleet struct {
 	cfgCh    chan *config.Config
 	cache    cache.Cache
 	reporter state.Reporter
+
+	bulkLatency *limit.LatencySignal // Elasticsearch latency followed by adaptive limits
+	logTargets  *logger.Targets      // agents and API keys whose requests are logged at a lower level
+
+	mut   sync.Mutex
+	tls   *api.TLSReloader     // TLS configuration of the running servers, nil if not running with TLS
+	apply func(*config.Config) // applies hot settings to the running subsystems, nil if not running
 }
 
 // NewFleet creates the actual fleet server service.
@@ -63,11 +83,13 @@ func NewFleet(bi build.Info, reporter state.Reporter, standAlone bool) (*Fleet,
 	}
 
 	return &Fleet{
-		standAlone: standAlone,
-		bi:         bi,
-		verCon:     verCon,
-		cfgCh:      make(chan *config.Config, 1),
-		reporter:   reporter,
+		standAlone:  standAlone,
+		bi:          bi,
+		verCon:      verCon,
+		cfgCh:       make(chan *config.Config, 1),
+		reporter:    reporter,
+		bulkLatency: limit.NewLatencySignal(),
+		logTargets:  logger.NewTargets(),
 	}, nil
 }
 
@@ -172,8 +194,15 @@ LOOP:
 			}
 		}
 
-		// Start or restart server
-		if configChangedServer(curCfg, newCfg) {
+		// Start or restart server, certificate changes and hot settings are applied to the running server
+		serverChanged := configChangedServer(curCfg, newCfg)
+		if !serverChanged && configChangedTLS(curCfg, newCfg) && !f.reloadTLS(newCfg) {
+			serverChanged = true
+		}
+		if !serverChanged && configChangedHot(curCfg, newCfg) && !f.applyHot(newCfg) {
+			serverChanged = true
+		}
+		if serverChanged {
 			if srvCancel != nil {
 				log.Info().Msg("stopping server on configuration change")
 				stop(srvCancel, srvEg)
@@ -199,9 +228,10 @@ LOOP:
 		}
 	}
 
-	// Server is coming down; wait for the server group to exit cleanly.
+	// Server is coming down; wait for the server group to drain and exit cleanly.
 	// Timeout if something is locked up.
-	err = safeWait(srvEg, time.Second)
+	timeouts := curCfg.Inputs[0].Server.Timeouts
+	err = safeWait(srvEg, timeouts.PreDrain+timeouts.Drain+kShutdownTimeout)
 
 	// Eat cancel error to minimize confusion in logs
 	if errors.Is(err, context.Canceled) {
@@ -248,7 +278,7 @@ func configChangedServer(curCfg, newCfg *config.Config) bool {
 		zlog.Info().
 			Interface("old", curCfg.Redact()).
 			Msg("output configuration has changed")
-	case !reflect.DeepEqual(curCfg.Inputs[0].Server, newCfg.Inputs[0].Server):
+	case !reflect.DeepEqual(withoutHotSettings(curCfg.Inputs[0].Server), withoutHotSettings(newCfg.Inputs[0].Server)):
 		zlog.Info().
 			Interface("old", curCfg.Redact()).
 			Msg("server configuration has changed")
@@ -259,6 +289,121 @@ func configChangedServer(curCfg, newCfg *config.Config) bool {
 	return changed
 }
 
+// configChangedTLS returns true if the server certificates or certificate authorities changed.
+func configChangedTLS(curCfg, newCfg *config.Config) bool {
+	if curCfg == nil {
+		return false
+	}
+	return !reflect.DeepEqual(curCfg.Inputs[0].Server.TLS, newCfg.Inputs[0].Server.TLS)
+}
+
+// configChangedHot returns true if the settings applied to the running server changed.
+func configChangedHot(curCfg, newCfg *config.Config) bool {
+	if curCfg == nil {
+		return false
+	}
+	return !reflect.DeepEqual(withoutTLSMaterial(curCfg.Inputs[0].Server), withoutTLSMaterial(newCfg.Inputs[0].Server))
+}
+
+// withoutHotSettings returns a copy of the server configuration without the settings applied to
+// the running server: the TLS material, route limits, compression, checkin timeouts, bulk flush
+// options and the audit log. Any other change requires restarting the server.
+func withoutHotSettings(s config.Server) config.Server {
+	s = withoutTLSMaterial(s)
+	s.CompressionLevel = 0
+	s.CompressionThresh = 0
+
+	s.Timeouts.CheckinTimestamp = 0
+	s.Timeouts.CheckinLongPoll = 0
+	s.Timeouts.CheckinJitter = 0
+	s.Timeouts.CheckinMaxPoll = 0
+
+	s.Bulk.FlushInterval = 0
+	s.Bulk.FlushThresholdCount = 0
+	s.Bulk.FlushThresholdSize = 0
+
+	s.Limits.CheckinLimit = config.Limit{}
+	s.Limits.ArtifactLimit = config.Limit{}
+	s.Limits.EnrollLimit = config.Limit{}
+	s.Limits.AckLimit = config.Limit{}
+	s.Limits.StatusLimit = config.Limit{}
+	s.Limits.UploadStartLimit = config.Limit{}
+	s.Limits.UploadEndLimit = config.Limit{}
+	s.Limits.UploadChunkLimit = config.Limit{}
+
+	s.Audit = config.Audit{}
+	return s
+}
+
+// withoutTLSMaterial returns a copy of the server configuration without the certificates and
+// certificate authorities, which are reloaded without restarting the server.
+func withoutTLSMaterial(s config.Server) config.Server {
+	if s.TLS != nil {
+		tls := *s.TLS
+		tls.Certificate = tlscommon.CertificateConfig{}
+		tls.CAs = nil
+		s.TLS = &tls
+	}
+	return s
+}
+
+// reloadTLS applies the TLS configuration of cfg to the running servers, returns false if it
+// could not be applied and the servers have to be restarted.
+func (f *Fleet) reloadTLS(cfg *config.Config) bool {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.tls == nil {
+		return false
+	}
+	if err := f.tls.Update(cfg.Inputs[0].Server.TLS); err != nil {
+		log.Error().Err(err).Msg("unable to apply tls configuration change")
+		return false
+	}
+	log.Info().Msg("tls configuration change applied")
+	return true
+}
+
+func (f *Fleet) setTLSReloader(r *api.TLSReloader) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.tls = r
+}
+
+// applyHot applies the hot settings of cfg to the running subsystems, returns false if the
+// subsystems are not running and the server has to be restarted.
+func (f *Fleet) applyHot(cfg *config.Config) bool {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.apply == nil {
+		return false
+	}
+	f.apply(cfg)
+	log.Info().Msg("server configuration change applied")
+	return true
+}
+
+func (f *Fleet) setApply(apply func(*config.Config)) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.apply = apply
+}
+
+// warnLocalCAFleet warns when other fleet-servers are known while the server uses a certificate
+// authority of its own: each server then serves a certificate of a different certificate authority,
+// and the agents pinning one of them cannot connect to the others.
+func warnLocalCAFleet(ctx context.Context, bulker bulk.Bulk, serverID string) {
+	ids, err := dl.FindServerIDs(ctx, bulker, 2)
+	if err != nil {
+		log.Debug().Err(err).Msg("unable to find the fleet-servers sharing the local certificate authority")
+		return
+	}
+	delete(ids, serverID)
+	if len(ids) > 0 {
+		log.Warn().Msg("other fleet-servers are running while the local certificate authority is specific to this one; " +
+			"configure the ssl_bootstrap certificate_authority shared by all of them, or ssl certificates")
+	}
+}
+
 func safeWait(g *errgroup.Group, to time.Duration) error {
 	var err error
 	waitCh := make(chan error)
@@ -327,7 +472,8 @@ func (f *Fleet) initBulker(ctx context.Context, tracer *apm.Tracer, cfg *config.
 		return nil, err
 	}
 
-	blk := bulk.NewBulker(es, tracer, bulk.BulkOptsFromCfg(cfg)...)
+	opts := append(bulk.BulkOptsFromCfg(cfg), bulk.WithFlushObserver(f.bulkLatency.Observe))
+	blk := bulk.NewBulker(es, tracer, opts...)
 	return blk, nil
 }
 
@@ -352,7 +498,7 @@ func (f *Fleet) runServer(ctx context.Context, cfg *config.Config) (err error) {
 	defer bulkCancel()
 
 	// Create the APM tracer.
-	tracer, err := f.initTracer(cfg.Inputs[0].Server.Instrumentation)
+	tracer, tracerTransport, err := f.initTracer(cfg.Inputs[0].Server.Instrumentation)
 	if err != nil {
 		return err
 	}
@@ -366,9 +512,11 @@ func (f *Fleet) runServer(ctx context.Context, cfg *config.Config) (err error) {
 	// Execute the bulker engine in a goroutine with its orphaned context.
 	// Create an error channel for the case where the bulker exits
 	// unexpectedly (ie. not cancelled by the bulkCancel context).
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
+	bulkDone := make(chan struct{})
 
 	go func() {
+		defer close(bulkDone)
 		runFunc := loggedRunFunc(bulkCtx, "Bulker", bulker.Run)
 
 		// Emit the error from bulker.Run to the local error channel.
@@ -401,17 +549,28 @@ func (f *Fleet) runServer(ctx context.Context, cfg *config.Config) (err error) {
 			log.Info().Msg("flushing instrumentation tracer...")
 			tracer.Flush(nil)
 			tracer.Close()
+			if c, ok := tracerTransport.(io.Closer); ok {
+				if err := c.Close(); err != nil {
+					log.Warn().Err(err).Msg("fail to close the instrumentation transport")
+				}
+			}
 		}()
 	}
 
+	defer f.setApply(nil)
 	if err = f.runSubsystems(ctx, cfg, g, bulker, tracer); err != nil {
 		return err
 	}
 
-	return g.Wait()
+	err = g.Wait()
+
+	// Stop the bulker once the subsystems exited, it flushes the queued operations first.
+	bulkCancel()
+	<-bulkDone
+	return err
 }
 
-func (f *Fleet) runSubsystems(ctx context.Context, cfg *config.Config, g *errgroup.Group, bulker bulk.Bulk, tracer *apm.Tracer) (err error) {
+func (f *Fleet) runSubsystems(ctx context.Context, cfg *config.Config, g *errgroup.Group, bulker *bulk.Bulker, tracer *apm.Tracer) (err error) {
 	esCli := bulker.Client()
 
 	// Version check is not performed in standalone mode because it is expected that
@@ -440,9 +599,42 @@ func (f *Fleet) runSubsystems(ctx context.Context, cfg *config.Config, g *errgro
 		}
 	}
 
-	// Run scheduler for periodic GC/cleanup
-	gcCfg := cfg.Inputs[0].Server.GC
-	sched, err := scheduler.New(gc.Schedules(bulker, gcCfg.ScheduleInterval, gcCfg.CleanupAfterExpiredInterval))
+	// Create the indices owned by fleet-server before their first write maps them dynamically, the
+	// schedule leases, policy pins and policy rollouts are not reliable without their mappings
+	if err := dl.EnsureIndices(ctx, bulker); err != nil {
+		return fmt.Errorf("failed to create fleet-server indices: %w", err)
+	}
+
+	// The audit log records the security events of the subsystems and servers
+	if err := audit.Configure(&cfg.Inputs[0].Server.Audit); err != nil {
+		return fmt.Errorf("failed to open the audit log: %w", err)
+	}
+
+	// The subsystems keep running while the servers drain so that the requests in flight can
+	// complete; they are stopped once the servers exited.
+	srvCtx := ctx
+	ctx, stopSubsystems := context.WithCancel(context.Background())
+	var servers sync.WaitGroup
+	defer func() {
+		if err != nil {
+			stopSubsystems()
+			return
+		}
+		go func() {
+			<-srvCtx.Done()
+			servers.Wait()
+			stopSubsystems()
+		}()
+	}()
+
+	// Run scheduler for periodic GC/cleanup, each schedule runs on the fleet-server holding its lease.
+	// The agent ID is unknown until the agent enrolls; a random ID is used as lease holder then.
+	serverID := cfg.Fleet.Agent.ID
+	if serverID == "" {
+		serverID = uuid.Must(uuid.NewV4()).String()
+	}
+	sched, err := scheduler.New(gc.Schedules(bulker, &cfg.Inputs[0].Server),
+		scheduler.WithLease(gc.NewLease(bulker, serverID, f.bi.Version)))
 	if err != nil {
 		return fmt.Errorf("failed to create elasticsearch GC: %w", err)
 	}
@@ -469,16 +661,42 @@ func (f *Fleet) runSubsystems(ctx context.Context, cfg *config.Config, g *errgro
 	cord := coordinator.NewMonitor(cfg.Fleet, f.bi.Version, bulker, pim, coordinator.NewCoordinatorZero)
 	g.Go(loggedRunFunc(ctx, "Coordinator policy monitor", cord.Run))
 
-	// Policy monitor
-	pm := policy.NewMonitor(bulker, pim, cfg.Inputs[0].Server.Limits.PolicyThrottle)
+	// Policy pin monitor
+	ppm, err := monitor.NewSimple(dl.FleetPolicyPins, esCli, monCli,
+		monitor.WithFetchSize(cfg.Inputs[0].Monitor.FetchSize),
+		monitor.WithPollTimeout(cfg.Inputs[0].Monitor.PollTimeout),
+	)
+	if err != nil {
+		return err
+	}
+	g.Go(loggedRunFunc(ctx, "Policy pin index monitor", ppm.Run))
+
+	// Policy rollout monitor
+	prm, err := monitor.NewSimple(dl.FleetPolicyRollouts, esCli, monCli,
+		monitor.WithFetchSize(cfg.Inputs[0].Monitor.FetchSize),
+		monitor.WithPollTimeout(cfg.Inputs[0].Monitor.PollTimeout),
+	)
+	if err != nil {
+		return err
+	}
+	g.Go(loggedRunFunc(ctx, "Policy rollout index monitor", prm.Run))
+
+	// Policy monitor; the quarantined policy revisions degrade the state reported by the self monitor
+	reporter := policy.NewQuarantineReporter(f.reporter)
+	pm := policy.NewMonitor(bulker, pim, cfg.Inputs[0].Server.Limits.PolicyThrottle,
+		policy.WithRevisionHistory(cfg.Inputs[0].Monitor.PolicyRevisionHistory),
+		policy.WithRollouts(cfg.Inputs[0].Server.PolicyRollouts),
+		policy.WithPolicyPinMonitor(ppm),
+		policy.WithPolicyRolloutMonitor(prm),
+		policy.WithReporter(reporter))
 	g.Go(loggedRunFunc(ctx, "Policy monitor", pm.Run))
 
 	// Policy self monitor
 	var sm policy.SelfMonitor
 	if f.standAlone {
-		sm = policy.NewStandAloneSelfMonitor(bulker, f.reporter)
+		sm = policy.NewStandAloneSelfMonitor(bulker, reporter)
 	} else {
-		sm = policy.NewSelfMonitor(cfg.Fleet, bulker, pim, cfg.Inputs[0].Policy.ID, f.reporter)
+		sm = policy.NewSelfMonitor(cfg.Fleet, bulker, pim, cfg.Inputs[0].Policy.ID, reporter)
 	}
 	g.Go(loggedRunFunc(ctx, "Policy self monitor", sm.Run))
 
@@ -514,16 +732,121 @@ func (f *Fleet) runSubsystems(ctx context.Context, cfg *config.Config, g *errgro
 	}
 
 	at := api.NewArtifactT(&cfg.Inputs[0].Server, bulker, f.cache)
-	ack := api.NewAckT(&cfg.Inputs[0].Server, bulker, f.cache)
-	st := api.NewStatusT(&cfg.Inputs[0].Server, bulker, f.cache)
+	ack := api.NewAckT(&cfg.Inputs[0].Server, bulker, f.cache, pm)
+	// Cache warm-up; status is held as starting until it completes
+	cw := api.NewCacheWarmer(cfg.Inputs[0].Cache.Warmup, bulker, f.cache)
+	g.Go(loggedRunFunc(ctx, "Cache warmup", cw.Run))
+
+	// Without ssl configuration, the servers use a certificate issued by the local certificate authority when enabled
+	srvCfg := &cfg.Inputs[0].Server
+	statusOpts := []api.OptFunc{api.WithReadyFunc(cw.Ready)}
+	var ca *localca.CA
+	if srvCfg.TLS == nil && srvCfg.TLSBootstrap.Enabled {
+		ca = localca.New(&srvCfg.TLSBootstrap, localca.Hosts(srvCfg))
+		if _, err := ca.Ensure(); err != nil {
+			return fmt.Errorf("unable to bootstrap tls: %w", err)
+		}
+		log.Info().
+			Str("ca", ca.CAFile()).
+			Str("ca_sha256", ca.Fingerprint()).
+			Msg("serving tls with the certificate of the local certificate authority")
+		if !ca.Shared() {
+			warnLocalCAFleet(ctx, bulker, cfg.Fleet.Agent.ID)
+		}
+		bootstrapCfg := *srvCfg
+		bootstrapCfg.TLS = ca.ServerConfig()
+		srvCfg = &bootstrapCfg
+		statusOpts = append(statusOpts, api.WithCAFingerprint(ca.Fingerprint))
+	}
+
+	st := api.NewStatusT(&cfg.Inputs[0].Server, bulker, f.cache, statusOpts...)
 	ut := api.NewUploadT(&cfg.Inputs[0].Server, bulker, monCli, f.cache) // uses no-retry client for bufferless chunk upload
 
-	for _, endpoint := range (&cfg.Inputs[0].Server).BindEndpoints() {
-		apiServer := api.NewServer(endpoint, &cfg.Inputs[0].Server, ct, et, at, ack, st, sm, f.bi, ut, bulker, tracer)
-		g.Go(loggedRunFunc(ctx, "Http server", func(ctx context.Context) error {
+	// TLS configuration shared by the servers, certificates are reloaded when changed on disk or in the configuration
+	var tlsReloader *api.TLSReloader
+	if srvCfg.TLS != nil && srvCfg.TLS.IsEnabled() {
+		tlsReloader, err = api.NewTLSReloader(srvCfg.TLS, srvCfg.Host)
+		if err != nil {
+			return err
+		}
+		g.Go(loggedRunFunc(srvCtx, "TLS reloader", func(ctx context.Context) error {
+			defer f.setTLSReloader(nil)
+			return tlsReloader.Run(ctx, srvCfg.TLSReloadInterval)
+		}))
+		if ca != nil {
+			// changes to the ssl configuration restart the servers, so that they stop using the local certificate authority
+			g.Go(loggedRunFunc(srvCtx, "Local CA", func(ctx context.Context) error {
+				return ca.Run(ctx, func() {
+					if err := tlsReloader.Update(srvCfg.TLS); err != nil {
+						log.Error().Err(err).Msg("unable to load the renewed local server certificate")
+					}
+				})
+			}))
+		} else {
+			f.setTLSReloader(tlsReloader)
+		}
+	}
+
+	// Each listener serves its route groups with its own limits and TLS settings, the internal routes
+	// are served on the internal address, by the listener bound to it if any.
+	internalAddress := srvCfg.BindInternalAddress()
+	listeners := srvCfg.BindListeners()
+	reconfigureServers := make([]func(*config.Server), 0, len(listeners)+1)
+	addServer := func(addr string, lCfg *config.Server, reconfigure func(*config.Server) config.Server, opts ...api.ServerOpt) {
+		opts = append(opts, api.WithBulkLatency(f.bulkLatency), api.WithLogTargets(f.logTargets))
+		if tlsReloader != nil && lCfg.TLS == srvCfg.TLS {
+			opts = append(opts, api.WithTLSReloader(tlsReloader))
+		}
+		apiServer := api.NewServer(addr, lCfg, ct, et, at, ack, st, sm, f.bi, ut, bulker, tracer, opts...)
+		servers.Add(1)
+		g.Go(loggedRunFunc(srvCtx, "Http server", func(ctx context.Context) error {
+			defer servers.Done()
 			return apiServer.Run(ctx)
 		}))
+		reconfigureServers = append(reconfigureServers, func(cfg *config.Server) {
+			lCfg := reconfigure(cfg)
+			apiServer.Reconfigure(&lCfg)
+		})
 	}
+	internalRoutes := []api.ServerOpt{
+		api.WithInternalRoutes(api.CacheRoutes(f.cache)...),
+		api.WithInternalRoutes(api.ScheduleRoutes(sched)...),
+		api.WithInternalRoutes(api.RolloutRoutes(pm)...),
+		api.WithInternalRoutes(api.PolicyPinRoutes(bulker)...),
+		api.WithInternalRoutes(api.LogTargetRoutes(f.logTargets)...),
+	}
+	internalBound := false
+	for i := range listeners {
+		l := &listeners[i]
+		network, addr := l.BindAddress()
+		opts := []api.ServerOpt{api.WithNetwork(network), api.WithRouteGroups(l.Routes...)}
+		if network == "tcp" && addr == internalAddress {
+			opts = append(opts, internalRoutes...)
+			internalBound = true
+		}
+		lCfg := srvCfg.ListenerServer(l)
+		// listener changes restart the servers, the listener at i is the same in the applied configuration
+		addServer(addr, &lCfg, func(cfg *config.Server) config.Server {
+			return cfg.ListenerServer(&cfg.BindListeners()[i])
+		}, opts...)
+	}
+	if !internalBound && internalAddress != ":0" {
+		addServer(internalAddress, srvCfg, func(cfg *config.Server) config.Server { return *cfg }, internalRoutes...)
+	}
+
+	f.setApply(func(cfg *config.Config) {
+		srvCfg := &cfg.Inputs[0].Server
+		bulker.Reconfigure(bulk.BulkOptsFromCfg(cfg)...)
+		ct.Reconfigure(srvCfg)
+		et.Reconfigure(srvCfg)
+		ack.Reconfigure(srvCfg)
+		if err := audit.Configure(&srvCfg.Audit); err != nil {
+			log.Error().Err(err).Msg("unable to apply audit log configuration change")
+		}
+		for _, reconfigure := range reconfigureServers {
+			reconfigure(srvCfg)
+		}
+	})
 
 	return err
 }
@@ -539,9 +862,11 @@ func (f *Fleet) Reload(ctx context.Context, cfg *config.Config) error {
 
 const envAPMActive = "ELASTIC_APM_ACTIVE"
 
-func (f *Fleet) initTracer(cfg config.Instrumentation) (*apm.Tracer, error) {
+// initTracer returns the tracer of the instrumentation and its transport, to the APM server hosts or to an
+// OpenTelemetry collector.
+func (f *Fleet) initTracer(cfg config.Instrumentation) (*apm.Tracer, apmtransport.Transport, error) {
 	if !cfg.Enabled && os.Getenv(envAPMActive) != "true" {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	log.Info().Msg("fleet-server instrumentation is enabled")
@@ -560,22 +885,45 @@ func (f *Fleet) initTracer(cfg config.Instrumentation) (*apm.Tracer, error) {
 		defer os.Unsetenv(envTransactionSampleRate)
 	}
 
-	options, err := cfg.APMHTTPTransportOptions()
-	if err != nil {
-		return nil, err
-	}
-
-	transport, err := apmtransport.NewHTTPTransport(options)
-	if err != nil {
-		return nil, err
+	var transport apmtransport.Transport
+	if cfg.OTLP.Enabled {
+		log.Info().
+			Str("protocol", cfg.OTLP.GetProtocol()).
+			Str("endpoint", cfg.OTLP.GetEndpoint()).
+			Msg("fleet-server instrumentation is exported with OTLP")
+		t, err := otlp.NewTransport(&cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		transport = t
+	} else {
+		options, err := cfg.APMHTTPTransportOptions()
+		if err != nil {
+			return nil, nil, err
+		}
+		transport, err = apmtransport.NewHTTPTransport(options)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return apm.NewTracerOptions(apm.TracerOptions{
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
 		ServiceName:        "fleet-server",
 		ServiceVersion:     f.bi.Version,
 		ServiceEnvironment: cfg.Environment,
 		Transport:          transport,
 	})
+	if err != nil {
+		if c, ok := transport.(io.Closer); ok {
+			c.Close() //nolint:errcheck // the tracer error is returned
+		}
+		return nil, nil, err
+	}
+	if cfg.OTLP.Enabled {
+		// the route and bulk metrics are otherwise only exposed by the metrics endpoint
+		tracer.RegisterMetricsGatherer(otlp.NewRegistryGatherer("http_server", "bulk"))
+	}
+	return tracer, transport, nil
 }
 
 func elasticsearchOptions(instumented bool, bi build.Info) []es.ConfigOption {
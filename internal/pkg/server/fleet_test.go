@@ -6,7 +6,9 @@ package server
 
 import (
 	"testing"
+	"time"
 
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 	"github.com/elastic/fleet-server/v7/internal/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -132,6 +134,17 @@ func Test_initTracer(t *testing.T) {
 		cfg: config.Instrumentation{
 			Enabled: true,
 		},
+	}, {
+		name:                 "enabled with otlp",
+		apmActiveEnvVariable: "",
+		expectTracer:         true,
+		cfg: config.Instrumentation{
+			Enabled: true,
+			OTLP: config.InstrumentationOTLP{
+				Enabled:  true,
+				Protocol: config.OTLPProtocolHTTP,
+			},
+		},
 	}, {
 		name:                 "not enabled",
 		apmActiveEnvVariable: "",
@@ -143,7 +156,7 @@ func Test_initTracer(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			f := Fleet{}
 			t.Setenv("ELASTIC_APM_ACTIVE", tc.apmActiveEnvVariable)
-			tarcer, err := f.initTracer(tc.cfg)
+			tarcer, _, err := f.initTracer(tc.cfg)
 			assert.Nil(t, err)
 
 			if tc.expectTracer {
@@ -155,3 +168,90 @@ func Test_initTracer(t *testing.T) {
 		})
 	}
 }
+
+func Test_configChangedTLS(t *testing.T) {
+	enabled := true
+	newCfg := func(tls *tlscommon.ServerConfig, port uint16) *config.Config {
+		return &config.Config{Inputs: []config.Input{{Server: config.Server{Port: port, TLS: tls}}}}
+	}
+	cur := newCfg(&tlscommon.ServerConfig{
+		Enabled:     &enabled,
+		Certificate: tlscommon.CertificateConfig{Certificate: "/certs/old.crt", Key: "/certs/old.key"},
+		CAs:         []string{"/certs/ca.crt"},
+	}, 8220)
+
+	rotated := newCfg(&tlscommon.ServerConfig{
+		Enabled:     &enabled,
+		Certificate: tlscommon.CertificateConfig{Certificate: "/certs/new.crt", Key: "/certs/new.key"},
+		CAs:         []string{"/certs/ca.crt", "/certs/new-ca.crt"},
+	}, 8220)
+	assert.False(t, configChangedServer(cur, rotated), "certificate changes do not restart the server")
+	assert.True(t, configChangedTLS(cur, rotated))
+
+	disabled := newCfg(nil, 8220)
+	assert.True(t, configChangedServer(cur, disabled))
+
+	clientAuth := newCfg(&tlscommon.ServerConfig{
+		Enabled:          &enabled,
+		Certificate:      tlscommon.CertificateConfig{Certificate: "/certs/old.crt", Key: "/certs/old.key"},
+		CAs:              []string{"/certs/ca.crt"},
+		VerificationMode: tlscommon.VerifyNone,
+	}, 8220)
+	assert.True(t, configChangedServer(cur, clientAuth))
+
+	assert.False(t, configChangedTLS(cur, newCfg(cur.Inputs[0].Server.TLS, 8221)))
+	assert.False(t, configChangedTLS(nil, cur))
+}
+
+func Test_configChangedHot(t *testing.T) {
+	base := func() *config.Config {
+		cfg := &config.Config{Inputs: []config.Input{{}}}
+		cfg.Inputs[0].Server.InitDefaults()
+		return cfg
+	}
+	cur := base()
+
+	testcases := []struct {
+		name          string
+		update        func(*config.Server)
+		serverChanged bool
+	}{{
+		name:   "rate limit",
+		update: func(s *config.Server) { s.Limits.CheckinLimit.Interval = time.Second },
+	}, {
+		name:   "keyed limit",
+		update: func(s *config.Server) { s.Limits.EnrollLimit.Keyed.By = config.LimitBySourceIP },
+	}, {
+		name:   "compression",
+		update: func(s *config.Server) { s.CompressionLevel = 9 },
+	}, {
+		name:   "checkin timeouts",
+		update: func(s *config.Server) { s.Timeouts.CheckinLongPoll = time.Minute },
+	}, {
+		name:   "bulk flush",
+		update: func(s *config.Server) { s.Bulk.FlushInterval = time.Second },
+	}, {
+		name:          "bind address",
+		update:        func(s *config.Server) { s.Port = 9220 },
+		serverChanged: true,
+	}, {
+		name:          "read timeout",
+		update:        func(s *config.Server) { s.Timeouts.Read = time.Second },
+		serverChanged: true,
+	}, {
+		name:          "max connections",
+		update:        func(s *config.Server) { s.Limits.MaxConnections = 1 },
+		serverChanged: true,
+	}}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			newCfg := base()
+			tc.update(&newCfg.Inputs[0].Server)
+			assert.Equal(t, tc.serverChanged, configChangedServer(cur, newCfg))
+			assert.True(t, configChangedHot(cur, newCfg))
+		})
+	}
+
+	assert.False(t, configChangedHot(cur, base()))
+	assert.False(t, configChangedHot(nil, cur))
+}
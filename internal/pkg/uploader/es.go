@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
 	"github.com/elastic/fleet-server/v7/internal/pkg/dsl"
@@ -29,10 +30,14 @@ const (
 	FileHeaderIndexPattern = ".fleet-files-%s"
 	FileDataIndexPattern   = ".fleet-file-data-%s"
 
-	FieldBaseID   = "bid"
-	FieldLast     = "last"
-	FieldSHA2     = "sha2"
-	FieldUploadID = "upload_id"
+	FieldID          = "_id"
+	FieldBaseID      = "bid"
+	FieldLast        = "last"
+	FieldSHA2        = "sha2"
+	FieldUploadID    = "upload_id"
+	FieldUploadStart = "upload_start"
+	FieldFileStatus  = "file.Status"
+	FieldSize        = "size"
 )
 
 var (
@@ -40,6 +45,10 @@ var (
 	QueryUploadID   = prepareFindMetaByUploadID()
 	QueryChunkInfo  = prepareChunkWithoutData()
 	MatchChunkByBID = prepareQueryChunkByBID()
+
+	QueryStaleUploads = prepareFindStaleUploads()
+	QueryChunkBIDs    = prepareFindChunkBIDs()
+	QueryFileDocIDs   = prepareFindFileDocIDs()
 )
 
 func prepareFindChunkIDs() *dsl.Tmpl {
@@ -117,6 +126,118 @@ func UpdateFileDoc(ctx context.Context, bulker bulk.Bulk, source string, fileID
 	return bulker.Update(ctx, fmt.Sprintf(FileHeaderIndexPattern, source), fileID, data)
 }
 
+// finds uploads in progress that were started before the given time
+func prepareFindStaleUploads() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	filter := root.Query().Bool().Filter()
+	filter.Terms(FieldFileStatus, []string{string(upload.StatusAwaiting), string(upload.StatusProgress)}, nil)
+	filter.Range(FieldUploadStart, dsl.WithRangeLTE(tmpl.Bind(FieldUploadStart)))
+	root.Sort().SortOrder(FieldUploadStart, dsl.SortAscend)
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// lists the distinct base IDs of chunk documents in order, after the given base ID
+func prepareFindChunkBIDs() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Size(0)
+	root.Query().Range(FieldBaseID, dsl.WithRangeGT(tmpl.Bind(FieldBaseID)))
+	terms := root.Aggs().Agg(FieldBaseID).Terms("field", FieldBaseID, nil)
+	terms.Param("order", map[string]string{"_key": "asc"})
+	terms.Param(FieldSize, tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+func prepareFindFileDocIDs() *dsl.Tmpl {
+	tmpl := dsl.NewTmpl()
+	root := dsl.NewRoot()
+	root.Param("_source", false)
+	root.Query().Terms(FieldID, tmpl.Bind(FieldID), nil)
+	root.WithSize(tmpl.Bind(FieldSize))
+	tmpl.MustResolve(root)
+	return tmpl
+}
+
+// FindStaleUploads returns up to size uploads that are still in progress and were started before the given time.
+func FindStaleUploads(ctx context.Context, bulker bulk.Bulk, startedBefore time.Time, size int) ([]upload.Info, error) {
+	query, err := QueryStaleUploads.Render(map[string]interface{}{
+		FieldUploadStart: startedBefore.UnixMilli(),
+		FieldSize:        size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, fmt.Sprintf(FileHeaderIndexPattern, "*"), query)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]upload.Info, 0, len(res.HitsT.Hits))
+	for _, hit := range res.HitsT.Hits {
+		info, err := infoFromHit(hit)
+		if err != nil {
+			log.Warn().Err(err).Str("fileID", hit.ID).Msg("skipping unreadable upload metadata document")
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ListChunkBaseIDs returns up to size distinct base IDs of chunk documents in all file data indices,
+// ordered and starting after the given base ID.
+func ListChunkBaseIDs(ctx context.Context, bulker bulk.Bulk, after string, size int) ([]string, error) {
+	query, err := QueryChunkBIDs.Render(map[string]interface{}{
+		FieldBaseID: after,
+		FieldSize:   size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, fmt.Sprintf(FileDataIndexPattern, "*"), query)
+	if err != nil {
+		return nil, err
+	}
+
+	agg, ok := res.Aggregations[FieldBaseID]
+	if !ok {
+		return nil, nil
+	}
+	ids := make([]string, len(agg.Buckets))
+	for i, bucket := range agg.Buckets {
+		ids[i] = bucket.Key
+	}
+	return ids, nil
+}
+
+// FindFileDocIDs returns which of the given IDs have an upload metadata document.
+func FindFileDocIDs(ctx context.Context, bulker bulk.Bulk, ids []string) (map[string]bool, error) {
+	query, err := QueryFileDocIDs.Render(map[string]interface{}{
+		FieldID:   ids,
+		FieldSize: len(ids),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bulker.Search(ctx, fmt.Sprintf(FileHeaderIndexPattern, "*"), query)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(res.HitsT.Hits))
+	for _, hit := range res.HitsT.Hits {
+		found[hit.ID] = true
+	}
+	return found, nil
+}
+
 /*
 	Chunk Operations
 */
@@ -239,8 +360,20 @@ func DeleteChunksByQuery(ctx context.Context, bulker bulk.Bulk, source string, b
 	if err != nil {
 		return err
 	}
-	_, err = bulker.Client().DeleteByQuery([]string{fmt.Sprintf(FileDataIndexPattern, source)}, bytes.NewReader(q))
-	return err
+	res, err := bulker.Client().DeleteByQuery([]string{fmt.Sprintf(FileDataIndexPattern, source)}, bytes.NewReader(q),
+		bulker.Client().DeleteByQuery.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		var esres es.DeleteByQueryResponse
+		if err := json.NewDecoder(res.Body).Decode(&esres); err != nil {
+			return fmt.Errorf("unable to delete chunks, status %d: %w", res.StatusCode, err)
+		}
+		return es.TranslateError(res.StatusCode, esres.Error)
+	}
+	return nil
 }
 
 // convenience function for translating the elasticsearch "field" response format
@@ -10,6 +10,7 @@ import (
 	"fmt"
 
 	"github.com/elastic/fleet-server/v7/internal/pkg/bulk"
+	"github.com/elastic/fleet-server/v7/internal/pkg/es"
 	"github.com/elastic/fleet-server/v7/internal/pkg/uploader/upload"
 )
 
@@ -26,10 +27,17 @@ func FetchUploadInfo(ctx context.Context, bulker bulk.Bulk, uploadID string) (up
 		return upload.Info{}, fmt.Errorf("unable to locate upload record, got %d records, expected 1", len(results))
 	}
 
+	return infoFromHit(results[0])
+}
+
+func infoFromHit(hit es.HitT) (upload.Info, error) {
 	var fi FileMetaDoc
-	if err := json.Unmarshal(results[0].Source, &fi); err != nil {
+	if err := json.Unmarshal(hit.Source, &fi); err != nil {
 		return upload.Info{}, fmt.Errorf("file meta doc parsing error: %w", err)
 	}
+	if fi.File.ChunkSize <= 0 {
+		return upload.Info{}, fmt.Errorf("file meta doc parsing error: invalid chunk size %d", fi.File.ChunkSize)
+	}
 
 	// calculate number of chunks required
 	cnt := fi.File.Size / fi.File.ChunkSize
@@ -42,7 +50,7 @@ func FetchUploadInfo(ctx context.Context, bulker bulk.Bulk, uploadID string) (up
 		Source:    fi.Source,
 		AgentID:   fi.AgentID,
 		ActionID:  fi.ActionID,
-		DocID:     results[0].ID,
+		DocID:     hit.ID,
 		ChunkSize: fi.File.ChunkSize,
 		Total:     fi.File.Size,
 		Count:     int(cnt),
@@ -19,6 +19,7 @@ const (
 	StatusDone     Status = "READY"
 	StatusFail     Status = "UPLOAD_ERROR"
 	StatusDel      Status = "DELETED"
+	StatusExpired  Status = "EXPIRED" // not completed within the upload time limit, the chunks are deleted
 )
 
 type Info struct {
@@ -37,7 +38,7 @@ type Info struct {
 // convenience functions for computing current "Status" based on the fields
 func (i Info) Expired(timeout time.Duration) bool { return time.Now().After(i.Start.Add(timeout)) }
 func (i Info) StatusCanUpload() bool { // returns true if more chunks can be uploaded. False if the upload process has completed (with or without error)
-	return !(i.Status == StatusFail || i.Status == StatusDone || i.Status == StatusDel)
+	return !(i.Status == StatusFail || i.Status == StatusDone || i.Status == StatusDel || i.Status == StatusExpired)
 }
 
 type Chunk struct {